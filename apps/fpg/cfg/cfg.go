@@ -14,19 +14,34 @@ import (
 
 type Cfg struct {
 	// GUI-specific settings (user-side)
-	RsyncTarget     string `toml:"rsync_target"`    // e.g. user@host:/freepdm/vaults
+	RsyncTarget     string `toml:"rsync_target"`    // e.g. user@host:/freepdm/vaults, empty syncs over the server
 	LocalVaultsRoot string `toml:"local_vault_dir"` // e.g. /home/user/My CAD Vaults
 	VaultGroupUID   int    `toml:"vault_group_uid"` // e.g. 125
 
+	// The FreePDM server, the vaults and their rules live there
+	ServerURL string `toml:"server_url"`        // e.g. https://pdm.example.com
+	CAFile    string `toml:"ca_file,omitempty"` // PEM of a private certificate authority
+	LastUser  string `toml:"last_user,omitempty"`
+
+	// The program that opens the CAD files
+	FreeCADPath string `toml:"freecad_path,omitempty"` // e.g. /usr/bin/freecad, "freecad" in the PATH when empty
+
 	// Optional: SSH/rsync tuning
 	SSHKeyPath string `toml:"ssh_key_path,omitempty"`
 	ExtraArgs  string `toml:"extra_args,omitempty"` // free rsync flags
 }
 
-func Default() *Cfg { return &Cfg{} }
+// The defaults when nothing is configured
+const (
+	DefaultServerURL = "http://localhost:8080"
+	DefaultFreeCAD   = "freecad"
+)
 
-// ~/.config/fpg/config.toml (Linux); OS-specific pad
-func path() (string, error) {
+func Default() *Cfg { return &Cfg{ServerURL: DefaultServerURL} }
+
+// Dir returns the directory of the config, which also keeps the files of
+// the offline mode. ~/.config/fpg (Linux); OS-specific pad
+func Dir() (string, error) {
 	dir, err := os.UserConfigDir()
 	if err != nil {
 		return "", err
@@ -35,7 +50,16 @@ func path() (string, error) {
 	if err := os.MkdirAll(cfgDir, 0o755); err != nil {
 		return "", err
 	}
-	return filepath.Join(cfgDir, "config.toml"), nil
+	return cfgDir, nil
+}
+
+// ~/.config/fpg/config.toml (Linux); OS-specific pad
+func path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
 }
 
 func Load() (*Cfg, error) {
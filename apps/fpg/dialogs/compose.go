@@ -36,6 +36,17 @@ type ComposeOptions struct {
 	// Optional dialog title and submit button label; if empty, sensible defaults are used.
 	DialogTitle string // default: "Compose descriptions"
 	SubmitLabel string // default: "Write files"
+
+	// Optional properties, one row each below the descriptions. The values
+	// are filled in when the dialog is submitted.
+	Properties []Property
+}
+
+// Property is an optional row of the dialog, such as the volume of a model
+type Property struct {
+	Key         string
+	PlaceHolder string
+	Value       *string // the entered text, trimmed
 }
 
 // ShowComposeDescriptions opens a configurable dialog to capture Title/Details,
@@ -149,6 +160,12 @@ func ShowComposeDescriptions(
 		widget.NewFormItem("Title", short),
 		widget.NewFormItem("Details", long),
 	)
+	propEntries := make([]*widget.Entry, len(opts.Properties))
+	for i, p := range opts.Properties {
+		propEntries[i] = widget.NewEntry()
+		propEntries[i].SetPlaceHolder(p.PlaceHolder)
+		items = append(items, widget.NewFormItem(p.Key, propEntries[i]))
+	}
 
 	// Show dialog
 	form := dialog.NewForm(
@@ -183,6 +200,12 @@ func ShowComposeDescriptions(
 				filePath = path
 			}
 
+			for i, p := range opts.Properties {
+				if p.Value != nil {
+					*p.Value = strings.TrimSpace(propEntries[i].Text)
+				}
+			}
+
 			onSubmit(filePath, short.Text, long.Text)
 		},
 		win,
@@ -6,34 +6,48 @@ package dialogs
 
 import (
 	"errors"
+	"log"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 
+	"github.com/grd/FreePDM/apps/fpg/cfg"
 	"github.com/grd/FreePDM/apps/fpg/state"
 	"github.com/grd/FreePDM/internal/client"
 )
 
-// ShowLoginWindow opens a movable, resizable login window.
+// ShowLoginWindow opens a movable, resizable login window. The server and
+// the user are remembered in the config after a successful login. When the
+// server can not be reached the user can work offline, onSuccess is called
+// then too.
 func ShowLoginWindow(st *state.AppState, onSuccess func()) {
 	win := fyne.CurrentApp().NewWindow("Login")
 
+	server := widget.NewEntry()
 	user := widget.NewEntry()
 	pass := widget.NewPasswordEntry()
 	status := widget.NewLabel("")
 
+	server.SetPlaceHolder(cfg.DefaultServerURL)
 	user.SetPlaceHolder("Username")
 	pass.SetPlaceHolder("Password")
+	if st.Cfg != nil {
+		server.SetText(st.Cfg.ServerURL)
+		user.SetText(st.Cfg.LastUser)
+	}
 
 	form := &widget.Form{
 		Items: []*widget.FormItem{
+			{Text: "Server", Widget: server},
 			{Text: "Username", Widget: user},
 			{Text: "Password", Widget: pass},
 		},
 		SubmitText: "Login",
 		CancelText: "Close",
+		OnCancel:   win.Close,
 		OnSubmit: func() {
 			if user.Text == "" || pass.Text == "" {
 				dialog.ShowError(errors.New("please enter username and password"), win)
@@ -41,20 +55,33 @@ func ShowLoginWindow(st *state.AppState, onSuccess func()) {
 			}
 			status.SetText("Signing in…")
 
-			// TODO: read base URL from st.Cfg later if you store it there.
-			api := client.New("http://localhost:8080")
+			config := cfg.Default()
+			if st.Cfg != nil {
+				*config = *st.Cfg
+			}
+			config.ServerURL = strings.TrimSpace(server.Text)
+			if config.ServerURL == "" {
+				config.ServerURL = cfg.DefaultServerURL
+			}
+			config.LastUser = user.Text
+			st.SetConfig(config)
 
 			go func() {
-				if err := api.Login(user.Text, pass.Text); err != nil {
+				if err := st.Login(user.Text, pass.Text); err != nil {
 					fyne.Do(func() {
 						status.SetText("")
+						if client.Unreachable(err) {
+							offerOffline(win, st, user.Text, pass.Text, err, onSuccess)
+							return
+						}
 						dialog.ShowError(err, win)
 					})
 					return
 				}
+				if err := cfg.Save(config); err != nil {
+					log.Printf("saving the config: %v", err)
+				}
 				fyne.Do(func() {
-					st.SetAPI(api)
-					st.User = user.Text
 					status.SetText("Signed in")
 					win.Close()
 					if onSuccess != nil {
@@ -74,4 +101,24 @@ func ShowLoginWindow(st *state.AppState, onSuccess func()) {
 	win.SetContent(content)
 	win.Resize(fyne.NewSize(520, 360)) // window is movable/resizable
 	win.Show()
+	win.Canvas().Focus(pass)
+}
+
+// offerOffline asks to work offline when the server can not be reached
+func offerOffline(win fyne.Window, st *state.AppState, user, pass string, cause error, onSuccess func()) {
+	msg := cause.Error() + "\n\nWork offline with the local copies of the vaults?\n" +
+		"Renames and check-ins wait until the server is back."
+	dialog.ShowConfirm("Server not reachable", msg, func(yes bool) {
+		if !yes {
+			return
+		}
+		if err := st.GoOffline(user, pass); err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		win.Close()
+		if onSuccess != nil {
+			onSuccess()
+		}
+	}, win)
 }
@@ -26,12 +26,15 @@ func BuildPathSettingsView(parent fyne.Window, st *state.AppState) fyne.CanvasOb
 	// Entries with current values (if any)
 	rsyncEntry := widget.NewEntry()
 	localEntry := widget.NewEntry()
+	freecadEntry := widget.NewEntry()
 	if st.Cfg != nil {
 		rsyncEntry.SetText(st.Cfg.RsyncTarget)
 		localEntry.SetText(st.Cfg.LocalVaultsRoot)
+		freecadEntry.SetText(st.Cfg.FreeCADPath)
 	}
-	rsyncEntry.SetPlaceHolder("user@host:/srv/freepdm/vaults/Main   (or a local path)")
+	rsyncEntry.SetPlaceHolder("user@host:/srv/freepdm/vaults   (or a local path, empty syncs over the server)")
 	localEntry.SetPlaceHolder("/home/you/FreePDM/vaults/Main")
+	freecadEntry.SetPlaceHolder(cfg.DefaultFreeCAD + "   (in the PATH)")
 
 	// Folder picker for local vault directory
 	browseBtn := widget.NewButton("Choose…", func() {
@@ -65,16 +68,15 @@ func BuildPathSettingsView(parent fyne.Window, st *state.AppState) fyne.CanvasOb
 
 	// Save handler (validates and persists to ~/.config/fpg/config.toml)
 	save := func() {
-		config := &cfg.Cfg{
-			RsyncTarget:     strings.TrimSpace(rsyncEntry.Text),
-			LocalVaultsRoot: strings.TrimSpace(localEntry.Text),
+		config := cfg.Default()
+		if st.Cfg != nil {
+			*config = *st.Cfg
 		}
-		if config.RsyncTarget == "" {
-			dialog.ShowError(errors.New("rsync target cannot be empty"), parent)
-			return
-		}
-		// Minimal validation: accept local paths or rsync-style remote (user@host:/path)
-		// If you want to require user@host:/path only, add: !strings.Contains(cfg.RsyncTarget, ":")
+		config.RsyncTarget = strings.TrimSpace(rsyncEntry.Text)
+		config.LocalVaultsRoot = strings.TrimSpace(localEntry.Text)
+		config.FreeCADPath = strings.TrimSpace(freecadEntry.Text)
+		// Without an rsync target the local copy syncs over the API of the
+		// server. Accept local paths or rsync-style remote (user@host:/path)
 		if config.LocalVaultsRoot == "" {
 			dialog.ShowError(errors.New("local vault folder cannot be empty"), parent)
 			return
@@ -95,6 +97,7 @@ func BuildPathSettingsView(parent fyne.Window, st *state.AppState) fyne.CanvasOb
 				Text:   "Local vault folder",
 				Widget: container.NewBorder(nil, nil, nil, browseBtn, localEntry),
 			},
+			{Text: "FreeCAD program", Widget: freecadEntry},
 		},
 		SubmitText: "Save",
 		CancelText: "Close",
@@ -0,0 +1,65 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dialogs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/grd/FreePDM/internal/shared"
+)
+
+// ShowWhereUsed shows the parents that refer to a container, with the
+// version of the parent and the version of the container it uses.
+func ShowWhereUsed(win fyne.Window, title string, list []shared.WhereUsed) {
+	if len(list) == 0 {
+		dialog.ShowInformation("Where used", title+" is not used anywhere.", win)
+		return
+	}
+
+	headers := []string{"Parent", "Number", "Location", "Version", "Uses"}
+	cell := func(u shared.WhereUsed, col int) string {
+		switch col {
+		case 0:
+			return strings.Repeat("  ", u.Level-1) + u.Name
+		case 1:
+			return u.PartNumber
+		case 2:
+			return path.Join(u.Vault, u.Path, u.ContainerNumber)
+		case 3:
+			return fmt.Sprint(u.Version)
+		default:
+			return fmt.Sprintf("%s/%s v%d", u.ChildVault, u.ChildContainer, u.ChildVersion)
+		}
+	}
+
+	table := widget.NewTableWithHeaders(
+		func() (int, int) { return len(list), len(headers) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.TableCellID, obj fyne.CanvasObject) {
+			obj.(*widget.Label).SetText(cell(list[id.Row], id.Col))
+		},
+	)
+	table.ShowHeaderColumn = false
+	table.UpdateHeader = func(id widget.TableCellID, obj fyne.CanvasObject) {
+		if id.Row < 0 && id.Col >= 0 {
+			obj.(*widget.Label).SetText(headers[id.Col])
+		}
+	}
+	for i, w := range []float32{220, 100, 220, 70, 140} {
+		table.SetColumnWidth(i, w)
+	}
+
+	body := container.NewBorder(widget.NewLabel(title+" is used by:"), nil, nil, nil, table)
+	d := dialog.NewCustom("Where used", "Close", body, win)
+	d.Resize(fyne.NewSize(800, 420))
+	d.Show()
+}
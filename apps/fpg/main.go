@@ -5,19 +5,50 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 
+	"github.com/grd/FreePDM/apps/fpg/cfg"
+	"github.com/grd/FreePDM/apps/fpg/dialogs"
+	"github.com/grd/FreePDM/apps/fpg/offline"
+	"github.com/grd/FreePDM/apps/fpg/state"
 	"github.com/grd/FreePDM/apps/fpg/tabs"
+	"github.com/grd/FreePDM/internal/domain/models"
+	"github.com/grd/FreePDM/internal/shared"
 )
 
 func main() {
 	a := app.New()
 	w := a.NewWindow("FreePDM")
 
+	st := state.New()
+	if c, err := cfg.Load(); err != nil {
+		log.Printf("failed to read config: %v", err)
+	} else {
+		st.SetConfig(c)
+	}
+	if q, err := openQueue(); err != nil {
+		log.Printf("failed to read the offline queue: %v", err)
+	} else {
+		st.Queue = q
+	}
+
 	// 1) Eerst de TabManager maken
 	tm := tabs.NewTabManager(w)
+	tm.State = st
+	tm.OpenVault = func(v tabs.Vault) { openVault(w, tm, st, v, nil) }
+	tm.OpenResult = func(r shared.SearchResult) {
+		v := tabs.Vault{Name: r.Vault, Path: filepath.Join(st.Cfg.LocalVaultsRoot, r.Vault)}
+		openVault(w, tm, st, v, func(vt *tabs.VaultTab) { vt.Reveal(r.Path, r.ContainerNumber) })
+	}
 
 	// 2) Main menu pas daarna (menu-acties gebruiken tm)
 	w.SetMainMenu(tabs.BuildMainMenu(w, tm))
@@ -27,22 +58,102 @@ func main() {
 
 	// 4) Optioneel: start met Home tab
 	home := tabs.NewHomeTab(func() {
-		vt := tabs.NewVaultsTab(w, func(v tabs.Vault) {
-			// TODO: echte open-logic hier
-		})
+		vt := tabs.NewVaultsTab(w, st, tm.OpenVault)
 		tm.AddTabItem(vt.Tab)
 	})
 	tm.AddTabItem(home)
 
-	vt := tabs.NewVaultsTab(w, func(v tabs.Vault) {
-		// Open de gekozen vault in een nieuwe tab
-		vaultTab := tabs.NewVaultTab(w, v.Path, func(p string) {
-			// Hier later je CAD-editor/tab openen
-		})
-		tm.AddTabItem(vaultTab.Tab)
-	})
+	vt := tabs.NewVaultsTab(w, st, tm.OpenVault)
 	tm.AddTabItem(vt.Tab)
+	tm.OnLogin = func() {
+		vt.Reload()
+		tm.Connect()
+	}
 
 	w.Resize(fyne.NewSize(1100, 700))
-	w.ShowAndRun()
+	w.Show()
+
+	// 5) Aanmelden bij de server, daarna komen de vaults van de server
+	dialogs.ShowLoginWindow(st, tm.OnLogin)
+	a.Run()
+}
+
+// openVault opens a vault in a new tab. Once signed in, the file operations
+// of the tab run on the server, and a missing local copy is fetched first.
+// then is called with the tab when it is ready, it can be nil.
+func openVault(w fyne.Window, tm *tabs.TabManager, st *state.AppState, v tabs.Vault, then func(*tabs.VaultTab)) {
+	ready := func(vaultTab *tabs.VaultTab) {
+		if then != nil {
+			then(vaultTab)
+		}
+	}
+
+	newTab := func() *tabs.VaultTab {
+		vaultTab := tabs.NewVaultTab(w, v.Path, nil)
+		vaultTab.OnOpenCAD = vaultTab.OpenInFreeCAD
+		if st.Cfg != nil {
+			vaultTab.FreeCAD = st.Cfg.FreeCADPath
+		}
+		vaultTab.Queue = st.Queue
+		vaultTab.User = st.User
+		return vaultTab
+	}
+
+	sync := st.Sync()
+	if sync == nil {
+		if st.Offline() && !hasLocalCopy(st, v) {
+			dialog.ShowInformation("Offline", "Vault "+v.Name+" has no local copy yet, open it once online.", w)
+			return
+		}
+		vaultTab := newTab()
+		tm.AddVaultTab(vaultTab)
+		ready(vaultTab)
+		return
+	}
+
+	_, err := os.Stat(v.Path)
+	fresh := errors.Is(err, os.ErrNotExist)
+
+	go func() {
+		err := os.MkdirAll(v.Path, 0o755)
+		if err == nil {
+			_, err = sync.PullIndex(models.VaultInfo{Name: v.Name})
+		}
+		fyne.Do(func() {
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("fetching vault %s: %w", v.Name, err), w)
+				return
+			}
+			vaultTab := newTab()
+			vaultTab.API = st.API
+			vaultTab.Sync = sync
+			vaultTab.SetWorkspace(st.Workspace())
+			tm.AddVaultTab(vaultTab)
+			if fresh {
+				vaultTab.Update(func() { ready(vaultTab) })
+			} else {
+				ready(vaultTab)
+			}
+		})
+	}()
+}
+
+// hasLocalCopy tells whether a vault was fetched before, with its file index
+func hasLocalCopy(st *state.AppState, v tabs.Vault) bool {
+	index := filepath.Join(st.Cfg.LocalVaultsRoot, ".data", v.Name)
+	for _, dir := range []string{v.Path, index} {
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// openQueue reads the operations that wait for the server
+func openQueue() (*offline.Queue, error) {
+	dir, err := cfg.Dir()
+	if err != nil {
+		return nil, err
+	}
+	return offline.Open(filepath.Join(dir, "queue.json"))
 }
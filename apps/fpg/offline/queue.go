@@ -0,0 +1,254 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package offline keeps what fpg needs without the server: the vaults of
+// the last session and the operations that wait for the server. The file
+// index of a vault is in its local copy already.
+package offline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grd/FreePDM/internal/client"
+)
+
+// The kinds of the operations
+const (
+	KindRename  = "rename"  // Src is renamed or moved to Dst
+	KindCheckIn = "checkin" // the container Src is pushed and checked in
+)
+
+// ErrConflict is the error of an operation that the server can not do any
+// more, for instance because somebody else changed the vault.
+var ErrConflict = errors.New("conflict")
+
+// ErrBlocked is the error of an operation that is not replayed, because it
+// builds on an earlier operation with a conflict.
+var ErrBlocked = errors.New("blocked by an earlier conflict")
+
+// Op is an operation that was done offline and waits for the server
+type Op struct {
+	ID     int64     `json:"id"`
+	Kind   string    `json:"kind"`
+	User   string    `json:"user"`
+	Vault  string    `json:"vault"`
+	Name   string    `json:"name"` // of the node, for the messages
+	Queued time.Time `json:"queued"`
+
+	// The paths on the server. Src is the container directory of a check-in
+	Src string `json:"src"`
+	Dst string `json:"dst,omitempty"`
+
+	// The node in the local copy, and where it moves after a rename, "" when
+	// it stays
+	Local string `json:"local"`
+	To    string `json:"to,omitempty"`
+
+	// The check-in
+	Container  string            `json:"container,omitempty"`
+	Short      string            `json:"short,omitempty"`
+	Long       string            `json:"long,omitempty"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+func (op Op) String() string {
+	switch op.Kind {
+	case KindRename:
+		return fmt.Sprintf("%s: move %s to %s", op.Vault, op.Src, op.Dst)
+	case KindCheckIn:
+		return fmt.Sprintf("%s: check in %s", op.Vault, op.Name)
+	}
+	return fmt.Sprintf("%s: %s %s", op.Vault, op.Kind, op.Src)
+}
+
+// Result is the outcome of an operation at the replay
+type Result struct {
+	Op       Op
+	Err      error // nil when the server did it
+	Conflict bool  // the server refused it, it is dropped from the queue
+	Blocked  bool  // it was not run because of an earlier conflict, it stays
+}
+
+// IsConflict tells whether an error means that the server refused an
+// operation, so that trying it again does not help.
+func IsConflict(err error) bool {
+	if errors.Is(err, ErrConflict) {
+		return true
+	}
+	var statusErr *client.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.Code {
+	case http.StatusUnauthorized, http.StatusTooManyRequests:
+		return false
+	}
+	return statusErr.Code >= 400 && statusErr.Code < 500
+}
+
+// Queue is the list of operations that wait for the server, oldest first.
+// It is kept in a file, so that it survives a restart.
+type Queue struct {
+	mu   sync.Mutex
+	file string
+	ops  []Op
+	next int64
+}
+
+// Open reads the queue of the file, an empty queue when it does not exist
+func Open(file string) (*Queue, error) {
+	q := &Queue{file: file, next: 1}
+	buf, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(buf, &q.ops); err != nil {
+		return nil, fmt.Errorf("invalid queue %s: %w", file, err)
+	}
+	for _, op := range q.ops {
+		q.next = max(q.next, op.ID+1)
+	}
+	return q, nil
+}
+
+// Add appends an operation
+func (q *Queue) Add(op Op) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	op.ID = q.next
+	if op.Queued.IsZero() {
+		op.Queued = time.Now()
+	}
+	q.ops = append(q.ops, op)
+	if err := q.save(); err != nil {
+		q.ops = q.ops[:len(q.ops)-1]
+		return err
+	}
+	q.next++
+	return nil
+}
+
+// Ops returns the operations of the user, of one vault or of all vaults
+// when vault is "".
+func (q *Queue) Ops(user, vault string) []Op {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var list []Op
+	for _, op := range q.ops {
+		if op.User == user && (vault == "" || op.Vault == vault) {
+			list = append(list, op)
+		}
+	}
+	return list
+}
+
+// Discard removes an operation
+func (q *Queue) Discard(id int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.remove(map[int64]bool{id: true})
+}
+
+// Replay runs the operations of the user in order. An operation that is
+// done or that has a conflict leaves the queue. A later operation on the
+// paths of a conflict, or below them, builds on what the server refused: it
+// is not run and stays, for the user to look at. The replay stops at the
+// first other failure, which keeps that operation and the later ones, for
+// instance when the server is gone again.
+func (q *Queue) Replay(user string, run func(op Op) error) ([]Result, error) {
+	var results []Result
+	done := map[int64]bool{}
+	blocked := map[string][]string{} // vault -> the paths of the conflicts
+	for _, op := range q.Ops(user, "") {
+		if op.touches(blocked[op.Vault]) {
+			// What builds on this one is blocked as well
+			blocked[op.Vault] = append(blocked[op.Vault], op.paths()...)
+			results = append(results, Result{Op: op, Err: ErrBlocked, Blocked: true})
+			continue
+		}
+
+		err := run(op)
+		conflict := err != nil && IsConflict(err)
+		results = append(results, Result{Op: op, Err: err, Conflict: conflict})
+		if err != nil && !conflict {
+			break
+		}
+		if conflict {
+			blocked[op.Vault] = append(blocked[op.Vault], op.paths()...)
+		}
+		done[op.ID] = true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return results, q.remove(done)
+}
+
+// paths returns the paths on the server that the operation changes
+func (op Op) paths() []string {
+	if op.Dst == "" {
+		return []string{op.Src}
+	}
+	return []string{op.Src, op.Dst}
+}
+
+// touches tells whether the operation works on one of the paths, or inside
+// one of them, or on a directory that holds one of them.
+func (op Op) touches(list []string) bool {
+	inside := func(p, dir string) bool {
+		return p == dir || strings.HasPrefix(p, dir+"/")
+	}
+	for _, p := range op.paths() {
+		for _, other := range list {
+			if inside(p, other) || inside(other, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (q *Queue) remove(ids map[int64]bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	kept := q.ops[:0:0]
+	for _, op := range q.ops {
+		if !ids[op.ID] {
+			kept = append(kept, op)
+		}
+	}
+	q.ops = kept
+	return q.save()
+}
+
+// save writes the queue, through a temporary file so that a crash does not
+// lose it.
+func (q *Queue) save() error {
+	buf, err := json.MarshalIndent(q.ops, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(q.file), 0o755); err != nil {
+		return err
+	}
+	tmp := q.file + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.file)
+}
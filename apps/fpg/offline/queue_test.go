@@ -0,0 +1,174 @@
+package offline_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/grd/FreePDM/apps/fpg/offline"
+	"github.com/grd/FreePDM/internal/client"
+)
+
+func TestIsConflict(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{offline.ErrConflict, true},
+		{fmt.Errorf("move: %w", offline.ErrConflict), true},
+		{&client.StatusError{Code: http.StatusConflict}, true},
+		{&client.StatusError{Code: http.StatusForbidden}, true},
+		{&client.StatusError{Code: http.StatusNotFound}, true},
+		{fmt.Errorf("check in: %w", &client.StatusError{Code: http.StatusBadRequest}), true},
+		{&client.StatusError{Code: http.StatusUnauthorized}, false},
+		{&client.StatusError{Code: http.StatusTooManyRequests}, false},
+		{&client.StatusError{Code: http.StatusInternalServerError}, false},
+		{&client.StatusError{Code: http.StatusServiceUnavailable}, false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := offline.IsConflict(tt.err); got != tt.want {
+			t.Errorf("IsConflict(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	errDown := errors.New("server down")
+	abc := []offline.Op{{Src: "a"}, {Src: "b"}, {Src: "c"}}
+
+	tests := []struct {
+		name      string
+		ops       []offline.Op     // abc when empty
+		errs      map[string]error // of the operation, by source
+		ran       []string
+		conflicts []string
+		blocked   []string
+		left      []string // in the queue after the replay
+	}{
+		{
+			name: "all done",
+			ran:  []string{"a", "b", "c"},
+		},
+		{
+			name:      "conflicts on other paths leave the queue",
+			errs:      map[string]error{"a": offline.ErrConflict, "c": &client.StatusError{Code: http.StatusConflict}},
+			ran:       []string{"a", "b", "c"},
+			conflicts: []string{"a", "c"},
+		},
+		{
+			name: "operations after a conflict on its paths stay",
+			ops: []offline.Op{
+				{Src: "pumps/1.FCStd", Dst: "valves/1.FCStd"},
+				{Src: "valves/1.FCStd", Dst: "valves/2.FCStd"}, // the moved file
+				{Src: "valves/2.FCStd"},                        // renamed by a blocked one
+				{Src: "pumps"},                                 // holds the source
+				{Src: "valves/10.FCStd"},
+				{Src: "valves/1.FCStd", Vault: "other"},
+			},
+			errs:      map[string]error{"pumps/1.FCStd": offline.ErrConflict},
+			ran:       []string{"pumps/1.FCStd", "valves/10.FCStd", "valves/1.FCStd"},
+			conflicts: []string{"pumps/1.FCStd"},
+			blocked:   []string{"valves/1.FCStd", "valves/2.FCStd", "pumps"},
+			left:      []string{"valves/1.FCStd", "valves/2.FCStd", "pumps"},
+		},
+		{
+			name: "stops at the first failure",
+			errs: map[string]error{"b": errDown},
+			ran:  []string{"a", "b"},
+			left: []string{"b", "c"},
+		},
+		{
+			name:      "conflict before a failure",
+			errs:      map[string]error{"a": offline.ErrConflict, "c": &client.StatusError{Code: http.StatusServiceUnavailable}},
+			ran:       []string{"a", "b", "c"},
+			conflicts: []string{"a"},
+			left:      []string{"c"},
+		},
+		{
+			name: "nothing done",
+			errs: map[string]error{"a": &client.StatusError{Code: http.StatusUnauthorized}},
+			ran:  []string{"a"},
+			left: []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "queue.json")
+			q, err := offline.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ops := tt.ops
+			if len(ops) == 0 {
+				ops = abc
+			}
+			for _, op := range ops {
+				op.Kind, op.User = offline.KindRename, "jdoe"
+				if op.Vault == "" {
+					op.Vault = "main"
+				}
+				if err := q.Add(op); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Somebody else's operation is not replayed and stays
+			if err := q.Add(offline.Op{Kind: offline.KindRename, User: "other", Vault: "main", Src: "x"}); err != nil {
+				t.Fatal(err)
+			}
+
+			var ran []string
+			results, err := q.Replay("jdoe", func(op offline.Op) error {
+				ran = append(ran, op.Src)
+				return tt.errs[op.Src]
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(ran) != fmt.Sprint(tt.ran) || len(results) != len(tt.ran)+len(tt.blocked) {
+				t.Errorf("ran %v with %d results, want %v", ran, len(results), tt.ran)
+			}
+			var conflicts, blocked []string
+			for _, r := range results {
+				switch {
+				case r.Conflict:
+					conflicts = append(conflicts, r.Op.Src)
+				case r.Blocked:
+					blocked = append(blocked, r.Op.Src)
+					if !errors.Is(r.Err, offline.ErrBlocked) {
+						t.Errorf("result of blocked %s: %v", r.Op.Src, r.Err)
+					}
+					continue
+				}
+				if r.Err != tt.errs[r.Op.Src] {
+					t.Errorf("result of %s: %v, want %v", r.Op.Src, r.Err, tt.errs[r.Op.Src])
+				}
+			}
+			if fmt.Sprint(conflicts) != fmt.Sprint(tt.conflicts) {
+				t.Errorf("conflicts %v, want %v", conflicts, tt.conflicts)
+			}
+			if fmt.Sprint(blocked) != fmt.Sprint(tt.blocked) {
+				t.Errorf("blocked %v, want %v", blocked, tt.blocked)
+			}
+
+			// What is left survives a restart, in the same order
+			reopened, err := offline.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var left []string
+			for _, op := range reopened.Ops("jdoe", "") {
+				left = append(left, op.Src)
+			}
+			if fmt.Sprint(left) != fmt.Sprint(tt.left) {
+				t.Errorf("left %v, want %v", left, tt.left)
+			}
+			if others := reopened.Ops("other", "main"); len(others) != 1 {
+				t.Errorf("operations of the other user: %v", others)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package offline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/grd/FreePDM/internal/client"
+)
+
+// ErrNoVaults is the error when the vaults of the server were never listed
+var ErrNoVaults = errors.New("the vaults of the server are not known yet, sign in once first")
+
+// vaultList is the file with the vaults of the last session
+type vaultList struct {
+	Server string         `json:"server"`
+	User   string         `json:"user"`
+	Vaults []client.Vault `json:"vaults"`
+}
+
+// SaveVaults keeps the vaults that the user has on the server
+func SaveVaults(file, server, user string, vaults []client.Vault) error {
+	buf, err := json.MarshalIndent(vaultList{Server: server, User: user, Vaults: vaults}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, buf, 0o600)
+}
+
+// LoadVaults returns the vaults that SaveVaults kept for the server and the
+// user.
+func LoadVaults(file, server, user string) ([]client.Vault, error) {
+	buf, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoVaults
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list vaultList
+	if err := json.Unmarshal(buf, &list); err != nil {
+		return nil, fmt.Errorf("invalid vault list %s: %w", file, err)
+	}
+	if list.Server != server || list.User != user {
+		return nil, ErrNoVaults
+	}
+	return list.Vaults, nil
+}
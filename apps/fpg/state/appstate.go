@@ -5,10 +5,18 @@
 package state
 
 import (
+	"log"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/grd/FreePDM/apps/fpg/cfg"
+	"github.com/grd/FreePDM/apps/fpg/offline"
+	"github.com/grd/FreePDM/internal/adapters/httpsync"
+	"github.com/grd/FreePDM/internal/adapters/rsync"
 	"github.com/grd/FreePDM/internal/client"
+	ports "github.com/grd/FreePDM/internal/ports/sync"
+	"github.com/grd/FreePDM/internal/workspace"
 )
 
 type AppState struct {
@@ -17,6 +25,14 @@ type AppState struct {
 	User string
 	Cfg  *cfg.Cfg
 
+	// The operations that wait for the server, done while offline
+	Queue *offline.Queue
+
+	// Offline the vaults of the last session are used, pass signs in again
+	// once the server is back.
+	offline bool
+	pass    string
+
 	// Example domain state
 	vaults []client.Vault
 }
@@ -37,3 +53,143 @@ func (s *AppState) Vaults() []client.Vault {
 	defer s.mu.RUnlock()
 	return append([]client.Vault(nil), s.vaults...)
 }
+
+// Login signs in to the server of the config and fetches the vaults that
+// the user has access to.
+func (s *AppState) Login(user, pass string) error {
+	s.mu.RLock()
+	c := s.Cfg
+	s.mu.RUnlock()
+
+	server := c.ServerURL
+	if server == "" {
+		server = cfg.DefaultServerURL
+	}
+	api, err := client.NewWithOptions(client.Options{BaseURL: server, CAFile: c.CAFile})
+	if err != nil {
+		return err
+	}
+	if err := api.Login(user, pass); err != nil {
+		return err
+	}
+	vaults, err := api.ListVaults()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.API = api
+	s.User = user
+	s.vaults = vaults
+	s.offline, s.pass = false, ""
+	s.mu.Unlock()
+
+	if file, err := vaultsFile(); err == nil {
+		err = offline.SaveVaults(file, api.BaseURL, user, vaults)
+		if err != nil {
+			log.Printf("failed to keep the vault list: %v", err)
+		}
+	}
+	return nil
+}
+
+// vaultsFile is the file with the vaults of the last session
+func vaultsFile() (string, error) {
+	dir, err := cfg.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "vaults.json"), nil
+}
+
+// GoOffline works without the server, with the vaults of the last session
+// of the user. The password signs in again when the server is back, it
+// can be "" to ask for it.
+func (s *AppState) GoOffline(user, pass string) error {
+	s.mu.RLock()
+	server := s.Cfg.ServerURL
+	s.mu.RUnlock()
+	if server == "" {
+		server = cfg.DefaultServerURL
+	}
+
+	file, err := vaultsFile()
+	if err != nil {
+		return err
+	}
+	vaults, err := offline.LoadVaults(file, strings.TrimRight(server, "/"), user)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.API = nil
+	s.User = user
+	s.vaults = vaults
+	s.offline, s.pass = true, pass
+	s.mu.Unlock()
+	return nil
+}
+
+// Offline tells whether the user works without the server
+func (s *AppState) Offline() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.offline
+}
+
+// Reconnect signs in again after the offline mode, with the password of
+// GoOffline.
+func (s *AppState) Reconnect() error {
+	s.mu.RLock()
+	user, pass := s.User, s.pass
+	s.mu.RUnlock()
+	return s.Login(user, pass)
+}
+
+// CanReconnect tells whether Reconnect has a password
+func (s *AppState) CanReconnect() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.offline && s.pass != ""
+}
+
+// Connected tells whether the user signed in to the server
+func (s *AppState) Connected() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.API != nil
+}
+
+// Sync returns the transport that keeps the local vault copy up to date:
+// rsync when the settings have an rsync target, otherwise the API of the
+// server. It is nil when there is no connection.
+func (s *AppState) Sync() ports.LocalCopy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.API == nil {
+		return nil
+	}
+	c := s.Cfg
+	if c.RsyncTarget == "" {
+		return httpsync.New(c.LocalVaultsRoot, s.API.BaseURL, s.API.TransferClient())
+	}
+
+	t := rsync.New(c.LocalVaultsRoot, c.RsyncTarget)
+	t.Extra = strings.Fields(c.ExtraArgs)
+	if c.SSHKeyPath != "" {
+		t.SetSSHOptions(ports.SSHOptions{IdentityFile: c.SSHKeyPath})
+	}
+	return t
+}
+
+// Workspace compares the local vault copy with the server, nil when there
+// is no connection to the server.
+func (s *AppState) Workspace() *workspace.Workspace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.API == nil {
+		return nil
+	}
+	return workspace.New(s.Cfg.LocalVaultsRoot, s.User, s.API)
+}
@@ -0,0 +1,239 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tabs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+
+	"github.com/grd/FreePDM/apps/fpg/dialogs"
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/client"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/domain/models"
+	"github.com/grd/FreePDM/internal/workspace"
+)
+
+// Check Out, Check In and New Version work on the ticked containers of the
+// tree, or on the selected container when none are ticked. The check-out
+// and the new version are pulled afterwards, a check-in pushes the local
+// changes first.
+
+// target is a container of a version command
+type target struct {
+	rel  string // of the container directory in the vault
+	name string // of the file
+	item client.Item
+}
+
+// targets returns the ticked containers, or else the selected one
+func (vt *VaultTab) targets() []target {
+	nodes := make([]string, 0, len(vt.marked))
+	for abs := range vt.marked {
+		nodes = append(nodes, abs)
+	}
+	if len(nodes) == 0 && vt.selectedUID != "" {
+		nodes = append(nodes, vt.selectedUID)
+	}
+	sort.Strings(nodes)
+
+	var list []target
+	for _, abs := range nodes {
+		if t, ok := vt.target(abs); ok {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+// target returns the container of a node, false for a directory
+func (vt *VaultTab) target(abs string) (target, bool) {
+	file, cn := vt.item(abs)
+	if cn == "" {
+		return target{}, false
+	}
+	rel := filepath.ToSlash(vt.rel(abs))
+	return target{rel: rel, name: path.Base(file), item: client.Item{Dir: dirOf(rel), Container: cn}}, true
+}
+
+// versionOp runs a version command on the containers in the background.
+// It goes on after a failure, the failures are shown together.
+func (vt *VaultTab) versionOp(title string, list []target, run func(t target) error) {
+	if !vt.connected(title) {
+		return
+	}
+	if len(list) == 0 {
+		dialog.ShowInformation(title, "Tick the containers, or select one, first.", vt.win)
+		return
+	}
+
+	vt.runOnServer(func() error {
+		var errs []error
+		for _, t := range list {
+			if err := run(t); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+			}
+		}
+		return errors.Join(errs...)
+	}, nil, func() {
+		clear(vt.marked)
+	})
+}
+
+// checkOut checks out the latest versions and pulls them
+func (vt *VaultTab) checkOut(list []target) {
+	vault := models.VaultInfo{Name: vt.vault()}
+	vt.versionOp("Check Out", list, func(t target) error {
+		nr, err := vt.API.CheckOut(vault.Name, t.item, -1)
+		if err != nil {
+			return err
+		}
+		_, err = vt.Sync.PullVersion(vault, t.rel, nr)
+		return err
+	})
+}
+
+// newVersion creates new versions, which are checked out, and pulls them
+func (vt *VaultTab) newVersion(list []target) {
+	vault := models.VaultInfo{Name: vt.vault()}
+	vt.versionOp("New Version", list, func(t target) error {
+		nr, err := vt.API.NewVersion(vault.Name, t.item)
+		if err != nil {
+			return err
+		}
+		_, err = vt.Sync.PullVersion(vault, t.rel, nr)
+		return err
+	})
+}
+
+// checkIn asks for the descriptions of the check-in, which are the same
+// for all containers, then pushes the local changes and checks them in.
+// Offline the check-ins are queued.
+func (vt *VaultTab) checkIn(list []target) {
+	if !vt.queueable("Check In") {
+		return
+	}
+	if len(list) == 0 {
+		dialog.ShowInformation("Check In", "Tick the containers, or select one, first.", vt.win)
+		return
+	}
+
+	names := make([]string, len(list))
+	for i, t := range list {
+		names[i] = t.name
+	}
+	opts := dialogs.ComposeOptions{DialogTitle: "Check In", SubmitLabel: "Check In"}
+
+	// The volume and material belong to one model, the server computes the
+	// weight from them
+	var volume, material string
+	if len(list) == 1 {
+		opts.Properties = []dialogs.Property{
+			{Key: db.PropertyVolume, PlaceHolder: "12500 mm^3, optional", Value: &volume},
+			{Key: db.PropertyMaterial, PlaceHolder: "Steel, optional", Value: &material},
+		}
+	}
+
+	dialogs.ShowComposeDescriptions(vt.win, strings.Join(names, ", "), opts, func(_, short, long string) {
+		ci := client.CheckInOptions{Description: short, LongDescription: long}
+		if volume != "" {
+			if _, _, err := db.ParseVolume(volume); err != nil {
+				dialog.ShowError(err, vt.win)
+				return
+			}
+		}
+		for key, value := range map[string]string{db.PropertyVolume: volume, db.PropertyMaterial: material} {
+			if value != "" {
+				if ci.Properties == nil {
+					ci.Properties = map[string]string{}
+				}
+				ci.Properties[key] = value
+			}
+		}
+
+		if vt.offline() {
+			vt.queueCheckIn(list, ci)
+			return
+		}
+		vault := models.VaultInfo{Name: vt.vault()}
+		vt.versionOp("Check In", list, func(t target) error {
+			if _, err := vt.Sync.Push(vault, t.rel); err != nil {
+				return err
+			}
+			opts, err := withReferences(filepath.Dir(vt.Root), vault.Name, t.rel, ci)
+			if err != nil {
+				return err
+			}
+			_, err = vt.API.CheckIn(vault.Name, t.item, opts)
+			return err
+		})
+	})
+}
+
+// withReferences adds the containers that the FreeCAD documents of a
+// container link to, in the local copy at root, to the check-in.
+func withReferences(root, vault, rel string, ci client.CheckInOptions) (client.CheckInOptions, error) {
+	refs, err := workspace.New(root, "", nil).References(vault, rel, layout.Latest)
+	if err != nil {
+		return ci, fmt.Errorf("failed to read the links of %s: %w", rel, err)
+	}
+	ci.References = refs
+	return ci, nil
+}
+
+// lockOwner returns who checked out a version of the container, "" when
+// nobody did or when the node is no container. It reads the local index,
+// see withLocks for a decision that needs the check-outs of the server.
+func (vt *VaultTab) lockOwner(cn string) string {
+	if cn == "" || vt.FS == nil {
+		return ""
+	}
+	return vt.FS.IsLockedItem(cn)
+}
+
+// checkedOutVersion returns the version of the container that the user
+// checked out, layout.Latest when the local index doesn't have it.
+func (vt *VaultTab) checkedOutVersion(cn string) int16 {
+	if cn == "" || vt.FS == nil {
+		return layout.Latest
+	}
+	if nr, ok := vt.FS.CheckedOutVersion(cn, vt.user()); ok {
+		return nr
+	}
+	return layout.Latest
+}
+
+// withLocks fetches the check-outs of the server into the local index in
+// the background and calls fn afterwards, so that lockOwner is up to date.
+// Without the server the local index is all there is and fn is called
+// right away.
+func (vt *VaultTab) withLocks(fn func()) {
+	if vt.Sync == nil {
+		fn()
+		return
+	}
+	sync, vault := vt.Sync, models.VaultInfo{Name: vt.vault()}
+	go func() {
+		_, err := sync.PullIndex(vault)
+		fyne.Do(func() {
+			if err == nil {
+				err = vt.FS.ReadLockedIndex()
+			}
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("fetching the check-outs: %w", err), vt.win)
+				return
+			}
+			vt.tree.Refresh()
+			fn()
+		})
+	}()
+}
@@ -0,0 +1,238 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tabs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/grd/FreePDM/apps/fpg/cfg"
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/domain/models"
+)
+
+// How often the file that FreeCAD has open is checked for a save
+const saveCheckInterval = 2 * time.Second
+
+// OpenInFreeCAD opens the file of a container in FreeCAD. With a server the
+// user chooses to check it out for editing or to open the latest version
+// read-only, and the version is pulled with the containers that it uses.
+// A check-in is offered when FreeCAD saved the file, at the first save and
+// when FreeCAD exits.
+func (vt *VaultTab) OpenInFreeCAD(abs string) {
+	t, ok := vt.target(abs)
+	if !ok {
+		// A file of a version directory is opened as it is
+		if fi, err := os.Stat(abs); err == nil && !fi.IsDir() {
+			vt.launchFreeCAD(abs, nil)
+			return
+		}
+		dialog.ShowInformation("Open in FreeCAD", "Select a container or a file.", vt.win)
+		return
+	}
+	if vt.API == nil || vt.Sync == nil {
+		// Offline a check-out of the user is edited, the check-in is queued
+		if vt.offline() && vt.lockOwner(t.item.Container) == vt.User {
+			vt.openVersion(t, vt.checkedOutVersion(t.item.Container), true)
+		} else {
+			vt.openVersion(t, layout.Latest, false)
+		}
+		return
+	}
+
+	vt.withLocks(func() { vt.confirmOpen(t) })
+}
+
+// confirmOpen asks whether to check out the container for editing and
+// opens it
+func (vt *VaultTab) confirmOpen(t target) {
+	by := vt.lockOwner(t.item.Container)
+	mine := by != "" && by == vt.API.User()
+
+	edit := widget.NewCheck("Check out for editing", nil)
+	note := widget.NewLabel("")
+	switch {
+	case mine:
+		edit.SetChecked(true)
+		edit.Disable()
+		note.SetText("You checked it out, the local changes are kept.")
+	case by != "":
+		edit.Disable()
+		note.SetText("Checked out by " + by + ", it opens read-only.")
+	default:
+		edit.SetChecked(true)
+	}
+
+	content := container.NewVBox(widget.NewLabelWithStyle(t.name, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), edit, note)
+	dialog.ShowCustomConfirm("Open in FreeCAD", "Open", "Cancel", content, func(open bool) {
+		if !open {
+			return
+		}
+		switch {
+		case mine:
+			vt.openCheckedOut(t)
+		case edit.Checked:
+			vt.pullAndOpen(t, true)
+		default:
+			vt.pullAndOpen(t, false)
+		}
+	}, vt.win)
+}
+
+// pullAndOpen checks out the latest version when edit is set, pulls the
+// version and its references and opens it.
+func (vt *VaultTab) pullAndOpen(t target, edit bool) {
+	vault := models.VaultInfo{Name: vt.vault()}
+	version := int16(layout.Latest)
+
+	vt.runOnServer(func() error {
+		if edit {
+			nr, err := vt.API.CheckOut(vault.Name, t.item, -1)
+			if err != nil {
+				return err
+			}
+			version = nr
+		}
+		_, err := vt.Sync.PullVersion(vault, t.rel, version)
+		return err
+	}, nil, func() {
+		vt.openVersion(t, version, edit)
+	})
+}
+
+// openCheckedOut opens the version that the user checked out, which need
+// not be the latest one. The local copy has the changes of the user, the
+// version is only pulled when missing.
+func (vt *VaultTab) openCheckedOut(t target) {
+	version := vt.checkedOutVersion(t.item.Container)
+	if _, err := vt.versionFile(t, version); err == nil {
+		vt.openVersion(t, version, true)
+		return
+	}
+	vault := models.VaultInfo{Name: vt.vault()}
+	vt.runOnServer(func() error {
+		_, err := vt.Sync.PullVersion(vault, t.rel, version)
+		return err
+	}, nil, func() {
+		vt.openVersion(t, version, true)
+	})
+}
+
+// openVersion opens the local file of a version, with the offer of a
+// check-in when it is edited.
+func (vt *VaultTab) openVersion(t target, version int16, edit bool) {
+	file, err := vt.versionFile(t, version)
+	if err != nil {
+		dialog.ShowError(err, vt.win)
+		return
+	}
+	if edit {
+		vt.launchFreeCAD(file, &t)
+	} else {
+		vt.launchFreeCAD(file, nil)
+	}
+}
+
+// versionFile returns the local file of a version of the container
+func (vt *VaultTab) versionFile(t target, version int16) (string, error) {
+	dir := filepath.Join(vt.Root, filepath.FromSlash(t.rel))
+	pretty, err := layout.VersionDir(filepath.Join(dir, layout.VersionFile), version)
+	if err != nil {
+		return "", err
+	}
+	if pretty == "" {
+		return "", fmt.Errorf("%s has no versions", t.name)
+	}
+	file := filepath.Join(dir, pretty, t.name)
+	if _, err := os.Stat(file); err != nil {
+		return "", fmt.Errorf("%s is not in the local copy: %w", t.name, err)
+	}
+	return file, nil
+}
+
+// launchFreeCAD starts FreeCAD with the file. For a checked out container
+// the file is watched for saves, which offer the check-in.
+func (vt *VaultTab) launchFreeCAD(file string, checkedOut *target) {
+	bin := vt.FreeCAD
+	if bin == "" {
+		bin = cfg.DefaultFreeCAD
+	}
+	var opened time.Time
+	if fi, err := os.Stat(file); err == nil {
+		opened = fi.ModTime()
+	}
+
+	cmd := exec.Command(bin, file)
+	if err := cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			err = fmt.Errorf("FreeCAD %q not found, set its path in the settings", bin)
+		}
+		dialog.ShowError(err, vt.win)
+		return
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	if checkedOut == nil {
+		return
+	}
+
+	t := *checkedOut
+	go func() {
+		ticker := time.NewTicker(saveCheckInterval)
+		defer ticker.Stop()
+		offered := false
+		for {
+			select {
+			case <-exited:
+				if savedSince(file, opened) {
+					fyne.Do(func() { vt.offerCheckIn(t, "FreeCAD was closed.") })
+				}
+				return
+			case <-ticker.C:
+				if !offered && savedSince(file, opened) {
+					offered = true
+					fyne.Do(func() { vt.offerCheckIn(t, t.name+" was saved.") })
+				}
+			}
+		}
+	}()
+}
+
+// savedSince tells whether the file changed after the time
+func savedSince(file string, since time.Time) bool {
+	fi, err := os.Stat(file)
+	return err == nil && fi.ModTime().After(since)
+}
+
+// offerCheckIn asks to check in a container, as long as the user has it
+// checked out.
+func (vt *VaultTab) offerCheckIn(t target, why string) {
+	if vt.API == nil && !vt.offline() {
+		return
+	}
+	vt.withLocks(func() {
+		if vt.lockOwner(t.item.Container) != vt.user() {
+			return
+		}
+		dialog.ShowConfirm("Check In", why+"\nCheck in "+t.name+" now?", func(yes bool) {
+			if yes {
+				vt.checkIn([]target{t})
+			}
+		}, vt.win)
+	})
+}
@@ -0,0 +1,361 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tabs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/grd/FreePDM/apps/fpg/offline"
+	"github.com/grd/FreePDM/apps/fpg/state"
+	"github.com/grd/FreePDM/internal/client"
+	"github.com/grd/FreePDM/internal/domain/models"
+	ports "github.com/grd/FreePDM/internal/ports/sync"
+)
+
+// Offline the vault tabs browse their local copies. Renames, moves and
+// check-ins wait in the queue of the state, which is replayed once the
+// user is signed in again. The server is tried every reconnectInterval.
+
+// How often the server is tried while offline
+const reconnectInterval = 30 * time.Second
+
+// offline tells whether the tab works without the server
+func (vt *VaultTab) offline() bool {
+	return vt.API == nil && vt.Queue != nil
+}
+
+// user returns who works in the tab
+func (vt *VaultTab) user() string {
+	if vt.API != nil {
+		return vt.API.User()
+	}
+	return vt.User
+}
+
+// queueable is connected for the operations that can wait for the server
+func (vt *VaultTab) queueable(title string) bool {
+	return vt.offline() || vt.connected(title)
+}
+
+// enqueue adds an operation of the tab to the queue
+func (vt *VaultTab) enqueue(op offline.Op) error {
+	op.User, op.Vault = vt.User, vt.vault()
+	if err := vt.Queue.Add(op); err != nil {
+		return err
+	}
+	vt.refreshTree()
+	return nil
+}
+
+// queued returns the operations on a node that wait for the server, as text
+func (vt *VaultTab) queued(abs string) string {
+	if vt.Queue == nil {
+		return ""
+	}
+	rel := filepath.ToSlash(vt.rel(abs))
+	var kinds []string
+	for _, op := range vt.Queue.Ops(vt.user(), vt.vault()) {
+		if op.Local == rel {
+			kinds = append(kinds, op.Kind)
+		}
+	}
+	return strings.Join(kinds, ", ")
+}
+
+// setOnline gives the tab the server of the state, or takes it away when
+// the user works offline.
+func (vt *VaultTab) setOnline(st *state.AppState) {
+	vt.User, vt.Queue = st.User, st.Queue
+	if st.Offline() {
+		vt.API, vt.Sync = nil, nil
+		vt.statuses = nil
+		vt.SetWorkspace(nil)
+	} else {
+		vt.API, vt.Sync = st.API, st.Sync()
+		vt.SetWorkspace(st.Workspace())
+	}
+	vt.Follow()
+	vt.refreshTree()
+}
+
+// queueCheckIn queues the check-ins of the containers that the user has
+// checked out.
+func (vt *VaultTab) queueCheckIn(list []target, ci client.CheckInOptions) {
+	var errs []error
+	for _, t := range list {
+		if by := vt.lockOwner(t.item.Container); by != vt.User {
+			errs = append(errs, fmt.Errorf("%s: not checked out by you", t.name))
+			continue
+		}
+		err := vt.enqueue(offline.Op{
+			Kind: offline.KindCheckIn, Name: t.name, Src: t.rel, Local: t.rel,
+			Container: t.item.Container, Short: ci.Description, Long: ci.LongDescription,
+			Properties: ci.Properties,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+		}
+	}
+	clear(vt.marked)
+	if err := errors.Join(errs...); err != nil {
+		dialog.ShowError(err, vt.win)
+	}
+}
+
+// AddVaultTab adds a vault tab, which follows the state of the connection,
+// the changes of its local copy and the events of the server.
+func (tm *TabManager) AddVaultTab(vt *VaultTab) *container.TabItem {
+	if err := vt.Watch(); err != nil {
+		log.Printf("watching %s: %v", vt.Root, err)
+	}
+	vt.Follow()
+	tm.vaultTabs = append(tm.vaultTabs, vt)
+	return tm.AddTabItem(vt.Tab)
+}
+
+// forget drops a closed vault tab, which stops watching its local copy and
+// following the server
+func (tm *TabManager) forget(ti *container.TabItem) {
+	for i, vt := range tm.vaultTabs {
+		if vt.Tab == ti {
+			vt.StopWatching()
+			vt.StopFollowing()
+			tm.vaultTabs = append(tm.vaultTabs[:i], tm.vaultTabs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Connect sets up the vault tabs after a login. Online they get the server
+// and the queue of the offline mode is replayed. Offline the server is
+// tried until it is back.
+func (tm *TabManager) Connect() {
+	for _, vt := range tm.vaultTabs {
+		vt.setOnline(tm.State)
+	}
+	if tm.State.Offline() {
+		tm.watchServer()
+		return
+	}
+	tm.replay()
+}
+
+// WorkOffline leaves the server, the vault tabs queue their operations
+func (tm *TabManager) WorkOffline() {
+	st := tm.State
+	if st.Offline() {
+		return
+	}
+	if err := st.GoOffline(st.User, ""); err != nil {
+		dialog.ShowError(err, tm.win)
+		return
+	}
+	if tm.OnLogin != nil {
+		tm.OnLogin()
+	}
+}
+
+// watchServer signs in again in the background once the server is back.
+// Without the password of the login the user signs in from the menu.
+func (tm *TabManager) watchServer() {
+	st := tm.State
+	if tm.watching || !st.CanReconnect() {
+		return
+	}
+	tm.watching = true
+
+	go func() {
+		ticker := time.NewTicker(reconnectInterval)
+		defer ticker.Stop()
+		defer fyne.Do(func() { tm.watching = false })
+
+		for range ticker.C {
+			if !st.Offline() {
+				return // signed in from the menu
+			}
+			err := st.Reconnect()
+			if err == nil {
+				fyne.Do(func() {
+					if tm.OnLogin != nil {
+						tm.OnLogin()
+					}
+				})
+				return
+			}
+			if !client.Unreachable(err) {
+				fyne.Do(func() {
+					dialog.ShowError(fmt.Errorf("the server is back, sign in again: %w", err), tm.win)
+				})
+				return
+			}
+		}
+	}()
+}
+
+// replay runs the queued operations of the user on the server, and shows
+// how it went.
+func (tm *TabManager) replay() {
+	st := tm.State
+	if st.Queue == nil || len(st.Queue.Ops(st.User, "")) == 0 {
+		return
+	}
+	api, sync, root := st.API, st.Sync(), st.Cfg.LocalVaultsRoot
+
+	go func() {
+		touched := map[string]bool{}
+		results, err := st.Queue.Replay(st.User, func(op offline.Op) error {
+			touched[op.Vault] = true
+			return replayOp(api, sync, root, op)
+		})
+		for vault := range touched {
+			if _, indexErr := sync.PullIndex(models.VaultInfo{Name: vault}); indexErr != nil {
+				err = errors.Join(err, indexErr)
+			}
+		}
+		left := len(st.Queue.Ops(st.User, ""))
+
+		fyne.Do(func() {
+			for _, vt := range tm.vaultTabs {
+				if touched[vt.vault()] {
+					vt.FS.Reread()
+					vt.invalidateAll()
+				}
+				vt.refreshTree()
+			}
+			showReplay(tm.win, results, left, err)
+		})
+	}()
+}
+
+// replayOp runs an operation of the queue. A check-in needs the check-out
+// of the user on the server still, otherwise it is a conflict.
+func replayOp(api *client.API, sync ports.LocalCopy, root string, op offline.Op) error {
+	switch op.Kind {
+	case offline.KindRename:
+		if _, err := api.Rename(op.Vault, op.Src, op.Dst); err != nil {
+			return err
+		}
+		if op.To == "" {
+			return nil
+		}
+		dir := filepath.Join(root, op.Vault)
+		return moveLocal(filepath.Join(dir, filepath.FromSlash(op.Local)), filepath.Join(dir, filepath.FromSlash(op.To)))
+
+	case offline.KindCheckIn:
+		c, err := api.Container(op.Vault, op.Src)
+		if err != nil {
+			return err
+		}
+		switch by := c.LockedBy(c.Latest()); by {
+		case op.User:
+		case "":
+			return fmt.Errorf("%w: %s is not checked out any more", offline.ErrConflict, op.Name)
+		default:
+			return fmt.Errorf("%w: %s is checked out by %s now", offline.ErrConflict, op.Name, by)
+		}
+		if _, err := sync.Push(models.VaultInfo{Name: op.Vault}, op.Src); err != nil {
+			return err
+		}
+		ci := client.CheckInOptions{Description: op.Short, LongDescription: op.Long, Properties: op.Properties}
+		if ci, err = withReferences(root, op.Vault, op.Src, ci); err != nil {
+			return err
+		}
+		_, err = api.CheckIn(op.Vault, client.Item{Dir: dirOf(op.Src), Container: op.Container}, ci)
+		return err
+	}
+	return fmt.Errorf("%w: unknown operation %q", offline.ErrConflict, op.Kind)
+}
+
+// showReplay shows the outcome of the replay of the queue
+func showReplay(win fyne.Window, results []offline.Result, left int, err error) {
+	var lines []string
+	for _, r := range results {
+		switch {
+		case r.Err == nil:
+			lines = append(lines, "Done: "+r.Op.String())
+		case r.Conflict:
+			lines = append(lines, fmt.Sprintf("Conflict, dropped: %s\n    %v", r.Op, r.Err))
+		case r.Blocked:
+			lines = append(lines, fmt.Sprintf("Not tried, kept: %s\n    %v", r.Op, r.Err))
+		default:
+			lines = append(lines, fmt.Sprintf("Failed, kept: %s\n    %v", r.Op, r.Err))
+		}
+	}
+	if left > 0 {
+		lines = append(lines, fmt.Sprintf("\n%d operation(s) still wait for the server.", left))
+	}
+	if err != nil && (len(results) == 0 || results[len(results)-1].Err == nil) {
+		lines = append(lines, "\n"+err.Error())
+	}
+
+	text := widget.NewLabel(strings.Join(lines, "\n"))
+	text.Wrapping = fyne.TextWrapWord
+	scroll := container.NewVScroll(text)
+	scroll.SetMinSize(fyne.NewSize(520, 240))
+	dialog.ShowCustom("Offline operations", "Close", scroll, win)
+}
+
+// ShowPending lists the queued operations of the user, which can be
+// discarded one by one.
+func (tm *TabManager) ShowPending() {
+	st := tm.State
+	if st.Queue == nil {
+		return
+	}
+	ops := st.Queue.Ops(st.User, "")
+	if len(ops) == 0 {
+		dialog.ShowInformation("Pending Operations", "No operations wait for the server.", tm.win)
+		return
+	}
+
+	rows := container.NewVBox()
+	for _, op := range ops {
+		label := widget.NewLabel(op.String() + "  (" + op.Queued.Format("2006-01-02 15:04") + ")")
+		var discard *widget.Button
+		discard = widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+			dialog.ShowConfirm("Discard", "Discard "+op.String()+"?", func(yes bool) {
+				if !yes {
+					return
+				}
+				if err := st.Queue.Discard(op.ID); err != nil {
+					dialog.ShowError(err, tm.win)
+					return
+				}
+				label.TextStyle.Italic = true
+				label.SetText("Discarded: " + op.String())
+				discard.Disable()
+				for _, vt := range tm.vaultTabs {
+					vt.refreshTree()
+				}
+			}, tm.win)
+		})
+		rows.Add(container.NewBorder(nil, nil, nil, discard, label))
+	}
+
+	scroll := container.NewVScroll(rows)
+	scroll.SetMinSize(fyne.NewSize(560, 260))
+	dialog.ShowCustom("Pending Operations", "Close", scroll, tm.win)
+}
+
+// queueRename queues a rename or a move of the node abs. src and dst are
+// the paths on the server, to is where the node moves in the local copy.
+func (vt *VaultTab) queueRename(abs, src, dst, to string) {
+	op := offline.Op{Kind: offline.KindRename, Name: path.Base(src), Src: src, Dst: dst, Local: filepath.ToSlash(vt.rel(abs)), To: to}
+	if err := vt.enqueue(op); err != nil {
+		dialog.ShowError(err, vt.win)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tabs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/grd/FreePDM/apps/fpg/state"
+	"github.com/grd/FreePDM/internal/client"
+	"github.com/grd/FreePDM/internal/shared"
+)
+
+const (
+	allVaults    = "All vaults"
+	thumbnailDim = 48
+)
+
+// SearchTab searches the containers of the vaults on the server by name,
+// container number, part number, description, material and
+// revision state. A double-click on a result opens its folder in a vault
+// tab.
+type SearchTab struct {
+	Tab    *container.TabItem
+	OnOpen func(r shared.SearchResult) // opens the folder of a result
+
+	state *state.AppState
+	win   fyne.Window
+
+	results []shared.SearchResult
+	thumbs  map[string]fyne.Resource // by vault and path, nil when there is none
+
+	lastClick   widget.ListItemID
+	lastClickAt time.Time
+
+	query  *widget.Entry
+	vault  *widget.Select
+	rstate *widget.SelectEntry
+	list   *widget.List
+	status *widget.Label
+}
+
+// NewSearchTab creates the Search tab. onOpen is called on a double-click
+// on a result.
+func NewSearchTab(win fyne.Window, st *state.AppState, onOpen func(r shared.SearchResult)) *SearchTab {
+	t := &SearchTab{OnOpen: onOpen, state: st, win: win, thumbs: map[string]fyne.Resource{}, lastClick: -1}
+
+	t.query = widget.NewEntry()
+	t.query.SetPlaceHolder("Name, number, description or material")
+	t.query.OnSubmitted = func(string) { t.run() }
+
+	vaults := []string{allVaults}
+	for _, v := range st.Vaults() {
+		vaults = append(vaults, v.Name)
+	}
+	t.vault = widget.NewSelect(vaults, nil)
+	t.vault.SetSelected(allVaults)
+
+	t.rstate = widget.NewSelectEntry(shared.RevisionStates)
+	t.rstate.SetPlaceHolder("Any state")
+
+	searchBtn := widget.NewButtonWithIcon("Search", theme.SearchIcon(), t.run)
+	topBar := container.NewBorder(nil, nil, nil,
+		container.NewHBox(t.vault, container.NewGridWrap(fyne.NewSize(160, t.rstate.MinSize().Height), t.rstate), searchBtn),
+		t.query)
+
+	t.list = widget.NewList(
+		func() int { return len(t.results) },
+		func() fyne.CanvasObject {
+			img := canvas.NewImageFromResource(theme.FileIcon())
+			img.FillMode = canvas.ImageFillContain
+			img.SetMinSize(fyne.NewSize(thumbnailDim, thumbnailDim))
+			name := widget.NewLabelWithStyle("name", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+			detail := widget.NewLabel("detail")
+			detail.Truncation = fyne.TextTruncateEllipsis
+			lock := widget.NewLabelWithStyle("", fyne.TextAlignTrailing, fyne.TextStyle{Italic: true})
+			lock.Importance = widget.WarningImportance
+			return container.NewBorder(nil, nil, img, lock, container.NewVBox(name, detail))
+		},
+		func(i widget.ListItemID, co fyne.CanvasObject) {
+			t.updateRow(t.results[i], co.(*fyne.Container))
+		},
+	)
+
+	t.list.OnSelected = func(id widget.ListItemID) {
+		// Unselect right away, so that the second click selects again
+		t.list.Unselect(id)
+		now := time.Now()
+		if t.lastClick == id && now.Sub(t.lastClickAt) <= 400*time.Millisecond {
+			t.lastClick, t.lastClickAt = -1, time.Time{}
+			if t.OnOpen != nil {
+				t.OnOpen(t.results[id])
+			}
+			return
+		}
+		t.lastClick, t.lastClickAt = id, now
+	}
+
+	t.status = widget.NewLabel("")
+	if !st.Connected() {
+		t.status.SetText("Sign in to the server to search.")
+	}
+
+	content := container.NewBorder(topBar, t.status, nil, nil, t.list)
+	t.Tab = container.NewTabItemWithIcon("Search", theme.SearchIcon(), content)
+	return t
+}
+
+// updateRow shows a result in a row of the list
+func (t *SearchTab) updateRow(r shared.SearchResult, row *fyne.Container) {
+	texts := row.Objects[0].(*fyne.Container)
+	img := row.Objects[1].(*canvas.Image)
+	lock := row.Objects[2].(*widget.Label)
+
+	name := r.Name
+	if r.PartNumber != "" {
+		name += "  (" + r.PartNumber + ")"
+	}
+	texts.Objects[0].(*widget.Label).SetText(name)
+
+	detail := []string{path.Join(r.Vault, r.Path), "#" + r.ContainerNumber, fmt.Sprintf("version %d", r.Version)}
+	if r.State != "" {
+		detail = append(detail, r.State)
+	}
+	if descr, _, _ := strings.Cut(r.Description, "\n"); descr != "" {
+		detail = append(detail, descr)
+	}
+	texts.Objects[1].(*widget.Label).SetText(strings.Join(detail, " · "))
+
+	switch {
+	case r.LockedBy == "":
+		lock.SetText("")
+	case t.state.API != nil && r.LockedBy == t.state.API.User():
+		lock.SetText("checked out by you")
+	default:
+		lock.SetText("checked out by " + r.LockedBy)
+	}
+
+	img.Resource = theme.FileIcon()
+	if res, ok := t.thumbs[thumbKey(r)]; ok {
+		if res != nil {
+			img.Resource = res
+		}
+	} else {
+		t.fetchThumbnail(r)
+	}
+	img.Refresh()
+}
+
+// thumbKey is the key of the thumbnail of a result
+func thumbKey(r shared.SearchResult) string {
+	return path.Join(r.Vault, r.Path, r.ContainerNumber)
+}
+
+// fetchThumbnail fetches the thumbnail of a result in the background. A
+// container without one shows the file icon.
+func (t *SearchTab) fetchThumbnail(r shared.SearchResult) {
+	api := t.state.API
+	if api == nil {
+		return
+	}
+	key := thumbKey(r)
+	t.thumbs[key] = nil // once
+
+	go func() {
+		png, err := api.Thumbnail(r.Vault, path.Join(r.Path, r.ContainerNumber))
+		if err != nil {
+			return
+		}
+		fyne.Do(func() {
+			t.thumbs[key] = fyne.NewStaticResource(key+".png", png)
+			t.list.Refresh()
+		})
+	}()
+}
+
+// run searches on the server and shows the results
+func (t *SearchTab) run() {
+	api := t.state.API
+	if api == nil {
+		dialog.ShowInformation("Search", "Sign in to the server first, the search runs there.", t.win)
+		return
+	}
+
+	opts := client.SearchOptions{State: strings.TrimSpace(t.rstate.Text)}
+	if t.vault.Selected != allVaults {
+		opts.Vault = t.vault.Selected
+	}
+	text := strings.TrimSpace(t.query.Text)
+	t.status.SetText("Searching…")
+
+	go func() {
+		list, err := api.Search(text, opts)
+		fyne.Do(func() {
+			if err != nil {
+				t.status.SetText("")
+				dialog.ShowError(fmt.Errorf("search: %w", err), t.win)
+				return
+			}
+			t.results = list
+			t.lastClick = -1
+			t.list.Refresh()
+			t.list.ScrollToTop()
+			t.status.SetText(fmt.Sprintf("%d container(s) found.", len(list)))
+		})
+	}()
+}
@@ -9,12 +9,26 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/driver/desktop"
+
+	"github.com/grd/FreePDM/apps/fpg/dialogs"
+	"github.com/grd/FreePDM/apps/fpg/state"
+	"github.com/grd/FreePDM/internal/shared"
 )
 
 type TabManager struct {
 	win  fyne.Window
 	Tabs *container.DocTabs
 	curr *container.TabItem // track current tab ourselves
+
+	State     *state.AppState // the session with the server
+	OpenVault func(v Vault)   // opens a vault of a Vaults tab
+	OnLogin   func()          // after a login from the menu
+
+	// OpenResult opens the folder of a search result in a vault tab
+	OpenResult func(r shared.SearchResult)
+
+	vaultTabs []*VaultTab // follow the connection, see Connect
+	watching  bool        // the server is tried while offline
 }
 
 func NewTabManager(win fyne.Window) *TabManager {
@@ -28,8 +42,8 @@ func NewTabManager(win fyne.Window) *TabManager {
 	tm.Tabs.OnSelected = func(ti *container.TabItem) {
 		tm.curr = ti
 	}
-	// Optional: intercept close or react on close
-	// tm.Tabs.OnClosed = func(ti *container.TabItem) {}
+	// Closed vault tabs no longer follow the connection
+	tm.Tabs.OnClosed = func(ti *container.TabItem) { tm.forget(ti) }
 
 	// Hotkeys
 	c := win.Canvas()
@@ -52,6 +66,12 @@ func NewTabManager(win fyne.Window) *TabManager {
 		Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift,
 	}, func(fyne.Shortcut) { tm.PrevTab() })
 
+	// Ctrl+F — search
+	c.AddShortcut(&desktop.CustomShortcut{
+		KeyName:  fyne.KeyF,
+		Modifier: fyne.KeyModifierControl,
+	}, func(fyne.Shortcut) { tm.OpenSearch() })
+
 	// Ctrl+1..9 — select by index (1-based)
 	keys := []fyne.KeyName{
 		fyne.Key1, fyne.Key2, fyne.Key3, fyne.Key4, fyne.Key5,
@@ -70,13 +90,23 @@ func NewTabManager(win fyne.Window) *TabManager {
 
 func BuildMainMenu(win fyne.Window, tm *TabManager) *fyne.MainMenu {
 	fileMenu := fyne.NewMenu("File",
+		fyne.NewMenuItem("Login…", func() {
+			dialogs.ShowLoginWindow(tm.State, tm.OnLogin)
+		}),
 		fyne.NewMenuItem("Open Vaults", func() {
-			vt := NewVaultsTab(win, func(v Vault) {
-				// TODO: replace with real open logic
+			vt := NewVaultsTab(win, tm.State, func(v Vault) {
+				if tm.OpenVault != nil {
+					tm.OpenVault(v)
+					return
+				}
 				dialog.ShowInformation("Open Vault", "Opening: "+v.Path, win)
 			})
 			tm.AddTabItem(vt.Tab)
 		}),
+		fyne.NewMenuItem("Work Offline", func() { tm.WorkOffline() }),
+		fyne.NewMenuItem("Pending Operations…", func() { tm.ShowPending() }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Search…", func() { tm.OpenSearch() }),
 		fyne.NewMenuItemSeparator(),
 		fyne.NewMenuItem("Close Tab", func() { tm.CloseCurrent() }),
 		fyne.NewMenuItemSeparator(),
@@ -97,6 +127,13 @@ func BuildMainMenu(win fyne.Window, tm *TabManager) *fyne.MainMenu {
 	return fyne.NewMainMenu(fileMenu, viewMenu, helpMenu)
 }
 
+// OpenSearch adds a Search tab
+func (tm *TabManager) OpenSearch() {
+	st := NewSearchTab(tm.win, tm.State, tm.OpenResult)
+	tm.AddTabItem(st.Tab)
+	tm.win.Canvas().Focus(st.query)
+}
+
 func (tm *TabManager) AddTab(title string, content fyne.CanvasObject) *container.TabItem {
 	ti := container.NewTabItem(title, content)
 	tm.Tabs.Append(ti)
@@ -125,6 +162,7 @@ func (tm *TabManager) CloseCurrent() {
 		ti = tm.Tabs.Items[0]
 	}
 	tm.Tabs.Remove(ti)
+	tm.forget(ti)
 	// After remove, Fyne will select something; OnSelected will update tm.curr.
 }
 
@@ -172,6 +210,7 @@ func (tm *TabManager) CloseByTitle(title string) bool {
 	for _, ti := range tm.Tabs.Items {
 		if ti.Text == title {
 			tm.Tabs.Remove(ti)
+			tm.forget(ti)
 			return true
 		}
 	}
@@ -0,0 +1,37 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tabs
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+// treeRow is a row of the vault tree that opens a context menu on a
+// secondary tap (right click).
+type treeRow struct {
+	widget.BaseWidget
+	content *fyne.Container
+	uid     string // the node of the row, set on every update
+
+	onMenu func(uid string, pos fyne.Position)
+}
+
+func newTreeRow(content *fyne.Container, onMenu func(uid string, pos fyne.Position)) *treeRow {
+	r := &treeRow{content: content, onMenu: onMenu}
+	r.ExtendBaseWidget(r)
+	return r
+}
+
+func (r *treeRow) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(r.content)
+}
+
+// TappedSecondary implements fyne.SecondaryTappable
+func (r *treeRow) TappedSecondary(ev *fyne.PointEvent) {
+	if r.onMenu != nil && r.uid != "" {
+		r.onMenu(r.uid, ev.AbsolutePosition)
+	}
+}
@@ -5,10 +5,7 @@
 package tabs
 
 import (
-	"errors"
 	"fmt"
-	"io"
-	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
@@ -22,7 +19,13 @@ import (
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"github.com/grd/FreePDM/apps/fpg/dialogs"
+	"github.com/grd/FreePDM/apps/fpg/offline"
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/client"
+	ports "github.com/grd/FreePDM/internal/ports/sync"
 	"github.com/grd/FreePDM/internal/vault/localfs"
+	"github.com/grd/FreePDM/internal/workspace"
 )
 
 var reNumeric = regexp.MustCompile(`^\d+$`)
@@ -31,7 +34,13 @@ type VaultTab struct {
 	Tab       *container.TabItem
 	Root      string
 	FS        *localfs.FileSystem
-	OnOpenCAD func(path string) // called when a “file” (incl. numeric-dir) is opened
+	OnOpenCAD func(path string)    // called when a “file” (incl. numeric-dir) is opened
+	API       *client.API          // the server, nil when not connected
+	Sync      ports.LocalCopy      // keeps the local copy up to date, nil without server
+	Workspace *workspace.Workspace // compares the local copy with the server, nil without
+	FreeCAD   string               // the program of OpenInFreeCAD, "freecad" when empty
+	Queue     *offline.Queue       // keeps the operations while offline, nil without
+	User      string               // who works in the tab, also offline
 	win       fyne.Window
 
 	// UI
@@ -50,6 +59,11 @@ type VaultTab struct {
 	allocateBtn *widget.Button
 	assignBtn   *widget.Button
 
+	// UI version actions, on the ticked containers or the selected one
+	checkOutBtn   *widget.Button
+	checkInBtn    *widget.Button
+	newVersionBtn *widget.Button
+
 	// state
 	lastClickPath string
 	lastClickAt   time.Time
@@ -57,6 +71,18 @@ type VaultTab struct {
 
 	// inside type VaultTab
 	infoCache map[string]localfs.FileInfo // abs-node-id -> FileInfo
+	children  map[string][]string         // abs dir -> the node IDs in it
+	watch     *treeWatch                  // follows the changes on disk, nil when off
+	unfollow  func()                      // ends Follow, nil when the server events are not followed
+	pulling   bool                        // the file index is fetched after server events
+	pending   *serverPull                 // the server events that came meanwhile, nil when none
+	indexMod  time.Time                   // the file index that the tree shows, see rereadIndex
+	indexSize int64
+	statuses  map[string]workspace.Status // abs container -> state on the server
+	marked    map[string]bool             // abs containers that are ticked
+
+	statusBusy  bool // refreshStatus compares the vault
+	statusAgain bool // and runs once more after that
 }
 
 // NewVaultTab builds the Vault UI tab.
@@ -72,6 +98,8 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 		Root:      root,
 		OnOpenCAD: onOpenCAD,
 		infoCache: make(map[string]localfs.FileInfo),
+		children:  make(map[string][]string),
+		marked:    make(map[string]bool),
 		win:       win,
 	}
 
@@ -105,31 +133,71 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 			return false
 		},
 
-		// create node UI (main icon + label + right-aligned status badge)
+		// create node UI (tick + main icon + label + lock owner + right-aligned status badge)
 		func(branch bool) fyne.CanvasObject {
+			tick := widget.NewCheck("", nil)
 			icon := widget.NewIcon(theme.FolderIcon())
 			lbl := widget.NewLabel("")
+			lock := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Italic: true})
+			lock.Importance = widget.WarningImportance
 
 			badge := widget.NewButtonWithIcon("", theme.InfoIcon(), func() {})
 			badge.Importance = widget.LowImportance
 			badge.Hide()
 
-			left := container.NewHBox(icon, lbl)
+			left := container.NewHBox(tick, icon, lbl, lock)
 			row := container.NewBorder(nil, nil, left, badge, nil)
-			return row
+			return newTreeRow(row, vt.showContextMenu)
 		},
 
 		func(uid widget.TreeNodeID, branch bool, obj fyne.CanvasObject) {
-			row := obj.(*fyne.Container)             // Border
-			left := row.Objects[0].(*fyne.Container) // HBox(icon,label)
+			tr := obj.(*treeRow)
+			tr.uid = string(uid)
+			row := tr.content                        // Border
+			left := row.Objects[0].(*fyne.Container) // HBox(tick,icon,label,lock)
 			badge := row.Objects[1].(*widget.Button) // right-side badge
 
-			icon := left.Objects[0].(*widget.Icon)
-			lbl := left.Objects[1].(*widget.Label)
+			tick := left.Objects[0].(*widget.Check)
+			icon := left.Objects[1].(*widget.Icon)
+			lbl := left.Objects[2].(*widget.Label)
+			lock := left.Objects[3].(*widget.Label)
 
 			abs := string(uid)
 
+			// Only containers can be ticked for the version actions
+			tick.OnChanged = nil
+			tick.Hide()
+			lock.Hide()
+
 			if fi, ok := vt.lookupInfo(abs); ok {
+				if cn := fi.ContainerNumber(); cn != "" {
+					tick.SetChecked(vt.marked[abs])
+					tick.OnChanged = func(on bool) {
+						if on {
+							vt.marked[abs] = true
+						} else {
+							delete(vt.marked, abs)
+						}
+					}
+					tick.Show()
+
+					if by := vt.lockOwner(cn); by != "" {
+						if by == vt.user() {
+							by = "you"
+						}
+						lock.SetText("checked out by " + by)
+						lock.Show()
+					}
+				}
+				if kinds := vt.queued(abs); kinds != "" {
+					text := "queued: " + kinds
+					if lock.Visible() {
+						text = lock.Text + ", " + text
+					}
+					lock.SetText(text)
+					lock.Show()
+				}
+
 				name := fi.Name()
 				if fi.Alloc() == localfs.AllocAllocatedWithCandidate {
 					if cand, ok := fi.AllocCandidate(); ok && cand != "" {
@@ -173,7 +241,7 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 					badge.Show()
 
 				default:
-					badge.Hide()
+					vt.statusBadge(abs, badge)
 				}
 				return
 			}
@@ -191,11 +259,15 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 	// --- Buttons: Rename/Move/Copy/Delete ------------------------------------
 	vt.renameBtn = widget.NewButtonWithIcon("Rename", theme.DocumentCreateIcon(), func() {
 		uid := vt.selectedUID
-		if uid == "" {
+		if uid == "" || !vt.queueable("Rename") {
 			return
 		}
+		oldName := filepath.Base(uid)
+		if fi, ok := vt.lookupInfo(uid); ok {
+			oldName = fi.Name()
+		}
 		entry := widget.NewEntry()
-		entry.SetText(filepath.Base(uid))
+		entry.SetText(oldName)
 		dialog.ShowForm("Rename", "OK", "Cancel", []*widget.FormItem{
 			widget.NewFormItem("New name", entry),
 		}, func(ok bool) {
@@ -203,87 +275,68 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 				return
 			}
 			newName := strings.TrimSpace(entry.Text)
-			if newName == "" || newName == filepath.Base(uid) {
+			if newName == "" || newName == oldName {
 				return
 			}
-			if err := renamePath(vt, uid, filepath.Join(filepath.Dir(uid), newName)); err != nil {
-				dialog.ShowError(err, win)
-				return
-			}
-			vt.refreshTree()
+			vt.renameNode(uid, newName)
 		}, win)
 	})
 
 	vt.moveBtn = widget.NewButtonWithIcon("Move", theme.NavigateNextIcon(), func() {
 		uid := vt.selectedUID
-		if uid == "" {
+		if uid == "" || !vt.queueable("Move") {
 			return
 		}
 		dest := widget.NewEntry()
-		dest.SetPlaceHolder("Destination directory")
+		dest.SetPlaceHolder("Destination directory in the vault")
 		dialog.ShowForm("Move", "OK", "Cancel", []*widget.FormItem{
 			widget.NewFormItem("To dir", dest),
 		}, func(ok bool) {
 			if !ok {
 				return
 			}
-			d := strings.TrimSpace(dest.Text)
-			if d == "" {
-				return
-			}
-			if err := movePath(uid, filepath.Join(d, filepath.Base(uid))); err != nil {
-				dialog.ShowError(err, win)
-				return
-			}
-			vt.refreshTree()
+			vt.moveNode(uid, dest.Text)
 		}, win)
 	})
 
 	vt.copyBtn = widget.NewButtonWithIcon("Copy", theme.ContentCopyIcon(), func() {
 		uid := vt.selectedUID
-		if uid == "" {
+		if uid == "" || !vt.connected("Copy") {
 			return
 		}
 		dest := widget.NewEntry()
-		dest.SetPlaceHolder("Destination directory")
+		dest.SetPlaceHolder("Destination directory in the vault")
 		dialog.ShowForm("Copy", "OK", "Cancel", []*widget.FormItem{
 			widget.NewFormItem("To dir", dest),
 		}, func(ok bool) {
 			if !ok {
 				return
 			}
-			d := strings.TrimSpace(dest.Text)
-			if d == "" {
-				return
-			}
-			if err := copyPath(uid, filepath.Join(d, filepath.Base(uid))); err != nil {
-				dialog.ShowError(err, win)
-				return
-			}
-			vt.refreshTree()
+			vt.copyNode(uid, dest.Text)
 		}, win)
 	})
 
 	vt.delBtn = widget.NewButtonWithIcon("Delete", theme.DeleteIcon(), func() {
 		uid := vt.selectedUID
-		if uid == "" {
+		if uid == "" || !vt.connected("Delete") {
 			return
 		}
 		dialog.ShowConfirm("Delete", "Are you sure?\n"+uid, func(yes bool) {
 			if !yes {
 				return
 			}
-			if err := os.RemoveAll(uid); err != nil {
-				dialog.ShowError(err, win)
-				return
-			}
 			vt.selectedUID = ""
-			vt.refreshTree()
+			vt.deleteNode(uid)
 		}, win)
 	})
 
 	// --- Buttons: Refresh / Allocate / Assign ---------------------------------
 	vt.refreshBtn = widget.NewButtonWithIcon("Refresh", theme.ViewRefreshIcon(), func() {
+		if vt.API != nil {
+			vt.Update(nil)
+			return
+		}
+		vt.invalidateAll()
 		vt.refreshTree()
 	})
 
@@ -294,27 +347,19 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 			dialog.ShowInformation("Allocate", "Select a directory first.", win)
 			return
 		}
+		if !vt.connected("Allocate") {
+			return
+		}
 		if fi, ok := vt.lookupInfo(abs); ok && !fi.IsDir() {
 			abs = filepath.Dir(abs)
 		}
-
-		rel := vt.rel(abs)
-
-		fl, err := vt.FS.Allocate(rel)
-		if err != nil {
-			dialog.ShowError(err, win)
-			return
-		}
-
-		vt.refreshTree()
-		absContainer := filepath.Join(vt.Root, fl.Path, fl.ContainerNumber)
-		vt.tree.Select(widget.TreeNodeID(absContainer))
+		vt.allocateIn(abs)
 	})
 
 	// Assign: only relevant for an allocated container that still has the EmptyFile in version 0.
 	vt.assignBtn = widget.NewButtonWithIcon("Assign", theme.DocumentCreateIcon(), func() {
 		abs := vt.selectedUID
-		if abs == "" {
+		if abs == "" || !vt.connected("Assign") {
 			return
 		}
 		cn := filepath.Base(abs) // container number (numeric string)
@@ -331,16 +376,23 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 				if name == "" {
 					return
 				}
-				if err := vt.FS.Assign(cn, name); err != nil {
-					dialog.ShowError(err, win)
-					return
-				}
-				vt.refreshTree()
+				vt.assignName(cn, name)
 			},
 			win,
 		)
 	})
 
+	// --- Buttons: Check Out / Check In / New Version ---------------------------
+	vt.checkOutBtn = widget.NewButtonWithIcon("Check Out", theme.DownloadIcon(), func() {
+		vt.checkOut(vt.targets())
+	})
+	vt.checkInBtn = widget.NewButtonWithIcon("Check In", theme.UploadIcon(), func() {
+		vt.checkIn(vt.targets())
+	})
+	vt.newVersionBtn = widget.NewButtonWithIcon("New Version", theme.ContentAddIcon(), func() {
+		vt.newVersion(vt.targets())
+	})
+
 	// Initially disable/hide action buttons until a selection is made.
 	vt.renameBtn.Disable()
 	vt.moveBtn.Disable()
@@ -371,6 +423,8 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 		widget.NewSeparator(),
 		// Toolbar: Refresh + Allocate + Assign + (Rename/Move/Copy/Delete)
 		container.NewHBox(vt.refreshBtn, vt.allocateBtn, vt.assignBtn, vt.renameBtn, vt.moveBtn, vt.copyBtn, vt.delBtn),
+		// Version actions on the ticked containers, or else the selected one
+		container.NewHBox(vt.checkOutBtn, vt.checkInBtn, vt.newVersionBtn),
 	)
 
 	vt.tree.OnSelected = func(uid widget.TreeNodeID) {
@@ -404,6 +458,9 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 			vt.assignBtn.Enable()
 
 			vt.assignBtn.OnTapped = func() {
+				if !vt.connected("Assign") {
+					return
+				}
 				// Resolve numeric container number from FileInfo (never from the UI label)
 				cn := fi.ContainerNumber()
 				if cn == "" {
@@ -435,11 +492,7 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 							dialog.ShowError(fmt.Errorf("file name is required"), win)
 							return
 						}
-						if err := vt.FS.Assign(cn, name); err != nil {
-							dialog.ShowError(err, win)
-							return
-						}
-						vt.refreshTree()
+						vt.assignName(cn, name)
 					},
 					win,
 				)
@@ -520,11 +573,70 @@ func NewVaultTab(win fyne.Window, root string, onOpenCAD func(string)) *VaultTab
 	return vt
 }
 
+// ---------- Context menu ----------
+
+// showContextMenu opens the menu of a tree node at the position of the
+// secondary tap.
+func (vt *VaultTab) showContextMenu(uid string, pos fyne.Position) {
+	fi, ok := vt.lookupInfo(uid)
+	if !ok || fi.ContainerNumber() == "" {
+		return // only containers have a menu for now
+	}
+
+	only := func() []target {
+		if t, ok := vt.target(uid); ok {
+			return []target{t}
+		}
+		return nil
+	}
+
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem("Open in FreeCAD", func() { vt.OpenInFreeCAD(uid) }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Check Out", func() { vt.checkOut(only()) }),
+		fyne.NewMenuItem("Check In", func() { vt.checkIn(only()) }),
+		fyne.NewMenuItem("New Version", func() { vt.newVersion(only()) }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Where Used", func() { vt.showWhereUsed(fi, false) }),
+		fyne.NewMenuItem("Where Used (All Levels)", func() { vt.showWhereUsed(fi, true) }),
+	)
+	widget.ShowPopUpMenuAtPosition(menu, vt.win.Canvas(), pos)
+}
+
+// showWhereUsed asks the server which assemblies and drawings, in every
+// vault, refer to the container.
+func (vt *VaultTab) showWhereUsed(fi localfs.FileInfo, recursive bool) {
+	if vt.API == nil {
+		dialog.ShowInformation("Where used", "Connect to the server to search the references.", vt.win)
+		return
+	}
+
+	vault := filepath.Base(vt.Root)
+	cn := fi.ContainerNumber()
+	title := fmt.Sprintf("%s (%s/%s)", fi.Name(), vault, cn)
+
+	go func() {
+		list, err := vt.API.WhereUsed(vault, cn, recursive)
+		fyne.Do(func() {
+			if err != nil {
+				dialog.ShowError(err, vt.win)
+				return
+			}
+			dialogs.ShowWhereUsed(vt.win, title, list)
+		})
+	}()
+}
+
 // ---------- Tree helpers ----------
 
-// listChildren returns immediate children as absolute node IDs.
-// It converts the absolute 'abs' into a vault-relative path for localfs.ListDir.
+// listChildren returns immediate children as absolute node IDs, which are
+// the paths on disk: the number directory for a container. A directory is
+// listed once, the watcher drops it from the cache when it changes.
 func (vt *VaultTab) listChildren(abs string) []string {
+	if ids, ok := vt.children[abs]; ok {
+		return ids
+	}
+
 	rel := vt.rel(abs)                 // "" for root
 	entries, err := vt.FS.ListDir(rel) // your FS expects relative paths
 	if err != nil {
@@ -539,11 +651,37 @@ func (vt *VaultTab) listChildren(abs string) []string {
 		if strings.HasPrefix(name, ".") {
 			continue
 		}
-		out = append(out, filepath.Join(abs, name)) // absolute node IDs
+		child := filepath.Join(abs, nodeName(e)) // absolute node IDs
+		vt.infoCache[child] = e
+		out = append(out, child)
 	}
+	vt.children[abs] = out
 	return out
 }
 
+// nodeName is the name of a node on disk, the number for a container
+func nodeName(fi localfs.FileInfo) string {
+	if cn := fi.ContainerNumber(); cn != "" {
+		return cn
+	}
+	return fi.Name()
+}
+
+// invalidate drops the listing of a directory, it is read again at the
+// next refresh of the tree.
+func (vt *VaultTab) invalidate(dir string) {
+	for _, child := range vt.children[dir] {
+		delete(vt.infoCache, child)
+	}
+	delete(vt.children, dir)
+}
+
+// invalidateAll drops all listings, after the file index changed
+func (vt *VaultTab) invalidateAll() {
+	clear(vt.children)
+	clear(vt.infoCache)
+}
+
 // rel returns the vault-relative path for an absolute path under vt.Root.
 // "" means the vault root itself.
 func (vt *VaultTab) rel(abs string) string {
@@ -563,6 +701,25 @@ func (vt *VaultTab) rel(abs string) string {
 	return "" // outside → treat as root
 }
 
+// Reveal opens the branches down to the directory dir of the vault and
+// selects the node name in it, or the directory itself when name is "".
+func (vt *VaultTab) Reveal(dir, name string) {
+	abs := vt.Root
+	vt.tree.OpenBranch(widget.TreeNodeID(abs))
+	for _, part := range strings.Split(layout.CleanRel(dir), "/") {
+		if part == "" {
+			continue
+		}
+		abs = filepath.Join(abs, part)
+		vt.tree.OpenBranch(widget.TreeNodeID(abs))
+	}
+	if name != "" {
+		abs = filepath.Join(abs, name)
+	}
+	vt.tree.Select(widget.TreeNodeID(abs))
+	vt.tree.ScrollTo(widget.TreeNodeID(abs))
+}
+
 func (vt *VaultTab) currentSelection() string {
 	return vt.selectedUID
 }
@@ -570,6 +727,96 @@ func (vt *VaultTab) currentSelection() string {
 func (vt *VaultTab) refreshTree() {
 	// Force refresh of the currently visible nodes
 	vt.tree.Refresh()
+	vt.refreshStatus()
+}
+
+// SetWorkspace shows the states of the containers on the server as badges
+func (vt *VaultTab) SetWorkspace(ws *workspace.Workspace) {
+	vt.Workspace = ws
+	vt.refreshStatus()
+}
+
+// refreshStatus compares the containers with the server in the background
+// and shows their states as badges. A refresh while the vault is compared
+// waits for it and runs once, instead of comparing the vault twice at the
+// same time.
+func (vt *VaultTab) refreshStatus() {
+	ws := vt.Workspace
+	if ws == nil {
+		return
+	}
+	if vt.statusBusy {
+		vt.statusAgain = true
+		return
+	}
+	vt.statusBusy = true
+	vault := filepath.Base(vt.Root)
+
+	go func() {
+		list, err := ws.StatusTree(vault, "")
+		if err != nil {
+			log.Printf("status of vault %s: %v", vault, err)
+		}
+		statuses := make(map[string]workspace.Status, len(list))
+		for _, st := range list {
+			if st.Error != "" {
+				log.Printf("status of %s/%s: %s", vault, st.Path, st.Error)
+			}
+			statuses[filepath.Join(vt.Root, filepath.FromSlash(st.Path))] = st
+		}
+		fyne.Do(func() {
+			vt.statuses = statuses
+			vt.tree.Refresh()
+			vt.statusBusy = false
+			if vt.statusAgain {
+				vt.statusAgain = false
+				vt.refreshStatus()
+			}
+		})
+	}()
+}
+
+// statusBadge shows the state of a container on the server, nothing when
+// it is unmodified.
+func (vt *VaultTab) statusBadge(abs string, badge *widget.Button) {
+	st, ok := vt.statuses[abs]
+	if !ok || st.State == workspace.Unmodified {
+		badge.Hide()
+		return
+	}
+
+	switch {
+	case st.Error != "":
+		badge.SetIcon(theme.QuestionIcon())
+	case st.Conflict():
+		badge.SetIcon(theme.ErrorIcon())
+	case st.State == workspace.Modified:
+		badge.SetIcon(theme.WarningIcon())
+	case st.State == workspace.Outdated:
+		badge.SetIcon(theme.DownloadIcon())
+	case st.State == workspace.CheckedOutByMe:
+		badge.SetIcon(theme.AccountIcon())
+	default:
+		badge.SetIcon(theme.VisibilityOffIcon())
+	}
+
+	msg := fmt.Sprintf("State: %s\nLocal version: %d, server version: %d", st.State, st.LocalVersion, st.ServerVersion)
+	if st.Error != "" {
+		msg = "The state is not known: " + st.Error
+	}
+	if st.LockedBy != "" {
+		msg += "\nChecked out by " + st.LockedBy
+	}
+	if len(st.Modified) > 0 {
+		msg += "\nModified: " + strings.Join(st.Modified, ", ")
+	}
+	if st.Conflict() {
+		msg += "\nConflict: the local changes meet changes on the server."
+	}
+	badge.OnTapped = func() {
+		dialog.ShowInformation("Status", msg, vt.win)
+	}
+	badge.Show()
 }
 
 // toIDs converts []string node IDs into []widget.TreeNodeID
@@ -635,115 +882,6 @@ func (vt *VaultTab) openPath(win fyne.Window, path string) {
 	dialog.ShowInformation("Open", "Open file:\n"+path, win)
 }
 
-// ---------- FS ops (safe-ish) ----------
-
-func renamePath(vt *VaultTab, src, dst string) error {
-	if src == "" || dst == "" {
-		return errors.New("empty path")
-	}
-	if sameFile(src, dst) {
-		return nil
-	}
-	ok, err := localfs.IsEmptyDirectory(src)
-	if err != nil {
-		log.Print("hello3")
-		return err
-	}
-	if ok {
-		return os.Rename(src, dst)
-	}
-	ok, err = localfs.IsContainer(src)
-	if err != nil {
-		log.Print("hello2")
-		return err
-	}
-	if ok {
-		log.Print("hello")
-		return vt.FS.FileRename(src, dst)
-	}
-
-	// No empty, no Container, it must be a directory rename
-	return vt.FS.DirectoryRename(src, dst)
-}
-
-func movePath(src, dst string) error {
-	// Try rename (cheap); if cross-device, fallback to copy+delete.
-	if err := os.Rename(src, dst); err == nil {
-		return nil
-	} else if !isCrossDevice(err) {
-		return err
-	}
-	if err := copyPath(src, dst); err != nil {
-		return err
-	}
-	return os.RemoveAll(src)
-}
-
-func copyPath(src, dst string) error {
-	fi, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
-	if fi.IsDir() {
-		return copyDir(src, dst)
-	}
-	return copyFile(src, dst, fi.Mode())
-}
-
-func copyFile(src, dst string, mode fs.FileMode) error {
-	in, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
-	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
-		return err
-	}
-	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
-	if err != nil {
-		return err
-	}
-	_, cErr := io.Copy(out, in)
-	cErr2 := out.Close()
-	if cErr != nil {
-		return cErr
-	}
-	return cErr2
-}
-
-func copyDir(src, dst string) error {
-	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		rel, _ := filepath.Rel(src, path)
-		target := filepath.Join(dst, rel)
-		if d.IsDir() {
-			return os.MkdirAll(target, 0o755)
-		}
-		info, err := d.Info()
-		if err != nil {
-			return err
-		}
-		return copyFile(path, target, info.Mode())
-	})
-}
-
-func sameFile(a, b string) bool {
-	aa, _ := filepath.Abs(a)
-	bb, _ := filepath.Abs(b)
-	return aa == bb
-}
-
-func isCrossDevice(err error) bool {
-	// crude check: on unix, EXDEV; windows: use message
-	if errors.Is(err, os.ErrInvalid) {
-		return false
-	}
-	msg := err.Error()
-	return strings.Contains(msg, "invalid cross-device link") || strings.Contains(strings.ToLower(msg), "exdev")
-}
-
 // lookupInfo returns FileInfo for a given absolute node id.
 // It first checks the cache, then falls back to listing the parent once.
 func (vt *VaultTab) lookupInfo(abs string) (localfs.FileInfo, bool) {
@@ -762,7 +900,7 @@ func (vt *VaultTab) lookupInfo(abs string) (localfs.FileInfo, bool) {
 		return localfs.FileInfo{}, false
 	}
 	for _, fi := range entries {
-		childAbs := filepath.Join(parentAbs, fi.Name())
+		childAbs := filepath.Join(parentAbs, nodeName(fi))
 		vt.infoCache[childAbs] = fi
 		if childAbs == abs {
 			return fi, true
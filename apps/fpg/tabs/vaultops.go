@@ -0,0 +1,247 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tabs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/client"
+	"github.com/grd/FreePDM/internal/domain/models"
+)
+
+// The file operations of the vault tab run on the server, which enforces
+// the rules of the vault: the access lists, the check-outs and the file
+// index. The local copy follows: it gets the new index and the containers
+// that were added, and the moves are repeated on disk.
+
+// vault returns the name of the vault of the tab
+func (vt *VaultTab) vault() string {
+	return filepath.Base(vt.Root)
+}
+
+// connected tells the user to sign in when the tab has no server
+func (vt *VaultTab) connected(title string) bool {
+	if vt.API == nil || vt.Sync == nil {
+		dialog.ShowInformation(title, "Sign in to the server first, the vault is changed there.", vt.win)
+		return false
+	}
+	return true
+}
+
+// item returns the path of a node on the server, with the container number
+// when it is a container. The server names a container by its file name.
+func (vt *VaultTab) item(abs string) (string, string) {
+	rel := filepath.ToSlash(vt.rel(abs))
+	if fi, ok := vt.lookupInfo(abs); ok && fi.ContainerNumber() != "" {
+		if fl, err := vt.FS.ContainerFileList(fi.ContainerNumber()); err == nil {
+			return path.Join(dirOf(rel), fl.Name), fl.ContainerNumber
+		}
+	}
+	return rel, ""
+}
+
+// dirOf returns the directory of a vault path, "" for the vault root
+func dirOf(rel string) string {
+	return layout.CleanRel(path.Dir(rel))
+}
+
+// destination returns the vault path of a directory that the user entered.
+// The server wants "." for the vault root.
+func destination(dir string) string {
+	if rel := layout.CleanRel(strings.TrimSpace(dir)); rel != "" {
+		return rel
+	}
+	return "."
+}
+
+// runOnServer runs op in the background, op changes the vault on the
+// server. Afterwards the local copy gets the new file index, also when op
+// failed halfway, and the containers of pull, with the new index at hand.
+// At last done is called on success. pull and done can be nil.
+func (vt *VaultTab) runOnServer(op func() error, pull func() []string, done func()) {
+	vault := models.VaultInfo{Name: vt.vault()}
+
+	go func() {
+		err := op()
+		_, indexErr := vt.Sync.PullIndex(vault)
+
+		var list []string
+		fyne.DoAndWait(func() {
+			if indexErr == nil {
+				indexErr = vt.FS.Reread()
+			}
+			if err == nil && indexErr == nil && pull != nil {
+				list = pull()
+			}
+		})
+		if err == nil {
+			err = indexErr
+		}
+		for _, rel := range list {
+			if err != nil {
+				break
+			}
+			_, err = vt.Sync.Pull(vault, rel)
+		}
+
+		fyne.Do(func() {
+			vt.invalidateAll()
+			vt.refreshTree()
+			if err != nil {
+				dialog.ShowError(err, vt.win)
+				return
+			}
+			if done != nil {
+				done()
+			}
+		})
+	}()
+}
+
+// moveLocal repeats a move of the server in the local copy, when the node
+// was pulled before.
+func moveLocal(src, dst string) error {
+	if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// Update fetches the file index and the latest versions of all containers
+// of the vault from the server. done is called afterwards, it can be nil.
+func (vt *VaultTab) Update(done func()) {
+	if !vt.connected("Update") {
+		return
+	}
+	vt.runOnServer(func() error { return nil }, func() []string {
+		var list []string
+		for _, fl := range vt.FS.Items("") {
+			list = append(list, path.Join(fl.Path, fl.ContainerNumber))
+		}
+		return list
+	}, done)
+}
+
+// renameNode renames a container or a directory inside its directory
+func (vt *VaultTab) renameNode(abs, name string) {
+	src, cn := vt.item(abs)
+	if vt.offline() {
+		to := ""
+		if cn == "" {
+			to = path.Join(dirOf(filepath.ToSlash(vt.rel(abs))), name)
+		}
+		vt.queueRename(abs, src, path.Join(dirOf(src), name), to)
+		return
+	}
+	vt.runOnServer(func() error {
+		if _, err := vt.API.Rename(vt.vault(), src, path.Join(dirOf(src), name)); err != nil {
+			return err
+		}
+		if cn != "" {
+			return nil // the directory of a container is its number
+		}
+		return moveLocal(abs, filepath.Join(filepath.Dir(abs), name))
+	}, nil, nil)
+}
+
+// moveNode moves a container or a directory into the directory dir
+func (vt *VaultTab) moveNode(abs, dir string) {
+	src, _ := vt.item(abs)
+	dst := destination(dir)
+	if vt.offline() {
+		vt.queueRename(abs, src, dst, path.Join(layout.CleanRel(dst), filepath.Base(abs)))
+		return
+	}
+	vt.runOnServer(func() error {
+		if _, err := vt.API.Rename(vt.vault(), src, dst); err != nil {
+			return err
+		}
+		return moveLocal(abs, filepath.Join(vt.Root, filepath.FromSlash(layout.CleanRel(dst)), filepath.Base(abs)))
+	}, nil, nil)
+}
+
+// copyNode copies a container, or a directory with its containers, into
+// the directory dir. The copies are new containers that are pulled.
+func (vt *VaultTab) copyNode(abs, dir string) {
+	src, cn := vt.item(abs)
+	var dst string
+	vt.runOnServer(func() (err error) {
+		dst, err = vt.API.Copy(vt.vault(), src, destination(dir))
+		if err == nil && cn == "" {
+			err = os.MkdirAll(filepath.Join(vt.Root, filepath.FromSlash(dst)), 0o755)
+		}
+		return err
+	}, func() []string {
+		if cn != "" {
+			fl, err := vt.FS.GetItem(dirOf(dst), path.Base(dst))
+			if err != nil {
+				return nil
+			}
+			return []string{path.Join(fl.Path, fl.ContainerNumber)}
+		}
+		var list []string
+		for _, fl := range vt.FS.Items(dst) {
+			list = append(list, path.Join(fl.Path, fl.ContainerNumber))
+		}
+		return list
+	}, nil)
+}
+
+// deleteNode removes a container, or an empty directory
+func (vt *VaultTab) deleteNode(abs string) {
+	rel, cn := vt.item(abs)
+	vt.runOnServer(func() error {
+		var err error
+		if cn != "" {
+			_, err = vt.API.Remove(vt.vault(), client.Item{Dir: dirOf(rel), Container: cn})
+		} else {
+			err = vt.API.Rmdir(vt.vault(), dirOf(rel), path.Base(rel))
+		}
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(abs)
+	}, nil, nil)
+}
+
+// allocateIn allocates an empty container in the directory abs and selects it
+func (vt *VaultTab) allocateIn(abs string) {
+	dir := filepath.ToSlash(vt.rel(abs))
+	var cn string
+	vt.runOnServer(func() (err error) {
+		cn, _, err = vt.API.Allocate(vt.vault(), dir, client.AllocateOptions{})
+		return err
+	}, func() []string {
+		return []string{path.Join(dir, cn)}
+	}, func() {
+		vt.tree.OpenBranch(widget.TreeNodeID(abs))
+		vt.tree.Select(widget.TreeNodeID(filepath.Join(abs, cn)))
+	})
+}
+
+// assignName gives an allocated container its file name
+func (vt *VaultTab) assignName(cn, name string) {
+	vt.runOnServer(func() error {
+		return vt.API.Assign(vt.vault(), cn, name)
+	}, func() []string {
+		fl, err := vt.FS.ContainerFileList(cn)
+		if err != nil {
+			return nil
+		}
+		return []string{path.Join(fl.Path, cn)}
+	}, nil)
+}
@@ -21,6 +21,7 @@ import (
 	"fyne.io/fyne/v2/widget"
 
 	"github.com/grd/FreePDM/apps/fpg/cfg"
+	"github.com/grd/FreePDM/apps/fpg/state"
 )
 
 func loadConfig() (*cfg.Cfg, error) {
@@ -35,12 +36,20 @@ func loadConfig() (*cfg.Cfg, error) {
 // Vaults model & filesystem helpers
 // ----------------------------------------------------------------------------
 
-// Vault represents a single vault folder detected under LocalVaultDir.
+// Vault represents a single vault folder detected under LocalVaultDir, or a
+// vault of the server with its local copy there.
 type Vault struct {
 	Name string // folder name
 	Path string // absolute path
 }
 
+// sortVaults sorts alphabetically by name for stable UX
+func sortVaults(list []Vault) {
+	sort.Slice(list, func(i, j int) bool {
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+}
+
 // listVaults returns immediate subdirectories in a given root as vaults,
 // skipping hidden directories that start with a dot.
 func listVaults(root string) ([]Vault, error) {
@@ -74,10 +83,7 @@ func listVaults(root string) ([]Vault, error) {
 		out = append(out, Vault{Name: name, Path: p})
 	}
 
-	// Sort alphabetically by name for stable UX
-	sort.Slice(out, func(i, j int) bool {
-		return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name)
-	})
+	sortVaults(out)
 	return out, nil
 }
 
@@ -105,6 +111,9 @@ type VaultsTab struct {
 	Vaults   []Vault
 	OnOpen   func(v Vault) // callback when "Open Vault" is pressed
 
+	state *state.AppState // lists the vaults of the server once signed in
+	win   fyne.Window
+
 	// internal state
 	selectedIndex int
 	lastSelIdx    int
@@ -120,10 +129,12 @@ type VaultsTab struct {
 }
 
 // NewVaultsTab creates the Vaults tab.
-// - win is used for dialogs.
-// - onOpen is an optional callback invoked when the user presses "Open Vault".
-func NewVaultsTab(win fyne.Window, onOpen func(v Vault)) *VaultsTab {
-	t := &VaultsTab{OnOpen: onOpen, selectedIndex: -1, lastSelIdx: -1}
+//   - win is used for dialogs.
+//   - st lists the vaults of the server when the user signed in, otherwise
+//     the folders under the local vault root are listed.
+//   - onOpen is an optional callback invoked when the user presses "Open Vault".
+func NewVaultsTab(win fyne.Window, st *state.AppState, onOpen func(v Vault)) *VaultsTab {
+	t := &VaultsTab{OnOpen: onOpen, state: st, win: win, selectedIndex: -1, lastSelIdx: -1}
 
 	// Top: Root path controls
 	t.rootEntry = widget.NewEntry()
@@ -296,8 +307,23 @@ func NewVaultsTab(win fyne.Window, onOpen func(v Vault)) *VaultsTab {
 	return t
 }
 
-// reload updates the vault list based on the current RootPath.
+// Reload lists the vaults again, after a login for instance
+func (t *VaultsTab) Reload() {
+	t.reload(t.win)
+}
+
+// reload updates the vault list based on the current RootPath, or on the
+// server when the user signed in.
 func (t *VaultsTab) reload(win fyne.Window) {
+	if t.state != nil && t.state.Connected() {
+		t.reloadServer(win)
+		return
+	}
+	if t.state != nil && t.state.Offline() {
+		t.reloadOffline()
+		return
+	}
+
 	root := strings.TrimSpace(t.RootPath)
 	if root == "" {
 		t.Vaults = nil
@@ -343,3 +369,55 @@ func (t *VaultsTab) reload(win fyne.Window) {
 	t.detailPath.SetText("")
 	t.openBtn.Disable()
 }
+
+// reloadOffline lists the vaults of the last session, with their local
+// copies under RootPath.
+func (t *VaultsTab) reloadOffline() {
+	list := t.state.Vaults()
+	t.Vaults = make([]Vault, len(list))
+	for i, v := range list {
+		t.Vaults[i] = Vault{Name: v.Name, Path: filepath.Join(t.RootPath, v.Name)}
+	}
+	sortVaults(t.Vaults)
+	t.vaultList.Refresh()
+	t.statusLabel.SetText(fmt.Sprintf("Offline, %d vault(s) of the last session.", len(t.Vaults)))
+
+	t.vaultList.UnselectAll()
+	t.selectedIndex = -1
+	t.detailName.SetText("")
+	t.detailPath.SetText("")
+	t.openBtn.Disable()
+}
+
+// reloadServer lists the vaults that the user has access to on the server.
+// Their local copies are under RootPath.
+func (t *VaultsTab) reloadServer(win fyne.Window) {
+	api := t.state.API
+	t.statusLabel.SetText("Loading the vaults of the server…")
+
+	go func() {
+		list, err := api.ListVaults()
+		fyne.Do(func() {
+			if err != nil {
+				t.statusLabel.SetText("")
+				dialog.ShowError(fmt.Errorf("listing the vaults of the server: %w", err), win)
+				return
+			}
+			t.state.SetVaults(list)
+
+			t.Vaults = make([]Vault, len(list))
+			for i, v := range list {
+				t.Vaults[i] = Vault{Name: v.Name, Path: filepath.Join(t.RootPath, v.Name)}
+			}
+			sortVaults(t.Vaults)
+			t.vaultList.Refresh()
+			t.statusLabel.SetText(fmt.Sprintf("%d vault(s) on %s.", len(t.Vaults), api.BaseURL))
+
+			t.vaultList.UnselectAll()
+			t.selectedIndex = -1
+			t.detailName.SetText("")
+			t.detailPath.SetText("")
+			t.openBtn.Disable()
+		})
+	}()
+}
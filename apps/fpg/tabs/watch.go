@@ -0,0 +1,423 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tabs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/grd/FreePDM/internal/client"
+	"github.com/grd/FreePDM/internal/domain/models"
+	"github.com/grd/FreePDM/internal/vault/localfs"
+	"github.com/grd/FreePDM/internal/workspace"
+)
+
+// The tree follows the local copy: a change on disk drops the listing of
+// its directory, and the file index is read again when it changes. The
+// server changes reach the tree the same way: Follow receives the events of
+// the server and ServerEvent pulls them into the local copy.
+
+const (
+	watchSettle = 200 * time.Millisecond // the watcher waits for more changes before the tree is updated
+	followRetry = 10 * time.Second       // before the events of the server are followed again
+)
+
+// treeWatch collects the changes on disk until they settle
+type treeWatch struct {
+	w *fsnotify.Watcher
+
+	mu         sync.Mutex
+	dirs       map[string]bool // abs directories whose entries changed
+	containers map[string]bool // abs containers whose files changed
+	index      bool            // the file index changed
+	locks      bool            // the checked out versions changed
+	timer      *time.Timer
+}
+
+// Watch follows the changes of the local copy and of its file index, and
+// updates the nodes of the tree that changed.
+func (vt *VaultTab) Watch() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	tw := &treeWatch{w: w, dirs: map[string]bool{}, containers: map[string]bool{}}
+	if err := tw.addTree(vt.Root); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Add(vt.FS.DataDir()); err != nil {
+		w.Close()
+		return err
+	}
+	vt.watch = tw
+
+	go vt.watchLoop(tw)
+	return nil
+}
+
+// StopWatching ends Watch, when the tab is closed
+func (vt *VaultTab) StopWatching() {
+	if vt.watch == nil {
+		return
+	}
+	vt.watch.w.Close()
+	vt.watch.mu.Lock()
+	if vt.watch.timer != nil {
+		vt.watch.timer.Stop()
+	}
+	vt.watch.mu.Unlock()
+	vt.watch = nil
+}
+
+// addTree watches a directory and the directories in it
+func (tw *treeWatch) addTree(root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil // removed meanwhile
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return tw.w.Add(p)
+	})
+}
+
+func (vt *VaultTab) watchLoop(tw *treeWatch) {
+	for {
+		select {
+		case ev, ok := <-tw.w.Events:
+			if !ok {
+				return
+			}
+			vt.noteChange(tw, ev)
+		case err, ok := <-tw.w.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("watching %s: %v", vt.Root, err)
+		}
+	}
+}
+
+// noteChange records what a change on disk means for the tree
+func (vt *VaultTab) noteChange(tw *treeWatch, ev fsnotify.Event) {
+	if ev.Has(fsnotify.Chmod) && !ev.Has(fsnotify.Write) {
+		return
+	}
+	structural := ev.Has(fsnotify.Create) || ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename)
+	if ev.Has(fsnotify.Create) {
+		if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+			if err := tw.addTree(ev.Name); err != nil {
+				log.Printf("watching %s: %v", ev.Name, err)
+			}
+		}
+	}
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if filepath.Dir(ev.Name) == vt.FS.DataDir() {
+		switch filepath.Base(ev.Name) {
+		case localfs.LockedFileCsv:
+			tw.locks = true
+		case "FileList.csv":
+			tw.index = true
+		default:
+			return
+		}
+	} else if cn := containerOf(vt.Root, ev.Name); cn != "" && cn != ev.Name {
+		// A file of a container, its node and state can change
+		tw.containers[cn] = true
+		tw.dirs[filepath.Dir(cn)] = true
+	} else if structural {
+		tw.dirs[filepath.Dir(ev.Name)] = true
+	} else {
+		return
+	}
+
+	if tw.timer == nil {
+		tw.timer = time.AfterFunc(watchSettle, func() { vt.applyChanges(tw) })
+	}
+}
+
+// containerOf returns the container directory of a path in the local copy,
+// "" when it is not in a container.
+func containerOf(root, abs string) string {
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	dir := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		if reNumeric.MatchString(part) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// applyChanges updates the tree with the changes that settled
+func (vt *VaultTab) applyChanges(tw *treeWatch) {
+	tw.mu.Lock()
+	dirs, containers, index, locks := tw.dirs, tw.containers, tw.index, tw.locks
+	tw.dirs, tw.containers, tw.index, tw.locks = map[string]bool{}, map[string]bool{}, false, false
+	tw.timer = nil
+	tw.mu.Unlock()
+
+	fyne.Do(func() {
+		if vt.watch != tw {
+			return // stopped
+		}
+		switch {
+		case index:
+			// A fetch of ServerEvent is shown already
+			if vt.rereadIndex() {
+				vt.invalidateAll()
+			}
+		case locks:
+			if err := vt.FS.ReadLockedIndex(); err != nil {
+				log.Printf("reading the check-outs of %s: %v", vt.Root, err)
+			}
+		}
+		for dir := range dirs {
+			vt.invalidate(dir)
+		}
+		vt.tree.Refresh()
+		vt.refreshStatusOf(containers)
+	})
+}
+
+// rereadIndex reads the file index again, unless the tree shows it
+// already, and tells whether it did.
+func (vt *VaultTab) rereadIndex() bool {
+	fi, statErr := os.Stat(filepath.Join(vt.FS.DataDir(), "FileList.csv"))
+	if statErr == nil && fi.ModTime().Equal(vt.indexMod) && fi.Size() == vt.indexSize {
+		return false
+	}
+	if err := vt.FS.Reread(); err != nil {
+		log.Printf("reading the index of %s: %v", vt.Root, err)
+		return true
+	}
+	if statErr == nil {
+		vt.indexMod, vt.indexSize = fi.ModTime(), fi.Size()
+	}
+	return true
+}
+
+// refreshStatusOf compares some containers with the server in the
+// background, instead of the whole vault.
+func (vt *VaultTab) refreshStatusOf(containers map[string]bool) {
+	ws := vt.Workspace
+	if ws == nil || len(containers) == 0 {
+		return
+	}
+	vault := vt.vault()
+	list := make(map[string]string, len(containers))
+	for abs := range containers {
+		list[abs] = filepath.ToSlash(vt.rel(abs))
+	}
+
+	go func() {
+		for abs, rel := range list {
+			st, err := ws.Status(vault, rel)
+			fyne.Do(func() {
+				if vt.statuses == nil {
+					vt.statuses = map[string]workspace.Status{}
+				}
+				if err != nil {
+					delete(vt.statuses, abs)
+				} else {
+					vt.statuses[abs] = st
+				}
+				vt.tree.Refresh()
+			})
+		}
+	}()
+}
+
+// Follow receives the events of the vault from the server, until
+// StopFollowing or the server refuses them. A broken stream is opened
+// again, after the file index is fetched for the events that were missed.
+func (vt *VaultTab) Follow() {
+	vt.StopFollowing()
+	api := vt.API
+	if api == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	vt.unfollow = cancel
+	vault := vt.vault()
+
+	go func() {
+		for {
+			err := api.Events(ctx, []string{vault}, func(ev localfs.Event) {
+				fyne.Do(func() { vt.ServerEvent(ev) })
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			var statusErr *client.StatusError
+			if errors.As(err, &statusErr) && !client.Unreachable(err) {
+				log.Printf("following the events of %s: %v", vault, err)
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(followRetry):
+			}
+			fyne.Do(func() { vt.ServerEvent(localfs.Event{}) })
+		}
+	}()
+}
+
+// StopFollowing ends Follow, when the tab goes offline or is closed
+func (vt *VaultTab) StopFollowing() {
+	if vt.unfollow != nil {
+		vt.unfollow()
+		vt.unfollow = nil
+	}
+}
+
+// serverPull collects the server events for one fetch of the file index
+type serverPull struct {
+	all        bool              // events were missed, the whole tree is read again
+	dirs       map[string]bool   // abs directories whose entries changed
+	containers map[string]bool   // abs containers whose state changed
+	pulls      map[string]string // abs container -> rel, that got new files
+}
+
+// ServerEvent brings a change on the server into the local copy: the file
+// index, with the check-outs, is fetched and the tree shows it. A
+// container that got new files is pulled only when its latest version is
+// in the local copy already and has no local changes, so that the vault is
+// not mirrored and local edits are kept. An empty event only fetches the
+// file index.
+//
+// Only one fetch runs at a time: the events that come meanwhile are
+// collected and fetched together afterwards.
+func (vt *VaultTab) ServerEvent(ev localfs.Event) {
+	if vt.Sync == nil {
+		return
+	}
+	p := vt.pending
+	if p == nil {
+		p = &serverPull{dirs: map[string]bool{}, containers: map[string]bool{}, pulls: map[string]string{}}
+		vt.pending = p
+	}
+
+	if ev.Kind == "" {
+		p.all = true
+	} else {
+		abs := func(rel string) string { return filepath.Join(vt.Root, filepath.FromSlash(rel)) }
+		p.dirs[abs(ev.Path)] = true
+		if ev.OldPath != "" {
+			p.dirs[abs(ev.OldPath)] = true
+		}
+		if ev.ContainerNumber != "" {
+			rel := path.Join(ev.Path, ev.ContainerNumber)
+			p.containers[abs(rel)] = true
+			switch ev.Kind {
+			case localfs.EventImport, localfs.EventAssign, localfs.EventCheckIn:
+				p.pulls[abs(rel)] = rel
+			}
+		}
+	}
+
+	if !vt.pulling {
+		vt.pullPending()
+	}
+}
+
+// pullPending fetches the file index for the collected server events and
+// starts again when more came meanwhile.
+func (vt *VaultTab) pullPending() {
+	p := vt.pending
+	if p == nil || vt.Sync == nil {
+		vt.pulling = false
+		return
+	}
+	vt.pending, vt.pulling = nil, true
+	local, ws, vault := vt.Sync, vt.Workspace, models.VaultInfo{Name: vt.vault()}
+
+	go func() {
+		_, err := local.PullIndex(vault)
+		if err != nil {
+			log.Printf("fetching the index of %s: %v", vault.Name, err)
+		}
+
+		// The tree shows the index before the watcher sees it changed
+		fyne.Do(func() {
+			if err != nil {
+				return
+			}
+			if vt.FS != nil {
+				vt.rereadIndex()
+			}
+			if p.all {
+				vt.invalidateAll()
+			} else {
+				for dir := range p.dirs {
+					vt.invalidate(dir)
+				}
+			}
+			vt.tree.Refresh()
+		})
+
+		if err == nil {
+			for dir, rel := range p.pulls {
+				if !unmodified(ws, vault.Name, rel, dir) {
+					continue
+				}
+				if _, err := local.Pull(vault, rel); err != nil {
+					log.Printf("pulling %s/%s: %v", vault.Name, rel, err)
+				}
+			}
+		}
+
+		fyne.Do(func() {
+			if err == nil {
+				containers := map[string]bool{}
+				for dir := range p.containers {
+					if workspace.IsContainer(dir) {
+						containers[dir] = true
+					}
+				}
+				vt.refreshStatusOf(containers)
+			}
+			vt.pullPending()
+		})
+	}()
+}
+
+// unmodified tells whether a version of the container at rel is in the
+// local copy without changes, so that a pull loses nothing. Without the
+// workspace the changes are not known and it is false.
+func unmodified(ws *workspace.Workspace, vault, rel, dir string) bool {
+	if ws == nil || !workspace.IsContainer(dir) {
+		return false
+	}
+	st, err := ws.Status(vault, rel)
+	return err == nil && st.LocalVersion >= 0 && len(st.Modified) == 0
+}
@@ -53,6 +53,7 @@ func setup() {
 	}
 
 	// Setting vaults and vaultsData
+	config.MustLoad()
 	vaults = config.Conf.VaultsDirectory
 	vaultsData = path.Join(vaults, "/.data")
 
@@ -5,20 +5,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/grd/FreePDM/internal/auth"
+	"github.com/grd/FreePDM/internal/config"
 	"github.com/grd/FreePDM/internal/db"
 	"github.com/grd/FreePDM/internal/logs"
 	"github.com/grd/FreePDM/internal/middleware"
 	"github.com/grd/FreePDM/internal/server"
-	"github.com/grd/FreePDM/internal/shared"
 	"github.com/grd/FreePDM/internal/util"
+	"github.com/grd/FreePDM/internal/vault/dropfolder"
 )
 
 func main() {
+	config.MustLoad()
 	logs.StartLogging()
 
 	dbConn, err := db.InitDB()
@@ -31,8 +40,41 @@ func main() {
 	userRepo := db.NewUserRepo(dbConn)
 	middleware.Init(*userRepo)
 	srv := server.NewServer(userRepo)
+
+	// Single sign-on is optional
+	if cfg, ok := auth.LoadOIDCConfig(); ok {
+		provider, err := auth.NewOIDCProvider(context.Background(), cfg)
+		if err != nil {
+			log.Fatalf("OIDC: %v", err)
+		}
+		srv.OIDC = provider
+		log.Printf("Single sign-on enabled with issuer %s", cfg.Issuer)
+	}
+
 	srv.Routes(mux)
 
+	// The server runs until it gets a signal to stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Import the files that are dropped into the vaults
+	var wg sync.WaitGroup
+	importer, err := dropfolder.New(dropfolder.Options{
+		Root:   config.VaultsDir(),
+		Vaults: config.Conf.DropImport,
+		Allow:  srv.CanImport,
+	})
+	if err != nil {
+		log.Fatalf("Drop folders: %v", err)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := importer.Run(ctx); err != nil {
+			log.Printf("[ERROR] Drop folders: %v", err)
+		}
+	}()
+
 	// Start HTTPS
 	certPath := path.Join("certs", "localhost.pem")
 	keyPath := path.Join("certs", "localhost-key.pem")
@@ -40,14 +82,31 @@ func main() {
 		log.Fatal("HTTPS certification files not found")
 	}
 
+	httpSrv := &http.Server{Handler: mux}
+	httpSrv.RegisterOnShutdown(srv.CloseEvents)
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := httpSrv.Shutdown(shutdown); err != nil {
+			log.Printf("[ERROR] Stopping the server: %v", err)
+		}
+	}()
+
 	if os.Getenv("USE_HTTPS") == "true" {
+		httpSrv.Addr = ":8443"
 		log.Println("Server running with HTTPS on https://localhost:8443")
-		log.Fatal(http.ListenAndServeTLS(":8443", certPath, keyPath, mux))
+		err = httpSrv.ListenAndServeTLS(certPath, keyPath)
 	} else {
+		httpSrv.Addr = ":8080"
 		log.Println("Server running with HTTP on http://localhost:8080")
-		log.Fatal(http.ListenAndServe(":8080", mux))
+		err = httpSrv.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
 	}
 
-	// Periodically search for new files
-	shared.ImportSharedFiles()
+	// Let the import that runs finish
+	wg.Wait()
+	log.Println("Server stopped")
 }
@@ -0,0 +1,168 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/grd/FreePDM/internal/adapters/httpsync"
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/client"
+	"github.com/grd/FreePDM/internal/domain/models"
+	"github.com/grd/FreePDM/internal/shared"
+	"github.com/grd/FreePDM/internal/workspace"
+)
+
+// backend runs the commands, on the server or on the vaults of this machine
+type backend interface {
+	Status(t target) (workspace.Status, error)
+	StatusTree(t target) ([]workspace.Status, error)
+	History(t target) ([]shared.VersionInfo, error)
+	Update(t target) (*versionResult, error)
+	CheckOut(t target, version int16) (*versionResult, error)
+	NewVersion(t target) (*versionResult, error)
+	CheckIn(t target, opts client.CheckInOptions) (*versionResult, error)
+}
+
+// versionResult is the result of the commands that change the versions
+type versionResult struct {
+	Vault     string `json:"vault"`
+	Path      string `json:"path"`
+	Version   int16  `json:"version,omitempty"`
+	Transfers int    `json:"transfers"` // files pulled or pushed
+}
+
+// serverBackend works on the server and keeps the local copy up to date
+type serverBackend struct {
+	api *client.API
+	tr  *httpsync.Transport
+	ws  *workspace.Workspace
+}
+
+func newServerBackend(server, caFile, login, password, root string) (*serverBackend, error) {
+	api, err := client.NewWithOptions(client.Options{BaseURL: server, CAFile: caFile})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", err, errUsage)
+	}
+	if err := api.Login(login, password); err != nil {
+		return nil, err
+	}
+	return &serverBackend{
+		api: api,
+		tr:  httpsync.New(root, api.BaseURL, api.TransferClient()),
+		ws:  workspace.New(root, login, api),
+	}, nil
+}
+
+func (b *serverBackend) Status(t target) (workspace.Status, error) {
+	return b.ws.Status(t.vault, t.rel())
+}
+
+func (b *serverBackend) StatusTree(t target) ([]workspace.Status, error) {
+	return b.ws.StatusTree(t.vault, t.dir)
+}
+
+func (b *serverBackend) History(t target) ([]shared.VersionInfo, error) {
+	return b.api.Versions(t.vault, t.item())
+}
+
+func (b *serverBackend) Update(t target) (*versionResult, error) {
+	rep, err := b.tr.Pull(models.VaultInfo{Name: t.vault}, t.rel())
+	return &versionResult{Vault: t.vault, Path: t.rel(), Transfers: rep.Changed}, err
+}
+
+func (b *serverBackend) CheckOut(t target, version int16) (*versionResult, error) {
+	nr, err := b.api.CheckOut(t.vault, t.item(), version)
+	if err != nil {
+		return nil, err
+	}
+	return b.pull(t, nr)
+}
+
+func (b *serverBackend) NewVersion(t target) (*versionResult, error) {
+	nr, err := b.api.NewVersion(t.vault, t.item())
+	if err != nil {
+		return nil, err
+	}
+	return b.pull(t, nr)
+}
+
+// CheckIn pushes the local changes first, the server accepts them only
+// while the version is checked out.
+func (b *serverBackend) CheckIn(t target, opts client.CheckInOptions) (*versionResult, error) {
+	rep, err := b.tr.Push(models.VaultInfo{Name: t.vault}, t.rel())
+	if err != nil {
+		return nil, err
+	}
+	if opts.References, err = b.ws.References(t.vault, t.rel(), layout.Latest); err != nil {
+		return nil, err
+	}
+	nr, err := b.api.CheckIn(t.vault, t.item(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &versionResult{Vault: t.vault, Path: t.rel(), Version: nr, Transfers: rep.Changed}, nil
+}
+
+func (b *serverBackend) pull(t target, version int16) (*versionResult, error) {
+	res := &versionResult{Vault: t.vault, Path: t.rel(), Version: version}
+	rep, err := b.tr.PullVersion(models.VaultInfo{Name: t.vault}, t.rel(), version)
+	res.Transfers = rep.Changed
+	return res, err
+}
+
+// printText prints the result of a command for humans
+func printText(w io.Writer, out output) {
+	switch res := out.Result.(type) {
+	case workspace.Status:
+		printStatus(w, res)
+	case []workspace.Status:
+		for _, st := range res {
+			printStatus(w, st)
+		}
+	case []shared.VersionInfo:
+		for _, v := range res {
+			line := fmt.Sprintf("%4d  %-10s %s", v.Number, v.Pretty, v.Date)
+			if v.LockedBy != "" {
+				line += "  checked out by " + v.LockedBy
+			}
+			if v.Description != "" {
+				line += "  " + strings.TrimSpace(v.Description)
+			}
+			fmt.Fprintln(w, line)
+		}
+	case *versionResult:
+		switch out.Command {
+		case "update":
+			fmt.Fprintf(w, "%s/%s is up to date, %d files pulled\n", res.Vault, res.Path, res.Transfers)
+		case "checkin":
+			fmt.Fprintf(w, "checked in version %d of %s/%s, %d files pushed\n", res.Version, res.Vault, res.Path, res.Transfers)
+		case "checkout":
+			fmt.Fprintf(w, "checked out version %d of %s/%s\n", res.Version, res.Vault, res.Path)
+		case "newversion":
+			fmt.Fprintf(w, "created version %d of %s/%s, it is checked out\n", res.Version, res.Vault, res.Path)
+		}
+	}
+}
+
+func printStatus(w io.Writer, st workspace.Status) {
+	if st.Error != "" {
+		fmt.Fprintf(w, "%-12s %s/%s  %s\n", "unknown", st.Vault, st.Path, st.Error)
+		return
+	}
+	line := fmt.Sprintf("%-12s %s/%s  local %d, server %d", st.State, st.Vault, st.Path, st.LocalVersion, st.ServerVersion)
+	if st.LockedBy != "" {
+		line += ", checked out by " + st.LockedBy
+	}
+	if st.Conflict() {
+		line += ", CONFLICT"
+	}
+	fmt.Fprintln(w, line)
+	for _, name := range st.Modified {
+		fmt.Fprintln(w, "    modified:", name)
+	}
+}
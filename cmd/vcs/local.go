@@ -0,0 +1,151 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/grd/FreePDM/internal/client"
+	"github.com/grd/FreePDM/internal/shared"
+	vfs "github.com/grd/FreePDM/internal/vault/localfs"
+	"github.com/grd/FreePDM/internal/workspace"
+)
+
+// localBackend works directly on the vaults of this machine, there is no
+// local copy to keep up to date.
+type localBackend struct {
+	user string
+	root string // the vaults directory
+}
+
+func (b *localBackend) workspace() *workspace.Workspace {
+	return workspace.New(b.root, b.user, workspace.DiskRemote{Root: b.root})
+}
+
+func (b *localBackend) Status(t target) (workspace.Status, error) {
+	return b.workspace().Status(t.vault, t.rel())
+}
+
+func (b *localBackend) StatusTree(t target) ([]workspace.Status, error) {
+	return b.workspace().StatusTree(t.vault, t.dir)
+}
+
+// container opens the vault and returns the container with its versions
+func (b *localBackend) container(t target) (*vfs.FileSystem, vfs.FileList, []vfs.FileVersion, error) {
+	fs, err := vfs.NewFileSystem(t.vault, b.user)
+	if err != nil {
+		return nil, vfs.FileList{}, nil, err
+	}
+	fl, err := fs.ContainerFileList(t.container)
+	if err != nil {
+		return nil, fl, nil, fmt.Errorf("container %s: %w", t.container, os.ErrNotExist)
+	}
+	versions, err := fs.Versions(fl)
+	return fs, fl, versions, err
+}
+
+func (b *localBackend) History(t target) ([]shared.VersionInfo, error) {
+	fs, fl, versions, err := b.container(t)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]shared.VersionInfo, 0, len(versions))
+	for _, v := range versions {
+		list = append(list, shared.VersionInfo{Number: v.Number, Pretty: v.Pretty, Date: v.Date,
+			LockedBy: fs.IsLocked(t.container, v), Description: fs.VersionDescription(fl, v)})
+	}
+	return list, nil
+}
+
+// Update does nothing, the vaults are the local copy
+func (b *localBackend) Update(t target) (*versionResult, error) {
+	return &versionResult{Vault: t.vault, Path: t.rel()}, nil
+}
+
+func (b *localBackend) CheckOut(t target, version int16) (*versionResult, error) {
+	fs, fl, versions, err := b.container(t)
+	if err != nil {
+		return nil, err
+	}
+	v, err := findVersion(versions, version)
+	if err != nil {
+		return nil, err
+	}
+	if by := fs.IsLocked(t.container, v); by != "" {
+		return nil, fmt.Errorf("version %d of %s is checked out by %s: %w", v.Number, fl.Name, by, errConflict)
+	}
+	if err := fs.CheckOut(fl, v); err != nil {
+		return nil, err
+	}
+	return &versionResult{Vault: t.vault, Path: t.rel(), Version: v.Number}, nil
+}
+
+func (b *localBackend) NewVersion(t target) (*versionResult, error) {
+	fs, fl, _, err := b.container(t)
+	if err != nil {
+		return nil, err
+	}
+	if by := fs.IsLockedItem(t.container); by != "" {
+		return nil, fmt.Errorf("%s is checked out by %s: %w", fl.Name, by, errConflict)
+	}
+	v, err := fs.NewVersion(fl)
+	if err != nil {
+		return nil, err
+	}
+	return &versionResult{Vault: t.vault, Path: t.rel(), Version: v.Number}, nil
+}
+
+func (b *localBackend) CheckIn(t target, opts client.CheckInOptions) (*versionResult, error) {
+	fs, fl, versions, err := b.container(t)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		if fs.IsLocked(t.container, v) == b.user {
+			if err := fs.UpdateProperties(fl, v, opts.Properties); err != nil {
+				return nil, err
+			}
+			if err := b.setReferences(fs, fl, v, t); err != nil {
+				return nil, err
+			}
+			if err := fs.CheckIn(fl, v, opts.Description, opts.LongDescription); err != nil {
+				return nil, err
+			}
+			return &versionResult{Vault: t.vault, Path: t.rel(), Version: v.Number}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not checked out by %s: %w", fl.Name, b.user, errConflict)
+}
+
+// setReferences stores the containers that the FreeCAD documents of the
+// checked out version link to
+func (b *localBackend) setReferences(fs *vfs.FileSystem, fl vfs.FileList, v vfs.FileVersion, t target) error {
+	list, err := b.workspace().References(t.vault, t.rel(), v.Number)
+	if err != nil || list == nil {
+		return err
+	}
+	refs := make([]vfs.FileReference, len(list))
+	for i, ref := range list {
+		refs[i] = vfs.FileReference{Vault: ref.Vault, ContainerNumber: ref.Container, Version: ref.Version}
+	}
+	return fs.SetReferences(fl, v, refs)
+}
+
+// findVersion returns a version, the latest one when the number is negative
+func findVersion(versions []vfs.FileVersion, number int16) (vfs.FileVersion, error) {
+	if len(versions) == 0 {
+		return vfs.FileVersion{}, fmt.Errorf("no versions: %w", os.ErrNotExist)
+	}
+	if number < 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, v := range versions {
+		if v.Number == number {
+			return v, nil
+		}
+	}
+	return vfs.FileVersion{}, fmt.Errorf("version %d: %w", number, os.ErrNotExist)
+}
@@ -0,0 +1,348 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/grd/FreePDM/internal/adapters/httpsync"
+	"github.com/grd/FreePDM/internal/client"
+	"github.com/grd/FreePDM/internal/config"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/workspace"
+)
+
+// The vcs tool works on the files of the vaults from the command line, for
+// scripts and CI. It talks to the server and keeps a local copy of the
+// vaults, or works on the vaults of this machine in local mode.
+
+// Exit codes, one per class of failure
+const (
+	exitOK        = 0
+	exitError     = 1 // any other failure
+	exitUsage     = 2
+	exitAuth      = 3 // the login failed
+	exitForbidden = 4 // the access control list denies it
+	exitConflict  = 5 // the version is checked out by someone else, or not by you
+	exitNotFound  = 6 // no such file, container or version
+	exitNetwork   = 7 // the server is not reachable
+)
+
+var (
+	errUsage    = errors.New("usage")
+	errConflict = errors.New("conflict")
+)
+
+const usage = `Usage: vcs [flags] <command> <file> [flags]
+
+Commands:
+  status      the state of a container, or of all containers in a directory
+  history     the versions of a container
+  update      pulls the latest version of a container and its references
+  checkout    checks out a version, -version N or the latest one, and pulls it
+  newversion  creates a new version, which is checked out, and pulls it
+  checkin     pushes the local changes and checks in, -m and -long describe them,
+              -volume and -material go with the model
+
+Flags:
+`
+
+// output is what vcs prints with -json
+type output struct {
+	Command  string `json:"command"`
+	File     string `json:"file"`
+	Result   any    `json:"result,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Class    string `json:"class,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// options are the flags and the arguments of a vcs command
+type options struct {
+	json    bool
+	server  string
+	caFile  string
+	login   string
+	root    string
+	local   bool
+	command string
+	file    string
+	version int16
+	checkIn client.CheckInOptions
+}
+
+func main() {
+	opts, flags, err := parseArgs(os.Args[1:])
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "vcs:", err)
+		}
+		flags.Usage()
+		os.Exit(exitUsage)
+	}
+
+	out := output{Command: opts.command, File: opts.file}
+	result, err := run(opts)
+	out.Result = result
+	out.ExitCode = exitCode(err)
+	if err != nil {
+		out.Error = err.Error()
+		out.Class = className(out.ExitCode)
+	}
+
+	if opts.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(out)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "vcs:", err)
+		if errors.Is(err, errUsage) {
+			flags.Usage()
+		}
+	} else {
+		printText(os.Stdout, out)
+	}
+	os.Exit(out.ExitCode)
+}
+
+func envOr(key, value string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return value
+}
+
+// parseArgs reads the flags and the command with its file. The flags may
+// come before and after the command and the file, "--" ends them.
+func parseArgs(args []string) (*options, *flag.FlagSet, error) {
+	me := ""
+	if u, err := user.Current(); err == nil {
+		me = u.Username
+	}
+
+	opts := &options{}
+	flags := flag.NewFlagSet("vcs", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.BoolVar(&opts.json, "json", false, "machine-readable output")
+	flags.StringVar(&opts.server, "server", os.Getenv("FREEPDM_SERVER"), "URL of the server, $FREEPDM_SERVER")
+	flags.StringVar(&opts.login, "user", envOr("FREEPDM_USER", me), "login name, $FREEPDM_USER; the password is $FREEPDM_PASSWORD")
+	flags.StringVar(&opts.caFile, "ca", os.Getenv("FREEPDM_CA"), "PEM file of the certificate authority of the server, $FREEPDM_CA")
+	flags.StringVar(&opts.root, "root", os.Getenv("FREEPDM_LOCAL_ROOT"), "the local copy of the vaults, $FREEPDM_LOCAL_ROOT")
+	flags.BoolVar(&opts.local, "local", false, "work on the vaults of this machine instead of the server")
+	descr := flags.String("m", "", "description of the check in")
+	longDescr := flags.String("long", "", "long description of the check in")
+	volume := flags.String("volume", "", `volume of the model at the check in, like "12500 mm^3"`)
+	material := flags.String("material", "", "material of the model at the check in")
+	version := flags.Int("version", -1, "version to check out, the latest when negative")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.SetOutput(os.Stderr)
+		flags.PrintDefaults()
+		flags.SetOutput(io.Discard)
+	}
+
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, flags, err
+		}
+		rest := flags.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	switch len(positional) {
+	case 0:
+		return nil, flags, fmt.Errorf("no command: %w", errUsage)
+	case 2:
+		opts.command, opts.file = positional[0], positional[1]
+	default:
+		return nil, flags, fmt.Errorf("%s needs one file: %w", positional[0], errUsage)
+	}
+	if *version > math.MaxInt16 {
+		return nil, flags, fmt.Errorf("version %d: %w", *version, errUsage)
+	}
+	opts.version = int16(max(*version, -1))
+
+	opts.checkIn = client.CheckInOptions{Description: *descr, LongDescription: *longDescr}
+	if *volume != "" {
+		if _, _, err := db.ParseVolume(*volume); err != nil {
+			return nil, flags, fmt.Errorf("%w: %w", err, errUsage)
+		}
+		opts.checkIn.Properties = map[string]string{db.PropertyVolume: *volume}
+	}
+	if *material != "" {
+		if opts.checkIn.Properties == nil {
+			opts.checkIn.Properties = map[string]string{}
+		}
+		opts.checkIn.Properties[db.PropertyMaterial] = *material
+	}
+	return opts, flags, nil
+}
+
+// run executes a command and returns its result
+func run(opts *options) (any, error) {
+	root := opts.root
+	var b backend
+	if opts.local {
+		// Only the vaults of this machine need the config of FREEPDM_DIR
+		if err := config.Load(); err != nil {
+			return nil, err
+		}
+		root = config.VaultsDir()
+		b = &localBackend{user: opts.login, root: root}
+	} else {
+		if opts.server == "" || root == "" {
+			return nil, fmt.Errorf("set the server and the local copy with -server and -root: %w", errUsage)
+		}
+		sb, err := newServerBackend(opts.server, opts.caFile, opts.login, os.Getenv("FREEPDM_PASSWORD"), root)
+		if err != nil {
+			return nil, err
+		}
+		b = sb
+	}
+	return runCommand(b, root, opts)
+}
+
+// runCommand runs the command on the file with a backend
+func runCommand(b backend, root string, opts *options) (any, error) {
+	t, err := resolve(root, opts.file)
+	if opts.command == "status" && errors.Is(err, workspace.ErrNoContainer) {
+		return b.StatusTree(t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.command {
+	case "status":
+		return b.Status(t)
+	case "history":
+		return b.History(t)
+	case "update":
+		return b.Update(t)
+	case "checkout":
+		return b.CheckOut(t, opts.version)
+	case "newversion":
+		return b.NewVersion(t)
+	case "checkin":
+		return b.CheckIn(t, opts.checkIn)
+	}
+	return nil, fmt.Errorf("unknown command %s: %w", opts.command, errUsage)
+}
+
+// target is the container of a file of the local copy
+type target struct {
+	vault     string
+	dir       string // of the container inside the vault
+	container string
+}
+
+func (t target) rel() string {
+	return path.Join(t.dir, t.container)
+}
+
+func (t target) item() client.Item {
+	return client.Item{Dir: t.dir, Container: t.container}
+}
+
+// resolve finds the vault and the container of a file, the closest
+// directory with a VER.txt. Without a container the target is the
+// directory and the error is ErrNoContainer.
+func resolve(root, file string) (target, error) {
+	root, _ = filepath.Abs(root)
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return target{}, err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return target{}, fmt.Errorf("%s is not in the vaults at %s: %w", file, root, os.ErrNotExist)
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := len(parts); i > 1; i-- {
+		if workspace.IsContainer(filepath.Join(root, filepath.Join(parts[:i]...))) {
+			return target{vault: parts[0], dir: path.Join(parts[1 : i-1]...), container: parts[i-1]}, nil
+		}
+	}
+	if _, err := os.Stat(abs); err != nil {
+		return target{}, err
+	}
+	return target{vault: parts[0], dir: path.Join(parts[1:]...)}, fmt.Errorf("%s: %w", file, workspace.ErrNoContainer)
+}
+
+// exitCode classifies an error
+func exitCode(err error) int {
+	var status *client.StatusError
+	var netErr net.Error
+	var urlErr *url.Error
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.As(err, &status):
+		switch status.Code {
+		case http.StatusUnauthorized:
+			return exitAuth
+		case http.StatusForbidden:
+			return exitForbidden
+		case http.StatusConflict:
+			return exitConflict
+		case http.StatusNotFound:
+			return exitNotFound
+		}
+		return exitError
+	case errors.Is(err, client.ErrTwoFactor):
+		return exitAuth
+	case errors.Is(err, errConflict):
+		return exitConflict
+	case errors.Is(err, workspace.ErrNoContainer), errors.Is(err, os.ErrNotExist), errors.Is(err, httpsync.ErrNotFound):
+		return exitNotFound
+	case errors.As(err, &urlErr), errors.As(err, &netErr):
+		return exitNetwork
+	}
+	return exitError
+}
+
+func className(code int) string {
+	switch code {
+	case exitUsage:
+		return "usage"
+	case exitAuth:
+		return "auth"
+	case exitForbidden:
+		return "forbidden"
+	case exitConflict:
+		return "conflict"
+	case exitNotFound:
+		return "not-found"
+	case exitNetwork:
+		return "network"
+	}
+	return "error"
+}
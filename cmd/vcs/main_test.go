@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grd/FreePDM/internal/adapters/httpsync"
+	"github.com/grd/FreePDM/internal/client"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/shared"
+	"github.com/grd/FreePDM/internal/workspace"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Setenv("FREEPDM_SERVER", "https://pdm.example.com")
+
+	tests := []struct {
+		args    []string
+		command string
+		file    string
+		json    bool
+		descr   string
+		version int16
+	}{
+		{args: []string{"status", "a.FCStd"}, command: "status", file: "a.FCStd", version: -1},
+		{args: []string{"-json", "checkin", "-m", "thicker", "a.FCStd"}, command: "checkin", file: "a.FCStd", json: true, descr: "thicker", version: -1},
+		{args: []string{"checkin", "a.FCStd", "-m", "thicker", "-json"}, command: "checkin", file: "a.FCStd", json: true, descr: "thicker", version: -1},
+		{args: []string{"checkout", "a.FCStd", "-version", "3"}, command: "checkout", file: "a.FCStd", version: 3},
+		{args: []string{"status", "--", "-a.FCStd"}, command: "status", file: "-a.FCStd", version: -1},
+	}
+	for _, tt := range tests {
+		opts, _, err := parseArgs(tt.args)
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if opts.command != tt.command || opts.file != tt.file || opts.json != tt.json ||
+			opts.checkIn.Description != tt.descr || opts.version != tt.version {
+			t.Errorf("%q: got %+v", tt.args, opts)
+		}
+		if opts.server != "https://pdm.example.com" {
+			t.Errorf("%q: server %q from the environment is lost", tt.args, opts.server)
+		}
+	}
+
+	opts, _, err := parseArgs([]string{"checkin", "a.FCStd", "-volume", "12 cm^3", "-material", "Steel"})
+	if err != nil || opts.checkIn.Properties[db.PropertyVolume] != "12 cm^3" || opts.checkIn.Properties[db.PropertyMaterial] != "Steel" {
+		t.Errorf("check in properties = %+v, %v", opts, err)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"status"},
+		{"status", "a.FCStd", "b.FCStd"},
+		{"checkin", "a.FCStd", "-volume", "twelve"},
+		{"checkout", "a.FCStd", "-version", "70000"},
+	} {
+		if _, _, err := parseArgs(args); !errors.Is(err, errUsage) {
+			t.Errorf("%q: %v, want a usage error", args, err)
+		}
+	}
+	if _, _, err := parseArgs([]string{"status", "a.FCStd", "-nosuchflag"}); err == nil {
+		t.Error("an unknown flag is accepted")
+	}
+}
+
+func write(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, "main/parts/7/VER.txt"), "Version:Pretty:Date\n0:0:d\n")
+	write(t, filepath.Join(root, "main/parts/7/0/bracket.FCStd"), "part")
+
+	got, err := resolve(root, filepath.Join(root, "main/parts/7/0/bracket.FCStd"))
+	if err != nil || got != (target{vault: "main", dir: "parts", container: "7"}) {
+		t.Errorf("resolve of a file = %+v, %v", got, err)
+	}
+	got, err = resolve(root, filepath.Join(root, "main/parts"))
+	if !errors.Is(err, workspace.ErrNoContainer) || got != (target{vault: "main", dir: "parts"}) {
+		t.Errorf("resolve of a directory = %+v, %v", got, err)
+	}
+	if _, err := resolve(root, t.TempDir()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("resolve outside the root: %v", err)
+	}
+}
+
+// fakeServer answers the commands of the server backend: the versions of
+// container 7, a check out of 8 that someone else has and the check in
+// of 7.
+func fakeServer(checkIns *[]map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/command":
+			var req shared.CommandRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			var resp shared.CommandResponse
+			switch {
+			case req.Command == "versions":
+				resp.Data = []string{
+					shared.VersionInfo{Number: 0, Pretty: "0", Date: "d"}.String(),
+					shared.VersionInfo{Number: 1, Pretty: "1", Date: "d", LockedBy: "me"}.String(),
+				}
+			case req.Command == "checkout" && req.Params["container"] == "8":
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]string{"error": "checked out by other"})
+				return
+			case req.Command == "checkin":
+				*checkIns = append(*checkIns, req.Params)
+				resp.Data = []string{"1"}
+			default:
+				resp.Error = "unexpected command " + req.Command
+			}
+			json.NewEncoder(w).Encode(resp)
+		case strings.HasPrefix(r.URL.Path, "/api/status/"):
+			json.NewEncoder(w).Encode(workspace.Container{
+				Versions: []workspace.Version{{Number: 0, Pretty: "0"}, {Number: 1, Pretty: "1"}},
+				Locks:    []workspace.Lock{{Version: 1, User: "me"}},
+				Files:    map[string]string{},
+			})
+		case strings.HasSuffix(r.URL.Path, "/files"):
+			w.Write([]byte("[]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestServerBackend(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, "main/parts/7/VER.txt"), "Version:Pretty:Date\n0:0:d\n1:1:d\n")
+	write(t, filepath.Join(root, "main/parts/8/VER.txt"), "Version:Pretty:Date\n0:0:d\n")
+	if err := os.MkdirAll(filepath.Join(root, "main/parts/7/1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var checkIns []map[string]string
+	srv := fakeServer(&checkIns)
+	defer srv.Close()
+
+	api := client.New(srv.URL)
+	b := &serverBackend{api: api, tr: httpsync.New(root, srv.URL, srv.Client()), ws: workspace.New(root, "me", api)}
+	opts := func(command, file string) *options {
+		return &options{command: command, file: filepath.Join(root, file), version: -1}
+	}
+
+	res, err := runCommand(b, root, opts("history", "main/parts/7"))
+	if list, ok := res.([]shared.VersionInfo); err != nil || !ok || len(list) != 2 || list[1].LockedBy != "me" {
+		t.Errorf("history = %+v, %v", res, err)
+	}
+
+	res, err = runCommand(b, root, opts("status", "main/parts/7"))
+	if st, ok := res.(workspace.Status); err != nil || !ok || st.State != workspace.CheckedOutByMe {
+		t.Errorf("status = %+v, %v", res, err)
+	}
+
+	_, err = runCommand(b, root, opts("checkout", "main/parts/8"))
+	if code := exitCode(err); code != exitConflict {
+		t.Errorf("check out of a locked version: exit code %d (%v), want %d", code, err, exitConflict)
+	}
+
+	checkIn := opts("checkin", "main/parts/7")
+	checkIn.checkIn = client.CheckInOptions{Description: "thicker"}
+	res, err = runCommand(b, root, checkIn)
+	if r, ok := res.(*versionResult); err != nil || !ok || r.Version != 1 {
+		t.Errorf("checkin = %+v, %v", res, err)
+	}
+	if len(checkIns) != 1 || checkIns[0]["description"] != "thicker" || checkIns[0]["container"] != "7" {
+		t.Errorf("checked in with %v", checkIns)
+	}
+
+	if _, err := runCommand(b, root, opts("status", "main/nosuchdir")); exitCode(err) != exitNotFound {
+		t.Errorf("status of a missing directory: %v", err)
+	}
+}
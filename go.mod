@@ -5,16 +5,17 @@ go 1.25.1
 require (
 	fyne.io/fyne/v2 v2.6.3
 	github.com/BurntSushi/toml v1.4.0
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/stretchr/testify v1.10.0
 	golang.org/x/exp v0.0.0-20230905200255-921286631fa9
 	gorm.io/driver/postgres v1.5.11
 	gorm.io/gorm v1.25.12
+	rsc.io/qr v0.2.0
 )
 
 require (
 	fyne.io/systray v1.11.0 // indirect
 	github.com/fredbi/uri v1.1.0 // indirect
-	github.com/fsnotify/fsnotify v1.9.0 // indirect
 	github.com/fyne-io/gl-js v0.2.0 // indirect
 	github.com/fyne-io/glfw-js v0.3.0 // indirect
 	github.com/fyne-io/image v0.1.1 // indirect
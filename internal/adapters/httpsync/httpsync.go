@@ -0,0 +1,469 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package httpsync implements the sync.Transport port over the HTTPS API
+// of the server, for clients without rsync or SSH. The sync handlers of
+// the server are the other side. Files go as a delta
+// against the copy on the other side, see the delta package. A pull
+// fetches the same containers as the rsync transport does, a push uploads
+// the changed files of the versions that the user checked out.
+package httpsync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/delta"
+	"github.com/grd/FreePDM/internal/domain/models"
+	"github.com/grd/FreePDM/internal/ports/sync"
+)
+
+// Latest selects the latest version of a container
+const Latest = layout.Latest
+
+// File is a file of a vault directory, the reply of the listing
+type File struct {
+	Path string `json:"path"` // relative to the listed directory
+	Size int64  `json:"size"`
+	Hash string `json:"hash"` // SHA-256, hexadecimal
+}
+
+// Upload is the state of an upload to the server
+type Upload struct {
+	Offset int64  `json:"offset"` // the data that the server has
+	Hash   string `json:"hash,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+var (
+	ErrReadOnly = errors.New("the vault is read-only")
+	ErrNotFound = errors.New("not found on the server")
+)
+
+// Transport syncs containers between the server and the local copy of the
+// vaults.
+type Transport struct {
+	LocalRoot string        // the local copy of the vaults
+	HTTP      *http.Client  // with the session of the user, http.DefaultClient when nil
+	Timeout   time.Duration // of one operation, none when zero
+	Retries   int           // resumes of an interrupted file
+
+	base string
+}
+
+var _ sync.LocalCopy = (*Transport)(nil)
+
+// Constructor
+func New(localRoot, baseURL string, client *http.Client) *Transport {
+	return &Transport{LocalRoot: localRoot, HTTP: client, Retries: 3, base: strings.TrimSuffix(baseURL, "/")}
+}
+
+// SetTarget sets the URL of the server, "https://pdm.example.com"
+func (t *Transport) SetTarget(target string) {
+	t.base = strings.TrimSuffix(target, "/")
+}
+
+// SetSSHOptions does nothing, the transport does not use SSH
+func (t *Transport) SetSSHOptions(sync.SSHOptions) {}
+
+// Pull fetches the container at rel with its latest version, and the
+// versions of the containers it refers to, into the local copy.
+func (t *Transport) Pull(vault models.VaultInfo, rel string) (sync.Report, error) {
+	return t.PullVersion(vault, rel, Latest)
+}
+
+// PullVersion fetches a version of the container at rel and its references
+func (t *Transport) PullVersion(vault models.VaultInfo, rel string, version int16) (sync.Report, error) {
+	ctx, cancel := t.context()
+	defer cancel()
+
+	rep := sync.Report{StartedAt: time.Now()}
+	logf := func(format string, args ...any) {
+		rep.Log = append(rep.Log, fmt.Sprintf(format, args...))
+	}
+	err := layout.Pull(ctx, fetcher{t: t, rep: &rep}, t.LocalRoot, vault.Name, rel, version, logf)
+	rep.EndedAt = time.Now()
+	return rep, err
+}
+
+// PullIndex fetches the file index of a vault, after the containers were
+// renamed, moved or added on the server.
+func (t *Transport) PullIndex(vault models.VaultInfo) (sync.Report, error) {
+	ctx, cancel := t.context()
+	defer cancel()
+
+	rep := sync.Report{StartedAt: time.Now()}
+	err := fetcher{t: t, rep: &rep}.FetchIndex(ctx, vault.Name)
+	rep.EndedAt = time.Now()
+	return rep, err
+}
+
+// Push uploads the changed files of the container at srcRel. The files of
+// the container itself, like VER.txt, belong to the server and stay.
+func (t *Transport) Push(vault models.VaultInfo, srcRel string) (sync.Report, error) {
+	return t.push(vault, srcRel, false)
+}
+
+// DryRunPush reports what Push would upload
+func (t *Transport) DryRunPush(vault models.VaultInfo, srcRel string) (sync.Report, error) {
+	return t.push(vault, srcRel, true)
+}
+
+func (t *Transport) push(vault models.VaultInfo, srcRel string, dryRun bool) (sync.Report, error) {
+	rep := sync.Report{StartedAt: time.Now()}
+	if vault.ReadOnly {
+		rep.EndedAt = rep.StartedAt
+		return rep, ErrReadOnly
+	}
+
+	ctx, cancel := t.context()
+	defer cancel()
+
+	err := t.pushDir(ctx, &rep, vault.Name, layout.CleanRel(srcRel), dryRun)
+	rep.EndedAt = time.Now()
+	return rep, err
+}
+
+func (t *Transport) pushDir(ctx context.Context, rep *sync.Report, vault, rel string, dryRun bool) error {
+	dir := t.local(vault, rel)
+	_, err := os.Stat(filepath.Join(dir, layout.VersionFile))
+	container := err == nil
+
+	remote, err := t.list(ctx, vault, rel, false, false)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	hashes := make(map[string]string, len(remote))
+	for _, f := range remote {
+		hashes[f.Path] = f.Hash
+	}
+
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(p, layout.PartSuffix) {
+			return err
+		}
+		name, _ := filepath.Rel(dir, p)
+		name = filepath.ToSlash(name)
+		if container && !strings.Contains(name, "/") {
+			return nil
+		}
+
+		hash, size, err := delta.HashFile(p)
+		if err != nil || hashes[name] == hash {
+			return err
+		}
+		file := path.Join(rel, name)
+		if dryRun {
+			rep.Changed++
+			rep.Bytes += size
+			rep.Log = append(rep.Log, "push "+path.Join(vault, file))
+			return nil
+		}
+		return t.pushFile(ctx, rep, vault, file, p, hash)
+	})
+}
+
+func (t *Transport) context() (context.Context, context.CancelFunc) {
+	if t.Timeout > 0 {
+		return context.WithTimeout(context.Background(), t.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (t *Transport) local(elem ...string) string {
+	return filepath.Join(append([]string{t.LocalRoot}, elem...)...)
+}
+
+func (t *Transport) client() *http.Client {
+	if t.HTTP == nil {
+		return http.DefaultClient
+	}
+	return t.HTTP
+}
+
+// url is an endpoint of the sync API of a vault
+func (t *Transport) url(vault, endpoint string, query url.Values) string {
+	return t.base + "/api/sync/" + url.PathEscape(vault) + "/" + endpoint + "?" + query.Encode()
+}
+
+func (t *Transport) do(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return t.client().Do(req)
+}
+
+// responseError is the error of a reply that is not OK
+func responseError(resp *http.Response, what string) error {
+	var reply struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&reply)
+	if reply.Error == "" {
+		reply.Error = resp.Status
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", what, ErrNotFound)
+	}
+	return fmt.Errorf("%s: %s", what, reply.Error)
+}
+
+// list returns the files of a directory of a vault, or of its data
+// directory, with their hashes.
+func (t *Transport) list(ctx context.Context, vault, rel string, data, shallow bool) ([]File, error) {
+	query := url.Values{"path": {rel}}
+	if data {
+		query.Set("data", "1")
+	}
+	if shallow {
+		query.Set("shallow", "1")
+	}
+
+	resp, err := t.do(ctx, http.MethodGet, t.url(vault, "files", query), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp, path.Join(vault, rel))
+	}
+
+	var files []File
+	if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		return nil, fmt.Errorf("%s: %w", path.Join(vault, rel), err)
+	}
+	return files, nil
+}
+
+// fetcher fetches the directories of a pull, the files that differ
+type fetcher struct {
+	t   *Transport
+	rep *sync.Report
+}
+
+func (f fetcher) FetchDir(ctx context.Context, vault, rel string, shallow bool) error {
+	return f.fetch(ctx, vault, rel, false, shallow, f.t.local(vault, rel))
+}
+
+func (f fetcher) FetchIndex(ctx context.Context, vault string) error {
+	return f.fetch(ctx, vault, "", true, false, f.t.local(layout.DataDir, vault))
+}
+
+func (f fetcher) fetch(ctx context.Context, vault, rel string, data, shallow bool, dir string) error {
+	files, err := f.t.list(ctx, vault, rel, data, shallow)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		local := filepath.Join(dir, filepath.FromSlash(file.Path))
+		if delta.Equal(local, file.Hash) {
+			continue
+		}
+		if err := f.t.pullFile(ctx, f.rep, vault, path.Join(rel, file.Path), data, local); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pullFile fetches a file as a delta against the local copy. The new file
+// is written next to it and replaces it when the hash is right. A part
+// that an interrupted pull left behind is resumed.
+func (t *Transport) pullFile(ctx context.Context, rep *sync.Report, vault, file string, data bool, local string) error {
+	part := local + layout.PartSuffix
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, offset, err := t.pullDelta(ctx, vault, file, data, local, part)
+		if err == nil {
+			if err = delta.Verify(part, res); err != nil {
+				// A part of an older file, start all over
+				os.Remove(part)
+				if offset > 0 {
+					continue
+				}
+			}
+		}
+		if err != nil {
+			if attempt < t.Retries && ctx.Err() == nil && !errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return fmt.Errorf("pull %s: %w", path.Join(vault, file), err)
+		}
+
+		if err := os.Rename(part, local); err != nil {
+			return err
+		}
+		rep.Changed++
+		rep.Bytes += res.Literal
+		rep.Log = append(rep.Log, fmt.Sprintf("pull %s (%d of %d bytes sent)", path.Join(vault, file), res.Literal, res.Size))
+		return nil
+	}
+}
+
+// pullDelta requests the delta of a file from the end of the part on, and
+// appends it to the part.
+func (t *Transport) pullDelta(ctx context.Context, vault, file string, data bool, local, part string) (delta.Result, int64, error) {
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	sig, err := delta.FileSignature(local, delta.DefaultBlockSize)
+	if err != nil {
+		return delta.Result{}, offset, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := sig.WriteTo(pw)
+		pw.CloseWithError(err)
+	}()
+
+	query := url.Values{"file": {file}, "offset": {strconv.FormatInt(offset, 10)}}
+	if data {
+		query.Set("data", "1")
+	}
+	resp, err := t.do(ctx, http.MethodPost, t.url(vault, "delta", query), pr)
+	if err != nil {
+		return delta.Result{}, offset, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The file on the server is shorter than the part
+		os.Remove(part)
+		return delta.Result{}, offset, errors.New("the file changed on the server")
+	default:
+		return delta.Result{}, offset, responseError(resp, path.Join(vault, file))
+	}
+
+	out, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return delta.Result{}, offset, err
+	}
+	defer out.Close()
+
+	var base io.ReaderAt
+	if old, err := os.Open(local); err == nil {
+		defer old.Close()
+		base = old
+	}
+	res, err := delta.Apply(out, base, sig.BlockSize, resp.Body)
+	if err != nil {
+		return res, offset, err
+	}
+	return res, offset, out.Close()
+}
+
+// pushFile uploads a file as a delta against the file of the server. An
+// interrupted upload resumes where the server says it stopped.
+func (t *Transport) pushFile(ctx context.Context, rep *sync.Report, vault, file, local, hash string) error {
+	for attempt := 0; ; attempt++ {
+		res, retry, err := t.pushDelta(ctx, vault, file, local, hash)
+		if err != nil {
+			if retry && attempt < t.Retries && ctx.Err() == nil {
+				continue
+			}
+			return fmt.Errorf("push %s: %w", path.Join(vault, file), err)
+		}
+
+		rep.Changed++
+		rep.Bytes += res.Literal
+		rep.Log = append(rep.Log, fmt.Sprintf("push %s (%d of %d bytes sent)", path.Join(vault, file), res.Literal, res.Size))
+		return nil
+	}
+}
+
+// pushDelta makes one attempt to upload a file. It tells whether another
+// attempt may succeed.
+func (t *Transport) pushDelta(ctx context.Context, vault, file, local, hash string) (res delta.Result, retry bool, err error) {
+	query := url.Values{"file": {file}, "hash": {hash}}
+
+	// Where the server resumes and what it has
+	resp, err := t.do(ctx, http.MethodGet, t.url(vault, "upload", query), nil)
+	if err != nil {
+		return res, true, err
+	}
+	var upload Upload
+	if resp.StatusCode != http.StatusOK {
+		err = responseError(resp, path.Join(vault, file))
+	} else {
+		err = json.NewDecoder(resp.Body).Decode(&upload)
+	}
+	resp.Body.Close()
+	if err != nil {
+		return res, false, err
+	}
+
+	resp, err = t.do(ctx, http.MethodGet, t.url(vault, "signature", query), nil)
+	if err != nil {
+		return res, true, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return res, false, responseError(resp, path.Join(vault, file))
+	}
+	sig, err := delta.ReadSignature(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return res, true, err
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return res, false, err
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var err error
+		res, err = delta.Write(pw, sig, f, upload.Offset)
+		pw.CloseWithError(err)
+	}()
+
+	query.Set("offset", strconv.FormatInt(upload.Offset, 10))
+	resp, err = t.do(ctx, http.MethodPost, t.url(vault, "upload", query), pr)
+	pr.Close()
+	<-done
+	if err != nil {
+		return res, true, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return res, false, nil
+	case http.StatusConflict, http.StatusBadRequest:
+		// Another offset or an interrupted delta, the server kept the part
+		return res, true, responseError(resp, path.Join(vault, file))
+	case http.StatusUnprocessableEntity:
+		return res, false, delta.ErrHash
+	default:
+		return res, false, responseError(resp, path.Join(vault, file))
+	}
+}
@@ -0,0 +1,206 @@
+package httpsync_test
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/grd/FreePDM/internal/adapters/httpsync"
+	"github.com/grd/FreePDM/internal/delta"
+	"github.com/grd/FreePDM/internal/domain/models"
+)
+
+// fakeServer serves the sync API of the vaults in root, without access
+// control and without resuming uploads.
+func fakeServer(t *testing.T, root string) *httptest.Server {
+	abs := func(r *http.Request, param string) string {
+		vault := strings.Split(r.URL.Path, "/")[3]
+		if r.URL.Query().Get("data") == "1" {
+			vault = filepath.Join(".data", vault)
+		}
+		return filepath.Join(root, vault, r.URL.Query().Get(param))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/sync/{vault}/files", func(w http.ResponseWriter, r *http.Request) {
+		dir := abs(r, "path")
+		files := []httpsync.File{}
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if p != dir && r.URL.Query().Get("shallow") == "1" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			hash, size, _ := delta.HashFile(p)
+			rel, _ := filepath.Rel(dir, p)
+			files = append(files, httpsync.File{Path: filepath.ToSlash(rel), Size: size, Hash: hash})
+			return nil
+		})
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(files)
+	})
+	mux.HandleFunc("POST /api/sync/{vault}/delta", func(w http.ResponseWriter, r *http.Request) {
+		sig, err := delta.ReadSignature(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		f, _ := os.Open(abs(r, "file"))
+		defer f.Close()
+		offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+		delta.Write(w, sig, f, offset)
+	})
+	mux.HandleFunc("GET /api/sync/{vault}/signature", func(w http.ResponseWriter, r *http.Request) {
+		sig, _ := delta.FileSignature(abs(r, "file"), delta.DefaultBlockSize)
+		sig.WriteTo(w)
+	})
+	mux.HandleFunc("GET /api/sync/{vault}/upload", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(httpsync.Upload{})
+	})
+	mux.HandleFunc("POST /api/sync/{vault}/upload", func(w http.ResponseWriter, r *http.Request) {
+		file := abs(r, "file")
+		old, _ := os.ReadFile(file)
+		var buf strings.Builder
+		res, err := delta.Apply(&buf, strings.NewReader(string(old)), delta.DefaultBlockSize, r.Body)
+		if err != nil || res.HashString() != r.URL.Query().Get("hash") {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		os.MkdirAll(filepath.Dir(file), 0o755)
+		os.WriteFile(file, []byte(buf.String()), 0o644)
+		json.NewEncoder(w).Encode(httpsync.Upload{Offset: res.Size})
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func write(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPullWithReferences(t *testing.T) {
+	server, local := t.TempDir(), t.TempDir()
+
+	// An assembly in "main" uses version 1 of a part in "lib"
+	assembly := strings.Repeat("assembly data ", 5000)
+	write(t, filepath.Join(server, "main/assy/1/VER.txt"), "Version:Pretty:Date\n0:0:d\n1:1:d\n")
+	write(t, filepath.Join(server, "main/assy/1/0/frame.FCStd"), "old")
+	write(t, filepath.Join(server, "main/assy/1/1/frame.FCStd"), assembly)
+	write(t, filepath.Join(server, "main/assy/1/1/References.txt"), "lib 7 1\n")
+	write(t, filepath.Join(server, ".data/lib/FileList.csv"), "Container:FileName:PreviousFile:Dir:PreviousDir\n7:bolt.FCStd::parts:\n")
+	write(t, filepath.Join(server, "lib/parts/7/VER.txt"), "Version:Pretty:Date\n0:0:d\n1:1:d\n2:2:d\n")
+	write(t, filepath.Join(server, "lib/parts/7/1/bolt.FCStd"), "bolt")
+	write(t, filepath.Join(server, "lib/parts/7/2/bolt.FCStd"), "newer bolt")
+
+	// An interrupted pull of the assembly
+	write(t, filepath.Join(local, "main/assy/1/1/frame.FCStd.fpdm-part"), assembly[:20000])
+
+	srv := fakeServer(t, server)
+	tr := httpsync.New(local, srv.URL, srv.Client())
+
+	rep, err := tr.Pull(models.VaultInfo{Name: "main"}, "assy/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{"main/assy/1/1/frame.FCStd", "lib/parts/7/1/bolt.FCStd", ".data/lib/FileList.csv"} {
+		if _, err := os.Stat(filepath.Join(local, file)); err != nil {
+			t.Errorf("%s not pulled", file)
+		}
+	}
+	for _, file := range []string{"main/assy/1/0/frame.FCStd", "lib/parts/7/2/bolt.FCStd", "main/assy/1/1/frame.FCStd.fpdm-part"} {
+		if _, err := os.Stat(filepath.Join(local, file)); err == nil {
+			t.Errorf("%s exists, only the used versions should be pulled", file)
+		}
+	}
+	if buf, _ := os.ReadFile(filepath.Join(local, "main/assy/1/1/frame.FCStd")); string(buf) != assembly {
+		t.Error("the resumed pull is corrupt")
+	}
+
+	// VER.txt and the version files of both containers, and the index of "lib"
+	if rep.Changed != 6 || rep.Bytes >= int64(len(assembly)) {
+		t.Errorf("unexpected report %+v", rep)
+	}
+
+	// Nothing changed since
+	if rep, err = tr.Pull(models.VaultInfo{Name: "main"}, "assy/1"); err != nil || rep.Changed != 0 {
+		t.Errorf("second pull: %+v, %v", rep, err)
+	}
+}
+
+func TestPush(t *testing.T) {
+	server, local := t.TempDir(), t.TempDir()
+	write(t, filepath.Join(server, "main/assy/1/VER.txt"), "Version:Pretty:Date\n0:0:d\n")
+	write(t, filepath.Join(server, "main/assy/1/0/frame.FCStd"), strings.Repeat("frame ", 10000))
+	write(t, filepath.Join(local, "main/assy/1/VER.txt"), "changed locally")
+	write(t, filepath.Join(local, "main/assy/1/0/frame.FCStd"), strings.Repeat("frame ", 10000)+"and more")
+
+	srv := fakeServer(t, server)
+	tr := httpsync.New(local, srv.URL, srv.Client())
+
+	vault := models.VaultInfo{Name: "main"}
+	rep, err := tr.DryRunPush(vault, "assy/1")
+	if err != nil || rep.Changed != 1 {
+		t.Fatalf("unexpected dry run %+v, %v", rep, err)
+	}
+
+	if rep, err = tr.Push(vault, "assy/1"); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Changed != 1 || rep.Bytes > delta.DefaultBlockSize*2 {
+		t.Errorf("unexpected report %+v", rep)
+	}
+	buf, _ := os.ReadFile(filepath.Join(server, "main/assy/1/0/frame.FCStd"))
+	if !strings.HasSuffix(string(buf), "and more") {
+		t.Error("the file is not pushed")
+	}
+	if buf, _ := os.ReadFile(filepath.Join(server, "main/assy/1/VER.txt")); string(buf) == "changed locally" {
+		t.Error("the files of the container are pushed")
+	}
+
+	vault.ReadOnly = true
+	if _, err := tr.Push(vault, "assy/1"); err != httpsync.ErrReadOnly {
+		t.Errorf("pushed to a read-only vault: %v", err)
+	}
+}
+
+func TestPullIndex(t *testing.T) {
+	server, local := t.TempDir(), t.TempDir()
+	write(t, filepath.Join(server, ".data/main/FileList.csv"), "Container:FileName:PreviousFile:Dir:PreviousDir\n1:frame.FCStd:frame.FCStd:assy:parts\n")
+	write(t, filepath.Join(server, ".data/main/ContainerNumber.txt"), "1")
+	write(t, filepath.Join(local, ".data/main/FileList.csv"), "Container:FileName:PreviousFile:Dir:PreviousDir\n1:frame.FCStd::parts:\n")
+
+	srv := fakeServer(t, server)
+	tr := httpsync.New(local, srv.URL, srv.Client())
+
+	rep, err := tr.PullIndex(models.VaultInfo{Name: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Changed != 2 {
+		t.Errorf("unexpected report %+v", rep)
+	}
+	if buf, _ := os.ReadFile(filepath.Join(local, ".data/main/FileList.csv")); !strings.Contains(string(buf), ":assy:parts") {
+		t.Errorf("the index is not the one of the server: %q", buf)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package layout knows the files of the vaults on disk as far as the sync
+// transports need them: VER.txt of a container, References.txt of a
+// version and the file index of a vault. Pull walks a container and the
+// containers that its version refers to, the transport fetches the files.
+package layout
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Files of the vault layout, see the localfs package
+const (
+	DataDir             = ".data"
+	FileListCsv         = "FileList.csv"
+	VersionFile         = "VER.txt"
+	ReferencesFile      = "References.txt"
+	PropertiesFile      = "Properties.txt"
+	DescriptionFile     = "Description.txt"
+	LongDescriptionFile = "LongDescription.txt"
+	LockedFileCsv       = "LockedFiles.csv"
+	PartSuffix          = ".fpdm-part" // a file that is being pulled
+)
+
+// Latest selects the latest version of a container
+const Latest = -1
+
+// Fetcher copies files of the server into the local copy of the vaults
+type Fetcher interface {
+	// FetchDir copies a directory of a vault, only its files and not the
+	// subdirectories when shallow.
+	FetchDir(ctx context.Context, vault, rel string, shallow bool) error
+
+	// FetchIndex copies the data directory of a vault with its file index
+	FetchIndex(ctx context.Context, vault string) error
+}
+
+// Pull fetches the container at rel with a version, and the versions of
+// the containers that it refers to, into the local copy at localRoot.
+// References that are not in the file index of their vault go to logf.
+func Pull(ctx context.Context, f Fetcher, localRoot, vault, rel string, version int16, logf func(format string, args ...any)) error {
+	p := puller{f: f, root: localRoot, logf: logf, seen: map[string]bool{}, indexes: map[string]map[string]string{}}
+	return p.pull(ctx, vault, CleanRel(rel), version)
+}
+
+// CleanRel makes a vault path relative and clean, "" for the vault root
+func CleanRel(rel string) string {
+	rel = path.Clean("/" + filepath.ToSlash(rel))
+	return strings.TrimPrefix(rel, "/")
+}
+
+// puller pulls containers and follows their references
+type puller struct {
+	f       Fetcher
+	root    string
+	logf    func(format string, args ...any)
+	seen    map[string]bool
+	indexes map[string]map[string]string // vault -> container -> directory
+}
+
+func (p *puller) local(elem ...string) string {
+	return filepath.Join(append([]string{p.root}, elem...)...)
+}
+
+func (p *puller) pull(ctx context.Context, vault, rel string, version int16) error {
+	key := fmt.Sprint(vault, "/", rel, "@", version)
+	if p.seen[key] {
+		return nil
+	}
+	p.seen[key] = true
+
+	// The files of the container itself, VER.txt tells the versions
+	if err := p.f.FetchDir(ctx, vault, rel, true); err != nil {
+		return err
+	}
+	pretty, err := VersionDir(p.local(vault, rel, VersionFile), version)
+	if err != nil {
+		return err
+	}
+	if pretty == "" {
+		return nil // nothing checked in yet
+	}
+
+	if err := p.f.FetchDir(ctx, vault, path.Join(rel, pretty), false); err != nil {
+		return err
+	}
+
+	// The containers that the version uses
+	for _, ref := range ReadReferences(p.local(vault, rel, pretty, ReferencesFile)) {
+		dir, err := p.resolve(ctx, ref.Vault, ref.Container)
+		if err != nil {
+			return err
+		}
+		if dir == "" {
+			p.logf("unresolved reference %s/%s", ref.Vault, ref.Container)
+			continue
+		}
+		if err := p.pull(ctx, ref.Vault, path.Join(dir, ref.Container), ref.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns the directory of a container, from the file index of
+// its vault. It is "" when the container is unknown.
+func (p *puller) resolve(ctx context.Context, vault, container string) (string, error) {
+	index, ok := p.indexes[vault]
+	if !ok {
+		if err := p.f.FetchIndex(ctx, vault); err != nil {
+			return "", err
+		}
+		var err error
+		if index, err = ReadFileList(p.local(DataDir, vault, FileListCsv)); err != nil {
+			return "", err
+		}
+		p.indexes[vault] = index
+	}
+	return index[container], nil
+}
+
+// VersionDir returns the directory of a version from VER.txt, "" when the
+// container has no versions.
+func VersionDir(file string, version int16) (string, error) {
+	records, err := readColonCsv(file)
+	if err != nil {
+		return "", err
+	}
+	if len(records) <= 1 {
+		return "", nil // only the header
+	}
+	records = records[1:]
+
+	if version == Latest {
+		return records[len(records)-1][1], nil
+	}
+	for _, rec := range records {
+		if rec[0] == strconv.Itoa(int(version)) {
+			return rec[1], nil
+		}
+	}
+	return "", fmt.Errorf("version %d not found in %s", version, file)
+}
+
+// Version is a line of VER.txt
+type Version struct {
+	Number int16
+	Pretty string // the directory of the version
+	Date   string
+}
+
+// ReadVersions returns the versions of a container from VER.txt, oldest
+// first.
+func ReadVersions(file string) ([]Version, error) {
+	records, err := readColonCsv(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	for i, rec := range records {
+		if i == 0 || len(rec) < 2 {
+			continue // the header
+		}
+		nr, err := strconv.ParseInt(rec[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", file, err)
+		}
+		v := Version{Number: int16(nr), Pretty: rec[1]}
+		if len(rec) > 2 {
+			v.Date = rec[2]
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
+
+// Lock is a checked out version, a line of LockedFiles.csv
+type Lock struct {
+	Container string
+	Version   int16
+	User      string
+}
+
+// ReadLocks returns the checked out versions of a vault, nil when the
+// file is missing.
+func ReadLocks(file string) ([]Lock, error) {
+	records, err := readColonCsv(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var locks []Lock
+	for i, rec := range records {
+		if i == 0 || len(rec) < 3 {
+			continue // the header
+		}
+		nr, err := strconv.ParseInt(rec[1], 10, 16)
+		if err != nil {
+			continue
+		}
+		locks = append(locks, Lock{Container: rec[0], Version: int16(nr), User: rec[2]})
+	}
+	return locks, nil
+}
+
+// ReadFileList returns the directories of the containers of a vault
+func ReadFileList(file string) (map[string]string, error) {
+	records, err := readColonCsv(file)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]string, len(records))
+	for i, rec := range records {
+		if i == 0 || len(rec) < 4 {
+			continue // the header
+		}
+		index[rec[0]] = rec[3]
+	}
+	return index, nil
+}
+
+func readColonCsv(file string) ([][]string, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bytes.NewReader(buf))
+	r.Comma = ':'
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", file, err)
+	}
+	return records, nil
+}
+
+// Reference is a line of References.txt
+type Reference struct {
+	Vault, Container string
+	Version          int16
+}
+
+// ReadReferences reads References.txt of a version, nil when it is missing
+func ReadReferences(file string) []Reference {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+
+	var refs []Reference
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		nr, err := strconv.ParseInt(fields[2], 10, 16)
+		if err != nil {
+			continue
+		}
+		refs = append(refs, Reference{Vault: fields[0], Container: fields[1], Version: int16(nr)})
+	}
+	return refs
+}
@@ -0,0 +1,298 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package rsync implements the sync.Transport port with rsync, over SSH or
+// between local paths. It knows the layout of a vault: a pull fetches one
+// container with its latest version and the containers that version
+// refers to, a push sends the checked out version of one container back.
+package rsync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/domain/models"
+	"github.com/grd/FreePDM/internal/ports/sync"
+)
+
+// Latest selects the latest version of a container
+const Latest = layout.Latest
+
+var ErrReadOnly = errors.New("the vault is read-only")
+
+// Runner executes rsync with the arguments and returns its combined output
+// and exit code.
+type Runner func(ctx context.Context, name string, args []string) (output []byte, exitCode int, err error)
+
+// Transport syncs containers between the server and the local copy of the
+// vaults.
+type Transport struct {
+	LocalRoot string        // the local copy of the vaults
+	Binary    string        // the rsync binary, "rsync" when empty
+	Extra     []string      // extra rsync flags
+	Timeout   time.Duration // of one operation, none when zero
+	Run       Runner        // runs rsync, nil executes Binary
+
+	target string
+	ssh    sync.SSHOptions
+}
+
+var _ sync.LocalCopy = (*Transport)(nil)
+
+// Constructor
+func New(localRoot, target string) *Transport {
+	return &Transport{LocalRoot: localRoot, target: strings.TrimSuffix(target, "/")}
+}
+
+// SetTarget sets the vaults root of the server, "user@host:/srv/vaults" or
+// a local path.
+func (t *Transport) SetTarget(target string) {
+	t.target = strings.TrimSuffix(target, "/")
+}
+
+// SetSSHOptions sets how rsync connects with SSH
+func (t *Transport) SetSSHOptions(opts sync.SSHOptions) {
+	t.ssh = opts
+}
+
+// Pull fetches the container at rel with its latest version, and the
+// versions of the containers it refers to, into the local copy.
+func (t *Transport) Pull(vault models.VaultInfo, rel string) (sync.Report, error) {
+	return t.PullVersion(vault, rel, Latest)
+}
+
+// PullVersion fetches a version of the container at rel and its references
+func (t *Transport) PullVersion(vault models.VaultInfo, rel string, version int16) (sync.Report, error) {
+	ctx, cancel := t.context()
+	defer cancel()
+
+	rep := sync.Report{StartedAt: time.Now()}
+	logf := func(format string, args ...any) {
+		rep.Log = append(rep.Log, fmt.Sprintf(format, args...))
+	}
+	err := layout.Pull(ctx, fetcher{t: t, rep: &rep}, t.LocalRoot, vault.Name, rel, version, logf)
+	rep.EndedAt = time.Now()
+	return rep, err
+}
+
+// PullIndex fetches the file index of a vault into the local copy
+func (t *Transport) PullIndex(vault models.VaultInfo) (sync.Report, error) {
+	ctx, cancel := t.context()
+	defer cancel()
+
+	rep := sync.Report{StartedAt: time.Now()}
+	err := fetcher{t: t, rep: &rep}.FetchIndex(ctx, vault.Name)
+	rep.EndedAt = time.Now()
+	return rep, err
+}
+
+// Push sends the latest local version of the container at srcRel, the
+// checked out one, to the server. The other versions and the files that
+// the server keeps of the container, like VER.txt and the descriptions,
+// stay as they are.
+func (t *Transport) Push(vault models.VaultInfo, srcRel string) (sync.Report, error) {
+	return t.push(vault, srcRel, false)
+}
+
+// DryRunPush reports what Push would send
+func (t *Transport) DryRunPush(vault models.VaultInfo, srcRel string) (sync.Report, error) {
+	return t.push(vault, srcRel, true)
+}
+
+func (t *Transport) push(vault models.VaultInfo, srcRel string, dryRun bool) (sync.Report, error) {
+	rep := sync.Report{StartedAt: time.Now()}
+	if vault.ReadOnly {
+		rep.EndedAt = rep.StartedAt
+		return rep, ErrReadOnly
+	}
+
+	ctx, cancel := t.context()
+	defer cancel()
+
+	rel := layout.CleanRel(srcRel)
+	pretty, err := layout.VersionDir(t.local(vault.Name, rel, layout.VersionFile), Latest)
+	if err == nil && pretty == "" {
+		err = fmt.Errorf("container %s has no versions", rel)
+	}
+	if err == nil {
+		rel = path.Join(rel, pretty)
+		err = t.rsync(ctx, &rep, dryRun, pushFilters, t.local(vault.Name, rel)+"/", t.remote(vault.Name, rel)+"/")
+	}
+	rep.EndedAt = time.Now()
+	return rep, err
+}
+
+// pushFilters leave out the files of a version that the server writes
+var pushFilters = []string{
+	"--exclude=/" + layout.ReferencesFile,
+	"--exclude=/" + layout.PropertiesFile,
+	"--exclude=/" + layout.DescriptionFile,
+	"--exclude=/" + layout.LongDescriptionFile,
+	"--exclude=*" + layout.PartSuffix,
+}
+
+func (t *Transport) context() (context.Context, context.CancelFunc) {
+	if t.Timeout > 0 {
+		return context.WithTimeout(context.Background(), t.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+func (t *Transport) local(elem ...string) string {
+	return filepath.Join(append([]string{t.LocalRoot}, elem...)...)
+}
+
+func (t *Transport) remote(elem ...string) string {
+	return t.target + "/" + path.Join(elem...)
+}
+
+// sshCommand is the remote shell of rsync, "" for its default
+func (t *Transport) sshCommand() string {
+	opts := t.ssh
+	if opts.Port == 0 && opts.IdentityFile == "" && opts.KnownHosts == "" && len(opts.ExtraArgs) == 0 {
+		return ""
+	}
+
+	cmd := []string{"ssh"}
+	if opts.Port != 0 {
+		cmd = append(cmd, "-p", strconv.Itoa(opts.Port))
+	}
+	if opts.IdentityFile != "" {
+		cmd = append(cmd, "-i", quote(opts.IdentityFile))
+	}
+	if opts.KnownHosts != "" {
+		cmd = append(cmd, "-o", quote("UserKnownHostsFile="+opts.KnownHosts))
+	}
+	for _, arg := range opts.ExtraArgs {
+		cmd = append(cmd, quote(arg))
+	}
+	return strings.Join(cmd, " ")
+}
+
+// quote quotes an argument of the remote shell when it needs it
+func quote(s string) string {
+	if !strings.ContainsAny(s, " \t'\"\\") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// rsync runs one transfer and adds its output to the report
+func (t *Transport) rsync(ctx context.Context, rep *sync.Report, dryRun bool, filters []string, src, dst string) error {
+	args := []string{"-a", "--partial", "--itemize-changes", "--stats"}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	if ssh := t.sshCommand(); ssh != "" {
+		args = append(args, "-e", ssh)
+	}
+	args = append(args, t.Extra...)
+	args = append(args, filters...)
+	args = append(args, src, dst)
+
+	// rsync creates the destination, but not its parents
+	if !strings.Contains(dst, ":") && !dryRun {
+		if err := os.MkdirAll(filepath.Dir(filepath.Clean(dst)), 0o755); err != nil {
+			return err
+		}
+	}
+
+	run := t.Run
+	if run == nil {
+		run = t.exec
+	}
+	out, code, err := run(ctx, t.binary(), args)
+	parseOutput(out, rep)
+	rep.ExitCode = code
+	if err != nil {
+		return fmt.Errorf("rsync %s: %w", src, err)
+	}
+	return nil
+}
+
+func (t *Transport) binary() string {
+	if t.Binary == "" {
+		return "rsync"
+	}
+	return t.Binary
+}
+
+// exec runs the rsync binary
+func (t *Transport) exec(ctx context.Context, name string, args []string) ([]byte, int, error) {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return out, exitErr.ExitCode(), err
+	}
+	return out, 0, err
+}
+
+// An itemized change, "YXcstpoguax path" of rsync --itemize-changes
+var reItemized = regexp.MustCompile(`^([<>ch.*])([fdLDS])[cstpoguaxn+.? ]{7,9} (.+)$`)
+
+// parseOutput counts the changes and transferred bytes of rsync output
+func parseOutput(out []byte, rep *sync.Report) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		switch {
+		case strings.HasPrefix(line, "*deleting "):
+			rep.Changed++
+			rep.Log = append(rep.Log, line)
+		case reItemized.MatchString(line):
+			m := reItemized.FindStringSubmatch(line)
+			// "." is an unchanged item, a directory is no change by itself
+			if m[1] != "." && m[2] != "d" {
+				rep.Changed++
+			}
+			rep.Log = append(rep.Log, line)
+		case strings.HasPrefix(line, "Total transferred file size:"):
+			rep.Bytes += statNumber(line)
+		case strings.HasPrefix(line, "rsync:"), strings.HasPrefix(line, "rsync error:"):
+			rep.Log = append(rep.Log, line)
+		}
+	}
+}
+
+// statNumber reads the number of a stats line, "1,234 bytes" is 1234
+func statNumber(line string) int64 {
+	_, value, _ := strings.Cut(line, ":")
+	value, _, _ = strings.Cut(strings.TrimSpace(value), " ")
+	value = strings.NewReplacer(",", "", ".", "").Replace(value)
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+// fetcher fetches the directories of a pull with rsync
+type fetcher struct {
+	t   *Transport
+	rep *sync.Report
+}
+
+func (f fetcher) FetchDir(ctx context.Context, vault, rel string, shallow bool) error {
+	var filters []string
+	if shallow {
+		filters = []string{"--exclude=/*/"}
+	}
+	t := f.t
+	return t.rsync(ctx, f.rep, false, filters, t.remote(vault, rel)+"/", t.local(vault, rel)+"/")
+}
+
+func (f fetcher) FetchIndex(ctx context.Context, vault string) error {
+	t := f.t
+	return t.rsync(ctx, f.rep, false, nil, t.remote(layout.DataDir, vault)+"/", t.local(layout.DataDir, vault)+"/")
+}
@@ -0,0 +1,176 @@
+package rsync_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/grd/FreePDM/internal/adapters/rsync"
+	"github.com/grd/FreePDM/internal/domain/models"
+	"github.com/grd/FreePDM/internal/ports/sync"
+)
+
+// fakeRsync copies between local directories like rsync -a does, with the
+// filters the transport uses, and prints the itemized changes.
+func fakeRsync(calls *[][]string) rsync.Runner {
+	return func(ctx context.Context, name string, args []string) ([]byte, int, error) {
+		*calls = append(*calls, args)
+		src, dst := args[len(args)-2], args[len(args)-1]
+		shallow := slices.Contains(args, "--exclude=/*/")
+		dryRun := slices.Contains(args, "--dry-run")
+		excluded := func(rel string) bool {
+			for _, arg := range args {
+				pattern, ok := strings.CutPrefix(arg, "--exclude=")
+				if !ok {
+					continue
+				}
+				if name, top := strings.CutPrefix(pattern, "/"); top && name == rel {
+					return true
+				}
+				if suffix, any := strings.CutPrefix(pattern, "*"); any && strings.HasSuffix(rel, suffix) {
+					return true
+				}
+			}
+			return false
+		}
+
+		var out strings.Builder
+		var total int64
+		err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(src, p)
+			if info.IsDir() {
+				if rel != "." && shallow {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if excluded(filepath.ToSlash(rel)) {
+				return nil
+			}
+			fmt.Fprintf(&out, ">f+++++++++ %s\n", filepath.ToSlash(rel))
+			total += info.Size()
+			if dryRun {
+				return nil
+			}
+			buf, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(filepath.Join(dst, rel)), 0o755); err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Join(dst, rel), buf, 0o644)
+		})
+		if err != nil {
+			return []byte("rsync: " + err.Error()), 23, err
+		}
+		fmt.Fprintf(&out, "\nNumber of files: 3\nTotal transferred file size: %d bytes\n", total)
+		return []byte(out.String()), 0, nil
+	}
+}
+
+func write(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPullWithReferences(t *testing.T) {
+	server, local := t.TempDir(), t.TempDir()
+
+	// An assembly in "main" uses version 1 of a part in "lib"
+	write(t, filepath.Join(server, "main/assy/1/VER.txt"), "Version:Pretty:Date\n0:0:d\n1:1:d\n")
+	write(t, filepath.Join(server, "main/assy/1/0/frame.FCStd"), "old")
+	write(t, filepath.Join(server, "main/assy/1/1/frame.FCStd"), "assembly")
+	write(t, filepath.Join(server, "main/assy/1/1/References.txt"), "lib 7 1\n")
+	write(t, filepath.Join(server, ".data/lib/FileList.csv"), "Container:FileName:PreviousFile:Dir:PreviousDir\n7:bolt.FCStd::parts:\n")
+	write(t, filepath.Join(server, "lib/parts/7/VER.txt"), "Version:Pretty:Date\n0:0:d\n1:1:d\n2:2:d\n")
+	write(t, filepath.Join(server, "lib/parts/7/1/bolt.FCStd"), "bolt")
+	write(t, filepath.Join(server, "lib/parts/7/2/bolt.FCStd"), "newer bolt")
+
+	var calls [][]string
+	tr := rsync.New(local, server)
+	tr.Run = fakeRsync(&calls)
+
+	rep, err := tr.Pull(models.VaultInfo{Name: "main"}, "assy/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{"main/assy/1/1/frame.FCStd", "lib/parts/7/1/bolt.FCStd"} {
+		if _, err := os.Stat(filepath.Join(local, file)); err != nil {
+			t.Errorf("%s not pulled", file)
+		}
+	}
+	for _, file := range []string{"main/assy/1/0/frame.FCStd", "lib/parts/7/2/bolt.FCStd"} {
+		if _, err := os.Stat(filepath.Join(local, file)); err == nil {
+			t.Errorf("%s pulled, only the used versions should be", file)
+		}
+	}
+
+	// VER.txt and the version files of both containers, and the index of "lib"
+	if rep.Changed != 6 || rep.Bytes == 0 || len(rep.Log) != rep.Changed {
+		t.Errorf("unexpected report %+v", rep)
+	}
+	if len(calls) != 5 {
+		t.Errorf("expected 5 rsync runs, got %d", len(calls))
+	}
+}
+
+func TestPush(t *testing.T) {
+	server, local := t.TempDir(), t.TempDir()
+	write(t, filepath.Join(local, "main/assy/1/VER.txt"), "Version:Pretty:Date\n1:1:d\n2:2:d\n")
+	write(t, filepath.Join(local, "main/assy/1/1/frame.FCStd"), "old")
+	write(t, filepath.Join(local, "main/assy/1/2/frame.FCStd"), "changed")
+	write(t, filepath.Join(local, "main/assy/1/2/References.txt"), "main 3 1\n")
+	write(t, filepath.Join(local, "main/assy/1/2/Properties.txt"), "Volume = 1 cm^3\n")
+
+	var calls [][]string
+	tr := rsync.New(local, server)
+	tr.Run = fakeRsync(&calls)
+	tr.SetSSHOptions(sync.SSHOptions{Port: 2222, IdentityFile: "/home/me/my key"})
+
+	vault := models.VaultInfo{Name: "main"}
+	rep, err := tr.DryRunPush(vault, "assy/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Changed != 1 {
+		t.Errorf("unexpected dry run report %+v", rep)
+	}
+	if _, err := os.Stat(filepath.Join(server, "main/assy/1/2/frame.FCStd")); err == nil {
+		t.Error("dry run pushed the file")
+	}
+	if !slices.Contains(calls[0], "ssh -p 2222 -i '/home/me/my key'") {
+		t.Errorf("unexpected ssh arguments %q", calls[0])
+	}
+
+	if _, err := tr.Push(vault, "/assy/1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(server, "main/assy/1/2/frame.FCStd")); err != nil {
+		t.Error("the checked out version is not pushed")
+	}
+	// Only the checked out version, without the files of the server
+	for _, name := range []string{"VER.txt", "1/frame.FCStd", "2/References.txt", "2/Properties.txt"} {
+		if _, err := os.Stat(filepath.Join(server, "main/assy/1", name)); err == nil {
+			t.Errorf("pushed %s", name)
+		}
+	}
+
+	vault.ReadOnly = true
+	if _, err := tr.Push(vault, "assy/1"); err != rsync.ErrReadOnly {
+		t.Errorf("pushed to a read-only vault: %v", err)
+	}
+}
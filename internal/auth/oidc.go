@@ -0,0 +1,469 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/grd/FreePDM/internal/db"
+)
+
+// OpenID Connect single sign-on with the authorization code flow and PKCE.
+//
+// Everything is configured in app.env, see LoadOIDCConfig. The provider
+// only needs the standard discovery document, so any issuer (Keycloak,
+// Azure AD, Authentik, a local mock in the tests...) will do.
+
+var (
+	ErrOIDCDisabled     = errors.New("oidc: single sign-on is not configured")
+	ErrOIDCInvalidToken = errors.New("oidc: invalid id token")
+)
+
+// OIDCConfig holds the settings of the identity provider.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// Claim names that are mapped onto PdmUser
+	LoginClaim string // defaults to preferred_username
+	RolesClaim string // defaults to roles
+
+	// RoleMap maps a value of the roles claim onto a PDM role. Values that
+	// are not in the map are ignored, so an empty map takes no roles from
+	// the provider. With a map the provider manages the roles: they are
+	// replaced on every login.
+	RoleMap map[string]string
+
+	// DefaultRoles are given to a user whose token carries no known role.
+	DefaultRoles []string
+
+	// AutoCreate creates unknown users on their first login.
+	AutoCreate bool
+}
+
+// LoadOIDCConfig reads the OIDC_* variables. The second return value is
+// false when OIDC_ISSUER is not set, which means SSO is disabled.
+func LoadOIDCConfig() (*OIDCConfig, bool) {
+	issuer := strings.TrimSpace(os.Getenv("OIDC_ISSUER"))
+	if issuer == "" {
+		return nil, false
+	}
+
+	cfg := &OIDCConfig{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(envOr("OIDC_SCOPES", "openid profile email")),
+		LoginClaim:   envOr("OIDC_LOGIN_CLAIM", "preferred_username"),
+		RolesClaim:   envOr("OIDC_ROLES_CLAIM", "roles"),
+		RoleMap:      map[string]string{},
+		DefaultRoles: splitList(envOr("OIDC_DEFAULT_ROLES", string(db.Viewer))),
+		AutoCreate:   os.Getenv("OIDC_AUTO_CREATE") != "false",
+	}
+
+	// OIDC_ROLE_MAP=pdm-admins:admin,pdm-designers:designer
+	for _, pair := range splitList(os.Getenv("OIDC_ROLE_MAP")) {
+		from, to, ok := strings.Cut(pair, ":")
+		if ok {
+			cfg.RoleMap[strings.TrimSpace(from)] = strings.ToLower(strings.TrimSpace(to))
+		}
+	}
+
+	return cfg, true
+}
+
+func envOr(key, fallback string) string {
+	if val := strings.TrimSpace(os.Getenv(key)); val != "" {
+		return val
+	}
+	return fallback
+}
+
+func splitList(s string) []string {
+	var ret []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			ret = append(ret, part)
+		}
+	}
+	return ret
+}
+
+// OIDCIdentity is the user as described by a verified ID token.
+type OIDCIdentity struct {
+	Subject       string
+	LoginName     string
+	Email         string
+	EmailVerified bool // the provider checked that the user owns Email
+	FullName      string
+	FirstName     string
+	LastName      string
+	Roles         []string
+	RolesManaged  bool // the provider manages the roles, see OIDCConfig.RoleMap
+}
+
+// Apply copies the identity onto a (new or existing) user record. Roles are
+// only replaced when the provider manages them, so that roles given by an
+// admin survive otherwise, and a role that was taken away at the provider
+// is taken away here as well.
+func (id OIDCIdentity) Apply(user *db.PdmUser) {
+	user.ExternalSubject = id.Subject
+	user.AuthSource = db.AuthSourceOIDC
+	if user.LoginName == "" {
+		user.LoginName = id.LoginName
+	}
+	if id.Email != "" {
+		user.EmailAddress = id.Email
+	}
+	if id.FullName != "" {
+		user.FullName = id.FullName
+	}
+	if id.FirstName != "" {
+		user.FirstName = id.FirstName
+	}
+	if id.LastName != "" {
+		user.LastName = id.LastName
+	}
+	if id.RolesManaged {
+		user.Roles = id.Roles
+	}
+}
+
+// OIDCProvider talks to one identity provider.
+type OIDCProvider struct {
+	Config *OIDCConfig
+
+	authURL  string
+	tokenURL string
+	jwksURL  string
+	client   *http.Client
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+}
+
+type discoveryDoc struct {
+	Issuer        string `json:"issuer"`
+	AuthEndpoint  string `json:"authorization_endpoint"`
+	TokenEndpoint string `json:"token_endpoint"`
+	JWKSURI       string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider fetches the discovery document of the issuer.
+func NewOIDCProvider(ctx context.Context, cfg *OIDCConfig) (*OIDCProvider, error) {
+	if cfg == nil {
+		return nil, ErrOIDCDisabled
+	}
+
+	p := &OIDCProvider{
+		Config: cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var doc discoveryDoc
+	if err := p.getJSON(ctx, cfg.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch %q != %q", doc.Issuer, cfg.Issuer)
+	}
+	if doc.AuthEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete discovery document")
+	}
+
+	p.authURL = doc.AuthEndpoint
+	p.tokenURL = doc.TokenEndpoint
+	p.jwksURL = doc.JWKSURI
+
+	return p, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// RandomToken returns a random url-safe string, used for state, nonce and
+// the PKCE code verifier.
+func RandomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // the system random source is broken
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// PKCEChallenge computes the S256 code challenge of a verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL is the URL the browser is sent to for logging in.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, verifier string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.Config.ClientID)
+	q.Set("redirect_uri", p.Config.RedirectURL)
+	q.Set("scope", strings.Join(p.Config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", PKCEChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	return p.authURL + sep + q.Encode()
+}
+
+// Exchange trades the authorization code for tokens and returns the
+// identity from the verified ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.RedirectURL)
+	form.Set("client_id", p.Config.ClientID)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.Config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tok struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+		Descr   string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("oidc token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.Error != "" {
+		return nil, fmt.Errorf("oidc token request: %s %s %s", resp.Status, tok.Error, tok.Descr)
+	}
+	if tok.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrOIDCInvalidToken)
+	}
+
+	claims, err := p.VerifyIDToken(ctx, tok.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	id := p.Config.MapClaims(claims)
+	return &id, nil
+}
+
+// VerifyIDToken checks signature, issuer, audience, expiry and nonce.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCInvalidToken, err)
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.Config.Issuer {
+		return nil, fmt.Errorf("%w: wrong issuer %q", ErrOIDCInvalidToken, iss)
+	}
+	if !hasAudience(claims["aud"], p.Config.ClientID) {
+		return nil, fmt.Errorf("%w: wrong audience", ErrOIDCInvalidToken)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: no expiry", ErrOIDCInvalidToken)
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCInvalidToken)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrOIDCInvalidToken)
+	}
+
+	return claims, nil
+}
+
+func hasAudience(aud any, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []any:
+		for _, a := range v {
+			if s, _ := a.(string); s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the signing key with the given id, refreshing the key set
+// once when the id is unknown (key rotation).
+func (p *OIDCProvider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k := p.lookupKey(kid); k != nil {
+		return k, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.jwksURL, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	p.keys = map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		p.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if k := p.lookupKey(kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("no signing key %q", kid)
+}
+
+func (p *OIDCProvider) lookupKey(kid string) *rsa.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k
+		}
+	}
+	return p.keys[kid]
+}
+
+// MapClaims turns the claims of an ID token into an identity.
+func (cfg *OIDCConfig) MapClaims(claims map[string]any) OIDCIdentity {
+	str := func(key string) string {
+		s, _ := claims[key].(string)
+		return s
+	}
+
+	id := OIDCIdentity{
+		Subject:   str("sub"),
+		LoginName: str(cfg.LoginClaim),
+		Email:     str("email"),
+		FullName:  str("name"),
+		FirstName: str("given_name"),
+		LastName:  str("family_name"),
+	}
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		// some providers send it as a string
+		id.EmailVerified = strings.EqualFold(v, "true")
+	}
+	if id.LoginName == "" {
+		// fall back on the local part of the e-mail address
+		id.LoginName, _, _ = strings.Cut(id.Email, "@")
+	}
+	if name := []rune(id.LoginName); len(name) > 30 {
+		id.LoginName = string(name[:30])
+	}
+
+	var values []string
+	switch v := claims[cfg.RolesClaim].(type) {
+	case string:
+		values = strings.Fields(strings.ReplaceAll(v, ",", " "))
+	case []any:
+		for _, val := range v {
+			if s, ok := val.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, val := range values {
+		role, ok := cfg.RoleMap[val]
+		if !ok {
+			continue
+		}
+		if !seen[role] {
+			seen[role] = true
+			id.Roles = append(id.Roles, role)
+		}
+	}
+	if len(cfg.RoleMap) > 0 {
+		id.RolesManaged = true
+		if len(id.Roles) == 0 {
+			id.Roles = append([]string(nil), cfg.DefaultRoles...)
+		}
+	}
+
+	return id
+}
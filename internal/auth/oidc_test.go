@@ -0,0 +1,239 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/grd/FreePDM/internal/auth"
+	"github.com/grd/FreePDM/internal/db"
+)
+
+// mockIssuer is a minimal OpenID provider that hands out one code.
+type mockIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "the-code" || auth.PKCEChallenge(r.Form.Get("code_verifier")) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+		tok.Header["kid"] = "k1"
+		signed, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	m.Server = httptest.NewServer(mux)
+
+	m.claims = jwt.MapClaims{
+		"iss":                m.URL,
+		"aud":                "freepdm",
+		"sub":                "1234",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"preferred_username": "jdoe",
+		"email":              "jdoe@example.com",
+		"name":               "John Doe",
+		"groups":             []string{"pdm-designers", "staff"},
+	}
+	return m
+}
+
+func (m *mockIssuer) provider(t *testing.T) *auth.OIDCProvider {
+	cfg := &auth.OIDCConfig{
+		Issuer:      m.URL,
+		ClientID:    "freepdm",
+		RedirectURL: "http://localhost/login/oidc/callback",
+		Scopes:      []string{"openid"},
+		LoginClaim:  "preferred_username",
+		RolesClaim:  "groups",
+		RoleMap:     map[string]string{"pdm-designers": "designer"},
+	}
+	p, err := auth.NewOIDCProvider(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+	return p
+}
+
+// login runs the browser part of the flow: read the challenge and nonce
+// from the authorization URL.
+func (m *mockIssuer) login(t *testing.T, p *auth.OIDCProvider, verifier, nonce string) {
+	u, err := url.Parse(p.AuthCodeURL("state", nonce, verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("expected S256 challenge, got %q", q.Get("code_challenge_method"))
+	}
+	m.challenge = q.Get("code_challenge")
+	m.claims["nonce"] = q.Get("nonce")
+}
+
+func TestOIDCExchange(t *testing.T) {
+	m := newMockIssuer(t)
+	defer m.Close()
+	p := m.provider(t)
+
+	verifier, nonce := auth.RandomToken(), auth.RandomToken()
+	m.login(t, p, verifier, nonce)
+
+	id, err := p.Exchange(context.Background(), "the-code", verifier, nonce)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	if id.Subject != "1234" || id.LoginName != "jdoe" || id.Email != "jdoe@example.com" || id.FullName != "John Doe" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+	if len(id.Roles) != 1 || id.Roles[0] != "designer" {
+		t.Errorf("expected roles [designer], got %v", id.Roles)
+	}
+}
+
+func TestOIDCRejectsBadTokens(t *testing.T) {
+	m := newMockIssuer(t)
+	defer m.Close()
+	p := m.provider(t)
+
+	verifier, nonce := auth.RandomToken(), auth.RandomToken()
+	m.login(t, p, verifier, nonce)
+
+	// wrong PKCE verifier
+	if _, err := p.Exchange(context.Background(), "the-code", auth.RandomToken(), nonce); err == nil {
+		t.Error("expected error for wrong code verifier")
+	}
+
+	// replayed nonce
+	if _, err := p.Exchange(context.Background(), "the-code", verifier, "other"); err == nil {
+		t.Error("expected error for nonce mismatch")
+	}
+
+	// token for another client
+	m.claims["aud"] = "someone-else"
+	if _, err := p.Exchange(context.Background(), "the-code", verifier, nonce); err == nil {
+		t.Error("expected error for wrong audience")
+	}
+
+	// expired token
+	m.claims["aud"] = "freepdm"
+	m.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+	if _, err := p.Exchange(context.Background(), "the-code", verifier, nonce); err == nil {
+		t.Error("expected error for expired token")
+	}
+}
+
+func TestOIDCMapClaims(t *testing.T) {
+	claims := map[string]any{
+		"sub":            "1234",
+		"email":          "jdoe@example.com",
+		"email_verified": "true",
+		"roles":          []any{"admin", "pdm-designers"},
+	}
+
+	// Without a role map the provider gives no roles, not even "admin"
+	cfg := &auth.OIDCConfig{LoginClaim: "preferred_username", RolesClaim: "roles"}
+	id := cfg.MapClaims(claims)
+	if len(id.Roles) != 0 {
+		t.Errorf("expected no roles without a role map, got %v", id.Roles)
+	}
+	if !id.EmailVerified {
+		t.Error("expected a verified e-mail address")
+	}
+
+	cfg.RoleMap = map[string]string{"pdm-designers": "designer"}
+	id = cfg.MapClaims(claims)
+	if len(id.Roles) != 1 || id.Roles[0] != "designer" {
+		t.Errorf("expected roles [designer], got %v", id.Roles)
+	}
+
+	// Nothing maps: the default roles
+	cfg.DefaultRoles = []string{"viewer"}
+	claims["roles"] = []any{"admin"}
+	id = cfg.MapClaims(claims)
+	if !id.RolesManaged || len(id.Roles) != 1 || id.Roles[0] != "viewer" {
+		t.Errorf("expected the default roles [viewer], got %v", id.Roles)
+	}
+
+	delete(claims, "email_verified")
+	if cfg.MapClaims(claims).EmailVerified {
+		t.Error("expected an unverified e-mail address without the claim")
+	}
+}
+
+func TestOIDCLoginNameRunes(t *testing.T) {
+	cfg := &auth.OIDCConfig{LoginClaim: "preferred_username"}
+	id := cfg.MapClaims(map[string]any{"preferred_username": strings.Repeat("é", 40)})
+	if !utf8.ValidString(id.LoginName) || id.LoginName != strings.Repeat("é", 30) {
+		t.Errorf("expected 30 runes, got %q", id.LoginName)
+	}
+}
+
+func TestOIDCApplyRoles(t *testing.T) {
+	user := &db.PdmUser{Roles: []string{"admin"}}
+
+	// The provider does not manage the roles: the admin's choice stays
+	auth.OIDCIdentity{Subject: "1234"}.Apply(user)
+	if len(user.Roles) != 1 || user.Roles[0] != "admin" {
+		t.Errorf("expected roles [admin], got %v", user.Roles)
+	}
+
+	// A role taken away at the provider is taken away here
+	auth.OIDCIdentity{Subject: "1234", Roles: []string{"viewer"}, RolesManaged: true}.Apply(user)
+	if len(user.Roles) != 1 || user.Roles[0] != "viewer" {
+		t.Errorf("expected roles [viewer], got %v", user.Roles)
+	}
+	auth.OIDCIdentity{Subject: "1234", RolesManaged: true}.Apply(user)
+	if len(user.Roles) != 0 {
+		t.Errorf("expected no roles, got %v", user.Roles)
+	}
+}
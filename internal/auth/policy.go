@@ -0,0 +1,160 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrPasswordReused = errors.New("password was used before")
+
+// PasswordPolicy describes which passwords are accepted. It is read from
+// app.env with LoadPasswordPolicy.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	// History is the number of previous passwords that can't be reused.
+	History int
+
+	// MaxAge is how long a password is valid, 0 means forever.
+	MaxAge time.Duration
+}
+
+// LockoutPolicy describes what happens after failed logins.
+type LockoutPolicy struct {
+	// MaxFailed is the number of failed logins in a row before the
+	// account is locked, 0 disables locking.
+	MaxFailed int
+
+	// LockDuration is how long the account stays locked. After that the
+	// next login attempt unlocks it. 0 means until an admin unlocks it.
+	LockDuration time.Duration
+}
+
+// LoadPasswordPolicy reads the PASSWORD_* variables. The defaults are the
+// rules we always had: at least 10 characters with an uppercase letter.
+func LoadPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:     EnvInt("PASSWORD_MIN_LENGTH", 10),
+		RequireUpper:  envBool("PASSWORD_REQUIRE_UPPER", true),
+		RequireLower:  envBool("PASSWORD_REQUIRE_LOWER", false),
+		RequireDigit:  envBool("PASSWORD_REQUIRE_DIGIT", false),
+		RequireSymbol: envBool("PASSWORD_REQUIRE_SYMBOL", false),
+		History:       EnvInt("PASSWORD_HISTORY", 0),
+		MaxAge:        time.Duration(EnvInt("PASSWORD_MAX_AGE_DAYS", 0)) * 24 * time.Hour,
+	}
+}
+
+// LoadLockoutPolicy reads the LOGIN_* variables.
+func LoadLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxFailed:    EnvInt("LOGIN_MAX_FAILED", 5),
+		LockDuration: time.Duration(EnvInt("LOGIN_LOCK_MINUTES", 15)) * time.Minute,
+	}
+}
+
+// EnvInt returns the integer of the variable key, fallback when it is not
+// set or not a number.
+func EnvInt(key string, fallback int) int {
+	val, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return fallback
+	}
+	return val
+}
+
+func envBool(key string, fallback bool) bool {
+	val, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return fallback
+	}
+	return val
+}
+
+// Validate checks a new password against the length and character rules.
+func (p PasswordPolicy) Validate(password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	switch {
+	case p.RequireUpper && !upper:
+		return errors.New("password must contain at least one uppercase letter")
+	case p.RequireLower && !lower:
+		return errors.New("password must contain at least one lowercase letter")
+	case p.RequireDigit && !digit:
+		return errors.New("password must contain at least one digit")
+	case p.RequireSymbol && !symbol:
+		return errors.New("password must contain at least one symbol")
+	}
+	return nil
+}
+
+// CheckHistory returns ErrPasswordReused when the password matches one of
+// the given hashes (newest first). Only the last History hashes count.
+func (p PasswordPolicy) CheckHistory(password string, hashes []string) error {
+	for i, hash := range hashes {
+		if i >= p.History {
+			break
+		}
+		if CheckPasswordHash(password, hash) {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// Expired tells whether a password that was set at changedAt must be changed.
+func (p PasswordPolicy) Expired(changedAt time.Time, now time.Time) bool {
+	if p.MaxAge <= 0 || changedAt.IsZero() {
+		return false
+	}
+	return now.Sub(changedAt) > p.MaxAge
+}
+
+// Rules returns the policy as human readable lines, for the password forms.
+func (p PasswordPolicy) Rules() []string {
+	rules := []string{fmt.Sprintf("Be at least %d characters", p.MinLength)}
+	if p.RequireUpper {
+		rules = append(rules, "Include at least one uppercase letter")
+	}
+	if p.RequireLower {
+		rules = append(rules, "Include at least one lowercase letter")
+	}
+	if p.RequireDigit {
+		rules = append(rules, "Include at least one digit")
+	}
+	if p.RequireSymbol {
+		rules = append(rules, "Include at least one symbol")
+	}
+	if p.History > 0 {
+		rules = append(rules, fmt.Sprintf("Differ from your last %d passwords", p.History))
+	}
+	return rules
+}
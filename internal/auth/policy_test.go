@@ -0,0 +1,55 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grd/FreePDM/internal/auth"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	p := auth.PasswordPolicy{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		History:       2,
+		MaxAge:        90 * 24 * time.Hour,
+	}
+
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{"Short1!", false},
+		{"longenough1!", false}, // no uppercase
+		{"Longenough!!", false}, // no digit
+		{"Longenough12", false}, // no symbol
+		{"Longenough1!", true},
+	}
+	for _, tt := range tests {
+		if err := p.Validate(tt.password); (err == nil) != tt.ok {
+			t.Errorf("Validate(%q) = %v, want ok=%v", tt.password, err, tt.ok)
+		}
+	}
+
+	h1, _ := auth.HashPassword("Password-1")
+	h2, _ := auth.HashPassword("Password-2")
+	h3, _ := auth.HashPassword("Password-3")
+	history := []string{h1, h2, h3}
+
+	if err := p.CheckHistory("Password-2", history); err != auth.ErrPasswordReused {
+		t.Errorf("expected ErrPasswordReused, got %v", err)
+	}
+	if err := p.CheckHistory("Password-3", history); err != nil {
+		t.Errorf("password older than the history should be allowed, got %v", err)
+	}
+
+	now := time.Now()
+	if p.Expired(now.Add(-30*24*time.Hour), now) {
+		t.Error("30 day old password should not be expired")
+	}
+	if !p.Expired(now.Add(-91*24*time.Hour), now) {
+		t.Error("91 day old password should be expired")
+	}
+}
@@ -25,7 +25,7 @@ func IsSeniorDesigner(user *db.PdmUser) bool {
 // HasAnyRole checks if the user has at least one of the given roles (case-insensitive)
 func HasAnyRole(user *db.PdmUser, roles ...string) bool {
 	for _, checkRole := range roles {
-		for _, userRole := range user.Roles {
+		for _, userRole := range user.EffectiveRoles() {
 			if strings.EqualFold(userRole, checkRole) {
 				return true
 			}
@@ -0,0 +1,76 @@
+package auth_test
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/grd/FreePDM/internal/auth"
+)
+
+// Test vectors of RFC 6238 appendix B (SHA1), truncated to 6 digits.
+func TestTOTPCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := auth.TOTPCode(secret, auth.TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.code {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := auth.GenerateTOTPSecret()
+	now := time.Now()
+
+	code, _ := auth.TOTPCode(secret, auth.TOTPStep(now))
+	step, ok := auth.ValidateTOTP(secret, code, now, 0)
+	if !ok {
+		t.Fatal("valid code rejected")
+	}
+
+	// a code can't be used twice
+	if _, ok := auth.ValidateTOTP(secret, code, now, step); ok {
+		t.Error("replayed code accepted")
+	}
+
+	// clock drift of one step is fine, two is not
+	if _, ok := auth.ValidateTOTP(secret, code, now.Add(30*time.Second), 0); !ok {
+		t.Error("code of previous step rejected")
+	}
+	if _, ok := auth.ValidateTOTP(secret, code, now.Add(90*time.Second), 0); ok {
+		t.Error("code of three steps ago accepted")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != auth.RecoveryCodeCount {
+		t.Fatalf("expected %d codes, got %d", auth.RecoveryCodeCount, len(codes))
+	}
+
+	remaining, ok := auth.UseRecoveryCode(codes[3], hashes)
+	if !ok || len(remaining) != len(hashes)-1 {
+		t.Fatal("recovery code rejected")
+	}
+	if _, ok := auth.UseRecoveryCode(codes[3], remaining); ok {
+		t.Error("recovery code accepted twice")
+	}
+}
@@ -5,38 +5,752 @@
 package client
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/shared"
+	"github.com/grd/FreePDM/internal/vault/localfs"
+	"github.com/grd/FreePDM/internal/workspace"
 )
 
+// API is the client of the server, for the shell, fpg and the vcs tool.
+// The session of the login is kept in the cookie jar of the HTTP client.
 type API struct {
 	BaseURL string
 	HTTP    *http.Client
+	Retries int           // of a request that did not reach the server
+	Backoff time.Duration // before the first retry, doubled for every next one
+
+	user string          // of the session
+	ctx  context.Context // of the requests, see WithContext
+}
+
+// Options configure a new API
+type Options struct {
+	BaseURL string        // "https://pdm.example.com"
+	CAFile  string        // PEM file of a private certificate authority, next to the system ones
+	Token   string        // a session token of an earlier login, see Token
+	Timeout time.Duration // of a request, 15 seconds when zero
+	Retries int           // 3 when zero, none when negative
+	Backoff time.Duration // 500 milliseconds when zero
+}
+
+var ErrTwoFactor = errors.New("the login needs a second factor, log in with the browser first")
+
+// StatusError is an error reply of the server
+type StatusError struct {
+	Code    int // the HTTP status
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return "server error: " + http.StatusText(e.Code)
+	}
+	return "server error: " + e.Message
 }
 
-func (a *API) ListVaults() (any, any) {
-	panic("unimplemented")
+// Unreachable tells whether a request failed because the server could not
+// be reached, rather than because the server refused it.
+func Unreachable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.Code {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
 }
 
+// Constructor, with the default options
 func New(base string) *API {
+	api, _ := NewWithOptions(Options{BaseURL: base})
+	return api
+}
+
+// NewWithOptions returns an API for the options. It fails when the
+// certificate authority can not be read.
+func NewWithOptions(opts Options) (*API, error) {
+	base, err := url.Parse(strings.TrimSuffix(opts.BaseURL, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid server address %q", opts.BaseURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
 	jar, _ := cookiejar.New(nil)
-	return &API{
-		BaseURL: base,
+	if opts.Token != "" {
+		jar.SetCookies(base, []*http.Cookie{{Name: shared.SessionName, Value: opts.Token, Path: "/"}})
+	}
+
+	api := &API{
+		BaseURL: base.String(),
 		HTTP: &http.Client{
-			Timeout: 15 * time.Second,
-			Jar:     jar,
+			Timeout:   opts.Timeout,
+			Jar:       jar,
+			Transport: transport,
 		},
+		Retries: opts.Retries,
+		Backoff: opts.Backoff,
+	}
+	if api.HTTP.Timeout == 0 {
+		api.HTTP.Timeout = 15 * time.Second
+	}
+	if api.Retries == 0 {
+		api.Retries = 3
+	}
+	if api.Backoff == 0 {
+		api.Backoff = 500 * time.Millisecond
+	}
+	return api, nil
+}
+
+// WithContext returns a copy of the API whose requests end with the context
+func (a *API) WithContext(ctx context.Context) *API {
+	c := *a
+	c.ctx = ctx
+	return &c
+}
+
+func (a *API) context() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+// User returns the login name of the session
+func (a *API) User() string {
+	return a.user
+}
+
+// Token returns the session token, to start a new API without a login
+func (a *API) Token() string {
+	u, err := url.Parse(a.BaseURL)
+	if err != nil {
+		return ""
+	}
+	for _, c := range a.HTTP.Jar.Cookies(u) {
+		if c.Name == shared.SessionName {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// retryable tells whether a request can be sent again. A request that did
+// not reach the server always can, a failing GET when the server or its
+// proxy is unavailable.
+func retryable(method string, resp *http.Response, err error) bool {
+	var opErr *net.OpError
+	if err != nil {
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	if method != http.MethodGet {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// do sends a request and decodes the JSON reply into out, or reads it into
+// out when out is a *[]byte. The body is sent again from the start when the
+// request is retried.
+func (a *API) do(method, path string, query url.Values, body io.ReadSeeker, contentType string, out any) error {
+	u := a.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	ctx := a.context()
+	wait := a.Backoff
+	for try := 0; ; try++ {
+		var rd io.Reader
+		if body != nil {
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			rd = struct{ io.Reader }{body} // the client closes a body that is a Closer
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u, rd)
+		if err != nil {
+			return err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := a.HTTP.Do(req)
+		if try < a.Retries && retryable(method, resp, err) {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			wait *= 2
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("request failed: %w", err)
+		}
+		defer resp.Body.Close()
+		return decodeReply(resp, out)
 	}
 }
 
+// decodeReply decodes a JSON reply, or returns the error of the server
+func decodeReply(resp *http.Response, out any) error {
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var errResp map[string]string
+		if json.Unmarshal(msg, &errResp) == nil {
+			return &StatusError{Code: resp.StatusCode, Message: errResp["error"]}
+		}
+		return &StatusError{Code: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if out == nil {
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		buf, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		*raw = buf
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// Login starts a session with the server. The session cookie stays in the
+// cookie jar of the HTTP client.
 func (a *API) Login(user, pass string) error {
-	// TODO: implement POST /login and error handling.
+	form := url.Values{"login_name": {user}, "password": {pass}}
+
+	// The server redirects after the login, where to tells how it went
+	noRedirect := *a.HTTP
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	req, err := http.NewRequestWithContext(a.context(), http.MethodPost, a.BaseURL+"/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSeeOther {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &StatusError{Code: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if strings.HasPrefix(resp.Header.Get("Location"), "/login/2fa") {
+		return ErrTwoFactor
+	}
+	a.user = user
+	return nil
+}
+
+// Logout ends the session
+func (a *API) Logout() error {
+	noRedirect := *a.HTTP
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	req, err := http.NewRequestWithContext(a.context(), http.MethodPost, a.BaseURL+"/logout", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	resp.Body.Close()
+	a.user = ""
 	return nil
 }
 
+// Command runs a vault command and returns the data of the reply
+func (a *API) Command(vault, command string, params map[string]string) ([]string, error) {
+	resp, err := a.command(vault, command, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Data, nil
+}
+
+// command runs a vault command and returns the reply, with its error
+func (a *API) command(vault, command string, params map[string]string) (*shared.CommandResponse, error) {
+	data, err := json.Marshal(shared.CommandRequest{User: a.user, Vault: vault, Command: command, Params: params})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	var resp shared.CommandResponse
+	if err := a.do(http.MethodPost, "/command", nil, bytes.NewReader(data), "application/json", &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Item is a container in a directory of a vault, by its container number
+// or else by its file name.
+type Item struct {
+	Dir       string
+	Container string
+	File      string
+}
+
+func (it Item) params() map[string]string {
+	params := map[string]string{"path": it.Dir}
+	if it.Container != "" {
+		params["container"] = it.Container
+	} else {
+		params["file"] = it.File
+	}
+	return params
+}
+
 // Domain types
 type Vault struct {
 	Name string
 	// add fields later (ID, path, etc.)
 }
+
+// ListVaults returns the vaults that the user has access to
+func (a *API) ListVaults() ([]Vault, error) {
+	names, err := a.Command("", "list", nil)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Vault, len(names))
+	for i, name := range names {
+		list[i] = Vault{Name: name}
+	}
+	return list, nil
+}
+
+// Root returns the vaults directory of the server, for admins
+func (a *API) Root() (string, error) {
+	data, err := a.Command("", "root", nil)
+	if err != nil {
+		return "", err
+	}
+	if len(data) != 1 {
+		return "", fmt.Errorf("unexpected reply of root: %q", data)
+	}
+	return data[0], nil
+}
+
+// Reserve reserves a block of part numbers of a project for later use
+func (a *API) Reserve(project, itemType string, count int) ([]string, error) {
+	return a.Command("", "reserve", map[string]string{"project": project, "type": itemType, "count": strconv.Itoa(count)})
+}
+
+// DirExists tells whether a directory of a vault exists
+func (a *API) DirExists(vault, dir string) (bool, error) {
+	resp, err := a.command(vault, "direxists", map[string]string{"path": dir})
+	if err != nil {
+		return false, err
+	}
+	return strings.HasSuffix(resp.Error, " exists"), nil
+}
+
+// List returns the names of the directories and files in a directory
+func (a *API) List(vault, dir string) ([]string, error) {
+	return a.Command(vault, "ls", map[string]string{"path": dir})
+}
+
+// Tree returns the paths of the directories and files under a directory.
+// The directories end with a slash.
+func (a *API) Tree(vault, dir string) ([]string, error) {
+	return a.Command(vault, "tree", map[string]string{"path": dir})
+}
+
+// Mkdir creates the directory name in dir
+func (a *API) Mkdir(vault, dir, name string) error {
+	_, err := a.Command(vault, "mkdir", map[string]string{"path": dir, "name": name})
+	return err
+}
+
+// Rmdir removes the empty directory name in dir
+func (a *API) Rmdir(vault, dir, name string) error {
+	_, err := a.Command(vault, "rmdir", map[string]string{"path": dir, "name": name})
+	return err
+}
+
+// AllocateOptions choose the part number of a new container: a reserved
+// number, or a new one of the scheme of the project and the item type.
+type AllocateOptions struct {
+	Number  string
+	Project string
+	Type    string
+}
+
+// Allocate allocates an empty container in dir. It returns the container
+// number and the part number, which is empty without a numbering scheme.
+func (a *API) Allocate(vault, dir string, opts AllocateOptions) (string, string, error) {
+	params := map[string]string{"path": dir}
+	for key, value := range map[string]string{"number": opts.Number, "project": opts.Project, "type": opts.Type} {
+		if value != "" {
+			params[key] = value
+		}
+	}
+	data, err := a.Command(vault, "allocate", params)
+	if err != nil {
+		return "", "", err
+	}
+	switch len(data) {
+	case 1:
+		return data[0], "", nil
+	case 2:
+		return data[0], data[1], nil
+	}
+	return "", "", fmt.Errorf("unexpected reply of allocate: %q", data)
+}
+
+// Assign gives the allocated container the file name of the file that was
+// stored in it.
+func (a *API) Assign(vault, container, file string) error {
+	_, err := a.Command(vault, "assign", map[string]string{"path": "", "container": container, "file": file})
+	return err
+}
+
+// Remove removes a container and returns its number
+func (a *API) Remove(vault string, it Item) (string, error) {
+	return a.single(vault, "rm", it.params())
+}
+
+// Rename renames or moves the file or directory src to dst, both paths in
+// the vault. When dst is a directory src keeps its name. It returns the new
+// path.
+func (a *API) Rename(vault, src, dst string) (string, error) {
+	return a.single(vault, "rename", map[string]string{"path": "", "src": src, "dst": dst})
+}
+
+// Copy copies the latest version of the file src, or the directory src
+// with its files, to dst like Rename
+func (a *API) Copy(vault, src, dst string) (string, error) {
+	return a.single(vault, "copy", map[string]string{"path": "", "src": src, "dst": dst})
+}
+
+// Property is a line of the information of a version
+type Property struct {
+	Key, Value string
+}
+
+// Info returns a version of a container, the latest when the version is
+// negative: the name, number, date, check out and properties.
+func (a *API) Info(vault string, it Item, version int16) ([]Property, error) {
+	params := it.params()
+	if version >= 0 {
+		params["version"] = strconv.Itoa(int(version))
+	}
+	data, err := a.Command(vault, "info", params)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Property, 0, len(data))
+	for _, line := range data {
+		key, value, _ := strings.Cut(line, ": ")
+		list = append(list, Property{Key: key, Value: value})
+	}
+	return list, nil
+}
+
+// Versions returns the versions of a container
+func (a *API) Versions(vault string, it Item) ([]shared.VersionInfo, error) {
+	data, err := a.Command(vault, "versions", it.params())
+	if err != nil {
+		return nil, err
+	}
+	list := make([]shared.VersionInfo, 0, len(data))
+	for _, line := range data {
+		v, err := shared.ParseVersionInfo(line)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// CheckOut checks out a version of a container, the latest one when the
+// version is negative. It returns the version.
+func (a *API) CheckOut(vault string, it Item, version int16) (int16, error) {
+	params := it.params()
+	if version >= 0 {
+		params["version"] = strconv.Itoa(int(version))
+	}
+	return a.versionCommand(vault, "checkout", params)
+}
+
+// UndoCheckOut releases the check-out of the user without a check-in
+func (a *API) UndoCheckOut(vault string, it Item) (int16, error) {
+	return a.versionCommand(vault, "undocheckout", it.params())
+}
+
+// CheckInOptions are the data that go with a check in
+type CheckInOptions struct {
+	Description     string
+	LongDescription string
+	Properties      map[string]string // of the version, such as "Volume" and "Material" of a model
+
+	// The containers that the version uses, see workspace.References. Nil
+	// leaves the references as they are, an empty list clears them.
+	References []layout.Reference
+}
+
+// CheckIn checks in the version of a container that the user checked out
+func (a *API) CheckIn(vault string, it Item, opts CheckInOptions) (int16, error) {
+	params := it.params()
+	params["description"] = opts.Description
+	params["long_description"] = opts.LongDescription
+	if len(opts.Properties) > 0 {
+		params["properties"] = shared.PropertiesParam(opts.Properties)
+	}
+	if opts.References != nil {
+		params["references"] = shared.ReferencesParam(opts.References)
+	}
+	return a.versionCommand(vault, "checkin", params)
+}
+
+// NewVersion creates a new version of a container, which is checked out
+func (a *API) NewVersion(vault string, it Item) (int16, error) {
+	return a.versionCommand(vault, "newversion", it.params())
+}
+
+func (a *API) versionCommand(vault, command string, params map[string]string) (int16, error) {
+	data, err := a.single(vault, command, params)
+	if err != nil {
+		return 0, err
+	}
+	nr, err := strconv.ParseInt(data, 10, 16)
+	return int16(nr), err
+}
+
+// single runs a command with a reply of one line
+func (a *API) single(vault, command string, params map[string]string) (string, error) {
+	data, err := a.Command(vault, command, params)
+	if err != nil {
+		return "", err
+	}
+	if len(data) != 1 {
+		return "", fmt.Errorf("unexpected reply of %s: %q", command, data)
+	}
+	return data[0], nil
+}
+
+// TransferClient returns the HTTP client of the API, with the session of
+// the user, for transfers of files that take longer than a request. Only
+// the reply of the server has to come within the timeout of a request,
+// the transfer itself ends with its context.
+func (a *API) TransferClient() *http.Client {
+	c := *a.HTTP
+	if t, ok := c.Transport.(*http.Transport); ok && c.Timeout > 0 {
+		t = t.Clone()
+		t.ResponseHeaderTimeout = c.Timeout
+		c.Transport = t
+	}
+	c.Timeout = 0
+	return &c
+}
+
+// Import uploads a local file into the directory dir of a vault and
+// returns the container number. The new container is checked out.
+func (a *API) Import(vault, dir, file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// A large file takes longer than a request
+	upload := *a
+	upload.HTTP = a.TransferClient()
+
+	q := url.Values{"path": {dir}, "name": {filepath.Base(file)}}
+	var resp shared.CommandResponse
+	if err := upload.do(http.MethodPost, "/api/import/"+url.PathEscape(vault), q, f, "application/octet-stream", &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Data) != 1 {
+		return "", fmt.Errorf("unexpected reply of import: %q", resp.Data)
+	}
+	return resp.Data[0], nil
+}
+
+// WhereUsed returns the parents that refer to a container. An empty vault
+// searches the container number in all vaults, recursive adds the parents
+// of the parents.
+func (a *API) WhereUsed(vault, container string, recursive bool) ([]shared.WhereUsed, error) {
+	q := url.Values{}
+	if vault != "" {
+		q.Set("vault", vault)
+	}
+	if recursive {
+		q.Set("recursive", "1")
+	}
+
+	var list []shared.WhereUsed
+	if err := a.do(http.MethodGet, "/api/whereused/"+url.PathEscape(container), q, nil, "", &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// SearchOptions narrows a search
+type SearchOptions struct {
+	Vault string // "" for all vaults
+	State string // the revision state, "" for any
+	Limit int    // 0 for the limit of the server
+}
+
+// Search returns the containers whose name, container number, part number,
+// description or material contain the text.
+func (a *API) Search(text string, opts SearchOptions) ([]shared.SearchResult, error) {
+	q := url.Values{"q": {text}}
+	if opts.Vault != "" {
+		q.Set("vault", opts.Vault)
+	}
+	if opts.State != "" {
+		q.Set("state", opts.State)
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	var list []shared.SearchResult
+	if err := a.do(http.MethodGet, "/api/search", q, nil, "", &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Thumbnail returns the PNG thumbnail of the latest version of the
+// container rel, the path of its directory.
+func (a *API) Thumbnail(vault, rel string) ([]byte, error) {
+	var png []byte
+	if err := a.do(http.MethodGet, "/api/thumbnail/"+url.PathEscape(vault), url.Values{"path": {rel}}, nil, "", &png); err != nil {
+		return nil, err
+	}
+	return png, nil
+}
+
+// Container returns the versions, the check outs and the file hashes of a
+// container on the server. It makes the API the remote of a workspace.
+func (a *API) Container(vault, rel string) (*workspace.Container, error) {
+	var c workspace.Container
+	if err := a.do(http.MethodGet, "/api/status/"+url.PathEscape(vault), url.Values{"path": {rel}}, nil, "", &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ErrEventsEnded is the error of Events when the server ends the stream
+var ErrEventsEnded = errors.New("the server ended the events")
+
+// Events follows the changes of the vaults on the server, of all vaults of
+// the user when none are given, and calls fn with every change. It returns
+// when the context ends or the stream breaks, the caller connects again.
+func (a *API) Events(ctx context.Context, vaults []string, fn func(ev localfs.Event)) error {
+	u := a.BaseURL + "/api/events"
+	if len(vaults) > 0 {
+		u += "?" + url.Values{"vault": vaults}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	stream := *a.HTTP
+	stream.Timeout = 0 // the stream stays open
+	resp, err := stream.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return decodeReply(resp, nil)
+	}
+
+	// An event is a block of lines that ends with an empty line, its data
+	// can be spread over several "data:" lines.
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	var data []byte
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var ev localfs.Event
+			if err := json.Unmarshal(data, &ev); err == nil {
+				fn(ev)
+			}
+			data = data[:0]
+		case strings.HasPrefix(line, "data:"):
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	return ErrEventsEnded
+}
@@ -0,0 +1,214 @@
+package client_test
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/client"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/shared"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The volume and material of a check in travel with the command to the
+// server, which turns them into the weight of the model.
+func TestCheckInProperties(t *testing.T) {
+	gormdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "items.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open SQLite DB: %v", err)
+	}
+	err = gormdb.AutoMigrate(&db.PdmUser{}, &db.PdmProject{}, &db.PdmItem{}, &db.PdmMaterial{}, &db.PdmModel{}, &db.PdmDocument{})
+	if err != nil {
+		t.Fatalf("failed to migrate schema: %v", err)
+	}
+	items := db.NewItemRepo(gormdb)
+	materials := db.NewMaterialRepo(gormdb)
+	if _, err := materials.CreateMaterial("Steel", "", 7.85, db.D_gcm3); err != nil {
+		t.Fatal(err)
+	}
+	if err := items.RecordImport("vault", "7", "parts", "bracket.FCStd", "jdoe"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server side of the checkin command
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req shared.CommandRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Command != "checkin" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		props, err := shared.ParsePropertiesParam(req.Params["properties"])
+		if err == nil {
+			err = materials.RecordProperties(req.Vault, req.Params["container"], props)
+		}
+		if err != nil {
+			json.NewEncoder(w).Encode(shared.CommandResponse{Error: err.Error()})
+			return
+		}
+		json.NewEncoder(w).Encode(shared.CommandResponse{Data: []string{"1"}})
+	}))
+	defer srv.Close()
+
+	api := client.New(srv.URL)
+	opts := client.CheckInOptions{
+		Description: "thicker",
+		Properties:  map[string]string{db.PropertyVolume: "10000 mm^3", db.PropertyMaterial: "steel"},
+	}
+	nr, err := api.CheckIn("vault", client.Item{Dir: "parts", Container: "7"}, opts)
+	if err != nil || nr != 1 {
+		t.Fatalf("CheckIn = %d, %v", nr, err)
+	}
+
+	var model db.PdmModel
+	if err := gormdb.Where("vault = ? AND container_number = ?", "vault", "7").First(&model).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 10 cm^3 of steel is 78.5 g
+	if model.ModelVolume != 10000 || model.ModelWeight < 0.0784 || model.ModelWeight > 0.0786 {
+		t.Errorf("model volume %g, weight %g; want 10000 and 0.0785", model.ModelVolume, model.ModelWeight)
+	}
+}
+
+func TestCheckInParams(t *testing.T) {
+	props := map[string]string{"Volume": "1 cm^3", "Material": "Steel"}
+	got, err := shared.ParsePropertiesParam(shared.PropertiesParam(props))
+	if err != nil || len(got) != 2 || got["Volume"] != "1 cm^3" {
+		t.Errorf("round trip = %v, %v", got, err)
+	}
+
+	for _, param := range []string{`{"": "x"}`, `{"a = b": "x"}`, `{"Note": "two\nlines"}`, `["Volume"]`} {
+		if _, err := shared.ParsePropertiesParam(param); err == nil {
+			t.Errorf("%s accepted", param)
+		}
+	}
+
+	refs := []layout.Reference{{Vault: "main", Container: "7", Version: 1}}
+	back, err := shared.ParseReferencesParam(shared.ReferencesParam(refs))
+	if err != nil || len(back) != 1 || back[0] != refs[0] {
+		t.Errorf("references round trip = %v, %v", back, err)
+	}
+	if back, err := shared.ParseReferencesParam(shared.ReferencesParam([]layout.Reference{})); err != nil || back == nil {
+		t.Errorf("no references = %v, %v; want an empty list", back, err)
+	}
+}
+
+// A GET is retried when the server is unavailable, with a growing wait in
+// between. A command changes something and is sent once.
+func TestRetry(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= 2 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method == http.MethodPost {
+			json.NewEncoder(w).Encode(shared.CommandResponse{Data: []string{"main"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"versions": []any{}, "files": map[string]string{}})
+	}))
+	defer srv.Close()
+
+	api, err := client.NewWithOptions(client.Options{BaseURL: srv.URL, Backoff: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := api.Container("main", "parts/7"); err != nil {
+		t.Fatal(err)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("retried after %v, want a wait of 20 and 40 ms", elapsed)
+	}
+
+	hits.Store(0)
+	_, err = api.ListVaults()
+	var status *client.StatusError
+	if !errors.As(err, &status) || status.Code != http.StatusServiceUnavailable || hits.Load() != 1 {
+		t.Errorf("command = %v after %d requests, want one 503", err, hits.Load())
+	}
+
+	// No retries at all
+	api, _ = client.NewWithOptions(client.Options{BaseURL: srv.URL, Retries: -1})
+	hits.Store(0)
+	if _, err := api.Container("main", "parts/7"); err == nil || hits.Load() != 1 {
+		t.Errorf("without retries = %v after %d requests", err, hits.Load())
+	}
+
+	// A server that is down is retried too, and is unreachable
+	srv.Close()
+	api, _ = client.NewWithOptions(client.Options{BaseURL: srv.URL, Retries: 2, Backoff: 10 * time.Millisecond})
+	start = time.Now()
+	_, err = api.Container("main", "parts/7")
+	if !client.Unreachable(err) || time.Since(start) < 30*time.Millisecond {
+		t.Errorf("down server = %v after %v", err, time.Since(start))
+	}
+}
+
+// A server with a certificate of a private authority is trusted with the
+// PEM file of the authority.
+func TestPrivateCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(shared.CommandResponse{Data: []string{"main"}})
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, cert, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	api, err := client.NewWithOptions(client.Options{BaseURL: srv.URL, CAFile: caFile, Retries: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, err := api.ListVaults(); err != nil || len(list) != 1 {
+		t.Errorf("with the authority = %v, %v", list, err)
+	}
+
+	api, _ = client.NewWithOptions(client.Options{BaseURL: srv.URL, Retries: -1})
+	if _, err := api.ListVaults(); err == nil {
+		t.Error("a certificate of an unknown authority is trusted")
+	}
+
+	notPEM := filepath.Join(dir, "ca.txt")
+	if err := os.WriteFile(notPEM, []byte("no certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.NewWithOptions(client.Options{BaseURL: srv.URL, CAFile: notPEM}); err == nil {
+		t.Error("a CA file without certificates is accepted")
+	}
+}
+
+// The transfers have no timeout of their own, only the reply has
+func TestTransferClient(t *testing.T) {
+	api, err := client.NewWithOptions(client.Options{BaseURL: "https://pdm.example.com", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := api.TransferClient()
+	if c.Timeout != 0 || c.Jar != api.HTTP.Jar {
+		t.Errorf("transfer client timeout %v, same session %v", c.Timeout, c.Jar == api.HTTP.Jar)
+	}
+	if tr, ok := c.Transport.(*http.Transport); !ok || tr.ResponseHeaderTimeout != 5*time.Second {
+		t.Errorf("transfer client transport %+v", c.Transport)
+	}
+	if api.HTTP.Timeout != 5*time.Second {
+		t.Errorf("the timeout of the API changed to %v", api.HTTP.Timeout)
+	}
+}
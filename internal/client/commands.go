@@ -5,10 +5,13 @@
 package client
 
 import (
-	"bufio"
 	"fmt"
-	"log"
+	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -40,10 +43,45 @@ const (
 
 var (
 	currentVault = "" // Placeholder for the current vault
-	currentDir   = "" // Initial directory
+	currentDir   = "" // Initial directory, the root of the vault
 	user         = "" // Login name
+
+	editor *lineEditor // of the prompt
 )
 
+// The commands of the shell, for the tab completion
+var commands = []string{
+	"help", "login", "list", "vault", "pwd", "ls", "tree", "cd", "mkdir", "rmdir", "import",
+	"allocate", "assign", "rm", "mv", "rename", "copy", "versions", "newversion",
+	"checkout", "checkin", "info", "exit", "quit",
+}
+
+// The number of arguments of the commands that have them
+var commandArgs = map[string]struct {
+	min, max int
+	usage    string
+}{
+	"login":      {0, 1, "login [name]"},
+	"vault":      {1, 1, "vault <name>"},
+	"ls":         {0, 1, "ls [dir]"},
+	"tree":       {0, 1, "tree [dir]"},
+	"cd":         {1, 1, "cd <directory>"},
+	"mkdir":      {1, 1, "mkdir <dir>"},
+	"rmdir":      {1, 1, "rmdir <dir>"},
+	"import":     {1, 1, "import <file>"},
+	"allocate":   {0, 0, "allocate"},
+	"assign":     {2, 2, "assign <cont nr> <file>"},
+	"rm":         {1, 1, "rm <file>"},
+	"mv":         {2, 2, "mv <src> <dst>"},
+	"rename":     {2, 2, "rename <src> <dst>"},
+	"copy":       {2, 2, "copy <src> <dst>"},
+	"versions":   {1, 1, "versions <file>"},
+	"newversion": {1, 1, "newversion <file>"},
+	"checkout":   {1, 2, "checkout <file> [version]"},
+	"checkin":    {1, 2, "checkin <file> [version]"},
+	"info":       {1, 2, "info <file> [version]"},
+}
+
 // handleCommand processes the input command and executes corresponding actions.
 func handleCommand(input string, directory string) {
 	// Split the command and arguments
@@ -57,33 +95,58 @@ func handleCommand(input string, directory string) {
 	command := parts[0]
 	args := parts[1:]
 
+	if n, ok := commandArgs[command]; ok && (len(args) < n.min || len(args) > n.max) {
+		fmt.Println(Cyan + "Usage: " + n.usage + Reset)
+		return
+	}
+
+	// Everything except a few commands works inside a vault
+	switch command {
+	case "help", "login", "list", "vault", "pwd", "exit", "quit":
+	default:
+		if currentVault == "" {
+			fmt.Println(Red + "First set the vault with the command vault" + Reset)
+			return
+		}
+	}
+
 	switch command {
 	case "help":
 		handleHelp()
+	case "login":
+		handleLogin(args)
 	case "list":
 		handleList()
 	case "vault":
 		handleVault(args[0])
 	case "tree":
-		handleTree(args[0])
+		handleTree(argOr(args, directory))
 	case "pwd":
 		handlePwd()
 	case "ls":
-		handleLs(directory)
+		handleLs(argOr(args, directory))
 	case "cd":
-		if len(args) < 1 {
-			fmt.Println(Cyan + "Usage: cd <directory>" + Reset)
-			return
-		}
 		handleCd(args[0])
+	case "mkdir", "rmdir":
+		handleDir(command, args[0])
+	case "import":
+		handleImport(args[0])
 	case "allocate": // returns the ID
 		handleAllocate()
 	case "assign":
 		id := args[0]
 		file := args[1]
 		handleAssign(id, file)
-	// case "rm":
-	// 	handleFileRemove()
+	case "rm":
+		handleFileRemove(args[0])
+	case "mv", "rename", "copy":
+		handleRenameCopy(command, args[0], args[1])
+	case "versions":
+		handleVersions(args[0])
+	case "newversion", "checkout", "checkin":
+		handleVersionCommand(command, args)
+	case "info":
+		handleInfo(args)
 	case "exit", "quit":
 		fmt.Println(Cyan + "Exiting the shell." + Reset)
 		os.Exit(0)
@@ -98,11 +161,12 @@ Welcome to the FreePDM help!
 
 Commands available:
 - help                       : Show help
+- login [name]               : Log in to the server, the password is asked
 - list                       : Show the list of vaults
 - vault <name>               : Activate a vault (shows in the prompt)
 - pwd                        : Show current directory (shows in the prompt)
-- ls                         : List files in the current directory
-- tree                       : Shows a tree of files and directories from the pwd
+- ls [dir]                   : List files in the current directory
+- tree [dir]                 : Shows a tree of files and directories from the pwd
 - cd <dir>                   : Change to a different directory
 - mkdir <dir>                : Create a directory
 - rmdir <dir>                : Remove an empty directory
@@ -113,168 +177,382 @@ Commands available:
 - mv <src> <dst>             : Move a file. Move file between vaults is not yet available
 - rename <src> <dst>         : Rename a file. Rename file between vaults is not yet available
 - copy <src> <dst>           : Copy a file. Copy file between vaults is not yet available
-- versions <file>            : Returns the number of versions
+- versions <file>            : Returns the versions of a file
 - newversion <file>          : Creates a new version of a file and check out
-- checkout <file> <version>  : Checks out a file. No-one but you can modify it
-- checkin <file> <version>   : Check in a file
-- info <file> <version>      : Returns the parameters of a file. If no version show the latest
+- checkout <file> [version]  : Checks out a file. No-one but you can modify it
+- checkin <file> [version]   : Check in a file, the descriptions are asked
+- info <file> [version]      : Returns the parameters of a file. If no version show the latest
 - exit                       : Quit the program
+
+Tab completes commands, vaults and files. The arrow keys browse the history.
 `
 	fmt.Println(message)
 }
 
+// argOr returns the first argument as a vault path, or else def
+func argOr(args []string, def string) string {
+	if len(args) == 0 {
+		return def
+	}
+	return vaultPath(args[0])
+}
+
+// vaultPath returns the path of p in the vault. A path that starts with a
+// slash starts at the root of the vault, otherwise at the current directory.
+func vaultPath(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(currentDir, p)
+	}
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// fileItem returns the item of a file argument
+func fileItem(file string) Item {
+	p := vaultPath(file)
+	dir := path.Dir(p)
+	if dir == "." {
+		dir = ""
+	}
+	return Item{Dir: dir, File: path.Base(p)}
+}
+
+// failed prints the error, when there is one
+func failed(err error) bool {
+	if err != nil {
+		fmt.Println(Red + err.Error() + Reset)
+		return true
+	}
+	return false
+}
+
+// handleLogin starts a session with the server
+func handleLogin(args []string) {
+	name := user
+	if len(args) > 0 {
+		name = args[0]
+	}
+	password, err := editor.readPassword("Password for " + name + ": ")
+	if failed(err) {
+		return
+	}
+	if err := shellAPI.Login(name, password); err != nil {
+		fmt.Println(Red + "Login failed: " + err.Error() + Reset)
+		return
+	}
+	user = name
+	fmt.Println(BrightGreen + "Logged in as " + name + Reset)
+}
+
 // handleList the list of vaults.
 func handleList() {
-	resp, err := sendCommand("list", nil)
-	if err != nil {
-		log.Println(err)
+	list, err := shellAPI.ListVaults()
+	if failed(err) {
+		return
 	}
-	if resp.Error == "Failed to show the list of vaults" {
-		fmt.Println(Red + resp.Error + Reset)
-	} else {
-		fmt.Printf(Cyan+"Data = %s\n"+Reset, resp.Data)
+	for _, vault := range list {
+		fmt.Println(Cyan + vault.Name + Reset)
 	}
 }
 
 // handleVault changes the current vault.
 func handleVault(vault string) {
-	resp, err := sendCommand("list", nil)
-	if err != nil {
-		fmt.Println(err)
-	}
-	if resp.Error == "Failed to show the list of vaults" {
-		fmt.Println(Cyan + resp.Error + Reset)
+	list, err := shellAPI.ListVaults()
+	if failed(err) {
 		return
 	}
-
-	for _, elem := range resp.Data {
-		if vault == elem {
-			currentVault = elem
-			currentDir = "."
-			break
-		}
+	if !slices.Contains(list, Vault{Name: vault}) {
+		fmt.Printf(Red+"Vault %s not found\n"+Reset, vault)
+		return
 	}
+	currentVault = vault
+	currentDir = ""
 	fmt.Printf(BrightGreen+"Switched to vault: %s\n"+Reset, vault)
 }
 
-// handleTree changes the current vault.
-func handleTree(path string) {
-	resp, err := sendCommand("tree", map[string]string{
-		"path": path,
-	})
-	if err != nil {
-		fmt.Println(err)
-	}
-	if resp.Error == "Failed to show the tree" {
-		fmt.Println(Cyan + resp.Error + Reset)
+// handleTree shows the directories and files under dir.
+func handleTree(dir string) {
+	list, err := shellAPI.Tree(currentVault, dir)
+	if failed(err) {
 		return
 	}
 
-	for _, elem := range resp.Data {
-		fmt.Println(elem)
+	for _, elem := range list {
+		rel := strings.TrimPrefix(elem, dir+"/")
+		if dir == "" {
+			rel = elem
+		}
+		depth := strings.Count(strings.TrimSuffix(rel, "/"), "/")
+		name := path.Base(strings.TrimSuffix(rel, "/"))
+		if strings.HasSuffix(rel, "/") {
+			fmt.Println(strings.Repeat("    ", depth) + Blue + name + "/" + Reset)
+		} else {
+			fmt.Println(strings.Repeat("    ", depth) + name)
+		}
 	}
 }
 
-// handleLs lists files and directories in the current directory.
+// handleLs lists files and directories in the directory.
 func handleLs(directory string) {
-	resp, err := sendCommand("ls", map[string]string{
-		"path": directory,
-	})
-	if err != nil {
-		fmt.Println(err)
+	list, err := shellAPI.List(currentVault, directory)
+	if failed(err) {
+		return
+	}
+	for _, name := range list {
+		fmt.Println(name)
 	}
-	fmt.Printf("Error = %s\n", resp.Error)
-	fmt.Printf("Data = %s\n", resp.Data)
 }
 
 // handleCd changes the current working directory.
 func handleCd(target string) {
-	fmt.Printf("dir = %s\n", target)
-	if currentVault == "" {
-		fmt.Println(Red + "First set the vault with the command vault" + Reset)
+	dir := vaultPath(target)
+	ok, err := shellAPI.DirExists(currentVault, dir)
+	if failed(err) {
 		return
 	}
-	resp, err := sendCommand("direxists", map[string]string{
-		"path": target,
-	})
-	if err != nil {
-		fmt.Println(err)
-	}
-	if resp.Error != "Directory "+target+" exists" {
+	if !ok {
 		fmt.Printf(Red+"directory %s does not exist\n"+Reset, target)
 		return
 	}
-	if target == ".." { // Up one level
-		if target != "/" {
-			lastSlash := strings.LastIndex(target, "/")
-			target = (target)[:lastSlash]
-			if target == "" {
-				target = "/"
-			}
-		}
-	}
-	fmt.Printf(Cyan+"Changed directory to: %s\n", target)
-	currentDir = target
+	currentDir = dir
 }
 
 // handlePwd prints the current working directory.
 func handlePwd() {
-	fmt.Println("Current directory:", currentDir)
+	fmt.Println("Current directory:", "/"+currentDir)
+}
+
+// handleDir creates or removes a directory.
+func handleDir(cmd, dir string) {
+	p := vaultPath(dir)
+	if p == "" {
+		fmt.Println(Red + "Not the root of the vault" + Reset)
+		return
+	}
+	parent := path.Dir(p)
+	if parent == "." {
+		parent = ""
+	}
+
+	if cmd == "mkdir" {
+		if !failed(shellAPI.Mkdir(currentVault, parent, path.Base(p))) {
+			fmt.Printf(Cyan+"Created /%s\n"+Reset, p)
+		}
+	} else if !failed(shellAPI.Rmdir(currentVault, parent, path.Base(p))) {
+		fmt.Printf(Cyan+"Removed /%s\n"+Reset, p)
+	}
+}
+
+// handleImport uploads a local file into the current directory.
+func handleImport(file string) {
+	number, err := shellAPI.Import(currentVault, currentDir, file)
+	if failed(err) {
+		return
+	}
+	fmt.Printf(Cyan+"Imported %s as container %s, it is checked out\n"+Reset, filepath.Base(file), number)
 }
 
 // allocates a new container inside the current vault and path.
 // Returns the container number.
 func handleAllocate() {
-	if currentVault == "" {
-		fmt.Println(Red + "First set the vault with the command vault" + Reset)
+	number, partNumber, err := shellAPI.Allocate(currentVault, currentDir, AllocateOptions{})
+	if failed(err) {
 		return
 	}
+	fmt.Printf(Cyan+"Container number = %s\n"+Reset, number)
+	if partNumber != "" {
+		fmt.Printf(Cyan+"Part number = %s\n"+Reset, partNumber)
+	}
+}
 
-	resp, err := sendCommand("allocate", map[string]string{
-		"vault": currentVault,
-		"path":  currentDir,
-	})
-	if err != nil {
-		fmt.Println(err)
+// assigns a file to a container id
+func handleAssign(id, file string) {
+	if !failed(shellAPI.Assign(currentVault, id, file)) {
+		fmt.Printf(Cyan+"Assigned %s to container %s\n"+Reset, file, id)
 	}
-	if resp.Error == "Failed to allocate a container" {
-		fmt.Println(Red + resp.Error + Reset)
+}
+
+// removes a file (container)
+func handleFileRemove(file string) {
+	number, err := shellAPI.Remove(currentVault, fileItem(file))
+	if !failed(err) {
+		fmt.Printf(Cyan+"Removed %s, container %s\n"+Reset, file, number)
 	}
+}
 
-	if len(resp.Data) > 0 {
-		fmt.Printf(Cyan+"Container number = %s\n"+Reset, resp.Data[0])
+// moves, renames or copies a file inside the vault
+func handleRenameCopy(cmd, src, dst string) {
+	var dest string
+	var err error
+	if cmd == "copy" {
+		dest, err = shellAPI.Copy(currentVault, vaultPath(src), vaultPath(dst))
 	} else {
-		fmt.Println(Red + "A serious error..." + Reset)
+		dest, err = shellAPI.Rename(currentVault, vaultPath(src), vaultPath(dst))
+	}
+	if !failed(err) {
+		fmt.Printf(Cyan+"%s -> /%s\n"+Reset, src, dest)
 	}
 }
 
-// assigns a file to a container id
-func handleAssign(id, file string) {
+// shows the versions of a file
+func handleVersions(file string) {
+	list, err := shellAPI.Versions(currentVault, fileItem(file))
+	if failed(err) {
+		return
+	}
+	for _, v := range list {
+		text := fmt.Sprintf("%4d  %-10s %s", v.Number, v.Pretty, v.Date)
+		if v.LockedBy != "" {
+			text += Yellow + "  checked out by " + v.LockedBy + Reset
+		}
+		if descr := strings.TrimSpace(v.Description); descr != "" {
+			text += "  " + descr
+		}
+		fmt.Println(text)
+	}
+}
 
+// versionArg returns the optional version argument, -1 without one
+func versionArg(args []string) (int16, error) {
+	if len(args) < 2 {
+		return -1, nil
+	}
+	nr, err := strconv.ParseInt(args[1], 10, 16)
+	if err != nil || nr < 0 {
+		return 0, fmt.Errorf("invalid version %s", args[1])
+	}
+	return int16(nr), nil
 }
 
-func NewPrompt() {
+// creates a new version, checks out or checks in a file
+func handleVersionCommand(cmd string, args []string) {
+	it := fileItem(args[0])
+	version, err := versionArg(args)
+	if failed(err) {
+		return
+	}
+
+	var nr int16
+	switch cmd {
+	case "newversion":
+		nr, err = shellAPI.NewVersion(currentVault, it)
+	case "checkout":
+		nr, err = shellAPI.CheckOut(currentVault, it, version)
+	case "checkin":
+		var descr, longDescr string
+		if descr, err = editor.readPrompt("Description: "); err != nil {
+			return
+		}
+		if longDescr, err = editor.readPrompt("Long description: "); err != nil {
+			return
+		}
+		nr, err = shellAPI.CheckIn(currentVault, it, CheckInOptions{Description: descr, LongDescription: longDescr})
+	}
+	if failed(err) {
+		return
+	}
+
+	switch cmd {
+	case "newversion":
+		fmt.Printf(Cyan+"Created version %d of %s, it is checked out\n"+Reset, nr, args[0])
+	case "checkout":
+		fmt.Printf(Cyan+"Checked out version %d of %s\n"+Reset, nr, args[0])
+	case "checkin":
+		fmt.Printf(Cyan+"Checked in version %d of %s\n"+Reset, nr, args[0])
+	}
+}
+
+// shows a version of a file and its properties
+func handleInfo(args []string) {
+	version, err := versionArg(args)
+	if failed(err) {
+		return
+	}
+	list, err := shellAPI.Info(currentVault, fileItem(args[0]), version)
+	if failed(err) {
+		return
+	}
+	for _, prop := range list {
+		fmt.Println(prop.Key + ": " + prop.Value)
+	}
+}
+
+// complete returns the candidates for the word of a command line
+func complete(args []string, word string) []string {
+	var names []string
+	switch {
+	case len(args) == 0:
+		names = commands
+	case args[0] == "vault" && len(args) == 1:
+		list, _ := shellAPI.ListVaults()
+		for _, v := range list {
+			names = append(names, v.Name)
+		}
+	case args[0] == "import":
+		matches, _ := filepath.Glob(word + "*")
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.IsDir() {
+				m += string(filepath.Separator)
+			}
+			names = append(names, m)
+		}
+		return names
+	case currentVault != "":
+		// The files in the directory of the word
+		dir, prefix := "", word
+		if i := strings.LastIndex(word, "/"); i >= 0 {
+			dir, prefix = word[:i+1], word[i+1:]
+		}
+		list, err := shellAPI.List(currentVault, vaultPath(dir))
+		if err != nil {
+			return nil
+		}
+		for _, name := range list {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, dir+name)
+			}
+		}
+		return names
+	}
+
+	var list []string
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// The server of the shell, with the session of the login
+var shellAPI *API
+
+// NewPrompt runs the shell on the server of the API
+func NewPrompt(api *API) {
+	shellAPI = api
 	user = os.Getenv("USER")
+	editor = newLineEditor(historyFile(), complete)
 
 	fmt.Println("Welcome to the FreePDM CLI!")
 	fmt.Println("If you need any help, type help.")
 	fmt.Println("")
-	scanner := bufio.NewScanner(os.Stdin)
 
 	for {
-		// Show prompt
-		fmt.Printf(BrightCyan+"%s:%s>"+Reset, currentVault, currentDir)
-
-		// Read input
-		if scanner.Scan() {
-			input := strings.TrimSpace(scanner.Text())
-			handleCommand(input, currentDir)
-		} else {
+		// Show prompt and read input
+		input, err := editor.readLine(fmt.Sprintf(BrightCyan+"%s:/%s>"+Reset, currentVault, currentDir))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Printf(Red+"Error reading input: %v\n"+Reset, err)
 			break
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Printf(Red+"Error reading input: %v\n", err)
+		input = strings.TrimSpace(input)
+		editor.addHistory(input)
+		handleCommand(input, currentDir)
 	}
 }
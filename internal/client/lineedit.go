@@ -0,0 +1,282 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// The history of the shell that is kept between sessions
+const maxHistory = 1000
+
+// lineEditor reads the lines of the shell with history and tab completion.
+// A terminal is switched into character mode with stty while a line is
+// read. Without a terminal, or without stty, the lines are read as is.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	history  []string
+	file     string // of the history, empty when it is not kept
+	complete func(args []string, word string) []string
+}
+
+// Constructor
+func newLineEditor(historyFile string, complete func(args []string, word string) []string) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(os.Stdin), out: os.Stdout, file: historyFile, complete: complete}
+	e.loadHistory()
+	return e
+}
+
+// historyFile returns the file that keeps the history of the shell
+func historyFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "freepdm", "shell_history")
+}
+
+func (e *lineEditor) loadHistory() {
+	if e.file == "" {
+		return
+	}
+	buf, err := os.ReadFile(e.file)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+		os.WriteFile(e.file, []byte(strings.Join(e.history, "\n")+"\n"), 0o600)
+	}
+}
+
+// addHistory adds a line to the history and to the history file
+func (e *lineEditor) addHistory(line string) {
+	if line == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+
+	if e.file == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(e.file), 0o700); err != nil {
+		return
+	}
+	f, err := os.OpenFile(e.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, line)
+	f.Close()
+}
+
+// stty runs stty on the terminal of the standard input
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// isTerminal tells whether the standard input is a terminal
+func isTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalMode switches the terminal to the stty settings and returns a
+// function that restores them.
+func terminalMode(settings ...string) (func(), error) {
+	if !isTerminal() {
+		return nil, errors.New("not a terminal")
+	}
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty(settings...); err != nil {
+		return nil, err
+	}
+	return func() { stty(state) }, nil
+}
+
+// readPlain reads a line without editing
+func (e *lineEditor) readPlain() (string, error) {
+	line, err := e.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// readPrompt reads a line without history and completion
+func (e *lineEditor) readPrompt(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	return e.readPlain()
+}
+
+// readPassword reads a line without echo
+func (e *lineEditor) readPassword(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	if restore, err := terminalMode("-echo"); err == nil {
+		defer func() {
+			restore()
+			fmt.Fprintln(e.out)
+		}()
+	}
+	return e.readPlain()
+}
+
+// readLine reads a line. The arrow keys up and down browse the history, tab
+// completes the word before the cursor, Ctrl-C discards the line and Ctrl-D
+// on an empty line ends the input with io.EOF.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := terminalMode("-icanon", "-echo", "-isig", "min", "1")
+	if err != nil {
+		fmt.Fprint(e.out, prompt)
+		return e.readPlain()
+	}
+	defer restore()
+
+	var line []byte
+	pos := len(e.history) // in the history, the new line at the end
+	saved := ""           // the new line while browsing the history
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r\033[K%s%s", prompt, line)
+	}
+	redraw()
+
+	for {
+		c, err := e.in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		switch c {
+		case '\r', '\n':
+			fmt.Fprintln(e.out)
+			return string(line), nil
+
+		case 3: // Ctrl-C
+			fmt.Fprintln(e.out, "^C")
+			line = line[:0]
+			pos = len(e.history)
+			redraw()
+
+		case 4: // Ctrl-D
+			if len(line) == 0 {
+				fmt.Fprintln(e.out)
+				return "", io.EOF
+			}
+
+		case 21: // Ctrl-U
+			line = line[:0]
+			redraw()
+
+		case 127, 8: // Backspace
+			if len(line) > 0 {
+				_, size := utf8.DecodeLastRune(line)
+				line = line[:len(line)-size]
+				redraw()
+			}
+
+		case '\t':
+			line = e.completeLine(line)
+			redraw()
+
+		case 27: // Escape sequence, only up and down are used
+			if b, err := e.in.ReadByte(); err != nil || b != '[' {
+				continue
+			}
+			var final byte
+			for final < 0x40 || final > 0x7e {
+				if final, err = e.in.ReadByte(); err != nil {
+					return "", err
+				}
+			}
+			switch {
+			case final == 'A' && pos > 0:
+				if pos == len(e.history) {
+					saved = string(line)
+				}
+				pos--
+				line = []byte(e.history[pos])
+				redraw()
+			case final == 'B' && pos < len(e.history):
+				pos++
+				if pos == len(e.history) {
+					line = []byte(saved)
+				} else {
+					line = []byte(e.history[pos])
+				}
+				redraw()
+			}
+
+		default:
+			if c >= 32 {
+				line = append(line, c)
+				fmt.Fprintf(e.out, "%c", c)
+			}
+		}
+	}
+}
+
+// completeLine completes the last word of the line. With more candidates
+// it completes their common prefix, or else shows them.
+func (e *lineEditor) completeLine(line []byte) []byte {
+	if e.complete == nil {
+		return line
+	}
+	text := string(line)
+	words := strings.Fields(text)
+	word := ""
+	if len(words) > 0 && !strings.HasSuffix(text, " ") {
+		word = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	candidates := e.complete(words, word)
+	head := text[:len(text)-len(word)]
+	switch len(candidates) {
+	case 0:
+		fmt.Fprint(e.out, "\a")
+		return line
+	case 1:
+		if !strings.HasSuffix(candidates[0], "/") {
+			return []byte(head + candidates[0] + " ")
+		}
+		return []byte(head + candidates[0])
+	}
+
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(prefix) > len(word) {
+		return []byte(head + prefix)
+	}
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	return line
+}
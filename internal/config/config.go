@@ -6,10 +6,12 @@ package config
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path"
+	"sync"
 
 	"github.com/BurntSushi/toml"
 	"github.com/grd/FreePDM/internal/util"
@@ -19,6 +21,9 @@ var (
 	appDir                string
 	configName, configDir string
 	Conf                  = Config{}
+
+	loadOnce sync.Once
+	loadErr  error
 )
 
 type Config struct {
@@ -26,15 +31,18 @@ type Config struct {
 	LogFile         string
 	LogLevel        string
 	Users           map[string]int
+	DropImport      map[string]bool // the vaults that import the files dropped into their directories
 }
 
 // AppDir returns the application directory
 func AppDir() string {
+	MustLoad()
 	return appDir
 }
 
 // VaultsDir returns the vaults directory
 func VaultsDir() string {
+	MustLoad()
 
 	// Ensure the vaults directory exists
 	if !util.DirExists(Conf.VaultsDirectory) {
@@ -46,14 +54,26 @@ func VaultsDir() string {
 
 // GetUid returns the uid for a given user name or -1 if not found.
 func GetUid(name string) int {
+	MustLoad()
 	if uid, ok := Conf.Users[name]; ok {
 		return uid
 	}
 	return -1
 }
 
+// Users returns the uids of the FreePDM users by name
+func Users() map[string]int {
+	MustLoad()
+	return Conf.Users
+}
+
 // ReadConfig reads the configuration file into Conf, handling errors appropriately.
 func ReadConfig() error {
+	MustLoad()
+	return readConfig()
+}
+
+func readConfig() error {
 	if !util.FileExists(configName) {
 		return fmt.Errorf("config file %s does not exist", configName)
 	}
@@ -68,7 +88,7 @@ func ReadConfig() error {
 	}
 
 	if !util.DirExists(Conf.VaultsDirectory) {
-		log.Fatal("vaults directory doesn't exist. See the installation manual")
+		return errors.New("vaults directory doesn't exist. See the installation manual")
 	}
 
 	return nil
@@ -76,6 +96,11 @@ func ReadConfig() error {
 
 // WriteConfig writes the current Conf structure to the config file.
 func WriteConfig() error {
+	MustLoad()
+	return writeConfig()
+}
+
+func writeConfig() error {
 	buf := new(bytes.Buffer)
 	err := toml.NewEncoder(buf).Encode(&Conf)
 	if err != nil {
@@ -98,16 +123,33 @@ func (cfg *Config) String() string {
 	return buf.String()
 }
 
-func init() {
-	appDir, ok := os.LookupEnv("FREEPDM_DIR")
+// Load reads the config file of the FREEPDM_DIR directory, and creates it
+// when it is missing. It runs once, the first call of any function of the
+// package loads the config, so that the programs that don't need it, such
+// as the vcs client of a server, run without FREEPDM_DIR.
+func Load() error {
+	loadOnce.Do(func() { loadErr = load() })
+	return loadErr
+}
+
+// MustLoad loads the config and exits when it can't
+func MustLoad() {
+	if err := Load(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func load() error {
+	dir, ok := os.LookupEnv("FREEPDM_DIR")
 	if !ok {
-		log.Fatal("The environment FREEPDM_DIR is not set. Please read the installation page.")
+		return errors.New("the environment FREEPDM_DIR is not set. Please read the installation page")
 	}
 
 	// Ensure the app directory exists
-	if !util.DirExists(appDir) {
-		log.Fatalf("application %s directory does not exist", appDir)
+	if !util.DirExists(dir) {
+		return fmt.Errorf("application %s directory does not exist", dir)
 	}
+	appDir = dir
 
 	configDir = path.Join(appDir, "data")
 	configName = path.Join(configDir, "FreePDM.toml")
@@ -115,19 +157,20 @@ func init() {
 	// Ensure the config directory exists
 	if !util.DirExists(configDir) {
 		if err := os.Mkdir(configDir, 0700); err != nil {
-			log.Fatalf("error creating config directory %s: %v", configDir, err)
+			return fmt.Errorf("error creating config directory %s: %v", configDir, err)
 		}
 	}
 
 	// Create a new config file if it doesn't exist
 	if !util.FileExists(configName) {
-		if err := WriteConfig(); err != nil {
-			log.Fatalf("error creating initial config file %s: %v", configName, err)
+		if err := writeConfig(); err != nil {
+			return fmt.Errorf("error creating initial config file %s: %v", configName, err)
 		}
 	}
 
 	// Read the configuration file
-	if err := ReadConfig(); err != nil {
-		log.Fatalf("error reading config file: %v", err)
+	if err := readConfig(); err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
 	}
+	return nil
 }
@@ -0,0 +1,325 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+//
+// Access control lists on vaults and directory subtrees.
+//
+// A vault without any ACL entries is open to every logged in user, with
+// the global role permissions (RolePermissions). As soon as a vault has an
+// entry, only the users and groups that are granted something can see it,
+// and only the subtrees they are granted. Grants on a directory are
+// inherited by everything below it. Admins can always do everything.
+//
+
+type AclPermission string
+
+const (
+	AclRead     AclPermission = "read"
+	AclWrite    AclPermission = "write"    // import, rename, move, copy, allocate
+	AclCheckout AclPermission = "checkout" // check out, check in, new version
+	AclRelease  AclPermission = "release"  // change the revision state
+	AclAdmin    AclPermission = "admin"    // everything, including the ACL itself and deletes
+)
+
+const (
+	SubjectUser  = "user"
+	SubjectGroup = "group"
+)
+
+// AclPermissions returns the permissions in order of strength
+func AclPermissions() []AclPermission {
+	return []AclPermission{AclRead, AclWrite, AclCheckout, AclRelease, AclAdmin}
+}
+
+// PdmAcl grants permissions on a vault directory to a user or group
+type PdmAcl struct {
+	Base
+	Vault       string         `gorm:"type:varchar(64);not null;index"`
+	Path        string         `gorm:"type:varchar(255)"` // relative to the vault, "" is the whole vault
+	SubjectType string         `gorm:"type:varchar(10);not null"`
+	Subject     string         `gorm:"type:varchar(64);not null"` // login name or group name
+	Permissions pq.StringArray `gorm:"type:text[]"`
+	ProjectID   uint           `gorm:"index"` // the project that made the grant, 0 for a grant of its own
+}
+
+// Grants tells whether the entry gives perm. Every permission implies read,
+// admin implies all.
+func (a PdmAcl) Grants(perm AclPermission) bool {
+	for _, p := range a.Permissions {
+		if AclPermission(p) == perm || AclPermission(p) == AclAdmin || perm == AclRead {
+			return true
+		}
+	}
+	return false
+}
+
+// CleanVaultPath normalizes a path inside a vault: no leading or trailing
+// slashes, no "..", and "" for the vault itself.
+func CleanVaultPath(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// covers tells whether the directory dir contains rel (or is rel).
+func covers(dir, rel string) bool {
+	return dir == "" || rel == dir || strings.HasPrefix(rel, dir+"/")
+}
+
+// Ease of handling
+type AclRepo struct {
+	DB *gorm.DB
+}
+
+// Constructor
+func NewAclRepo(db *gorm.DB) *AclRepo {
+	return &AclRepo{DB: db}
+}
+
+// Grant gives permissions on a vault subtree. An existing entry for the same
+// subject and path is replaced.
+func (r *AclRepo) Grant(vault, dir, subjectType, subject string, perms []AclPermission) error {
+	return r.grant(0, vault, dir, subjectType, subject, perms)
+}
+
+// GrantForProject gives permissions on a vault subtree on behalf of a
+// project. The entry is separate from the grants of its own, so that the
+// project can take it back without touching them.
+func (r *AclRepo) GrantForProject(projectID uint, vault, dir, subjectType, subject string, perms []AclPermission) error {
+	return r.grant(projectID, vault, dir, subjectType, subject, perms)
+}
+
+func (r *AclRepo) grant(projectID uint, vault, dir, subjectType, subject string, perms []AclPermission) error {
+	if subjectType != SubjectUser && subjectType != SubjectGroup {
+		return fmt.Errorf("unknown subject type %q", subjectType)
+	}
+	if subject == "" || len(perms) == 0 {
+		return fmt.Errorf("grant needs a subject and permissions")
+	}
+
+	list := make(pq.StringArray, len(perms))
+	for i, p := range perms {
+		if !slices.Contains(AclPermissions(), p) {
+			return fmt.Errorf("unknown permission %q", p)
+		}
+		list[i] = string(p)
+	}
+
+	entry := PdmAcl{
+		Vault:       vault,
+		Path:        CleanVaultPath(dir),
+		SubjectType: subjectType,
+		Subject:     subject,
+		ProjectID:   projectID,
+	}
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where(&entry).Where("path = ? AND project_id = ?", entry.Path, projectID).FirstOrInit(&entry).Error
+		if err != nil {
+			return err
+		}
+		entry.Permissions = list
+		return tx.Save(&entry).Error
+	})
+}
+
+// Revoke deletes an ACL entry of a vault
+func (r *AclRepo) Revoke(vault string, id uint) error {
+	return r.DB.Unscoped().Where("vault = ?", vault).Delete(&PdmAcl{}, id).Error
+}
+
+// RevokeSubject deletes the entry of a subject on a path, if any
+func (r *AclRepo) RevokeSubject(vault, dir, subjectType, subject string) error {
+	return r.DB.Unscoped().
+		Where("vault = ? AND path = ? AND subject_type = ? AND subject = ?", vault, CleanVaultPath(dir), subjectType, subject).
+		Delete(&PdmAcl{}).Error
+}
+
+// RevokeProject deletes the entries that a project made for a subject, or
+// for all subjects when subject is empty
+func (r *AclRepo) RevokeProject(projectID uint, subjectType, subject string) error {
+	if projectID == 0 {
+		return fmt.Errorf("revoke needs a project")
+	}
+	query := r.DB.Unscoped().Where("project_id = ?", projectID)
+	if subject != "" {
+		query = query.Where("subject_type = ? AND subject = ?", subjectType, subject)
+	}
+	return query.Delete(&PdmAcl{}).Error
+}
+
+// SubjectPermissions returns the permissions of a subject on a path, without
+// the inherited ones
+func (r *AclRepo) SubjectPermissions(vault, dir, subjectType, subject string) ([]AclPermission, error) {
+	var list []PdmAcl
+	err := r.DB.Where("vault = ? AND path = ? AND subject_type = ? AND subject = ?", vault, CleanVaultPath(dir), subjectType, subject).
+		Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var perms []AclPermission
+	for _, e := range list {
+		for _, p := range e.Permissions {
+			perms = append(perms, AclPermission(p))
+		}
+	}
+	return perms, nil
+}
+
+// VaultAcl returns all entries of a vault, sorted by path
+func (r *AclRepo) VaultAcl(vault string) ([]PdmAcl, error) {
+	var list []PdmAcl
+	err := r.DB.Where("vault = ?", vault).Order("path, subject_type, subject").Find(&list).Error
+	return list, err
+}
+
+// SubtreeAcl returns the entries of a vault on a directory and below it
+func (r *AclRepo) SubtreeAcl(vault, dir string) ([]PdmAcl, error) {
+	all, err := r.VaultAcl(vault)
+	if err != nil {
+		return nil, err
+	}
+	dir = CleanVaultPath(dir)
+	return slices.DeleteFunc(all, func(e PdmAcl) bool { return !covers(dir, e.Path) }), nil
+}
+
+// MovePath moves the entries on a directory and below it along with a
+// rename of the directory. It fails when the new place has entries
+// already, they would apply to the moved files.
+func (r *AclRepo) MovePath(vault, src, dst string) error {
+	src, dst = CleanVaultPath(src), CleanVaultPath(dst)
+	if src == "" || dst == "" {
+		return fmt.Errorf("the vault itself can't be moved")
+	}
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var all []PdmAcl
+		if err := tx.Where("vault = ?", vault).Find(&all).Error; err != nil {
+			return err
+		}
+		for _, e := range all {
+			if covers(dst, e.Path) {
+				return fmt.Errorf("%s has access entries already", dst)
+			}
+		}
+		for _, e := range all {
+			if !covers(src, e.Path) {
+				continue
+			}
+			moved := dst + strings.TrimPrefix(e.Path, src)
+			if err := tx.Model(&PdmAcl{}).Where("id = ?", e.ID).Update("path", moved).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Access holds the effective rights of one user on one vault. Create it
+// once per request with Effective and ask it about every path.
+type Access struct {
+	open    bool // vault without ACL entries
+	admin   bool
+	user    *PdmUser
+	entries []PdmAcl // the entries that apply to the user
+}
+
+// Effective computes the access of a user, who is a member of groups, on a vault.
+func (r *AclRepo) Effective(user *PdmUser, groups []string, vault string) (*Access, error) {
+	acc := &Access{
+		admin: user.HasRole(string(Admin)),
+		user:  user,
+	}
+	if acc.admin {
+		return acc, nil
+	}
+
+	all, err := r.VaultAcl(vault)
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == 0 {
+		acc.open = true
+		return acc, nil
+	}
+
+	for _, e := range all {
+		switch {
+		case e.SubjectType == SubjectUser && e.Subject == user.LoginName,
+			e.SubjectType == SubjectGroup && slices.Contains(groups, e.Subject):
+			acc.entries = append(acc.entries, e)
+		}
+	}
+	return acc, nil
+}
+
+// Can tells whether perm is granted on the path rel.
+func (a *Access) Can(rel string, perm AclPermission) bool {
+	if a.admin {
+		return true
+	}
+	if a.open {
+		return a.roleCan(perm)
+	}
+
+	rel = CleanVaultPath(rel)
+	for _, e := range a.entries {
+		if covers(e.Path, rel) && e.Grants(perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanSee tells whether rel may be shown: it is readable, or it is a parent
+// directory on the way to something readable.
+func (a *Access) CanSee(rel string) bool {
+	if a.Can(rel, AclRead) {
+		return true
+	}
+
+	rel = CleanVaultPath(rel)
+	for _, e := range a.entries {
+		if covers(rel, e.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Any tells whether the user has any access to the vault at all.
+func (a *Access) Any() bool {
+	return a.admin || a.open || len(a.entries) > 0
+}
+
+// roleCan maps the ACL permissions onto the global role permissions, for
+// vaults without ACL entries.
+func (a *Access) roleCan(perm AclPermission) bool {
+	switch perm {
+	case AclRead:
+		return true
+	case AclWrite:
+		return a.user.HasPermission(CreateItem)
+	case AclCheckout:
+		return a.user.HasPermission(CheckOut)
+	case AclRelease:
+		return a.user.HasRole(string(Approver))
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/grd/FreePDM/internal/db"
+)
+
+func TestAclMovePath(t *testing.T) {
+	acl := db.NewAclRepo(openProjectDB(t))
+
+	grants := []struct{ dir, subject string }{
+		{"pumps", "jdoe"},
+		{"pumps/secret", "boss"},
+		{"pumps2", "jdoe"},
+		{"valves", "jdoe"},
+	}
+	for _, g := range grants {
+		if err := acl.Grant("vault", g.dir, db.SubjectUser, g.subject, []db.AclPermission{db.AclRead}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := acl.SubtreeAcl("vault", "pumps")
+	if err != nil || len(list) != 2 {
+		t.Fatalf("entries below pumps = %+v, %v; want pumps and pumps/secret", list, err)
+	}
+
+	// The directory and its subdirectories move, "pumps2" is another one
+	if err := acl.MovePath("vault", "pumps", "archive/pumps"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := acl.VaultAcl("vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+	}
+	want := []string{"archive/pumps", "archive/pumps/secret", "pumps2", "valves"}
+	if len(paths) != len(want) {
+		t.Fatalf("paths after the move = %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("paths after the move = %v, want %v", paths, want)
+			break
+		}
+	}
+
+	// Entries at the new place would apply to the moved files
+	if err := acl.MovePath("vault", "pumps2", "valves"); err == nil {
+		t.Error("moved onto the entries of valves")
+	}
+	if err := acl.MovePath("vault", "", "elsewhere"); err == nil {
+		t.Error("moved the vault itself")
+	}
+}
+
+func TestAclOpenVault(t *testing.T) {
+	acl := db.NewAclRepo(openProjectDB(t))
+
+	// Without entries the vault is open, with the permissions of the roles
+	tests := []struct {
+		roles []string
+		perms map[db.AclPermission]bool
+	}{
+		{[]string{"viewer"}, map[db.AclPermission]bool{db.AclRead: true, db.AclWrite: false, db.AclCheckout: false, db.AclRelease: false, db.AclAdmin: false}},
+		{[]string{"designer"}, map[db.AclPermission]bool{db.AclRead: true, db.AclWrite: true, db.AclCheckout: true, db.AclRelease: false, db.AclAdmin: false}},
+		{[]string{"approver"}, map[db.AclPermission]bool{db.AclRead: true, db.AclWrite: true, db.AclCheckout: true, db.AclRelease: true, db.AclAdmin: false}},
+		{[]string{"admin"}, map[db.AclPermission]bool{db.AclRead: true, db.AclWrite: true, db.AclCheckout: true, db.AclRelease: true, db.AclAdmin: true}},
+	}
+	for _, tt := range tests {
+		user := &db.PdmUser{LoginName: "jdoe", Roles: tt.roles}
+		access, err := acl.Effective(user, nil, "vault")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !access.Any() || !access.CanSee("pumps") {
+			t.Errorf("%v: the open vault is hidden", tt.roles)
+		}
+		for perm, want := range tt.perms {
+			if got := access.Can("pumps/1", perm); got != want {
+				t.Errorf("%v: Can(%s) = %v, want %v", tt.roles, perm, got, want)
+			}
+		}
+	}
+}
+
+func TestAclAccess(t *testing.T) {
+	acl := db.NewAclRepo(openProjectDB(t))
+
+	grants := []struct {
+		dir, subjectType, subject string
+		perms                     []db.AclPermission
+	}{
+		{"pumps", db.SubjectUser, "jdoe", []db.AclPermission{db.AclRead}},
+		{"pumps/impellers", db.SubjectUser, "jdoe", []db.AclPermission{db.AclCheckout}},
+		{"valves/brass", db.SubjectGroup, "valve-team", []db.AclPermission{db.AclWrite}},
+		{"archive", db.SubjectGroup, "auditors", []db.AclPermission{db.AclAdmin}},
+		{"secret", db.SubjectUser, "boss", []db.AclPermission{db.AclAdmin}},
+	}
+	for _, g := range grants {
+		if err := acl.Grant("vault", g.dir, g.subjectType, g.subject, g.perms); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The designer role gives no rights on a vault with entries
+	jdoe := &db.PdmUser{LoginName: "jdoe", Roles: []string{"designer"}}
+	access, err := acl.Effective(jdoe, []string{"valve-team"}, "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !access.Any() {
+		t.Fatal("no access with grants")
+	}
+
+	tests := []struct {
+		rel  string
+		perm db.AclPermission
+		want bool
+	}{
+		{"pumps", db.AclRead, true},
+		{"pumps/12", db.AclRead, true},   // inherited
+		{"pumps/12", db.AclWrite, false}, // read only
+		{"pumps/impellers/3", db.AclCheckout, true},
+		{"pumps/impellers/3", db.AclRead, true}, // checkout implies read
+		{"pumps/impellers/3", db.AclRelease, false},
+		{"pumps2", db.AclRead, false},         // not below pumps
+		{"valves/brass/7", db.AclWrite, true}, // through the group
+		{"valves/brass/7", db.AclCheckout, false},
+		{"valves/steel", db.AclRead, false},
+		{"archive/1", db.AclRead, false}, // not a member of auditors
+		{"secret", db.AclRead, false},
+		{"", db.AclRead, false},
+		{"/pumps/../pumps/12/", db.AclRead, true}, // cleaned
+	}
+	for _, tt := range tests {
+		if got := access.Can(tt.rel, tt.perm); got != tt.want {
+			t.Errorf("Can(%q, %s) = %v, want %v", tt.rel, tt.perm, got, tt.want)
+		}
+	}
+
+	// Parent directories on the way to a grant can be seen, not read
+	see := map[string]bool{
+		"":             true,
+		"valves":       true,
+		"valves/brass": true,
+		"valves/steel": false,
+		"pumps/12":     true,
+		"archive":      false,
+		"secret":       false,
+	}
+	for rel, want := range see {
+		if got := access.CanSee(rel); got != want {
+			t.Errorf("CanSee(%q) = %v, want %v", rel, got, want)
+		}
+	}
+	if access.Can("valves", db.AclRead) {
+		t.Error("a parent directory on the way is readable")
+	}
+
+	// Admin on a subtree implies everything there
+	auditor := &db.PdmUser{LoginName: "mary", Roles: []string{"viewer"}}
+	access, err = acl.Effective(auditor, []string{"auditors"}, "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !access.Can("archive/1", db.AclRelease) || !access.Can("archive/1", db.AclAdmin) || access.Can("pumps", db.AclRead) {
+		t.Error("admin on archive gives the wrong rights")
+	}
+
+	// Somebody without grants has no access at all, not even to the root
+	stranger := &db.PdmUser{LoginName: "stranger", Roles: []string{"approver"}}
+	access, err = acl.Effective(stranger, []string{"other-team"}, "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access.Any() || access.CanSee("") || access.Can("pumps", db.AclRead) {
+		t.Error("access without any grant")
+	}
+
+	// An admin can do everything, also without grants
+	admin := &db.PdmUser{LoginName: "root", Roles: []string{"admin"}}
+	access, err = acl.Effective(admin, nil, "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !access.Any() || !access.Can("secret/1", db.AclAdmin) {
+		t.Error("an admin is refused")
+	}
+}
+
+func TestAclGrantOrder(t *testing.T) {
+	acl := db.NewAclRepo(openProjectDB(t))
+	jdoe := &db.PdmUser{LoginName: "jdoe", Roles: []string{"viewer"}}
+	can := func(rel string, perm db.AclPermission) bool {
+		t.Helper()
+		access, err := acl.Effective(jdoe, nil, "vault")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return access.Can(rel, perm)
+	}
+
+	// A new grant on the same path replaces the old one
+	if err := acl.Grant("vault", "pumps", db.SubjectUser, "jdoe", []db.AclPermission{db.AclWrite}); err != nil {
+		t.Fatal(err)
+	}
+	if err := acl.Grant("vault", "pumps/", db.SubjectUser, "jdoe", []db.AclPermission{db.AclRead}); err != nil {
+		t.Fatal(err)
+	}
+	if can("pumps/1", db.AclWrite) || !can("pumps/1", db.AclRead) {
+		t.Error("the second grant did not replace the first")
+	}
+
+	// Grants add up: a narrower grant can't take away a wider one
+	if err := acl.Grant("vault", "", db.SubjectUser, "jdoe", []db.AclPermission{db.AclCheckout}); err != nil {
+		t.Fatal(err)
+	}
+	if !can("pumps/1", db.AclCheckout) {
+		t.Error("the grant on the vault does not reach below a narrower grant")
+	}
+
+	// A grant of a project stands beside the grant of its own
+	if err := acl.GrantForProject(7, "vault", "pumps", db.SubjectUser, "jdoe", []db.AclPermission{db.AclRelease}); err != nil {
+		t.Fatal(err)
+	}
+	if !can("pumps/1", db.AclRelease) {
+		t.Error("the grant of the project is not effective")
+	}
+	if err := acl.RevokeProject(7, db.SubjectUser, "jdoe"); err != nil {
+		t.Fatal(err)
+	}
+	if can("pumps/1", db.AclRelease) || !can("pumps/1", db.AclCheckout) {
+		t.Error("revoking the project took the wrong grants")
+	}
+
+	// Unknown subjects and permissions are refused
+	if err := acl.Grant("vault", "pumps", "robot", "jdoe", []db.AclPermission{db.AclRead}); err == nil {
+		t.Error("granted to an unknown subject type")
+	}
+	if err := acl.Grant("vault", "pumps", db.SubjectUser, "jdoe", []db.AclPermission{"delete"}); err == nil {
+		t.Error("granted an unknown permission")
+	}
+}
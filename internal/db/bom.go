@@ -0,0 +1,251 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBomLineNotFound = errors.New("BOM line not found")
+	ErrBomCycle        = errors.New("the item is already part of the child")
+)
+
+//
+// Bills of materials. Every item can have child items with a quantity. The
+// weight of an item is the weight of its own models plus the weight of its
+// children, times their quantity.
+//
+
+// Ease of handling
+type BomRepo struct {
+	DB *gorm.DB
+}
+
+// Constructor
+func NewBomRepo(db *gorm.DB) *BomRepo {
+	return &BomRepo{DB: db}
+}
+
+// BomRow is a BOM line with the weights of the child
+type BomRow struct {
+	Line   PdmBomLine
+	Weight float64 // of one child, in kg
+	Total  float64 // of the quantity, in kg
+}
+
+// BomLines returns the lines of an item, sorted by position
+func (r *BomRepo) BomLines(parentID uint) ([]PdmBomLine, error) {
+	var lines []PdmBomLine
+	err := r.DB.Preload("Child").Where("parent_id = ?", parentID).Order("position, id").Find(&lines).Error
+	return lines, err
+}
+
+// AddBomLine adds a child to the BOM of an item. An item can't contain
+// itself, not even deeper down.
+func (r *BomRepo) AddBomLine(parentID, childID uint, quantity float64) (*PdmBomLine, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("invalid quantity %g", quantity)
+	}
+	if parentID == childID {
+		return nil, ErrBomCycle
+	}
+
+	contains, err := r.contains(childID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if contains {
+		return nil, ErrBomCycle
+	}
+
+	line := PdmBomLine{ParentID: parentID, ChildID: childID, Quantity: quantity}
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		var last PdmBomLine
+		err := tx.Where("parent_id = ?", parentID).Order("position DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		line.Position = last.Position + 10
+		return tx.Create(&line).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &line, nil
+}
+
+// UpdateBomLine changes the quantity of a line
+func (r *BomRepo) UpdateBomLine(parentID, lineID uint, quantity float64) error {
+	if quantity <= 0 {
+		return fmt.Errorf("invalid quantity %g", quantity)
+	}
+	res := r.DB.Model(&PdmBomLine{}).Where("id = ? AND parent_id = ?", lineID, parentID).Update("quantity", quantity)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrBomLineNotFound
+	}
+	return nil
+}
+
+// RemoveBomLine removes a line of the BOM of an item
+func (r *BomRepo) RemoveBomLine(parentID, lineID uint) error {
+	res := r.DB.Unscoped().Where("id = ? AND parent_id = ?", lineID, parentID).Delete(&PdmBomLine{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrBomLineNotFound
+	}
+	return nil
+}
+
+// contains tells whether item is somewhere in the BOM of parent
+func (r *BomRepo) contains(parentID, itemID uint) (bool, error) {
+	seen := map[uint]bool{}
+	todo := []uint{parentID}
+
+	for len(todo) > 0 {
+		var children []uint
+		if err := r.DB.Model(&PdmBomLine{}).Where("parent_id IN ?", todo).Pluck("child_id", &children).Error; err != nil {
+			return false, err
+		}
+		todo = todo[:0]
+		for _, c := range children {
+			if c == itemID {
+				return true, nil
+			}
+			if !seen[c] {
+				seen[c] = true
+				todo = append(todo, c)
+			}
+		}
+	}
+	return false, nil
+}
+
+// Weight returns the weight of an item in kg: its own models and its BOM.
+func (r *BomRepo) Weight(itemID uint) (float64, error) {
+	return r.weight(itemID, map[uint]float64{}, map[uint]bool{})
+}
+
+func (r *BomRepo) weight(itemID uint, done map[uint]float64, busy map[uint]bool) (float64, error) {
+	if w, ok := done[itemID]; ok {
+		return w, nil
+	}
+	if busy[itemID] {
+		return 0, ErrBomCycle
+	}
+	busy[itemID] = true
+	defer delete(busy, itemID)
+
+	var own float64
+	err := r.DB.Model(&PdmModel{}).Where("item_id = ?", itemID).
+		Select("COALESCE(SUM(model_weight), 0)").Scan(&own).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var lines []PdmBomLine
+	if err := r.DB.Where("parent_id = ?", itemID).Find(&lines).Error; err != nil {
+		return 0, err
+	}
+
+	total := own
+	for _, line := range lines {
+		w, err := r.weight(line.ChildID, done, busy)
+		if err != nil {
+			return 0, err
+		}
+		total += line.Quantity * w
+	}
+
+	done[itemID] = total
+	return total, nil
+}
+
+// Bom returns the lines of an item with their weights, and the weight of
+// the item itself.
+func (r *BomRepo) Bom(itemID uint) ([]BomRow, float64, error) {
+	lines, err := r.BomLines(itemID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	done := map[uint]float64{}
+	rows := make([]BomRow, len(lines))
+	for i, line := range lines {
+		w, err := r.weight(line.ChildID, done, map[uint]bool{})
+		if err != nil {
+			return nil, 0, err
+		}
+		rows[i] = BomRow{Line: line, Weight: w, Total: line.Quantity * w}
+	}
+
+	total, err := r.weight(itemID, done, map[uint]bool{})
+	if err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+// BomLevel is a line of an exploded BOM. The child is loaded with its
+// approved sources.
+type BomLevel struct {
+	BomRow
+	Level    int     // 1 for the lines of the top item
+	Quantity float64 // per top item
+}
+
+// Explode returns the BOM of an item with all levels below it, depth first
+// in the order of the positions.
+func (r *BomRepo) Explode(itemID uint) ([]BomLevel, error) {
+	var rows []BomLevel
+	done := map[uint]float64{}
+
+	var walk func(parentID uint, level int, quantity float64, busy map[uint]bool) error
+	walk = func(parentID uint, level int, quantity float64, busy map[uint]bool) error {
+		if busy[parentID] {
+			return ErrBomCycle
+		}
+		busy[parentID] = true
+		defer delete(busy, parentID)
+
+		var lines []PdmBomLine
+		err := r.DB.Preload("Child.Sources", func(db *gorm.DB) *gorm.DB { return db.Order("purchasing_source DESC, id") }).
+			Preload("Child.Sources.Manufacturer").
+			Preload("Child.Sources.Vendor").
+			Where("parent_id = ?", parentID).Order("position, id").Find(&lines).Error
+		if err != nil {
+			return err
+		}
+
+		for _, line := range lines {
+			w, err := r.weight(line.ChildID, done, map[uint]bool{})
+			if err != nil {
+				return err
+			}
+			rows = append(rows, BomLevel{
+				BomRow:   BomRow{Line: line, Weight: w, Total: line.Quantity * w},
+				Level:    level,
+				Quantity: quantity * line.Quantity,
+			})
+			if err := walk(line.ChildID, level+1, quantity*line.Quantity, busy); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(itemID, 1, 1, map[uint]bool{}); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -40,6 +40,27 @@ const (
 	StatusInvited   AccountStatus = "Invited"
 )
 
+const (
+	AuthSourceLocal = "local" // password stored in the PDM
+	AuthSourceOIDC  = "oidc"  // single sign-on
+)
+
+// Security events
+const (
+	EventLoginSuccess    = "login"
+	EventLoginFailed     = "login-failed"
+	EventAccountLocked   = "account-locked"
+	EventAccountUnlocked = "account-unlocked"
+	EventPasswordChanged = "password-changed"
+	EventPasswordReset   = "password-reset"
+	EventPasswordExpired = "password-expired"
+	EventRateLimited     = "rate-limited"
+	EventTOTPEnabled     = "2fa-enabled"
+	EventTOTPFailed      = "2fa-failed"
+	EventTOTPReset       = "2fa-reset"
+	EventRecoveryCode    = "recovery-code-used"
+)
+
 const (
 	CheckIn               RBAC = "Check-In"
 	CheckOut              RBAC = "Check-Out"
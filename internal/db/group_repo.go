@@ -0,0 +1,145 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+var ErrGroupNotFound = errors.New("group not found")
+
+// Ease of handling
+type GroupRepo struct {
+	DB *gorm.DB
+}
+
+// Constructor
+func NewGroupRepo(db *gorm.DB) *GroupRepo {
+	return &GroupRepo{DB: db}
+}
+
+// AllGroups returns the groups with their members, sorted by name
+func (r *GroupRepo) AllGroups() ([]PdmGroup, error) {
+	var groups []PdmGroup
+	err := r.DB.Preload("Users").Order("name").Find(&groups).Error
+	return groups, err
+}
+
+// LoadGroup returns a group with its members
+func (r *GroupRepo) LoadGroup(id uint) (*PdmGroup, error) {
+	var group PdmGroup
+	if err := r.DB.Preload("Users").First(&group, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, err
+	}
+	return &group, nil
+}
+
+// CreateGroup adds a new group
+func (r *GroupRepo) CreateGroup(name, description string, roles []string) (*PdmGroup, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("group name is empty")
+	}
+
+	group := PdmGroup{
+		Name:        name,
+		Description: description,
+		Roles:       pq.StringArray(roles),
+	}
+	return &group, r.DB.Create(&group).Error
+}
+
+// UpdateGroup changes name, description and roles. The ACL entries of the
+// group follow a new name.
+func (r *GroupRepo) UpdateGroup(id uint, name, description string, roles []string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("group name is empty")
+	}
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var group PdmGroup
+		if err := tx.First(&group, id).Error; err != nil {
+			return err
+		}
+
+		if group.Name != name {
+			err := tx.Model(&PdmAcl{}).
+				Where("subject_type = ? AND subject = ?", SubjectGroup, group.Name).
+				Update("subject", name).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&group).Updates(map[string]interface{}{
+			"name":        name,
+			"description": description,
+			"roles":       pq.StringArray(roles),
+		}).Error
+	})
+}
+
+// DeleteGroup removes a group, its memberships and its ACL entries
+func (r *GroupRepo) DeleteGroup(id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var group PdmGroup
+		if err := tx.First(&group, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", id).Delete(&PdmUserGroupLink{}).Error; err != nil {
+			return err
+		}
+		err := tx.Unscoped().
+			Where("subject_type = ? AND subject = ?", SubjectGroup, group.Name).
+			Delete(&PdmAcl{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&group).Error
+	})
+}
+
+// AddMember puts a user into a group
+func (r *GroupRepo) AddMember(groupID, userID uint) error {
+	link := PdmUserGroupLink{UserID: userID, GroupID: groupID}
+	return r.DB.Where(&link).FirstOrCreate(&link).Error
+}
+
+// RemoveMember takes a user out of a group
+func (r *GroupRepo) RemoveMember(groupID, userID uint) error {
+	return r.DB.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&PdmUserGroupLink{}).Error
+}
+
+// SetUserGroups replaces the group memberships of a user
+func (r *GroupRepo) SetUserGroups(userID uint, groupIDs []uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&PdmUserGroupLink{}).Error; err != nil {
+			return err
+		}
+		for _, id := range groupIDs {
+			if err := tx.Create(&PdmUserGroupLink{UserID: userID, GroupID: id}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GroupAcl returns the ACL entries granted to a group
+func (r *GroupRepo) GroupAcl(name string) ([]PdmAcl, error) {
+	var list []PdmAcl
+	err := r.DB.Where("subject_type = ? AND subject = ?", SubjectGroup, name).
+		Order("vault, path").Find(&list).Error
+	return list, err
+}
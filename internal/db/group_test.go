@@ -0,0 +1,258 @@
+package db_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/grd/FreePDM/internal/db"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openGroupDB(t *testing.T) *gorm.DB {
+	gormdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "groups.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open SQLite DB: %v", err)
+	}
+	err = gormdb.AutoMigrate(&db.PdmUser{}, &db.PdmGroup{}, &db.PdmUserGroupLink{}, &db.PdmAcl{})
+	if err != nil {
+		t.Fatalf("failed to migrate schema: %v", err)
+	}
+	return gormdb
+}
+
+func TestEffectiveRoles(t *testing.T) {
+	designers := &db.PdmGroup{Name: "designers", Roles: []string{"designer", "Viewer"}}
+	approvers := &db.PdmGroup{Name: "approvers", Roles: []string{"approver"}}
+
+	tests := []struct {
+		name   string
+		user   db.PdmUser
+		roles  []string
+		has    []string
+		hasNot []string
+		perms  []db.RBAC
+		no     []db.RBAC
+	}{
+		{
+			name:   "own roles",
+			user:   db.PdmUser{Roles: []string{"viewer"}},
+			roles:  []string{"viewer"},
+			has:    []string{"viewer", "VIEWER"},
+			hasNot: []string{"designer"},
+			perms:  []db.RBAC{db.ReadItems},
+			no:     []db.RBAC{db.CheckOut},
+		},
+		{
+			name:   "through a group, without doubles",
+			user:   db.PdmUser{Roles: []string{"viewer"}, Groups: []*db.PdmGroup{designers}},
+			roles:  []string{"viewer", "designer"},
+			has:    []string{"designer"},
+			hasNot: []string{"approver", "admin"},
+			perms:  []db.RBAC{db.ReadItems, db.CheckOut, db.CreateItem},
+			no:     []db.RBAC{db.DeleteItem, db.CreateUser},
+		},
+		{
+			name:  "only through groups",
+			user:  db.PdmUser{Groups: []*db.PdmGroup{designers, approvers}},
+			roles: []string{"designer", "Viewer", "approver"},
+			has:   []string{"approver", "designer"},
+			perms: []db.RBAC{db.CheckIn},
+			no:    []db.RBAC{db.CreateProject},
+		},
+		{
+			name:   "nothing",
+			user:   db.PdmUser{},
+			hasNot: []string{"viewer"},
+			no:     []db.RBAC{db.ReadItems},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles := tt.user.EffectiveRoles()
+			if len(roles) != len(tt.roles) {
+				t.Fatalf("EffectiveRoles() = %v, want %v", roles, tt.roles)
+			}
+			for i := range roles {
+				if roles[i] != tt.roles[i] {
+					t.Fatalf("EffectiveRoles() = %v, want %v", roles, tt.roles)
+				}
+			}
+			for _, role := range tt.has {
+				if !tt.user.HasRole(role) {
+					t.Errorf("HasRole(%s) = false", role)
+				}
+			}
+			for _, role := range tt.hasNot {
+				if tt.user.HasRole(role) {
+					t.Errorf("HasRole(%s) = true", role)
+				}
+			}
+			for _, perm := range tt.perms {
+				if !tt.user.HasPermission(perm) {
+					t.Errorf("HasPermission(%v) = false", perm)
+				}
+			}
+			for _, perm := range tt.no {
+				if tt.user.HasPermission(perm) {
+					t.Errorf("HasPermission(%v) = true", perm)
+				}
+			}
+		})
+	}
+
+	// The user's own record is not changed
+	user := db.PdmUser{Roles: []string{"viewer"}, Groups: []*db.PdmGroup{approvers}}
+	user.EffectiveRoles()
+	if len(user.Roles) != 1 {
+		t.Errorf("the roles of the user became %v", user.Roles)
+	}
+}
+
+func TestGroupRoles(t *testing.T) {
+	gormdb := openGroupDB(t)
+	users := db.NewUserRepo(gormdb)
+	groups := db.NewGroupRepo(gormdb)
+
+	user := &db.PdmUser{LoginName: "jdoe", Roles: []string{"viewer"}}
+	if err := users.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	group, err := groups.CreateGroup("designers", "", []string{"designer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := groups.AddMember(group.ID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loading the user brings the roles of the group along
+	loaded, err := users.LoadUser("jdoe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.HasRole("designer") || !loaded.HasPermission(db.CheckOut) {
+		t.Errorf("the role of the group is not inherited: %v", loaded.EffectiveRoles())
+	}
+
+	if err := groups.RemoveMember(group.ID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = users.LoadUser("jdoe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.HasRole("designer") {
+		t.Error("the role of the group stays after leaving it")
+	}
+}
+
+func TestUpdateGroup(t *testing.T) {
+	gormdb := openGroupDB(t)
+	groups := db.NewGroupRepo(gormdb)
+	acl := db.NewAclRepo(gormdb)
+
+	group, err := groups.CreateGroup("pump-team", "pumps", []string{"designer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []struct{ subjectType, subject string }{
+		{db.SubjectGroup, "pump-team"},
+		{db.SubjectUser, "pump-team"}, // a user of the same name
+		{db.SubjectGroup, "valve-team"},
+	} {
+		if err := acl.Grant("vault", "pumps", g.subjectType, g.subject, []db.AclPermission{db.AclRead}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := groups.UpdateGroup(group.ID, " pumps ", "all pumps", []string{"approver"}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := groups.LoadGroup(group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "pumps" || loaded.Description != "all pumps" || len(loaded.Roles) != 1 || loaded.Roles[0] != "approver" {
+		t.Errorf("updated group = %+v", loaded)
+	}
+
+	// The grants follow the new name, those of the user stay
+	if list, err := groups.GroupAcl("pumps"); err != nil || len(list) != 1 {
+		t.Errorf("grants of the renamed group = %v, %v", list, err)
+	}
+	if list, err := groups.GroupAcl("pump-team"); err != nil || len(list) != 0 {
+		t.Errorf("grants of the old name = %v, %v", list, err)
+	}
+	if perms, err := acl.SubjectPermissions("vault", "pumps", db.SubjectUser, "pump-team"); err != nil || len(perms) != 1 {
+		t.Errorf("grants of the user = %v, %v", perms, err)
+	}
+	if list, err := groups.GroupAcl("valve-team"); err != nil || len(list) != 1 {
+		t.Errorf("grants of another group = %v, %v", list, err)
+	}
+
+	if err := groups.UpdateGroup(group.ID, " ", "", nil); err == nil {
+		t.Error("renamed to an empty name")
+	}
+	if err := groups.UpdateGroup(group.ID+100, "ghost", "", nil); err == nil {
+		t.Error("updated a group that does not exist")
+	}
+}
+
+func TestDeleteGroup(t *testing.T) {
+	gormdb := openGroupDB(t)
+	users := db.NewUserRepo(gormdb)
+	groups := db.NewGroupRepo(gormdb)
+	acl := db.NewAclRepo(gormdb)
+
+	user := &db.PdmUser{LoginName: "jdoe"}
+	if err := users.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	group, err := groups.CreateGroup("pump-team", "", []string{"designer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := groups.AddMember(group.ID, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, subjectType := range []string{db.SubjectGroup, db.SubjectUser} {
+		if err := acl.Grant("vault", "pumps", subjectType, "pump-team", []db.AclPermission{db.AclWrite}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := groups.DeleteGroup(group.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := groups.LoadGroup(group.ID); err != db.ErrGroupNotFound {
+		t.Errorf("LoadGroup after the delete: %v", err)
+	}
+
+	// The members lose the roles, the grants of the group are gone
+	loaded, err := users.LoadUser("jdoe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Groups) != 0 || loaded.HasRole("designer") {
+		t.Errorf("the member keeps the group: %v", loaded.EffectiveRoles())
+	}
+	if list, err := groups.GroupAcl("pump-team"); err != nil || len(list) != 0 {
+		t.Errorf("grants of the deleted group = %v, %v", list, err)
+	}
+	if perms, err := acl.SubjectPermissions("vault", "pumps", db.SubjectUser, "pump-team"); err != nil || len(perms) != 1 {
+		t.Errorf("grants of the user = %v, %v", perms, err)
+	}
+
+	// A new group of the same name does not get the old grants back
+	if _, err := groups.CreateGroup("pump-team", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := groups.GroupAcl("pump-team"); err != nil || len(list) != 0 {
+		t.Errorf("grants of the new group = %v, %v", list, err)
+	}
+
+	if err := groups.DeleteGroup(group.ID); err == nil {
+		t.Error("deleted a group twice")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -70,6 +71,11 @@ func InitDB() (*gorm.DB, error) {
 		return nil, err
 	}
 
+	err = createRolePolicies(db)
+	if err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
@@ -81,17 +87,38 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// tables is the list of models that are kept in sync with the database.
+var tables = []any{
+	&PdmUser{},
+	&PdmPasswordHistory{},
+	&PdmSecurityEvent{},
+	&PdmRolePolicy{},
+	&PdmAcl{},
+	&PdmGroup{},
+	&PdmUserGroupLink{},
+	&PdmProject{},
+	&PdmUserProjectLink{},
+	&PdmItem{},
+	&PdmMaterial{},
+	&PdmModel{},
+	&PdmDocument{},
+	&PdmBomLine{},
+	&PdmReference{},
+	&PdmManufacturer{},
+	&PdmVendor{},
+	&PdmPurchase{},
+	&PdmNumberScheme{},
+	&PdmIssuedNumber{},
+}
+
 // createDefaultTables creates the default set of tables in the database.
+// AutoMigrate only adds what is missing, so it also runs on an existing
+// database to pick up new tables and columns.
 func createDefaultTables(db *gorm.DB) error {
 	// Check if a key table already exists
+	fresh := !db.Migrator().HasTable(&PdmUser{})
 
-	if db.Migrator().HasTable(&PdmUser{}) {
-		// fmt.Println("Tables already exist — skipping creation.")
-		return nil
-	}
-
-	// Create the default set of tables
-	if err := db.AutoMigrate(&PdmUser{}); err != nil {
+	if err := db.AutoMigrate(tables...); err != nil {
 		return fmt.Errorf("failed to migrate tables: %w", err)
 	}
 	// if err := db.AutoMigrate(&PdmUser{}, &PdmProject{}, &PdmItem{},
@@ -101,7 +128,9 @@ func createDefaultTables(db *gorm.DB) error {
 	// }
 
 	// Log successful creation
-	fmt.Println("Tables created successfully")
+	if fresh {
+		fmt.Println("Tables created successfully")
+	}
 	return nil
 }
 
@@ -126,3 +155,26 @@ func createAdminAccount(db *gorm.DB) error {
 	}
 	return nil
 }
+
+// createRolePolicies fills the role policies on a new database. The roles
+// in TOTP_REQUIRED_ROLES have to use two-factor authentication.
+func createRolePolicies(db *gorm.DB) error {
+	var count int64
+	db.Model(&PdmRolePolicy{}).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	required := map[string]bool{}
+	for _, role := range strings.Split(getEnv("TOTP_REQUIRED_ROLES", "admin,approver"), ",") {
+		required[strings.ToLower(strings.TrimSpace(role))] = true
+	}
+
+	for _, role := range GetAvailableRoles() {
+		policy := PdmRolePolicy{Role: role, RequireTOTP: required[role]}
+		if err := db.Create(&policy).Error; err != nil {
+			return fmt.Errorf("failed to create role policies: %w", err)
+		}
+	}
+	return nil
+}
@@ -5,151 +5,435 @@
 package db
 
 import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+
 	"gorm.io/gorm"
 )
 
-// Note:
-// According to: https://docs.sqlalchemy.org/en/14/tutorial/engine.html
-// 'The engine is typically a global object created just once for a particular database server, ...'
-//
-// So up till now i expected every user has it's own login,
-// but it looks like this is not possible using engines.
-// Now there has to be some research in a dedicated login system!
-
-// Item represents the items table.
-type Item struct {
-	gorm.Model
-	ID       uint   `gorm:"primaryKey"`
-	ItemName string `gorm:"size:100"`
-	// number          int
-	Project         string
-	Path            string
-	Name            string
-	Description     string
-	FullDescription string
+var (
+	ErrItemNotFound     = errors.New("item not found")
+	ErrDocumentNotFound = errors.New("document not found")
+)
+
+// Files with these extensions are models, everything else is a document.
+var modelExtensions = []string{".fcstd", ".step", ".stp", ".iges", ".igs", ".brep", ".stl", ".obj", ".3mf"}
+
+// IsModelFile tells whether a file name is a model
+func IsModelFile(name string) bool {
+	return slices.Contains(modelExtensions, strings.ToLower(filepath.Ext(name)))
 }
 
-// Create new project number
-// number [str] : Last current number
 //
-//	Number as string including leading zeros.
+// Items, models and documents of the vault containers.
 //
-// ndigits [int] : number of digits
+// The records follow the vaults: every container that holds a model, or
+// that is allocated, has an item. A model belongs to the item of its
+// container. A document stands alone until it is attached to an item, or
+// it belongs to the item of an allocated container.
 //
-//	Number of digits of the number length.
-//	If ndigits is -1 the length is just the length.
 
-// func (i Item) CreateItemNumber(n int) string {
-// 	// call_proj := Project{} // BUG: This needs to be something that is running because of the number which would be zero.
-
-// 	item_nr := createNumber()
-
-// 	return item_nr
+// Ease of handling
+type ItemRepo struct {
+	DB *gorm.DB
+}
 
-// 	return ""
-// }
+// Constructor
+func NewItemRepo(db *gorm.DB) *ItemRepo {
+	return &ItemRepo{DB: db}
+}
 
-// https://stackoverflow.com/questions/73887390/handle-multiple-users-login-database-with-sqlalchemy
+// userID returns the ID of a login name, or nil when it is unknown
+func (r *ItemRepo) userID(loginName string) *uint {
+	var user PdmUser
+	err := r.DB.Select("id").Where("login_name = ?", loginName).Limit(1).Find(&user).Error
+	if err != nil || user.ID == 0 {
+		return nil
+	}
+	return &user.ID
+}
 
-// func (i *Item) CreateItem(project, path string, number *int, name, description, full_description string) {
-// 	i.Project = project // User works on current project
-// 	i.Path = path       // TODO: create path automatically
-// 	i.Name = name
-// 	i.Description = description
-// 	i.FullDescription = full_description
-// 	// TODO: How to handle other related properties
+// projectID returns the project that is linked to the vault directory, or 0
+func (r *ItemRepo) projectID(vault, dir string) uint {
+	proj, err := NewProjectRepo(r.DB).ProjectForPath(vault, dir)
+	if err != nil {
+		return 0
+	}
+	return proj.ID
+}
 
-// 	if number == nil {
-// 		// TODO: get latest number and ndigits from conf / db
-// 		i.number = i.CreateItemNumber()
-// 	}
+// baseName is the file name without extension
+func baseName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName))
+}
 
-// proj := new(Project)
-// self.project_id = proj.get_id(self.project)
-// // self.project_id = Select()  // get project id based on project number / project name
-// new_item = PdmItem(item_number=self.number, item_name=self.name, item_description=self.description, item_full_description=self.full_description, path=self.path, project_id=self.project_id)
+// newItem prepares the item of a container
+func (r *ItemRepo) newItem(vault, container, dir, partNumber, user string) PdmItem {
+	dir = CleanVaultPath(dir)
+	return PdmItem{
+		ItemNumber:      partNumber,
+		ItemPath:        dir,
+		Vault:           vault,
+		ContainerNumber: container,
+		UserID:          r.userID(user),
+		ProjectID:       r.projectID(vault, dir),
+	}
+}
 
-// // TODO: Import Engine - From where?
-// Session.configure(bind=engine, future=True)
+// newModel prepares the model record of a file
+func newModel(vault, container, fileName string, itemID uint, userID *uint) PdmModel {
+	return PdmModel{
+		ModelName:       baseName(fileName),
+		ModelFilename:   fileName,
+		ModelExt:        strings.ToLower(filepath.Ext(fileName)),
+		Vault:           vault,
+		ContainerNumber: container,
+		UserID:          userID,
+		ItemID:          itemID,
+	}
+}
 
-// // https://docs.sqlalchemy.org/en/14/orm/session_basics.html#id1
-// with Session() as session:
-//     try:
-//         session.add(new_item)
-//     except:
-//         Session.rollback()
-//     finally:
-//         Session.close()
-// }
+// newDocument prepares the document record of a file
+func newDocument(vault, container, fileName string, itemID, userID *uint) PdmDocument {
+	return PdmDocument{
+		DocumentName:     baseName(fileName),
+		DocumentFilename: fileName,
+		DocumentExt:      strings.ToLower(filepath.Ext(fileName)),
+		Vault:            vault,
+		ContainerNumber:  container,
+		UserID:           userID,
+		ItemID:           itemID,
+	}
+}
 
-// Remove existing item
-func (i *Item) RemoveItem() {
-	// check if item is new (local == no state)
-	// -> if True user can remove
-	// -> if False Check if user == admin
-	//   -> if True User can remove item
-	//   -> if False warning message
+// RecordAllocate creates the item of a new, empty container
+func (r *ItemRepo) RecordAllocate(vault, container, dir, partNumber, user string) (*PdmItem, error) {
+	item := r.newItem(vault, container, dir, partNumber, user)
+	if err := r.DB.Create(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
 }
 
-// Update existing item
-func (i *Item) UpdateItem() {
-	// raise NotImplementedError("Function update_item is not implemented yet")
+// RecordImport records a file that is imported into a new container. A
+// model gets an item of its own, a document stands alone.
+func (r *ItemRepo) RecordImport(vault, container, dir, fileName, user string) error {
+	if !IsModelFile(fileName) {
+		doc := newDocument(vault, container, fileName, nil, r.userID(user))
+		return r.DB.Create(&doc).Error
+	}
+
+	item := r.newItem(vault, container, dir, "", user)
+	item.ItemName = baseName(fileName)
+	item.ItemNumberLinkedFiles = 1
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		model := newModel(vault, container, fileName, item.ID, item.UserID)
+		return tx.Create(&model).Error
+	})
 }
 
-// Update existing item
-func (i *Item) AddItemImage() {
-	// TODO: Auto generate image from models
+// RecordAssign records the file that is assigned to an allocated container.
+// The file belongs to the item of the container.
+func (r *ItemRepo) RecordAssign(vault, container, fileName, user string) error {
+	item, err := r.ItemForContainer(vault, container)
+	if errors.Is(err, ErrItemNotFound) {
+		// allocated before the items were recorded
+		return r.RecordImport(vault, container, "", fileName, user)
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]any{"item_number_linked_files": gorm.Expr("item_number_linked_files + 1")}
+		if item.ItemName == "" {
+			updates["item_name"] = baseName(fileName)
+		}
+		if err := tx.Model(item).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		userID := r.userID(user)
+		if IsModelFile(fileName) {
+			model := newModel(vault, container, fileName, item.ID, userID)
+			return tx.Create(&model).Error
+		}
+		doc := newDocument(vault, container, fileName, &item.ID, userID)
+		return tx.Create(&doc).Error
+	})
+}
 
-	// raise NotImplementedError("Function add_item_image is not implemented yet")
+// RecordVersion records a new or checked in version of a container.
+// Empty descriptions keep the current ones.
+func (r *ItemRepo) RecordVersion(vault, container string, version int16, descr, longDescr string) error {
+	models := map[string]any{"model_version": version}
+	docs := map[string]any{"document_version": version}
+	if descr != "" {
+		models["model_description"] = descr
+		docs["document_description"] = descr
+	}
+	if longDescr != "" {
+		models["model_full_description"] = longDescr
+		docs["document_full_description"] = longDescr
+	}
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&PdmModel{}).Where("vault = ? AND container_number = ?", vault, container).Updates(models).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&PdmDocument{}).Where("vault = ? AND container_number = ?", vault, container).Updates(docs).Error
+	})
 }
 
-// When inheritance not everything. Do i need a base class?
+// RecordRename records the new directory and file name of a container
+func (r *ItemRepo) RecordRename(vault, container, dir, fileName string) error {
+	where := "vault = ? AND container_number = ?"
+	ext := strings.ToLower(filepath.Ext(fileName))
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&PdmItem{}).Where(where, vault, container).Update("item_path", CleanVaultPath(dir)).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&PdmModel{}).Where(where, vault, container).Updates(map[string]any{
+			"model_name":     baseName(fileName),
+			"model_filename": fileName,
+			"model_ext":      ext,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&PdmDocument{}).Where(where, vault, container).Updates(map[string]any{
+			"document_name":     baseName(fileName),
+			"document_filename": fileName,
+			"document_ext":      ext,
+		}).Error
+	})
+}
 
-// Model related
-type Model struct {
+// RecordRemove deletes the records of a removed container. The documents
+// that were attached to its item stay, without item.
+func (r *ItemRepo) RecordRemove(vault, container string) error {
+	where := "vault = ? AND container_number = ?"
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Model(&PdmItem{}).Where(where, vault, container).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := tx.Model(&PdmDocument{}).Where("item_id IN ?", ids).Update("item_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("item_id IN ?", ids).Delete(&PdmModel{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("parent_id IN ? OR child_id IN ?", ids, ids).Delete(&PdmBomLine{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where(where, vault, container).Delete(&PdmDocument{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where(where, vault, container).Delete(&PdmModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Where(where, vault, container).Delete(&PdmItem{}).Error
+	})
 }
 
-// Create new model
-func (m Model) CreateModel() {
-	// create copy with iter: 0
-	// Create model for:
-	// -> Existing item
-	// -> For new Item
-	//    -> With new item also create item
+// ItemForContainer returns the item of a vault container
+func (r *ItemRepo) ItemForContainer(vault, container string) (*PdmItem, error) {
+	var item PdmItem
+	err := r.DB.Where("vault = ? AND container_number = ?", vault, container).First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
 
-	// raise NotImplementedError("Function create_model is not implemented yet")
+// ItemByNumber returns the item with the part number
+func (r *ItemRepo) ItemByNumber(number string) (*PdmItem, error) {
+	var list []PdmItem
+	err := r.DB.Where("item_number = ?", strings.TrimSpace(number)).Order("id").Limit(1).Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	if number == "" || len(list) == 0 {
+		return nil, ErrItemNotFound
+	}
+	return &list[0], nil
 }
 
-// Remove existing model
-func (m Model) RemoveModel() {
-	// check if model is new (local == no state)
-	// -> if True user can remove
-	// -> if False Check if user == admin
-	//   -> if True User can remove item
-	//   -> if False warning message
+// LoadItem returns an item with its models and documents
+func (r *ItemRepo) LoadItem(id uint) (*PdmItem, error) {
+	var item PdmItem
+	err := r.DB.Preload("User").
+		Preload("Models.Material").
+		Preload("Models", func(db *gorm.DB) *gorm.DB { return db.Order("model_filename") }).
+		Preload("Documents", func(db *gorm.DB) *gorm.DB { return db.Order("document_filename") }).
+		Preload("Sources", func(db *gorm.DB) *gorm.DB { return db.Order("purchasing_source DESC, id") }).
+		Preload("Sources.Manufacturer").
+		Preload("Sources.Vendor").
+		First(&item, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
 
-	// raise NotImplementedError("Function remove_model is not implemented yet")
+// FindItems searches the items on number, name and description. An empty
+// vault searches all vaults.
+func (r *ItemRepo) FindItems(vault, query string, limit int) ([]PdmItem, error) {
+	tx := r.DB.Model(&PdmItem{})
+	if vault != "" {
+		tx = tx.Where("vault = ?", vault)
+	}
+	if query = strings.TrimSpace(query); query != "" {
+		like := "%" + strings.ToLower(query) + "%"
+		tx = tx.Where("LOWER(item_number) LIKE ? OR LOWER(item_name) LIKE ? OR LOWER(item_description) LIKE ?", like, like, like)
+	}
+
+	var items []PdmItem
+	err := tx.Order("vault, item_path, item_number, item_name").Limit(limit).Find(&items).Error
+	return items, err
 }
 
-// Update existing model
-func (m Model) UpdateModel() {
-	// create copy with iter: N
+// ContainerMatch is a container of which the records match a search
+type ContainerMatch struct {
+	Vault           string
+	ContainerNumber string
+	Path            string // empty for a document without item
+	FileName        string
+	PartNumber      string
+	Version         int16
+	Description     string
+}
 
-	// raise NotImplementedError("Function update_model is not implemented yet")
+// SearchContainers searches the containers on part number, container
+// number, file name, description and material, without case, in the order
+// of vault and container. A container with more models can come more
+// than once. An empty vault searches all vaults, an empty query returns
+// all containers.
+func (r *ItemRepo) SearchContainers(vault, query string, offset, limit int) ([]ContainerMatch, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	like := "%" + query + "%"
+
+	items := r.DB.Table("pdm_items AS i").
+		Select("i.vault, i.container_number, i.item_path AS path, COALESCE(m.model_filename, i.item_name) AS file_name, "+
+			"i.item_number AS part_number, COALESCE(m.model_version, 0) AS version, "+
+			"COALESCE(NULLIF(m.model_description, ''), i.item_description) AS description").
+		Joins("LEFT JOIN pdm_models m ON m.item_id = i.id AND m.deleted_at IS NULL").
+		Joins("LEFT JOIN pdm_materials mat ON mat.id = m.material_id").
+		Where("i.deleted_at IS NULL").
+		Where("? = '' OR LOWER(i.item_number) LIKE ? OR LOWER(i.item_name) LIKE ? OR LOWER(i.item_description) LIKE ? "+
+			"OR LOWER(i.container_number) LIKE ? OR LOWER(m.model_filename) LIKE ? OR LOWER(m.model_description) LIKE ? "+
+			"OR LOWER(mat.material_name) LIKE ?", query, like, like, like, like, like, like, like)
+
+	// The documents of a container with an item are searched with the item
+	docs := r.DB.Table("pdm_documents AS d").
+		Select("d.vault, d.container_number, '' AS path, d.document_filename AS file_name, '' AS part_number, "+
+			"d.document_version AS version, d.document_description AS description").
+		Where("d.deleted_at IS NULL").
+		Where("NOT EXISTS (SELECT 1 FROM pdm_items i WHERE i.vault = d.vault AND i.container_number = d.container_number AND i.deleted_at IS NULL)").
+		Where("? = '' OR LOWER(d.container_number) LIKE ? OR LOWER(d.document_filename) LIKE ? OR LOWER(d.document_description) LIKE ?",
+			query, like, like, like)
+
+	if vault != "" {
+		items = items.Where("i.vault = ?", vault)
+		docs = docs.Where("d.vault = ?", vault)
+	}
+
+	var list []ContainerMatch
+	err := r.DB.Raw("SELECT * FROM (? UNION ?) AS found ORDER BY vault, container_number, file_name LIMIT ? OFFSET ?",
+		items, docs, limit, offset).Scan(&list).Error
+	return list, err
 }
 
-// Get model that is not latest version
-func (m Model) GetVersion( /*save_iter*/ ) {
-	// in UI set only release versions or all
-	// Optional two versions to compare
-	// is FC able to reload when model is changed?
+// UpdateItem changes the name and descriptions of an item
+func (r *ItemRepo) UpdateItem(id uint, name, descr, fullDescr string) error {
+	res := r.DB.Model(&PdmItem{}).Where("id = ?", id).Updates(map[string]any{
+		"item_name":             strings.TrimSpace(name),
+		"item_description":      strings.TrimSpace(descr),
+		"item_full_description": fullDescr,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrItemNotFound
+	}
+	return nil
+}
 
-	// raise NotImplementedError("Function get_version is not implemented yet")
+// AttachDocument links the document of a container to an item
+func (r *ItemRepo) AttachDocument(itemID uint, vault, container string) (*PdmDocument, error) {
+	var doc PdmDocument
+	err := r.DB.Where("vault = ? AND container_number = ?", vault, container).First(&doc).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.ItemID != nil && *doc.ItemID == itemID {
+		return &doc, nil
+	}
+
+	var previous uint // the Update below writes into doc.ItemID
+	if doc.ItemID != nil {
+		previous = *doc.ItemID
+	}
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&doc).Update("item_id", itemID).Error; err != nil {
+			return err
+		}
+		// The document moves from the item it was linked to
+		if previous != 0 {
+			err := tx.Model(&PdmItem{}).Where("id = ? AND item_number_linked_files > 0", previous).
+				Update("item_number_linked_files", gorm.Expr("item_number_linked_files - 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&PdmItem{}).Where("id = ?", itemID).
+			Update("item_number_linked_files", gorm.Expr("item_number_linked_files + 1")).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc.ItemID = &itemID
+	return &doc, nil
 }
 
-// Document related
-type Document struct {
-	// How much difference is there between a document and a model?
+// DetachDocument removes the link between a document and an item. The
+// document itself stays in the vault.
+func (r *ItemRepo) DetachDocument(itemID, docID uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&PdmDocument{}).Where("id = ? AND item_id = ?", docID, itemID).Update("item_id", nil)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDocumentNotFound
+		}
+		return tx.Model(&PdmItem{}).Where("id = ? AND item_number_linked_files > 0", itemID).
+			Update("item_number_linked_files", gorm.Expr("item_number_linked_files - 1")).Error
+	})
 }
 
 // Item / Model / Document Ownership states
@@ -0,0 +1,361 @@
+package db_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/grd/FreePDM/internal/db"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openItemDB(t *testing.T) *gorm.DB {
+	gormdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "items.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open SQLite DB: %v", err)
+	}
+	err = gormdb.AutoMigrate(&db.PdmUser{}, &db.PdmProject{}, &db.PdmItem{}, &db.PdmMaterial{}, &db.PdmModel{},
+		&db.PdmDocument{}, &db.PdmBomLine{}, &db.PdmManufacturer{}, &db.PdmVendor{}, &db.PdmPurchase{},
+		&db.PdmReference{})
+	if err != nil {
+		t.Fatalf("failed to migrate schema: %v", err)
+	}
+	return gormdb
+}
+
+func TestItemRecords(t *testing.T) {
+	gormdb := openItemDB(t)
+	repo := db.NewItemRepo(gormdb)
+
+	// A model gets an item, a document stands alone
+	if err := repo.RecordImport("vault", "1", "parts", "bracket.FCStd", "jdoe"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RecordImport("vault", "2", "parts", "datasheet.pdf", "jdoe"); err != nil {
+		t.Fatal(err)
+	}
+	item, err := repo.ItemForContainer("vault", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ItemName != "bracket" || item.ItemPath != "parts" {
+		t.Errorf("unexpected item %+v", item)
+	}
+	if _, err := repo.ItemForContainer("vault", "2"); err != db.ErrItemNotFound {
+		t.Errorf("document got an item: %v", err)
+	}
+
+	if _, err := repo.AttachDocument(item.ID, "vault", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RecordVersion("vault", "1", 1, "thicker", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RecordRename("vault", "1", "parts/old", "bracket-v2.FCStd"); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err = repo.LoadItem(item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(item.Models) != 1 || item.Models[0].ModelVersion != 1 || item.Models[0].ModelFilename != "bracket-v2.FCStd" {
+		t.Errorf("unexpected models %+v", item.Models)
+	}
+	if len(item.Documents) != 1 || item.Documents[0].ContainerNumber != "2" {
+		t.Errorf("unexpected documents %+v", item.Documents)
+	}
+	if item.ItemPath != "parts/old" || item.ItemNumberLinkedFiles != 2 {
+		t.Errorf("unexpected item %+v", item)
+	}
+
+	// An allocated container gets its file later
+	if _, err := repo.RecordAllocate("vault", "3", "parts", "PRT-0001", "jdoe"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RecordAssign("vault", "3", "drawing.pdf", "jdoe"); err != nil {
+		t.Fatal(err)
+	}
+	allocated, err := repo.ItemForContainer("vault", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocated.ItemNumber != "PRT-0001" || allocated.ItemName != "drawing" {
+		t.Errorf("unexpected allocated item %+v", allocated)
+	}
+
+	// The document moves to another item
+	if _, err := repo.AttachDocument(allocated.ID, "vault", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.AttachDocument(allocated.ID, "vault", "2"); err != nil {
+		t.Fatal(err)
+	}
+	item, err = repo.LoadItem(item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := repo.LoadItem(allocated.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ItemNumberLinkedFiles != 1 || moved.ItemNumberLinkedFiles != allocated.ItemNumberLinkedFiles+1 {
+		t.Errorf("linked files after the move: %d and %d", item.ItemNumberLinkedFiles, moved.ItemNumberLinkedFiles)
+	}
+	if _, err := repo.AttachDocument(item.ID, "vault", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the model keeps the attached document
+	if err := repo.RecordRemove("vault", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.LoadItem(item.ID); err != db.ErrItemNotFound {
+		t.Errorf("removed item still found: %v", err)
+	}
+	var doc db.PdmDocument
+	if err := gormdb.Where("container_number = ?", "2").First(&doc).Error; err != nil || doc.ItemID != nil {
+		t.Errorf("document not detached: %+v, %v", doc, err)
+	}
+}
+
+func TestSearchContainers(t *testing.T) {
+	gormdb := openItemDB(t)
+	repo := db.NewItemRepo(gormdb)
+	materials := db.NewMaterialRepo(gormdb)
+
+	if _, err := materials.CreateMaterial("Steel", "", 7.85, db.D_gcm3); err != nil {
+		t.Fatal(err)
+	}
+	imports := []struct{ vault, container, dir, file string }{
+		{"vault", "1", "parts", "bracket.FCStd"},
+		{"vault", "2", "docs", "datasheet.pdf"},
+		{"other", "1", "parts", "bracket.FCStd"},
+	}
+	for _, imp := range imports {
+		if err := repo.RecordImport(imp.vault, imp.container, imp.dir, imp.file, "jdoe"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.RecordVersion("vault", "2", 3, "Pump curves", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := materials.RecordProperties("vault", "1", map[string]string{db.PropertyMaterial: "Steel"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		vault, query string
+		want         []string // vault/container
+	}{
+		{"", "", []string{"other/1", "vault/1", "vault/2"}},
+		{"vault", "", []string{"vault/1", "vault/2"}},
+		{"", "BRACKET", []string{"other/1", "vault/1"}},
+		{"vault", "pump", []string{"vault/2"}},
+		{"", "steel", []string{"vault/1"}},
+		{"", "nothing", nil},
+	}
+	for _, tt := range tests {
+		list, err := repo.SearchContainers(tt.vault, tt.query, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range list {
+			got = append(got, m.Vault+"/"+m.ContainerNumber)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("search %q in %q = %v, want %v", tt.query, tt.vault, got, tt.want)
+		}
+	}
+
+	list, err := repo.SearchContainers("vault", "pump", 0, 10)
+	if err != nil || len(list) != 1 || list[0].FileName != "datasheet.pdf" || list[0].Version != 3 || list[0].Path != "" {
+		t.Errorf("document match = %+v, %v", list, err)
+	}
+	list, err = repo.SearchContainers("", "", 1, 1)
+	if err != nil || len(list) != 1 || list[0].Vault != "vault" || list[0].ContainerNumber != "1" || list[0].Path != "parts" {
+		t.Errorf("second page = %+v, %v", list, err)
+	}
+}
+
+func TestBomWeight(t *testing.T) {
+	gormdb := openItemDB(t)
+	items := db.NewItemRepo(gormdb)
+	materials := db.NewMaterialRepo(gormdb)
+	boms := db.NewBomRepo(gormdb)
+
+	steel, err := materials.CreateMaterial("Steel", "", 7.85, db.D_gcm3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []string{"1", "2"} {
+		if err := items.RecordImport("vault", c, "", "part"+c+".FCStd", "jdoe"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 10 cm^3 of steel is 78.5 g
+	props := map[string]string{db.PropertyVolume: "10000 mm^3", db.PropertyMaterial: "steel"}
+	if err := materials.RecordProperties("vault", "2", props); err != nil {
+		t.Fatal(err)
+	}
+
+	assy, _ := items.ItemForContainer("vault", "1")
+	part, _ := items.ItemForContainer("vault", "2")
+
+	if _, err := boms.AddBomLine(assy.ID, part.ID, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := boms.AddBomLine(part.ID, assy.ID, 1); err != db.ErrBomCycle {
+		t.Errorf("cycle accepted: %v", err)
+	}
+
+	rows, total, err := boms.Bom(assy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || !near(rows[0].Weight, 0.0785) || !near(total, 0.314) {
+		t.Errorf("unexpected BOM %+v, total %g", rows, total)
+	}
+
+	// A denser material changes the weight up the BOM
+	if err := materials.UpdateMaterial(steel.ID, "Steel", "", 8, db.D_gcm3); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := boms.Weight(assy.ID); err != nil || !near(w, 0.32) {
+		t.Errorf("weight = %g, %v", w, err)
+	}
+	if err := materials.DeleteMaterial(steel.ID); err != db.ErrMaterialInUse {
+		t.Errorf("material in use deleted: %v", err)
+	}
+}
+
+func TestPurchaseSources(t *testing.T) {
+	gormdb := openItemDB(t)
+	items := db.NewItemRepo(gormdb)
+	boms := db.NewBomRepo(gormdb)
+	purchase := db.NewPurchaseRepo(gormdb)
+
+	for _, c := range []string{"1", "2"} {
+		if err := items.RecordImport("vault", c, "", "part"+c+".FCStd", "jdoe"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assy, _ := items.ItemForContainer("vault", "1")
+	screw, _ := items.ItemForContainer("vault", "2")
+	if _, err := boms.AddBomLine(assy.ID, screw.ID, 8); err != nil {
+		t.Fatal(err)
+	}
+
+	bossard, err := purchase.CreateManufacturer("Bossard", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := purchase.CreateManufacturer("bossard", ""); err == nil {
+		t.Error("duplicate manufacturer accepted")
+	}
+	rs, err := purchase.CreateVendor("RS", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := purchase.AddSource(screw.ID, &bossard.ID, "BN 610 M4x10", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := purchase.AddSource(screw.ID, nil, "", &rs.ID, "123-456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.PurchasingSource || second.PurchasingSource {
+		t.Error("the first source is not the preferred one")
+	}
+	if _, err := purchase.AddSource(screw.ID, &bossard.ID, "", nil, ""); err == nil {
+		t.Error("source without part number accepted")
+	}
+
+	if err := purchase.SetPreferred(screw.ID, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := purchase.SetTraceability(screw.ID, db.Lot); err != nil {
+		t.Fatal(err)
+	}
+	if err := purchase.DeleteVendor(rs.ID); err != db.ErrPartyInUse {
+		t.Errorf("vendor in use deleted: %v", err)
+	}
+
+	rows, err := boms.Explode(assy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Level != 1 || rows[0].Quantity != 8 {
+		t.Fatalf("unexpected explosion %+v", rows)
+	}
+	child := rows[0].Line.Child
+	if child.ItemTraceability != db.Lot || len(child.Sources) != 2 || child.Sources[0].ID != second.ID {
+		t.Errorf("unexpected sources %+v", child.Sources)
+	}
+
+	if err := purchase.RemoveSource(screw.ID, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := purchase.DeleteVendor(rs.ID); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWhereUsed(t *testing.T) {
+	gormdb := openItemDB(t)
+	refs := db.NewReferenceRepo(gormdb)
+
+	// Version 2 of an assembly in "main" uses version 1 of a part in "lib",
+	// a drawing uses the assembly
+	part := []db.ReferenceTarget{{Vault: "lib", Container: "7", Version: 1}}
+	if err := refs.RecordReferences("main", "1", "assy", "frame.FCStd", 1, part); err != nil {
+		t.Fatal(err)
+	}
+	part[0].Version = 3
+	if err := refs.RecordReferences("main", "1", "assy", "frame.FCStd", 2, part); err != nil {
+		t.Fatal(err)
+	}
+	assy := []db.ReferenceTarget{{Vault: "main", Container: "1", Version: 2}}
+	if err := refs.RecordReferences("main", "2", "drawings", "frame.FCStd", 1, assy); err != nil {
+		t.Fatal(err)
+	}
+	// Checking in a version again replaces its references
+	if err := refs.RecordReferences("main", "1", "assy", "frame.FCStd", 2, part); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := refs.WhereUsed("", "7", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Reference.ParentVersion != 1 || list[1].Reference.ChildVersion != 3 {
+		t.Fatalf("unexpected where used %+v", list)
+	}
+
+	list, err = refs.WhereUsed("lib", "7", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[1].Level != 2 || list[1].Reference.ParentContainer != "2" {
+		t.Fatalf("unexpected recursive where used %+v", list)
+	}
+	if list, _ := refs.WhereUsed("main", "7", false); len(list) != 0 {
+		t.Errorf("found a container of another vault: %+v", list)
+	}
+
+	if err := refs.RecordRename("main", "1", "assemblies", "base.FCStd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := refs.RecordRemove("main", "2"); err != nil {
+		t.Fatal(err)
+	}
+	list, _ = refs.WhereUsed("lib", "7", true)
+	if len(list) != 2 || list[0].Reference.ParentName != "base.FCStd" {
+		t.Errorf("unexpected where used after rename and remove %+v", list)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMaterialNotFound = errors.New("material not found")
+	ErrMaterialInUse    = errors.New("material is in use")
+	ErrModelNotFound    = errors.New("model not found")
+)
+
+// Model properties that are read at check in
+const (
+	PropertyVolume   = "Volume"   // "12500 mm^3", see ParseVolume
+	PropertyMaterial = "Material" // name of a material of the catalogue
+)
+
+//
+// The materials catalogue. A model with a material and a volume gets a
+// weight, in kg, which is updated when the volume, the material or its
+// density changes.
+//
+
+// Ease of handling
+type MaterialRepo struct {
+	DB *gorm.DB
+}
+
+// Constructor
+func NewMaterialRepo(db *gorm.DB) *MaterialRepo {
+	return &MaterialRepo{DB: db}
+}
+
+// Materials returns the catalogue, sorted by name
+func (r *MaterialRepo) Materials() ([]PdmMaterial, error) {
+	var list []PdmMaterial
+	err := r.DB.Order("material_name, material_finish").Find(&list).Error
+	return list, err
+}
+
+// LoadMaterial returns a material of the catalogue
+func (r *MaterialRepo) LoadMaterial(id uint) (*PdmMaterial, error) {
+	var mat PdmMaterial
+	err := r.DB.First(&mat, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMaterialNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mat, nil
+}
+
+// MaterialByName returns the material with the name, case insensitive
+func (r *MaterialRepo) MaterialByName(name string) (*PdmMaterial, error) {
+	var list []PdmMaterial
+	err := r.DB.Where("LOWER(material_name) = ?", strings.ToLower(strings.TrimSpace(name))).
+		Order("id").Limit(1).Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrMaterialNotFound
+	}
+	return &list[0], nil
+}
+
+func validMaterial(name string, density float64, unit DensityUnit) error {
+	if name == "" {
+		return errors.New("material name is empty")
+	}
+	if density <= 0 {
+		return fmt.Errorf("invalid density %g", density)
+	}
+	if _, ok := densityFactors[unit]; !ok {
+		return fmt.Errorf("unknown density unit %q", unit)
+	}
+	return nil
+}
+
+// CreateMaterial adds a material to the catalogue
+func (r *MaterialRepo) CreateMaterial(name, finish string, density float64, unit DensityUnit) (*PdmMaterial, error) {
+	name = strings.TrimSpace(name)
+	if err := validMaterial(name, density, unit); err != nil {
+		return nil, err
+	}
+
+	mat := PdmMaterial{
+		MaterialName:        name,
+		MaterialFinish:      strings.TrimSpace(finish),
+		MaterialDensity:     density,
+		MaterialDensityUnit: unit,
+	}
+	if err := r.DB.Create(&mat).Error; err != nil {
+		return nil, err
+	}
+	return &mat, nil
+}
+
+// UpdateMaterial changes a material and the weights of the models that use it
+func (r *MaterialRepo) UpdateMaterial(id uint, name, finish string, density float64, unit DensityUnit) error {
+	name = strings.TrimSpace(name)
+	if err := validMaterial(name, density, unit); err != nil {
+		return err
+	}
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&PdmMaterial{}).Where("id = ?", id).Updates(map[string]any{
+			"material_name":         name,
+			"material_finish":       strings.TrimSpace(finish),
+			"material_density":      density,
+			"material_density_unit": unit,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrMaterialNotFound
+		}
+
+		var models []PdmModel
+		if err := tx.Where("material_id = ?", id).Find(&models).Error; err != nil {
+			return err
+		}
+		for i := range models {
+			if err := updateWeight(tx, &models[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteMaterial removes a material that no model uses
+func (r *MaterialRepo) DeleteMaterial(id uint) error {
+	var count int64
+	if err := r.DB.Model(&PdmModel{}).Where("material_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrMaterialInUse
+	}
+	return r.DB.Delete(&PdmMaterial{}, id).Error
+}
+
+// AssignMaterial sets the material of a model, nil removes it
+func (r *MaterialRepo) AssignMaterial(modelID uint, materialID *uint) error {
+	var model PdmModel
+	err := r.DB.First(&model, modelID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrModelNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if materialID != nil {
+		if _, err := r.LoadMaterial(*materialID); err != nil {
+			return err
+		}
+	}
+
+	model.MaterialID = materialID
+	return updateWeight(r.DB, &model)
+}
+
+// RecordProperties takes the volume and the material of the models of a
+// container from the properties of a checked in version.
+func (r *MaterialRepo) RecordProperties(vault, container string, props map[string]string) error {
+	volumeProp, materialProp := props[PropertyVolume], props[PropertyMaterial]
+	if volumeProp == "" && materialProp == "" {
+		return nil
+	}
+
+	var models []PdmModel
+	if err := r.DB.Where("vault = ? AND container_number = ?", vault, container).Find(&models).Error; err != nil {
+		return err
+	}
+
+	for i := range models {
+		model := &models[i]
+
+		if volumeProp != "" {
+			volume, unit, err := ParseVolume(volumeProp)
+			if err != nil {
+				return err
+			}
+			model.ModelVolume = volume
+			model.ModelVolumeUnit = unit
+		}
+
+		if materialProp != "" {
+			mat, err := r.MaterialByName(materialProp)
+			if err != nil && !errors.Is(err, ErrMaterialNotFound) {
+				return err
+			}
+			// An unknown material keeps the current one
+			if mat != nil {
+				model.MaterialID = &mat.ID
+			}
+		}
+
+		if err := updateWeight(r.DB, model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateWeight computes the weight of a model and stores it together with
+// the volume and the material.
+func updateWeight(tx *gorm.DB, model *PdmModel) error {
+	model.ModelWeight = 0
+	if model.MaterialID != nil && model.ModelVolume > 0 {
+		var mat PdmMaterial
+		if err := tx.First(&mat, *model.MaterialID).Error; err != nil {
+			return err
+		}
+		weight, err := Mass(mat.MaterialDensity, mat.MaterialDensityUnit, model.ModelVolume, model.ModelVolumeUnit, W_kg)
+		if err != nil {
+			return err
+		}
+		model.ModelWeight = weight
+	}
+
+	return tx.Model(&PdmModel{}).Where("id = ?", model.ID).Updates(map[string]any{
+		"material_id":       model.MaterialID,
+		"model_volume":      model.ModelVolume,
+		"model_volume_unit": model.ModelVolumeUnit,
+		"model_weight":      model.ModelWeight,
+	}).Error
+}
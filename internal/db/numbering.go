@@ -0,0 +1,348 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//
+// Numbering service. A scheme has a pattern such as "PRJ-{project}-{seq:5}"
+// or "DWG-{seq}" and its own sequence. A scheme can be bound to a project
+// and/or an item type; the most specific scheme wins. Every issued number
+// is stored, the unique index makes sure a number is never issued twice.
+//
+// Pattern tokens:
+//
+//	{seq}      the sequence number
+//	{seq:N}    the sequence number with leading zeros up to N digits
+//	{project}  the project number
+//	{type}     the item type, such as "PRT" or "DWG"
+//	{year}     the year with four digits
+//	{yy}       the year with two digits
+//
+
+var (
+	ErrSchemeNotFound = errors.New("no numbering scheme found")
+
+	patternToken = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+
+	// Serializes the reservations of this process, the database lock does
+	// the same between processes.
+	numberMu sync.Mutex
+)
+
+// PdmNumberScheme is a pattern with a sequence
+type PdmNumberScheme struct {
+	Base
+	Name      string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Pattern   string `gorm:"type:varchar(64);not null"`
+	ProjectID uint   `gorm:"index"`            // 0 for all projects
+	ItemType  string `gorm:"type:varchar(16)"` // "" for all types
+	NextSeq   int64  `gorm:"default:1"`
+}
+
+// PdmIssuedNumber is a number that has been handed out
+type PdmIssuedNumber struct {
+	Base
+	Number    string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	SchemeID  uint   `gorm:"index"`
+	Seq       int64  // the sequence number that made it
+	IssuedTo  string `gorm:"type:varchar(30)"`
+	Vault     string `gorm:"type:varchar(64)"`
+	Container string `gorm:"type:varchar(16)"` // empty while the number is only reserved
+}
+
+// NumberVars are the values of the pattern tokens
+type NumberVars struct {
+	Project string
+	Type    string
+	Seq     int64
+	Time    time.Time
+}
+
+// FormatNumber fills in the tokens of a pattern
+func FormatNumber(pattern string, vars NumberVars) (string, error) {
+	var err error
+	number := patternToken.ReplaceAllStringFunc(pattern, func(token string) string {
+		m := patternToken.FindStringSubmatch(token)
+		switch m[1] {
+		case "seq":
+			s := strconv.FormatInt(vars.Seq, 10)
+			if m[2] != "" {
+				width, _ := strconv.Atoi(m[2])
+				if len(s) < width {
+					s = strings.Repeat("0", width-len(s)) + s
+				}
+			}
+			return s
+		case "project":
+			if vars.Project == "" {
+				err = fmt.Errorf("pattern %q needs a project", pattern)
+			}
+			return vars.Project
+		case "type":
+			if vars.Type == "" {
+				err = fmt.Errorf("pattern %q needs an item type", pattern)
+			}
+			return vars.Type
+		case "year":
+			return vars.Time.Format("2006")
+		case "yy":
+			return vars.Time.Format("06")
+		}
+		err = fmt.Errorf("unknown token %s in pattern %q", token, pattern)
+		return token
+	})
+	return number, err
+}
+
+// ValidatePattern checks the tokens of a pattern
+func ValidatePattern(pattern string) error {
+	if !strings.Contains(pattern, "{seq") {
+		return fmt.Errorf("pattern %q has no {seq}", pattern)
+	}
+	_, err := FormatNumber(pattern, NumberVars{Project: "P", Type: "T", Seq: 1, Time: time.Now()})
+	return err
+}
+
+// Ease of handling
+type NumberRepo struct {
+	DB *gorm.DB
+}
+
+// Constructor
+func NewNumberRepo(db *gorm.DB) *NumberRepo {
+	return &NumberRepo{DB: db}
+}
+
+// Schemes returns all numbering schemes
+func (r *NumberRepo) Schemes() ([]PdmNumberScheme, error) {
+	var list []PdmNumberScheme
+	err := r.DB.Order("name").Find(&list).Error
+	return list, err
+}
+
+// CreateScheme adds a numbering scheme
+func (r *NumberRepo) CreateScheme(name, pattern string, projectID uint, itemType string, start int64) (*PdmNumberScheme, error) {
+	if err := ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+	if start < 1 {
+		start = 1
+	}
+
+	scheme := &PdmNumberScheme{
+		Name:      strings.TrimSpace(name),
+		Pattern:   pattern,
+		ProjectID: projectID,
+		ItemType:  strings.TrimSpace(itemType),
+		NextSeq:   start,
+	}
+	return scheme, r.DB.Create(scheme).Error
+}
+
+// DeleteScheme removes a numbering scheme. The issued numbers stay.
+func (r *NumberRepo) DeleteScheme(id uint) error {
+	return r.DB.Delete(&PdmNumberScheme{}, id).Error
+}
+
+// ResolveScheme returns the most specific scheme for a project and item type
+func (r *NumberRepo) ResolveScheme(projectID uint, itemType string) (*PdmNumberScheme, error) {
+	var scheme PdmNumberScheme
+	err := r.DB.
+		Where("project_id IN ?", []uint{0, projectID}).
+		Where("item_type IN ?", []string{"", itemType}).
+		Order("project_id desc, item_type desc").
+		First(&scheme).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSchemeNotFound
+	}
+	return &scheme, err
+}
+
+// Reserve issues a block of count numbers of a scheme to a user. Numbers
+// that already exist, for instance entered by hand, are skipped.
+func (r *NumberRepo) Reserve(schemeID uint, vars NumberVars, count int, issuedTo string) ([]string, error) {
+	if count < 1 {
+		return nil, fmt.Errorf("invalid count %d", count)
+	}
+
+	numberMu.Lock()
+	defer numberMu.Unlock()
+
+	var numbers []string
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx
+		if tx.Dialector.Name() == "postgres" {
+			query = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+
+		var scheme PdmNumberScheme
+		if err := query.First(&scheme, schemeID).Error; err != nil {
+			return err
+		}
+
+		if vars.Project == "" && scheme.ProjectID != 0 {
+			var p PdmProject
+			if err := tx.First(&p, scheme.ProjectID).Error; err != nil {
+				return err
+			}
+			vars.Project = p.ProjectNumber
+		}
+		if vars.Type == "" {
+			vars.Type = scheme.ItemType
+		}
+		if vars.Time.IsZero() {
+			vars.Time = time.Now()
+		}
+
+		seq := scheme.NextSeq
+		for skipped := 0; len(numbers) < count; seq++ {
+			vars.Seq = seq
+			number, err := FormatNumber(scheme.Pattern, vars)
+			if err != nil {
+				return err
+			}
+
+			var exists int64
+			if err := tx.Model(&PdmIssuedNumber{}).Where("number = ?", number).Count(&exists).Error; err != nil {
+				return err
+			}
+			if exists > 0 {
+				if skipped++; skipped > 1000 {
+					return fmt.Errorf("scheme %s: no free numbers after %s", scheme.Name, number)
+				}
+				continue
+			}
+
+			issued := PdmIssuedNumber{Number: number, SchemeID: scheme.ID, Seq: seq, IssuedTo: issuedTo}
+			if err := tx.Create(&issued).Error; err != nil {
+				return err
+			}
+			numbers = append(numbers, number)
+		}
+
+		return tx.Model(&scheme).Update("next_seq", seq).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return numbers, nil
+}
+
+// Next issues one number for a project and item type
+func (r *NumberRepo) Next(projectID uint, itemType, issuedTo string) (string, error) {
+	scheme, err := r.ResolveScheme(projectID, itemType)
+	if err != nil {
+		return "", err
+	}
+	vars, err := r.Vars(projectID, itemType)
+	if err != nil {
+		return "", err
+	}
+
+	numbers, err := r.Reserve(scheme.ID, vars, 1, issuedTo)
+	if err != nil {
+		return "", err
+	}
+	return numbers[0], nil
+}
+
+// Vars returns the pattern values of a project and item type, so that a
+// scheme for all projects can have {project} too
+func (r *NumberRepo) Vars(projectID uint, itemType string) (NumberVars, error) {
+	vars := NumberVars{Type: itemType}
+	if projectID != 0 {
+		var p PdmProject
+		if err := r.DB.Select("project_number").First(&p, projectID).Error; err != nil {
+			return vars, err
+		}
+		vars.Project = p.ProjectNumber
+	}
+	return vars, nil
+}
+
+// Release takes back a number that was issued to a user but never used,
+// for instance because the container could not be made. When it was the
+// last number of its scheme, the sequence goes back so that the number is
+// issued again.
+func (r *NumberRepo) Release(number, issuedTo string) error {
+	numberMu.Lock()
+	defer numberMu.Unlock()
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var issued PdmIssuedNumber
+		err := tx.Where("number = ? AND issued_to = ? AND container = ''", number, issuedTo).First(&issued).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("number %s is not reserved by %s", number, issuedTo)
+			}
+			return err
+		}
+		if err := tx.Unscoped().Delete(&issued).Error; err != nil {
+			return err
+		}
+		if issued.Seq == 0 {
+			return nil
+		}
+		return tx.Model(&PdmNumberScheme{}).
+			Where("id = ? AND next_seq = ?", issued.SchemeID, issued.Seq+1).
+			Update("next_seq", issued.Seq).Error
+	})
+}
+
+// Assign records the container that uses a number
+func (r *NumberRepo) Assign(number, vault, container string) error {
+	result := r.DB.Model(&PdmIssuedNumber{}).
+		Where("number = ?", number).
+		Updates(map[string]interface{}{"vault": vault, "container": container})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("number %s has not been issued", number)
+	}
+	return nil
+}
+
+// ClaimReserved checks that a number has been reserved by the user and is
+// not used yet
+func (r *NumberRepo) ClaimReserved(number, issuedTo string) error {
+	var count int64
+	err := r.DB.Model(&PdmIssuedNumber{}).
+		Where("number = ? AND issued_to = ? AND container = ''", number, issuedTo).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("number %s is not reserved by %s", number, issuedTo)
+	}
+	return nil
+}
+
+// Reserved returns the numbers of a user that are not used yet
+func (r *NumberRepo) Reserved(issuedTo string) ([]PdmIssuedNumber, error) {
+	var list []PdmIssuedNumber
+	err := r.DB.Where("issued_to = ? AND container = ''", issuedTo).Order("number").Find(&list).Error
+	return list, err
+}
+
+// IssuedNumbers returns the last issued numbers of a scheme
+func (r *NumberRepo) IssuedNumbers(schemeID uint, limit int) ([]PdmIssuedNumber, error) {
+	var list []PdmIssuedNumber
+	err := r.DB.Where("scheme_id = ?", schemeID).Order("id desc").Limit(limit).Find(&list).Error
+	return list, err
+}
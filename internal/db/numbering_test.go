@@ -0,0 +1,156 @@
+package db_test
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grd/FreePDM/internal/db"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFormatNumber(t *testing.T) {
+	at := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		pattern string
+		vars    db.NumberVars
+		want    string
+	}{
+		{"DWG-{seq}", db.NumberVars{Seq: 42}, "DWG-42"},
+		{"PRJ-{project}-{seq:5}", db.NumberVars{Project: "0012", Seq: 7}, "PRJ-0012-00007"},
+		{"{type}{yy}-{seq:3}", db.NumberVars{Type: "PRT", Seq: 1234, Time: at}, "PRT25-1234"},
+		{"{year}/{seq:2}", db.NumberVars{Seq: 3, Time: at}, "2025/03"},
+	}
+	for _, tt := range tests {
+		got, err := db.FormatNumber(tt.pattern, tt.vars)
+		if err != nil || got != tt.want {
+			t.Errorf("FormatNumber(%q) = %q, %v; want %q", tt.pattern, got, err, tt.want)
+		}
+	}
+
+	if _, err := db.FormatNumber("PRJ-{project}-{seq}", db.NumberVars{Seq: 1}); err == nil {
+		t.Error("missing project accepted")
+	}
+	if err := db.ValidatePattern("DWG-{number}"); err == nil {
+		t.Error("pattern without {seq} accepted")
+	}
+}
+
+func TestReserveUnique(t *testing.T) {
+	gormdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "numbers.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open SQLite DB: %v", err)
+	}
+	if err := gormdb.AutoMigrate(&db.PdmProject{}, &db.PdmNumberScheme{}, &db.PdmIssuedNumber{}); err != nil {
+		t.Fatalf("failed to migrate schema: %v", err)
+	}
+	repo := db.NewNumberRepo(gormdb)
+
+	general, err := repo.CreateScheme("drawings", "DWG-{seq:4}", 0, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateScheme("parts", "PRT-{seq:4}", 0, "PRT", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// A number that was entered by hand is skipped
+	if err := gormdb.Create(&db.PdmIssuedNumber{Number: "DWG-0002"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = map[string]bool{}
+	)
+	for range 8 {
+		wg.Go(func() {
+			numbers, err := repo.Reserve(general.ID, db.NumberVars{}, 5, "jdoe")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, n := range numbers {
+				if seen[n] {
+					t.Errorf("number %s issued twice", n)
+				}
+				seen[n] = true
+			}
+		})
+	}
+	wg.Wait()
+
+	if len(seen) != 40 || seen["DWG-0002"] {
+		t.Errorf("got %d numbers, DWG-0002 issued: %v", len(seen), seen["DWG-0002"])
+	}
+
+	scheme, err := repo.ResolveScheme(0, "PRT")
+	if err != nil || scheme.Name != "parts" {
+		t.Errorf("ResolveScheme(PRT) = %v, %v", scheme, err)
+	}
+
+	number, err := repo.Next(0, "DOC", "jdoe")
+	if err != nil || number != "DWG-0042" {
+		t.Errorf("Next = %q, %v; want DWG-0042", number, err)
+	}
+	if err := repo.Assign(number, "vault", "12"); err != nil {
+		t.Error(err)
+	}
+	if err := repo.ClaimReserved(number, "jdoe"); err == nil {
+		t.Error("used number claimed again")
+	}
+}
+
+func TestNextProjectAndRelease(t *testing.T) {
+	gormdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "numbers.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open SQLite DB: %v", err)
+	}
+	if err := gormdb.AutoMigrate(&db.PdmProject{}, &db.PdmNumberScheme{}, &db.PdmIssuedNumber{}); err != nil {
+		t.Fatalf("failed to migrate schema: %v", err)
+	}
+	repo := db.NewNumberRepo(gormdb)
+
+	// A scheme for all projects fills in the project of the number
+	if _, err := repo.CreateScheme("projects", "PRJ-{project}-{seq:5}", 0, "", 1); err != nil {
+		t.Fatal(err)
+	}
+	p := db.PdmProject{ProjectNumber: "0012"}
+	if err := gormdb.Create(&p).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	number, err := repo.Next(p.ID, "", "jdoe")
+	if err != nil || number != "PRJ-0012-00001" {
+		t.Fatalf("Next = %q, %v; want PRJ-0012-00001", number, err)
+	}
+	if _, err := repo.Next(0, "", "jdoe"); err == nil {
+		t.Error("number without a project issued")
+	}
+
+	// A released number is issued again
+	if err := repo.Release(number, "someone"); err == nil {
+		t.Error("number of someone else released")
+	}
+	if err := repo.Release(number, "jdoe"); err != nil {
+		t.Fatal(err)
+	}
+	again, err := repo.Next(p.ID, "", "jdoe")
+	if err != nil || again != number {
+		t.Errorf("Next after Release = %q, %v; want %s", again, err, number)
+	}
+
+	// A used number stays
+	if err := repo.Assign(again, "vault", "12"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Release(again, "jdoe"); err == nil {
+		t.Error("used number released")
+	}
+}
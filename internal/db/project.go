@@ -5,32 +5,406 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-// Basically searching in the SQL database requires a connection to the database too.
-// Is it than a sub-class or better to request access to a class or has this class a interface too?
+var ErrProjectNotFound = errors.New("project not found")
 
-// Project represents the projects table.
-type Project struct {
-	gorm.Model
-	ID          uint   `gorm:"primaryKey"`
-	ProjectName string `gorm:"size:100"`
-	number      string
-	name        string
-	status      ProjectState
-	path        string
+// Ease of handling
+type ProjectRepo struct {
+	DB *gorm.DB
+}
+
+// Constructor
+func NewProjectRepo(db *gorm.DB) *ProjectRepo {
+	return &ProjectRepo{DB: db}
+}
+
+// Number of digits of a generated project number
+func projectNumberDigits() int {
+	n, err := strconv.Atoi(os.Getenv("PROJECT_NUMBER_DIGITS"))
+	if err != nil || n < 1 {
+		return 4
+	}
+	return n
+}
+
+// The project states that can follow a state
+var projectTransitions = map[ProjectState][]ProjectState{
+	New:        {Upcoming, Draft, NotStarted, Active, Canceld},
+	Draft:      {Upcoming, Pending, NotStarted, Active, Canceld},
+	Upcoming:   {Pending, NotStarted, Active, Onhold, Canceld},
+	Pending:    {NotStarted, Active, Onhold, Canceld},
+	NotStarted: {Active, Onhold, Canceld},
+	Active:     {Priority, Onhold, Canceld, Archived},
+	Priority:   {Active, Onhold, Canceld, Archived},
+	Onhold:     {Active, Canceld, Archived},
+	Canceld:    {Archived},
+	Archived:   {},
+}
+
+// ProjectStates returns all project states
+func ProjectStates() []ProjectState {
+	return []ProjectState{New, Draft, Upcoming, Pending, NotStarted, Active, Priority, Onhold, Canceld, Archived}
+}
+
+// ProjectTransitions returns the states that a project in state from can go to
+func ProjectTransitions(from ProjectState) []ProjectState {
+	return projectTransitions[from]
+}
+
+// CanTransition tells whether a project can go from one state to another
+func CanTransition(from, to ProjectState) bool {
+	return slices.Contains(projectTransitions[from], to)
+}
+
+// State returns the state of the project
+func (p PdmProject) State() ProjectState {
+	if p.ProjectStatus == "" {
+		return New
+	}
+	return ProjectState(p.ProjectStatus)
 }
 
 // Get id with Project number
-func (p Project) GetId(number string) int {
-	// raise NotImplementedError("Function get_id is not implemented yet")
+func (r *ProjectRepo) GetId(number string) (uint, error) {
+	var p PdmProject
+	if err := r.DB.Select("id").Where("project_number = ?", number).First(&p).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrProjectNotFound
+		}
+		return 0, err
+	}
+	return p.ID, nil
+}
+
+// ProjectSchemeType is the item type of the numbering scheme of the project
+// numbers. The scheme is created on the first project without a number, with
+// the pattern {seq:N} of PROJECT_NUMBER_DIGITS; an admin can change it like
+// any other scheme.
+const ProjectSchemeType = "PROJECT"
+
+// nextNumber issues the next project number from the numbering service.
+// Numbers that are taken already, for instance entered by hand, are skipped.
+func nextNumber(tx *gorm.DB) (string, error) {
+	numbers := NewNumberRepo(tx)
+	scheme, err := projectScheme(tx)
+	if err != nil {
+		return "", err
+	}
+
+	for range 1000 {
+		list, err := numbers.Reserve(scheme.ID, NumberVars{}, 1, "")
+		if err != nil {
+			return "", err
+		}
+		var exists int64
+		if err := tx.Unscoped().Model(&PdmProject{}).Where("project_number = ?", list[0]).Count(&exists).Error; err != nil {
+			return "", err
+		}
+		if exists == 0 {
+			return list[0], nil
+		}
+	}
+	return "", fmt.Errorf("scheme %s: no free project numbers", scheme.Name)
+}
+
+// projectScheme returns the numbering scheme of the projects, and creates
+// it when there is none. The sequence starts after the highest numeric
+// project number, so that the numbers go on where they were.
+func projectScheme(tx *gorm.DB) (*PdmNumberScheme, error) {
+	numberMu.Lock()
+	defer numberMu.Unlock()
+
+	var scheme PdmNumberScheme
+	err := tx.Where("project_id = 0 AND item_type = ?", ProjectSchemeType).First(&scheme).Error
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return &scheme, err
+	}
+
+	var existing []string
+	if err := tx.Unscoped().Model(&PdmProject{}).Pluck("project_number", &existing).Error; err != nil {
+		return nil, err
+	}
+	var last int64
+	for _, number := range existing {
+		if n, err := strconv.ParseInt(number, 10, 64); err == nil && n > last {
+			last = n
+		}
+	}
+
+	scheme = PdmNumberScheme{
+		Name:     "Projects",
+		Pattern:  fmt.Sprintf("{seq:%d}", projectNumberDigits()),
+		ItemType: ProjectSchemeType,
+		NextSeq:  last + 1,
+	}
+	return &scheme, tx.Create(&scheme).Error
+}
+
+// Create new project. An empty number is generated, an empty status is New.
+func (r *ProjectRepo) NewProject(number, name string, status ProjectState, vault, path string) (*PdmProject, error) {
+	if status == "" {
+		status = New
+	}
+
+	proj := &PdmProject{
+		ProjectNumber: number,
+		ProjectName:   name,
+		ProjectStatus: string(status),
+		ProjectVault:  vault,
+		ProjectPath:   CleanVaultPath(path),
+	}
+
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if proj.ProjectNumber == "" {
+			var err error
+			if proj.ProjectNumber, err = nextNumber(tx); err != nil {
+				return fmt.Errorf("failed to create project number: %w", err)
+			}
+		}
+		return tx.Create(proj).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proj, nil
+}
+
+// LoadProject returns a project with its members
+func (r *ProjectRepo) LoadProject(id uint) (*PdmProject, error) {
+	var p PdmProject
+	if err := r.DB.Preload("Users").First(&p, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProjectNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// AllProjects returns all projects, sorted by number
+func (r *ProjectRepo) AllProjects() ([]PdmProject, error) {
+	var list []PdmProject
+	err := r.DB.Preload("Users").Order("project_number").Find(&list).Error
+	return list, err
+}
+
+// ProjectsOfUser returns the projects that a user is a member of
+func (r *ProjectRepo) ProjectsOfUser(userID uint) ([]PdmProject, error) {
+	var list []PdmProject
+	err := r.DB.Preload("Users").
+		Joins("JOIN pdm_user_project_links l ON l.project_id = pdm_projects.id").
+		Where("l.user_id = ?", userID).
+		Order("project_number").Find(&list).Error
+	return list, err
+}
+
+// Update existing project: name and dates. The vault link changes with LinkVault.
+func (r *ProjectRepo) UpdateProject(p *PdmProject) error {
+	return r.DB.Model(&PdmProject{}).Where("id = ?", p.ID).Updates(map[string]interface{}{
+		"project_name":        p.ProjectName,
+		"project_date_start":  p.ProjectDateStart,
+		"project_date_finish": p.ProjectDateFinish,
+	}).Error
+}
+
+// SetState changes the state of a project. Becoming active sets the start
+// date, ending sets the finish date.
+func (r *ProjectRepo) SetState(id uint, to ProjectState) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var p PdmProject
+		if err := tx.First(&p, id).Error; err != nil {
+			return err
+		}
+		if !CanTransition(p.State(), to) {
+			return fmt.Errorf("project %s can't go from %s to %s", p.ProjectNumber, p.State(), to)
+		}
 
-	return -1 // BUG: Watch out !!!
+		now := time.Now()
+		updates := map[string]interface{}{"project_status": string(to)}
+		if to == Active && p.ProjectDateStart == nil {
+			updates["project_date_start"] = now
+		}
+		if (to == Archived || to == Canceld) && p.ProjectDateFinish == nil {
+			updates["project_date_finish"] = now
+		}
+		return tx.Model(&p).Updates(updates).Error
+	})
+}
+
+// Remove existing project, its members and the ACL entries that it made
+func (r *ProjectRepo) RemoveProject(id uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var p PdmProject
+		if err := tx.First(&p, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrProjectNotFound
+			}
+			return err
+		}
+		if err := NewAclRepo(tx).RevokeProject(id, "", ""); err != nil {
+			return err
+		}
+		if err := tx.Where("project_id = ?", id).Delete(&PdmUserProjectLink{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&p).Error
+	})
+}
+
+// Add user to project. The user gets perms on the vault subtree of the project.
+func (r *ProjectRepo) AddUserToProject(projectID, userID uint, perms []AclPermission) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var p PdmProject
+		if err := tx.First(&p, projectID).Error; err != nil {
+			return err
+		}
+		var u PdmUser
+		if err := tx.First(&u, userID).Error; err != nil {
+			return err
+		}
+
+		link := PdmUserProjectLink{UserID: userID, ProjectID: projectID}
+		if err := tx.Where(&link).FirstOrCreate(&link).Error; err != nil {
+			return err
+		}
+
+		if p.ProjectVault == "" || len(perms) == 0 {
+			return nil
+		}
+		return NewAclRepo(tx).GrantForProject(p.ID, p.ProjectVault, p.ProjectPath, SubjectUser, u.LoginName, perms)
+	})
+}
+
+// Remove user from project, including the access to the vault subtree
+func (r *ProjectRepo) RemoveUserFromProject(projectID, userID uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var p PdmProject
+		if err := tx.First(&p, projectID).Error; err != nil {
+			return err
+		}
+		var u PdmUser
+		if err := tx.First(&u, userID).Error; err != nil {
+			return err
+		}
+
+		if err := revokeProjectAccess(tx, &p, u.LoginName); err != nil {
+			return err
+		}
+		return tx.Where("project_id = ? AND user_id = ?", projectID, userID).Delete(&PdmUserProjectLink{}).Error
+	})
+}
+
+// LinkVault links a project to a vault subtree. The ACL entries that the
+// project made for its members move along, the other entries stay.
+func (r *ProjectRepo) LinkVault(id uint, vault, path string) error {
+	path = CleanVaultPath(path)
+
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var p PdmProject
+		if err := tx.First(&p, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrProjectNotFound
+			}
+			return err
+		}
+
+		if vault == "" {
+			if err := NewAclRepo(tx).RevokeProject(p.ID, "", ""); err != nil {
+				return err
+			}
+		} else {
+			err := tx.Model(&PdmAcl{}).Where("project_id = ?", p.ID).Updates(map[string]interface{}{
+				"vault": vault,
+				"path":  path,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&p).Updates(map[string]interface{}{
+			"project_vault": vault,
+			"project_path":  path,
+		}).Error
+	})
+}
+
+// revokeProjectAccess deletes the ACL entries that the project made for a
+// member. Grants of their own stay.
+func revokeProjectAccess(tx *gorm.DB, p *PdmProject, loginName string) error {
+	return NewAclRepo(tx).RevokeProject(p.ID, SubjectUser, loginName)
+}
+
+// ProjectForPath returns the project that is linked to the deepest vault
+// directory containing path
+func (r *ProjectRepo) ProjectForPath(vault, path string) (*PdmProject, error) {
+	var list []PdmProject
+	if err := r.DB.Where("project_vault = ?", vault).Find(&list).Error; err != nil {
+		return nil, err
+	}
+
+	path = CleanVaultPath(path)
+	var found *PdmProject
+	for i, p := range list {
+		if covers(p.ProjectPath, path) && (found == nil || len(p.ProjectPath) > len(found.ProjectPath)) {
+			found = &list[i]
+		}
+	}
+	if found == nil {
+		return nil, ErrProjectNotFound
+	}
+	return found, nil
+}
+
+// ProjectItems returns the items of a project
+func (r *ProjectRepo) ProjectItems(id uint) ([]PdmItem, error) {
+	var items []PdmItem
+	err := r.DB.Where("project_id = ?", id).Order("item_number").Find(&items).Error
+	return items, err
+}
+
+// ProjectProgress summarizes a project for the overview pages
+type ProjectProgress struct {
+	Items       int
+	DaysRunning int
+	Percent     int // part of the period between start and finish that has passed
+}
+
+// Progress computes the progress of a project
+func (r *ProjectRepo) Progress(p *PdmProject) (ProjectProgress, error) {
+	var prog ProjectProgress
+
+	var count int64
+	if err := r.DB.Model(&PdmItem{}).Where("project_id = ?", p.ID).Count(&count).Error; err != nil {
+		return prog, err
+	}
+	prog.Items = int(count)
+
+	if p.ProjectDateStart == nil {
+		return prog, nil
+	}
+	now := time.Now()
+	prog.DaysRunning = int(now.Sub(*p.ProjectDateStart).Hours() / 24)
+
+	switch {
+	case p.State() == Archived:
+		prog.Percent = 100
+	case p.ProjectDateFinish != nil && p.ProjectDateFinish.After(*p.ProjectDateStart):
+		total := p.ProjectDateFinish.Sub(*p.ProjectDateStart)
+		elapsed := now.Sub(*p.ProjectDateStart)
+		prog.Percent = min(100, max(0, int(100*elapsed.Seconds()/total.Seconds())))
+	}
+	return prog, nil
 }
 
 // var number int
@@ -62,62 +436,3 @@ func CreateNumber(number string, ndigits *int) (string, error) {
 	}
 	return strconv.Itoa(num), nil
 }
-
-// Create new project
-func NewProject(number string, name string, status *string, path string) (*Project, error) {
-	proj := new(Project)
-	proj.name = name
-	proj.path = path // TODO: create path automatically
-	// TODO: How to handle other related properties
-
-	if number == "" {
-		// TODO: get latest number and ndigits from conf / db
-		// var err error
-		// // proj.number, err = CreateNumber(last_number, ndigits)
-		// if err != nil {
-		// 	return nil, err
-		// }
-	} else {
-		proj.number = number
-	}
-
-	if status == nil {
-		proj.status = New
-	}
-
-	// new_project = PdmProject(self.number, self.name, self.status, self.date_start, self.date_finish, self.path)
-
-	// // TODO: Import Engine - From where?
-	// Session.configure(bind=engine, future=True)
-
-	// // https://docs.sqlalchemy.org/en/14/orm/session_basics.html#id1
-	// with Session() as session:
-	//     try:
-	//         session.add(new_project)
-	//     except:
-	//         Session.rollback()
-	//     finally:
-	//         Session.close()
-
-	return proj, nil
-}
-
-// Remove existing project
-func (p *Project) RemovePproject() {
-	// raise NotImplementedError("Function remove_project is not implemented yet")
-}
-
-// Update existing project
-func (p *Project) UpdateProject() {
-	// raise NotImplementedError("Function update_model is not implemented yet")
-}
-
-// Add user to project
-func (p *Project) AddUserToProject() {
-	// raise NotImplementedError("Function add_user_to_project is not implemented yet")
-}
-
-// Remove user from project
-func (p *Project) RemoveUserFromProject() {
-	// raise NotImplementedError("Function remove_user_from_project is not implemented yet")
-}
@@ -0,0 +1,123 @@
+package db_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/grd/FreePDM/internal/db"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openProjectDB(t *testing.T) *gorm.DB {
+	gormdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "projects.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open SQLite DB: %v", err)
+	}
+	err = gormdb.AutoMigrate(&db.PdmUser{}, &db.PdmProject{}, &db.PdmUserProjectLink{}, &db.PdmAcl{},
+		&db.PdmNumberScheme{}, &db.PdmIssuedNumber{})
+	if err != nil {
+		t.Fatalf("failed to migrate schema: %v", err)
+	}
+	return gormdb
+}
+
+func TestProjectNumbers(t *testing.T) {
+	gormdb := openProjectDB(t)
+	repo := db.NewProjectRepo(gormdb)
+
+	// Numbers entered by hand, numeric or not, are no trouble
+	for _, number := range []string{"0007", "ACME-1", "0009"} {
+		if _, err := repo.NewProject(number, "by hand", db.New, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := repo.NewProject("", "generated", db.New, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ProjectNumber != "0010" {
+		t.Errorf("first generated number = %q, want 0010", p.ProjectNumber)
+	}
+
+	// A taken number is skipped
+	if _, err := repo.NewProject("0011", "by hand", db.New, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	p, err = repo.NewProject("", "generated", db.New, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ProjectNumber != "0012" {
+		t.Errorf("next generated number = %q, want 0012", p.ProjectNumber)
+	}
+
+	scheme, err := db.NewNumberRepo(gormdb).ResolveScheme(0, db.ProjectSchemeType)
+	if err != nil || scheme.Pattern != "{seq:4}" {
+		t.Errorf("project scheme = %+v, %v", scheme, err)
+	}
+}
+
+func TestProjectGrants(t *testing.T) {
+	gormdb := openProjectDB(t)
+	repo := db.NewProjectRepo(gormdb)
+	acl := db.NewAclRepo(gormdb)
+
+	jdoe := db.PdmUser{LoginName: "jdoe"}
+	if err := gormdb.Create(&jdoe).Error; err != nil {
+		t.Fatal(err)
+	}
+	p, err := repo.NewProject("0001", "pump", db.New, "vault", "pump")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A grant of its own on the same directory, and one elsewhere
+	if err := acl.Grant("vault", "pump", db.SubjectUser, "jdoe", []db.AclPermission{db.AclRelease}); err != nil {
+		t.Fatal(err)
+	}
+	if err := acl.Grant("vault", "valve", db.SubjectUser, "jdoe", []db.AclPermission{db.AclRead}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddUserToProject(p.ID, jdoe.ID, []db.AclPermission{db.AclRead, db.AclWrite}); err != nil {
+		t.Fatal(err)
+	}
+
+	perms := func(vault, dir string) []db.AclPermission {
+		t.Helper()
+		list, err := acl.SubjectPermissions(vault, dir, db.SubjectUser, "jdoe")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+	if got := perms("vault", "pump"); len(got) != 3 {
+		t.Errorf("permissions on pump = %v, want release, read and write", got)
+	}
+
+	// The project grant moves, the others stay
+	if err := repo.LinkVault(p.ID, "vault", "pumps/p1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := perms("vault", "pump"); len(got) != 1 || got[0] != db.AclRelease {
+		t.Errorf("permissions on pump after the move = %v, want release", got)
+	}
+	if got := perms("vault", "pumps/p1"); len(got) != 2 {
+		t.Errorf("permissions on pumps/p1 = %v, want read and write", got)
+	}
+
+	// Leaving the project takes only the project grant
+	if err := repo.RemoveUserFromProject(p.ID, jdoe.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := perms("vault", "pumps/p1"); len(got) != 0 {
+		t.Errorf("permissions on pumps/p1 after leaving = %v, want none", got)
+	}
+	if got := perms("vault", "pump"); len(got) != 1 {
+		t.Errorf("own grant on pump is gone: %v", got)
+	}
+	if got := perms("vault", "valve"); len(got) != 1 {
+		t.Errorf("own grant on valve is gone: %v", got)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrManufacturerNotFound = errors.New("manufacturer not found")
+	ErrVendorNotFound       = errors.New("vendor not found")
+	ErrSourceNotFound       = errors.New("source not found")
+	ErrPartyInUse           = errors.New("still used by approved sources")
+)
+
+// TracebilityStates returns the traceability requirements for selection lists
+func TracebilityStates() []TracebilityState {
+	return []TracebilityState{NotTaced, Lot, Serial, LotSerial}
+}
+
+//
+// Purchasing data. Manufacturers and vendors are kept once, an item has
+// any number of approved sources: a manufacturer part number (MPN) and a
+// vendor to buy it from. One source can be the preferred one.
+//
+
+// Ease of handling
+type PurchaseRepo struct {
+	DB *gorm.DB
+}
+
+// Constructor
+func NewPurchaseRepo(db *gorm.DB) *PurchaseRepo {
+	return &PurchaseRepo{DB: db}
+}
+
+// Manufacturers returns the manufacturers, sorted by name
+func (r *PurchaseRepo) Manufacturers() ([]PdmManufacturer, error) {
+	var list []PdmManufacturer
+	err := r.DB.Order("manufacturer_name").Find(&list).Error
+	return list, err
+}
+
+// CreateManufacturer adds a manufacturer
+func (r *PurchaseRepo) CreateManufacturer(name, website string) (*PdmManufacturer, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("manufacturer name is empty")
+	}
+	if err := r.uniqueName(&PdmManufacturer{}, "manufacturer_name", name); err != nil {
+		return nil, err
+	}
+
+	m := PdmManufacturer{ManufacturerName: name, ManufacturerWebsite: strings.TrimSpace(website)}
+	if err := r.DB.Create(&m).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// DeleteManufacturer removes a manufacturer without approved sources
+func (r *PurchaseRepo) DeleteManufacturer(id uint) error {
+	return r.deleteParty(&PdmManufacturer{}, "manufacturer_id", id, ErrManufacturerNotFound)
+}
+
+// Vendors returns the vendors, sorted by name
+func (r *PurchaseRepo) Vendors() ([]PdmVendor, error) {
+	var list []PdmVendor
+	err := r.DB.Order("vendor_name").Find(&list).Error
+	return list, err
+}
+
+// CreateVendor adds a vendor
+func (r *PurchaseRepo) CreateVendor(name, website string) (*PdmVendor, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("vendor name is empty")
+	}
+	if err := r.uniqueName(&PdmVendor{}, "vendor_name", name); err != nil {
+		return nil, err
+	}
+
+	v := PdmVendor{VendorName: name, VendorWebsite: strings.TrimSpace(website)}
+	if err := r.DB.Create(&v).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// DeleteVendor removes a vendor without approved sources
+func (r *PurchaseRepo) DeleteVendor(id uint) error {
+	return r.deleteParty(&PdmVendor{}, "vendor_id", id, ErrVendorNotFound)
+}
+
+// uniqueName checks that no manufacturer or vendor has the name already
+func (r *PurchaseRepo) uniqueName(model any, column, name string) error {
+	var count int64
+	err := r.DB.Model(model).Where("LOWER("+column+") = ?", strings.ToLower(name)).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%s already exists", name)
+	}
+	return nil
+}
+
+// deleteParty deletes a manufacturer or vendor that no source refers to
+func (r *PurchaseRepo) deleteParty(model any, column string, id uint, notFound error) error {
+	var count int64
+	if err := r.DB.Model(&PdmPurchase{}).Where(column+" = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPartyInUse
+	}
+
+	res := r.DB.Delete(model, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// ItemSources returns the approved sources of an item, the preferred first
+func (r *PurchaseRepo) ItemSources(itemID uint) ([]PdmPurchase, error) {
+	var list []PdmPurchase
+	err := r.DB.Preload("Manufacturer").Preload("Vendor").
+		Where("item_id = ?", itemID).
+		Order("purchasing_source DESC, id").
+		Find(&list).Error
+	return list, err
+}
+
+// AddSource adds an approved source to an item. It needs a manufacturer
+// with part number, a vendor, or both.
+func (r *PurchaseRepo) AddSource(itemID uint, manufacturerID *uint, mpn string, vendorID *uint, vendorPN string) (*PdmPurchase, error) {
+	mpn, vendorPN = strings.TrimSpace(mpn), strings.TrimSpace(vendorPN)
+	if manufacturerID == nil && vendorID == nil {
+		return nil, errors.New("a source needs a manufacturer or a vendor")
+	}
+	if manufacturerID != nil && mpn == "" {
+		return nil, errors.New("a manufacturer needs a part number")
+	}
+
+	if manufacturerID != nil {
+		if err := r.exists(&PdmManufacturer{}, *manufacturerID, ErrManufacturerNotFound); err != nil {
+			return nil, err
+		}
+	}
+	if vendorID != nil {
+		if err := r.exists(&PdmVendor{}, *vendorID, ErrVendorNotFound); err != nil {
+			return nil, err
+		}
+	}
+
+	src := PdmPurchase{
+		ItemID:                 itemID,
+		ManufacturerID:         manufacturerID,
+		ManufacturerPartNumber: mpn,
+		VendorID:               vendorID,
+		VendorPartNumber:       vendorPN,
+	}
+
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		// The first source is the preferred one
+		var count int64
+		if err := tx.Model(&PdmPurchase{}).Where("item_id = ?", itemID).Count(&count).Error; err != nil {
+			return err
+		}
+		src.PurchasingSource = count == 0
+		return tx.Create(&src).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &src, nil
+}
+
+func (r *PurchaseRepo) exists(model any, id uint, notFound error) error {
+	var count int64
+	if err := r.DB.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// RemoveSource removes an approved source of an item
+func (r *PurchaseRepo) RemoveSource(itemID, sourceID uint) error {
+	res := r.DB.Where("id = ? AND item_id = ?", sourceID, itemID).Delete(&PdmPurchase{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrSourceNotFound
+	}
+	return nil
+}
+
+// SetPreferred makes a source the preferred source of its item
+func (r *PurchaseRepo) SetPreferred(itemID, sourceID uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&PdmPurchase{}).Where("item_id = ?", itemID).Update("purchasing_source", false).Error
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&PdmPurchase{}).Where("id = ? AND item_id = ?", sourceID, itemID).Update("purchasing_source", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrSourceNotFound
+		}
+		return nil
+	})
+}
+
+// SetTraceability sets the traceability that is required for an item
+func (r *PurchaseRepo) SetTraceability(itemID uint, state TracebilityState) error {
+	if state != "" && !slices.Contains(TracebilityStates(), state) {
+		return fmt.Errorf("unknown traceability %q", state)
+	}
+	res := r.DB.Model(&PdmItem{}).Where("id = ?", itemID).Update("item_traceability", state)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrItemNotFound
+	}
+	return nil
+}
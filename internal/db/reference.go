@@ -0,0 +1,150 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+//
+// References between containers. A checked in version of an assembly or a
+// drawing refers to versions of other containers, possibly in another
+// vault. The where used query follows those references backwards.
+//
+
+// Ease of handling
+type ReferenceRepo struct {
+	DB *gorm.DB
+}
+
+// Constructor
+func NewReferenceRepo(db *gorm.DB) *ReferenceRepo {
+	return &ReferenceRepo{DB: db}
+}
+
+// ReferenceTarget is the container version that a reference points to
+type ReferenceTarget struct {
+	Vault     string
+	Container string
+	Version   int16
+}
+
+// WhereUsed is a parent that uses a container
+type WhereUsed struct {
+	Level     int // 1 for a direct parent
+	Reference PdmReference
+	ItemID    uint   // the item of the parent, 0 without item
+	Number    string // the part number of the item
+}
+
+// RecordReferences stores the references of a checked in version. They
+// replace the references that the version had before.
+func (r *ReferenceRepo) RecordReferences(vault, container, dir, fileName string, version int16, targets []ReferenceTarget) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().
+			Where("parent_vault = ? AND parent_container = ? AND parent_version = ?", vault, container, version).
+			Delete(&PdmReference{}).Error
+		if err != nil {
+			return err
+		}
+		if len(targets) == 0 {
+			return nil
+		}
+
+		refs := make([]PdmReference, len(targets))
+		for i, t := range targets {
+			refs[i] = PdmReference{
+				ParentVault:     vault,
+				ParentContainer: container,
+				ParentVersion:   version,
+				ParentPath:      CleanVaultPath(dir),
+				ParentName:      fileName,
+				ChildVault:      t.Vault,
+				ChildContainer:  t.Container,
+				ChildVersion:    t.Version,
+			}
+		}
+		return tx.Create(&refs).Error
+	})
+}
+
+// RecordRename records the new directory and file name of a parent
+func (r *ReferenceRepo) RecordRename(vault, container, dir, fileName string) error {
+	return r.DB.Model(&PdmReference{}).
+		Where("parent_vault = ? AND parent_container = ?", vault, container).
+		Updates(map[string]any{"parent_path": CleanVaultPath(dir), "parent_name": fileName}).Error
+}
+
+// RecordRemove deletes the references of a removed container. References
+// to it stay, so that the where used query still shows the broken parents.
+func (r *ReferenceRepo) RecordRemove(vault, container string) error {
+	return r.DB.Unscoped().
+		Where("parent_vault = ? AND parent_container = ?", vault, container).
+		Delete(&PdmReference{}).Error
+}
+
+// References returns what a version of a container refers to
+func (r *ReferenceRepo) References(vault, container string, version int16) ([]PdmReference, error) {
+	var refs []PdmReference
+	err := r.DB.Where("parent_vault = ? AND parent_container = ? AND parent_version = ?", vault, container, version).
+		Order("child_vault, child_container").Find(&refs).Error
+	return refs, err
+}
+
+// WhereUsed returns the parents that refer to a container, with the
+// versions of the parent and of the container. An empty vault searches the
+// container number in all vaults. With recursive the parents of the parents
+// are added as well, depth first.
+func (r *ReferenceRepo) WhereUsed(vault, container string, recursive bool) ([]WhereUsed, error) {
+	var result []WhereUsed
+	seen := map[ReferenceTarget]bool{}
+
+	var walk func(vault, container string, level int) error
+	walk = func(vault, container string, level int) error {
+		tx := r.DB.Where("child_container = ?", container)
+		if vault != "" {
+			tx = tx.Where("child_vault = ?", vault)
+		}
+
+		var refs []PdmReference
+		err := tx.Order("parent_vault, parent_path, parent_name, parent_version, child_version").Find(&refs).Error
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range refs {
+			used := WhereUsed{Level: level, Reference: ref}
+
+			var items []PdmItem
+			err := r.DB.Where("vault = ? AND container_number = ?", ref.ParentVault, ref.ParentContainer).
+				Limit(1).Find(&items).Error
+			if err != nil {
+				return err
+			}
+			if len(items) > 0 {
+				used.ItemID, used.Number = items[0].ID, items[0].ItemNumber
+			}
+			result = append(result, used)
+
+			// Every parent only once, whatever version refers to the child
+			parent := ReferenceTarget{Vault: ref.ParentVault, Container: ref.ParentContainer}
+			if recursive && !seen[parent] {
+				seen[parent] = true
+				if err := walk(ref.ParentVault, ref.ParentContainer, level+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if vault != "" {
+		seen[ReferenceTarget{Vault: vault, Container: container}] = true
+	}
+	if err := walk(vault, container, 1); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -7,6 +7,7 @@ package db
 import (
 	"database/sql/driver"
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -94,9 +95,37 @@ func DefaultRoles() []Role {
 	return []Role{Viewer} // or Guest, depends on the baseline
 }
 
-// Check whether user has a role
+// HasStatus compares the account status, older records use lowercase
+func (u *PdmUser) HasStatus(status AccountStatus) bool {
+	return strings.EqualFold(u.AccountStatus, string(status))
+}
+
+// EffectiveRoles returns the roles of the user together with the roles
+// inherited from the groups. The groups must be loaded.
+func (u *PdmUser) EffectiveRoles() []string {
+	roles := append([]string{}, u.Roles...)
+	for _, g := range u.Groups {
+		for _, r := range g.Roles {
+			if !slices.ContainsFunc(roles, func(s string) bool { return strings.EqualFold(s, r) }) {
+				roles = append(roles, r)
+			}
+		}
+	}
+	return roles
+}
+
+// GroupNames returns the names of the groups of the user
+func (u *PdmUser) GroupNames() []string {
+	names := make([]string, len(u.Groups))
+	for i, g := range u.Groups {
+		names[i] = g.Name
+	}
+	return names
+}
+
+// Check whether user has a role, directly or through a group
 func (u *PdmUser) HasRole(role string) bool {
-	for _, r := range u.Roles {
+	for _, r := range u.EffectiveRoles() {
 		if strings.EqualFold(r, role) {
 			return true
 		}
@@ -125,7 +154,7 @@ func (u *PdmUser) HasAllRoles(roles []string) bool {
 
 // HasPermission checks if the user has the given RBAC permission.
 func (u *PdmUser) HasPermission(permission RBAC) bool {
-	permissions := RolePermissions(stringsToRoles(u.Roles))
+	permissions := RolePermissions(stringsToRoles(u.EffectiveRoles()))
 	for _, p := range permissions {
 		if p == permission {
 			return true
@@ -136,7 +165,7 @@ func (u *PdmUser) HasPermission(permission RBAC) bool {
 
 // HasAnyPermission checks if the user has at least one of the given permissions.
 func (u *PdmUser) HasAnyPermission(perms []RBAC) bool {
-	userPerms := RolePermissions(stringsToRoles(u.Roles))
+	userPerms := RolePermissions(stringsToRoles(u.EffectiveRoles()))
 	for _, perm := range perms {
 		for _, userPerm := range userPerms {
 			if perm == userPerm {
@@ -0,0 +1,179 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LogSecurityEvent adds an event to the audit trail. A failing audit is
+// logged but never stops a login.
+func (r *UserRepo) LogSecurityEvent(userID uint, loginName, event, ip, detail string) {
+	ev := PdmSecurityEvent{
+		UserID:    userID,
+		LoginName: loginName,
+		Event:     event,
+		IPAddress: ip,
+		Detail:    detail,
+	}
+	if err := r.DB.Create(&ev).Error; err != nil {
+		log.Printf("[ERROR] Failed to record security event %s for %s: %v", event, loginName, err)
+	}
+}
+
+// SecurityEvents returns the latest events, newest first. An empty
+// loginName returns the events of all users.
+func (r *UserRepo) SecurityEvents(loginName string, limit int) ([]PdmSecurityEvent, error) {
+	var events []PdmSecurityEvent
+	q := r.DB.Order("created_at desc, id desc").Limit(limit)
+	if loginName != "" {
+		q = q.Where("login_name = ?", loginName)
+	}
+	err := q.Find(&events).Error
+	return events, err
+}
+
+// RecordFailedLogin counts a failed login and locks the account when
+// maxFailed is reached. It returns true when this failure locked the
+// account. The counter is raised in the database, so that concurrent
+// failures all count.
+func (r *UserRepo) RecordFailedLogin(user *PdmUser, maxFailed int, lockFor time.Duration) (bool, error) {
+	err := r.DB.Model(&PdmUser{}).Where("id = ?", user.ID).
+		UpdateColumn("failed_logins", gorm.Expr("failed_logins + 1")).Error
+	if err != nil {
+		return false, err
+	}
+
+	locked := false
+	if maxFailed > 0 {
+		var until *time.Time
+		if lockFor > 0 {
+			t := time.Now().Add(lockFor)
+			until = &t
+		}
+		// Only the failure that reaches the limit locks the account
+		res := r.DB.Model(&PdmUser{}).
+			Where("id = ? AND failed_logins >= ? AND account_status <> ?", user.ID, maxFailed, string(StatusLocked)).
+			Updates(map[string]interface{}{
+				"account_status": string(StatusLocked),
+				"locked_until":   until,
+			})
+		if res.Error != nil {
+			return false, res.Error
+		}
+		if locked = res.RowsAffected > 0; locked {
+			user.AccountStatus = string(StatusLocked)
+			user.LockedUntil = until
+		}
+	}
+
+	err = r.DB.Model(&PdmUser{}).Where("id = ?", user.ID).Select("failed_logins").Scan(&user.FailedLogins).Error
+	return locked, err
+}
+
+// RecordLogin resets the failed login counter after a successful login.
+func (r *UserRepo) RecordLogin(user *PdmUser, ip string) error {
+	now := time.Now()
+	user.FailedLogins = 0
+	user.LastLoginAt = &now
+	user.LastLoginIP = ip
+
+	return r.DB.Model(&PdmUser{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"failed_logins": 0,
+		"last_login_at": now,
+		"last_login_ip": ip,
+	}).Error
+}
+
+// UnlockAccount makes a locked account active again.
+func (r *UserRepo) UnlockAccount(user *PdmUser) error {
+	user.AccountStatus = string(StatusActive)
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+
+	return r.DB.Model(&PdmUser{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"account_status": user.AccountStatus,
+		"failed_logins":  0,
+		"locked_until":   nil,
+	}).Error
+}
+
+// ExpirePassword marks the password as expired, the user has to change it
+// after the next login.
+func (r *UserRepo) ExpirePassword(user *PdmUser) error {
+	user.AccountStatus = string(StatusExpired)
+	user.MustChangePassword = true
+
+	return r.DB.Model(&PdmUser{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"account_status":       user.AccountStatus,
+		"must_change_password": true,
+	}).Error
+}
+
+// PasswordHistory returns the previous password hashes, newest first.
+func (r *UserRepo) PasswordHistory(userID uint, limit int) ([]string, error) {
+	var hashes []string
+	err := r.DB.Model(&PdmPasswordHistory{}).
+		Where("user_id = ?", userID).
+		Order("created_at desc, id desc").
+		Limit(limit).
+		Pluck("password_hash", &hashes).Error
+	return hashes, err
+}
+
+// ChangePassword sets a new password chosen by the user. The old hash goes
+// into the history, of which only the newest keep entries are kept.
+func (r *UserRepo) ChangePassword(user *PdmUser, hash string, keep int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if keep > 0 && user.PasswordHash != "" {
+			if err := tx.Create(&PdmPasswordHistory{UserID: user.ID, PasswordHash: user.PasswordHash}).Error; err != nil {
+				return err
+			}
+
+			var stale []uint
+			tx.Model(&PdmPasswordHistory{}).
+				Where("user_id = ?", user.ID).
+				Order("created_at desc, id desc").
+				Offset(keep).
+				Pluck("id", &stale)
+			if len(stale) > 0 {
+				if err := tx.Unscoped().Delete(&PdmPasswordHistory{}, stale).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		status := user.AccountStatus
+		if user.HasStatus(StatusExpired) {
+			status = string(StatusActive)
+		}
+
+		now := time.Now()
+		user.PasswordHash = hash
+		user.PasswordChangedAt = &now
+		user.MustChangePassword = false
+		user.AccountStatus = status
+
+		return tx.Model(&PdmUser{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"password_hash":        hash,
+			"password_changed_at":  now,
+			"must_change_password": false,
+			"account_status":       status,
+		}).Error
+	})
+}
+
+// ResetPassword sets a password chosen by an admin. The user has to
+// change it after the next login.
+func (r *UserRepo) ResetPassword(userID uint, hash string) error {
+	return r.DB.Model(&PdmUser{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password_hash":        hash,
+		"password_changed_at":  time.Now(),
+		"must_change_password": true,
+	}).Error
+}
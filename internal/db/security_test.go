@@ -0,0 +1,50 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grd/FreePDM/internal/db"
+)
+
+func TestRecordFailedLogin(t *testing.T) {
+	gormdb := openItemDB(t)
+	repo := db.NewUserRepo(gormdb)
+
+	user := &db.PdmUser{LoginName: "jdoe", AccountStatus: string(db.StatusActive)}
+	if err := gormdb.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Two copies of the record, like two requests that loaded the user
+	other := *user
+	for i, u := range []*db.PdmUser{user, &other} {
+		locked, err := repo.RecordFailedLogin(u, 3, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if locked {
+			t.Fatalf("failure %d locked the account", i+1)
+		}
+	}
+	if other.FailedLogins != 2 {
+		t.Errorf("expected 2 failed logins, got %d", other.FailedLogins)
+	}
+
+	locked, err := repo.RecordFailedLogin(user, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked || !user.HasStatus(db.StatusLocked) || user.LockedUntil == nil {
+		t.Fatalf("expected the third failure to lock the account, got %+v", user)
+	}
+
+	// Only the failure that reaches the limit reports the lock
+	locked, err = repo.RecordFailedLogin(&other, 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked || other.FailedLogins != 4 {
+		t.Errorf("expected a fourth failure without a new lock, got locked=%v count=%d", locked, other.FailedLogins)
+	}
+}
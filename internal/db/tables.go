@@ -37,6 +37,22 @@ type PdmUser struct {
 	AccountStatus      string         `gorm:"type:varchar(20);default:'active'"`
 	Roles              pq.StringArray `gorm:"type:text[]"`
 	ThemePreference    string         `gorm:"type:varchar(20);default:'system'"`
+	AuthSource         string         `gorm:"type:varchar(20);default:'local'"` // "local" or "oidc"
+	ExternalSubject    string         `gorm:"type:varchar(255);index"`          // "sub" claim of the identity provider
+	PasswordChangedAt  *time.Time
+	FailedLogins       int
+	LockedUntil        *time.Time // nil while locked means until an admin unlocks
+	LastLoginAt        *time.Time
+	LastLoginIP        string `gorm:"type:varchar(45)"`
+
+	// Two-factor authentication
+	TOTPSecret    string         `gorm:"column:totp_secret;type:varchar(64)"`
+	TOTPEnabled   bool           `gorm:"column:totp_enabled"`
+	TOTPRequired  bool           `gorm:"column:totp_required"` // required for this user, regardless of the roles
+	TOTPLastStep  int64          `gorm:"column:totp_last_step"`
+	RecoveryCodes pq.StringArray `gorm:"type:text[]"` // bcrypt hashes
+
+	Groups []*PdmGroup `gorm:"many2many:pdm_user_group_links;joinForeignKey:UserID;joinReferences:GroupID"`
 
 	// Projects  []*PdmProject `gorm:"many2many:user_project_link"`
 	// Items     []PdmItem     `gorm:"foreignKey:UserID"`
@@ -44,23 +60,60 @@ type PdmUser struct {
 	// Documents []PdmDocument `gorm:"foreignKey:UserID"`
 }
 
-// PdmUserRoleLink is the association table for users and roles
-type PdmUserRoleLink struct {
-	UserID uint `gorm:"primaryKey;autoIncrement:false"`
-	RoleID uint `gorm:"primaryKey;autoIncrement:false"`
+// PdmPasswordHistory keeps old password hashes so they can't be reused
+type PdmPasswordHistory struct {
+	Base
+	UserID       uint   `gorm:"index;not null"`
+	PasswordHash string `gorm:"type:varchar(60);not null"`
+}
+
+// PdmSecurityEvent is the audit trail of logins, lockouts and password changes
+type PdmSecurityEvent struct {
+	Base
+	UserID    uint   `gorm:"index"` // 0 for unknown login names
+	LoginName string `gorm:"type:varchar(30);index"`
+	Event     string `gorm:"type:varchar(30);index"`
+	IPAddress string `gorm:"type:varchar(45)"`
+	Detail    string `gorm:"type:varchar(255)"`
+}
+
+// PdmRolePolicy holds the security settings per role
+type PdmRolePolicy struct {
+	Base
+	Role        string `gorm:"type:varchar(30);uniqueIndex"`
+	RequireTOTP bool   `gorm:"column:require_totp"`
+}
+
+// PdmGroup is a team of users, such as "Mechanical" or "Suppliers". The
+// members inherit the roles of the group, and ACL entries can be granted
+// to the group.
+type PdmGroup struct {
+	Base
+	Name        string         `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Description string         `gorm:"type:varchar(255)"`
+	Roles       pq.StringArray `gorm:"type:text[]"`
+
+	Users []*PdmUser `gorm:"many2many:pdm_user_group_links;joinForeignKey:GroupID;joinReferences:UserID"`
+}
+
+// PdmUserGroupLink is the association table for users and groups
+type PdmUserGroupLink struct {
+	UserID  uint `gorm:"primaryKey;autoIncrement:false"`
+	GroupID uint `gorm:"primaryKey;autoIncrement:false"`
 }
 
 // PdmProject represents the projects table
 type PdmProject struct {
 	Base
-	ProjectNumber     string `gorm:"type:varchar(16);not null"`
+	ProjectNumber     string `gorm:"type:varchar(16);not null;uniqueIndex"`
 	ProjectName       string `gorm:"type:varchar(32)"`
-	ProjectStatus     string // Enum type can be defined later
+	ProjectStatus     string // ProjectState
 	ProjectDateStart  *time.Time
 	ProjectDateFinish *time.Time
-	ProjectPath       string
+	ProjectVault      string `gorm:"type:varchar(64)"`
+	ProjectPath       string // directory inside the vault
 
-	Users []*PdmUser `gorm:"many2many:user_project_link"`
+	Users []*PdmUser `gorm:"many2many:pdm_user_project_links;joinForeignKey:ProjectID;joinReferences:UserID"`
 }
 
 // PdmUserProjectLink is the association table for users and projects
@@ -72,22 +125,27 @@ type PdmUserProjectLink struct {
 // PdmItem represents the items table
 type PdmItem struct {
 	Base
-	ItemNumber            string `gorm:"type:varchar(16)"`
-	ItemName              string `gorm:"type:varchar(32)"`
-	ItemDescription       string `gorm:"type:varchar(32)"`
+	ItemNumber            string `gorm:"type:varchar(64);index"` // the part number
+	ItemName              string `gorm:"type:varchar(253)"`
+	ItemDescription       string `gorm:"type:varchar(255)"`
 	ItemFullDescription   string
 	ItemNumberLinkedFiles int
-	ItemPath              string `gorm:"not null"`
+	ItemPath              string `gorm:"not null"` // directory of the container inside the vault
 	ItemPreview           []byte // For LargeBinary
 
-	UserID uint
-	User   PdmUser
+	Vault           string `gorm:"type:varchar(64);index:idx_item_container"`
+	ContainerNumber string `gorm:"type:varchar(16);index:idx_item_container"`
+
+	ItemTraceability TracebilityState `gorm:"type:varchar(32)"` // required for the purchased item
+
+	UserID *uint
+	User   *PdmUser
 
 	ProjectID uint          `gorm:"foreignKey:ProjectID"`
 	Models    []PdmModel    `gorm:"foreignKey:ItemID"`
 	Documents []PdmDocument `gorm:"foreignKey:ItemID"`
+	Sources   []PdmPurchase `gorm:"foreignKey:ItemID"`
 	// Material   PdmMaterial   `gorm:"foreignKey:ItemID"`
-	// Purchasing PdmPurchase   `gorm:"foreignKey:ItemID"`
 }
 
 // PdmProjectItemLink is the association table for projects and items
@@ -100,37 +158,48 @@ type PdmProjectItemLink struct {
 type PdmModel struct {
 	Base
 	ModelNumber          int
-	ModelName            string `gorm:"type:varchar(32)"`
-	ModelDescription     string `gorm:"type:varchar(32)"`
+	ModelName            string `gorm:"type:varchar(253)"`
+	ModelDescription     string `gorm:"type:varchar(255)"`
 	ModelFullDescription string
 	ModelFilename        string `gorm:"type:varchar(253);not null"`
 	ModelExt             string `gorm:"type:varchar(253);not null"`
 	ModelPreview         []byte
+	ModelVersion         int16 // latest version of the container
+	ModelVolume          float64
+	ModelVolumeUnit      VolumeUnit `gorm:"type:varchar(32)"`
+	ModelWeight          float64    // in kg, computed from the volume and the material
+
+	Vault           string `gorm:"type:varchar(64);index:idx_model_container"`
+	ContainerNumber string `gorm:"type:varchar(16);index:idx_model_container"`
 
-	UserID uint
-	User   PdmUser
+	UserID *uint
+	User   *PdmUser
 
 	ItemID uint
 	Item   PdmItem
 
-	MaterialID uint
-	Material   PdmMaterial `gorm:"foreignKey:MaterialID;references:ID"`
+	MaterialID *uint
+	Material   *PdmMaterial `gorm:"foreignKey:MaterialID;references:ID"`
 }
 
 // PdmDocument represents the documents table
 type PdmDocument struct {
 	Base
 	DocumentNumber          int    // Or string?
-	DocumentName            string `gorm:"type:varchar(32)"`
-	DocumentDescription     string `gorm:"type:varchar(32)"`
+	DocumentName            string `gorm:"type:varchar(253)"`
+	DocumentDescription     string `gorm:"type:varchar(255)"`
 	DocumentFullDescription string
 	DocumentFilename        string `gorm:"type:varchar(253);not null"`
 	DocumentExt             string `gorm:"type:varchar(253);not null"`
+	DocumentVersion         int16  // latest version of the container
+
+	Vault           string `gorm:"type:varchar(64);index:idx_document_container"`
+	ContainerNumber string `gorm:"type:varchar(16);index:idx_document_container"`
 
-	UserID uint    `gorm:"foreignKey:UserID"`
-	User   PdmUser `gorm:"foreignKey:UserID"`
-	ItemID uint    `gorm:"foreignKey:ItemID"`
-	Item   PdmItem `gorm:"foreignKey:ItemID"`
+	UserID *uint    `gorm:"foreignKey:UserID"`
+	User   *PdmUser `gorm:"foreignKey:UserID"`
+	ItemID *uint    `gorm:"foreignKey:ItemID"` // nil until the document is attached to an item
+	Item   *PdmItem `gorm:"foreignKey:ItemID"`
 }
 
 // PdmMaterial represents the materials table
@@ -139,13 +208,39 @@ type PdmMaterial struct {
 	MaterialName            string `gorm:"type:varchar(32)"`
 	MaterialFinish          string `gorm:"type:varchar(32)"`
 	MaterialDensity         float64
-	MaterialDensityUnit     string // Enum can be defined later
+	MaterialDensityUnit     DensityUnit `gorm:"type:varchar(32)"`
 	MaterialVolume          float64
-	MaterialVolumeUnit      string // Enum can be defined later
+	MaterialVolumeUnit      VolumeUnit `gorm:"type:varchar(32)"`
 	MaterialWeight          float64
-	MaterialWeightUnit      string // Enum can be defined later
+	MaterialWeightUnit      WeightUnit `gorm:"type:varchar(32)"`
 	MaterialSurfaceArea     float64
-	MaterialSurfaceAreaUnit string // Enum can be defined later
+	MaterialSurfaceAreaUnit AreaUnit `gorm:"type:varchar(32)"`
+}
+
+// PdmBomLine is a line of the bill of materials of an item
+type PdmBomLine struct {
+	Base
+	ParentID uint `gorm:"not null;index"`
+	Parent   PdmItem
+	ChildID  uint `gorm:"not null;index"`
+	Child    PdmItem
+	Quantity float64 `gorm:"not null;default:1"`
+	Position int
+}
+
+// PdmReference is a reference of a version of a container to a version of
+// another container, for instance a part of an assembly or the model of a
+// drawing. The index on the child is for the where used queries.
+type PdmReference struct {
+	Base
+	ParentVault     string `gorm:"type:varchar(64);not null;index:idx_reference_parent"`
+	ParentContainer string `gorm:"type:varchar(16);not null;index:idx_reference_parent"`
+	ParentVersion   int16  `gorm:"not null;index:idx_reference_parent"`
+	ParentPath      string // directory of the parent container inside the vault
+	ParentName      string `gorm:"type:varchar(253)"` // file name of the parent
+	ChildVault      string `gorm:"type:varchar(64);not null;index:idx_reference_child"`
+	ChildContainer  string `gorm:"type:varchar(16);not null;index:idx_reference_child,priority:1"`
+	ChildVersion    int16
 }
 
 // PdmHistory represents the history table
@@ -161,32 +256,32 @@ type PdmHistory struct {
 	HistoryStoredNumber   int
 }
 
-// PdmPurchase represents the purchasing table
+// PdmPurchase is an approved source of an item: a manufacturer part
+// number, and where to buy it
 type PdmPurchase struct {
 	Base
-	PurchasingSource       bool
-	PurchasingTraceability string // Enum can be defined later
+	PurchasingSource       bool   // the preferred source of the item
+	ManufacturerPartNumber string `gorm:"type:varchar(64)"`
+	VendorPartNumber       string `gorm:"type:varchar(64)"`
 
-	ItemID         uint              `gorm:"foreignKey:ItemID"`
-	Item           PdmItem           `gorm:"foreignKey:ItemID"`
-	ManufacturerID uint              `gorm:"foreignKey:ManufacturerID"`
-	Manufacturers  []PdmManufacturer `gorm:"foreignKey:ManufacturerID"`
-	VendorID       uint              `gorm:"foreignKey:VendorID"`
-	Vendors        []PdmVendor       `gorm:"foreignKey:VendorID"`
+	ItemID         uint             `gorm:"not null;index"`
+	Item           PdmItem          `gorm:"foreignKey:ItemID"`
+	ManufacturerID *uint            `gorm:"index"`
+	Manufacturer   *PdmManufacturer `gorm:"foreignKey:ManufacturerID"`
+	VendorID       *uint            `gorm:"index"`
+	Vendor         *PdmVendor       `gorm:"foreignKey:VendorID"`
 }
 
 // PdmManufacturer represents the manufacturers table
 type PdmManufacturer struct {
 	Base
-	ManufacturerName string      `gorm:"type:varchar(32)"`
-	PurchasingID     uint        `gorm:"foreignKey:PurchasingID"`
-	Purchasing       PdmPurchase `gorm:"foreignKey:PurchasingID"`
+	ManufacturerName    string `gorm:"type:varchar(64);not null"`
+	ManufacturerWebsite string `gorm:"type:varchar(255)"`
 }
 
 // PdmVendor represents the vendors table
 type PdmVendor struct {
 	Base
-	VendorName    string      `gorm:"type:varchar(32)"`
-	VPurchasingID uint        `gorm:"foreignKey:VPurchasingID"`
-	VPurchasing   PdmPurchase `gorm:"foreignKey:VPurchasingID"`
+	VendorName    string `gorm:"type:varchar(64);not null"`
+	VendorWebsite string `gorm:"type:varchar(255)"`
 }
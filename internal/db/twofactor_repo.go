@@ -0,0 +1,96 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"strings"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm/clause"
+)
+
+// EnableTOTP stores a confirmed TOTP secret together with the hashed
+// recovery codes.
+func (r *UserRepo) EnableTOTP(user *PdmUser, secret string, recoveryHashes []string, step int64) error {
+	user.TOTPSecret = secret
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.RecoveryCodes = recoveryHashes
+
+	return r.DB.Model(&PdmUser{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_enabled":   true,
+		"totp_last_step": step,
+		"recovery_codes": pq.StringArray(recoveryHashes),
+	}).Error
+}
+
+// UpdateTOTPStep remembers the last used time step, so a code works once.
+func (r *UserRepo) UpdateTOTPStep(user *PdmUser, step int64) error {
+	user.TOTPLastStep = step
+	return r.DB.Model(&PdmUser{}).Where("id = ?", user.ID).Update("totp_last_step", step).Error
+}
+
+// UpdateRecoveryCodes stores the remaining recovery codes.
+func (r *UserRepo) UpdateRecoveryCodes(user *PdmUser, hashes []string) error {
+	user.RecoveryCodes = hashes
+	return r.DB.Model(&PdmUser{}).Where("id = ?", user.ID).Update("recovery_codes", pq.StringArray(hashes)).Error
+}
+
+// ResetTOTP removes the second factor, the user has to enrol again.
+func (r *UserRepo) ResetTOTP(userID uint) error {
+	return r.DB.Model(&PdmUser{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":    "",
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+		"recovery_codes": pq.StringArray{},
+	}).Error
+}
+
+// SetTOTPRequired requires two-factor authentication for a single user.
+func (r *UserRepo) SetTOTPRequired(userID uint, required bool) error {
+	return r.DB.Model(&PdmUser{}).Where("id = ?", userID).Update("totp_required", required).Error
+}
+
+// RolePolicies returns the security settings of all roles.
+func (r *UserRepo) RolePolicies() ([]PdmRolePolicy, error) {
+	var policies []PdmRolePolicy
+	err := r.DB.Order("role").Find(&policies).Error
+	return policies, err
+}
+
+// SetRoleRequiresTOTP requires (or not) two-factor authentication for
+// everyone with the role.
+func (r *UserRepo) SetRoleRequiresTOTP(role string, required bool) error {
+	policy := PdmRolePolicy{Role: strings.ToLower(role), RequireTOTP: required}
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}},
+		DoUpdates: clause.AssignmentColumns([]string{"require_totp", "updated_at"}),
+	}).Create(&policy).Error
+}
+
+// RequiresTOTP tells whether the user has to use two-factor authentication,
+// either personally or because of one of the roles, including the roles
+// of the groups.
+func (r *UserRepo) RequiresTOTP(user *PdmUser) (bool, error) {
+	if user.TOTPRequired {
+		return true, nil
+	}
+	effective := user.EffectiveRoles()
+	if len(effective) == 0 {
+		return false, nil
+	}
+
+	roles := make([]string, len(effective))
+	for i, role := range effective {
+		roles[i] = strings.ToLower(role)
+	}
+
+	var count int64
+	err := r.DB.Model(&PdmRolePolicy{}).
+		Where("require_totp = ? AND role IN ?", true, roles).
+		Count(&count).Error
+	return count > 0, err
+}
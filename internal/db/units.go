@@ -0,0 +1,150 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Conversion factors to the SI unit of every quantity: kg/m^3, m^3, kg and m^2.
+
+var densityFactors = map[DensityUnit]float64{
+	D_gmm3:        1e6,
+	D_gcm3:        1e3,
+	D_kgm3:        1,
+	D_tonnem3:     1e3,
+	D_metrictonm3: 1e3,
+	D_poundft3:    16.018463373960138,
+	D_poundinch3:  27679.904710203125,
+}
+
+var volumeFactors = map[VolumeUnit]float64{
+	V_mm3:   1e-9,
+	V_cm3:   1e-6,
+	V_m3:    1,
+	V_litre: 1e-3,
+	V_ft3:   0.028316846592,
+	V_inch3: 1.6387064e-5,
+}
+
+var weightFactors = map[WeightUnit]float64{
+	W_g:         1e-3,
+	W_kg:        1,
+	W_tonne:     1e3,
+	W_metricton: 1e3,
+	W_pound:     0.45359237,
+	W_slug:      14.593902937206364,
+}
+
+var areaFactors = map[AreaUnit]float64{
+	A_mm2:   1e-6,
+	A_cm2:   1e-4,
+	A_m2:    1,
+	A_ft2:   0.09290304,
+	A_inch2: 6.4516e-4,
+}
+
+// DensityUnits returns the density units for selection lists
+func DensityUnits() []DensityUnit {
+	return []DensityUnit{D_gmm3, D_gcm3, D_kgm3, D_tonnem3, D_metrictonm3, D_poundft3, D_poundinch3}
+}
+
+// VolumeUnits returns the volume units for selection lists
+func VolumeUnits() []VolumeUnit {
+	return []VolumeUnit{V_mm3, V_cm3, V_m3, V_litre, V_ft3, V_inch3}
+}
+
+// WeightUnits returns the weight units for selection lists
+func WeightUnits() []WeightUnit {
+	return []WeightUnit{W_g, W_kg, W_tonne, W_metricton, W_pound, W_slug}
+}
+
+// AreaUnits returns the area units for selection lists
+func AreaUnits() []AreaUnit {
+	return []AreaUnit{A_mm2, A_cm2, A_m2, A_ft2, A_inch2}
+}
+
+func convert[U ~string](value float64, from, to U, factors map[U]float64) (float64, error) {
+	f, ok := factors[from]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	t, ok := factors[to]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	return value * f / t, nil
+}
+
+// ConvertDensity converts a density from one unit to another
+func ConvertDensity(value float64, from, to DensityUnit) (float64, error) {
+	return convert(value, from, to, densityFactors)
+}
+
+// ConvertVolume converts a volume from one unit to another
+func ConvertVolume(value float64, from, to VolumeUnit) (float64, error) {
+	return convert(value, from, to, volumeFactors)
+}
+
+// ConvertWeight converts a weight from one unit to another
+func ConvertWeight(value float64, from, to WeightUnit) (float64, error) {
+	return convert(value, from, to, weightFactors)
+}
+
+// ConvertArea converts an area from one unit to another
+func ConvertArea(value float64, from, to AreaUnit) (float64, error) {
+	return convert(value, from, to, areaFactors)
+}
+
+// Mass returns the weight of a volume of a material with the density
+func Mass(density float64, densityUnit DensityUnit, volume float64, volumeUnit VolumeUnit, unit WeightUnit) (float64, error) {
+	d, err := ConvertDensity(density, densityUnit, D_kgm3)
+	if err != nil {
+		return 0, err
+	}
+	v, err := ConvertVolume(volume, volumeUnit, V_m3)
+	if err != nil {
+		return 0, err
+	}
+	return ConvertWeight(d*v, W_kg, unit)
+}
+
+// Short notations of the volume units, as CAD programs write them
+var volumeSymbols = map[string]VolumeUnit{
+	"mm^3": V_mm3, "mm3": V_mm3, "mm³": V_mm3,
+	"cm^3": V_cm3, "cm3": V_cm3, "cm³": V_cm3, "cc": V_cm3,
+	"m^3": V_m3, "m3": V_m3, "m³": V_m3,
+	"l": V_litre, "litre": V_litre, "liter": V_litre,
+	"ft^3": V_ft3, "ft3": V_ft3, "ft³": V_ft3,
+	"in^3": V_inch3, "in3": V_inch3, "in³": V_inch3, "inch^3": V_inch3,
+}
+
+// ParseVolume reads a volume such as "12500 mm^3" or "1.2 l". A volume
+// without unit is in mm^3, the unit of FreeCAD.
+func ParseVolume(s string) (float64, VolumeUnit, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, "", fmt.Errorf("invalid volume %q", s)
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || value < 0 {
+		return 0, "", fmt.Errorf("invalid volume %q", s)
+	}
+	if len(fields) == 1 {
+		return value, V_mm3, nil
+	}
+
+	unit := VolumeUnit(fields[1])
+	if _, ok := volumeFactors[unit]; ok {
+		return value, unit, nil
+	}
+	if unit, ok := volumeSymbols[strings.ToLower(fields[1])]; ok {
+		return value, unit, nil
+	}
+	return 0, "", fmt.Errorf("unknown volume unit %q", fields[1])
+}
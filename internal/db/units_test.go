@@ -0,0 +1,59 @@
+package db_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grd/FreePDM/internal/db"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func TestConvertUnits(t *testing.T) {
+	if v, err := db.ConvertDensity(7.85, db.D_gcm3, db.D_kgm3); err != nil || !near(v, 7850) {
+		t.Errorf("7.85 g/cm^3 = %g kg/m^3, %v", v, err)
+	}
+	if v, err := db.ConvertVolume(1, db.V_litre, db.V_cm3); err != nil || !near(v, 1000) {
+		t.Errorf("1 l = %g cm^3, %v", v, err)
+	}
+	if v, err := db.ConvertWeight(1, db.W_kg, db.W_pound); err != nil || !near(v, 2.2046226218487757) {
+		t.Errorf("1 kg = %g lb, %v", v, err)
+	}
+	if v, err := db.ConvertArea(1, db.A_ft2, db.A_inch2); err != nil || !near(v, 144) {
+		t.Errorf("1 ft^2 = %g in^2, %v", v, err)
+	}
+	if _, err := db.ConvertWeight(1, "stone", db.W_kg); err == nil {
+		t.Error("unknown unit accepted")
+	}
+
+	// 10 cm^3 of steel
+	if m, err := db.Mass(7.85, db.D_gcm3, 10000, db.V_mm3, db.W_g); err != nil || !near(m, 78.5) {
+		t.Errorf("mass = %g g, %v", m, err)
+	}
+}
+
+func TestParseVolume(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		unit db.VolumeUnit
+	}{
+		{"12500", 12500, db.V_mm3},
+		{"12.5 cm^3", 12.5, db.V_cm3},
+		{"2 L", 2, db.V_litre},
+		{"3 in³", 3, db.V_inch3},
+	}
+	for _, tt := range tests {
+		v, unit, err := db.ParseVolume(tt.in)
+		if err != nil || v != tt.want || unit != tt.unit {
+			t.Errorf("ParseVolume(%q) = %g %q, %v", tt.in, v, unit, err)
+		}
+	}
+	for _, in := range []string{"", "abc", "-1 mm3", "5 furlong"} {
+		if _, _, err := db.ParseVolume(in); err == nil {
+			t.Errorf("ParseVolume(%q) accepted", in)
+		}
+	}
+}
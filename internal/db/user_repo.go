@@ -48,16 +48,51 @@ func (r *UserRepo) UpdateUser(user *PdmUser) error {
 
 func (r *UserRepo) LoadUserByLoginName(loginName string) (*PdmUser, error) {
 	var user PdmUser
-	if err := r.DB.Where("login_name = ?", loginName).First(&user).Error; err != nil {
+	if err := r.DB.Preload("Groups").Where("login_name = ?", loginName).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// LoadUserByExternalSubject finds a single sign-on user by the "sub" claim.
+func (r *UserRepo) LoadUserByExternalSubject(subject string) (*PdmUser, error) {
+	var user PdmUser
+	result := r.DB.Preload("Groups").Where("auth_source = ? AND external_subject = ?", AuthSourceOIDC, subject).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, result.Error
+	}
+	return &user, nil
+}
+
+// SaveExternalUser creates or updates a user that logs in through single
+// sign-on. These users have no local password.
+func (r *UserRepo) SaveExternalUser(user *PdmUser) error {
+	if user.ID == 0 {
+		if err := r.DB.Create(user).Error; err != nil {
+			return err
+		}
+		// "default:true" overrides a false value on create
+		return r.ClearMustChangePassword(user.LoginName)
+	}
+
+	return r.DB.Model(&PdmUser{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"full_name":        user.FullName,
+		"first_name":       user.FirstName,
+		"last_name":        user.LastName,
+		"email_address":    user.EmailAddress,
+		"roles":            pq.StringArray(user.Roles),
+		"auth_source":      user.AuthSource,
+		"external_subject": user.ExternalSubject,
+	}).Error
+}
+
 // LoadUser search by ID on user name.
 func (r *UserRepo) LoadUserByID(id uint) (*PdmUser, error) {
 	var user PdmUser
-	if err := r.DB.First(&user, id).Error; err != nil {
+	if err := r.DB.Preload("Groups").First(&user, id).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
@@ -66,7 +101,7 @@ func (r *UserRepo) LoadUserByID(id uint) (*PdmUser, error) {
 // LoadUser search a user based on user name.
 func (r *UserRepo) LoadUser(loginname string) (*PdmUser, error) {
 	var user PdmUser
-	result := r.DB.Where("login_name = ?", loginname).First(&user)
+	result := r.DB.Preload("Groups").Where("login_name = ?", loginname).First(&user)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, ErrUserNotFound
@@ -99,7 +134,7 @@ func (r *UserRepo) ClearMustChangePassword(loginname string) error {
 
 func (r *UserRepo) GetAllUsers() ([]PdmUser, error) {
 	var users []PdmUser
-	err := r.DB.Find(&users).Error
+	err := r.DB.Preload("Groups").Find(&users).Error
 	return users, err
 }
 
@@ -130,7 +165,13 @@ func (r *UserRepo) RemoveUserFromLdap(user_id int, loginname string) {
 }
 
 func (r *UserRepo) UpdateAccountStatus(userID uint, status string) error {
-	return r.DB.Model(&PdmUser{}).Where("id = ?", userID).Update("account_status", status).Error
+	// A manual change also forgets the failed logins, and a manual lock
+	// has no end time.
+	return r.DB.Model(&PdmUser{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"account_status": status,
+		"failed_logins":  0,
+		"locked_until":   nil,
+	}).Error
 }
 
 func (r *UserRepo) UpdateThemePreference(userID uint, theme string) error {
@@ -0,0 +1,476 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package delta transfers a file as the difference with an older version
+// of it, the way rsync does. The receiver sends the block signature of the
+// file it has, the sender answers with a delta: references to blocks of
+// that file and the literal data in between. The delta ends with the size
+// and SHA-256 hash of the new file, which the receiver verifies.
+//
+// A delta can start at an offset of the new file, so that an interrupted
+// transfer resumes after the data that the receiver already wrote.
+package delta
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultBlockSize is the block size of a signature
+const DefaultBlockSize = 8 << 10
+
+const (
+	maxBlockSize = 1 << 20
+	maxBlocks    = 1 << 24
+	maxLiteral   = 64 << 10 // the data of one literal operation
+)
+
+// Magic numbers of the streams
+const (
+	signatureMagic = "FPDS"
+	deltaMagic     = "FPDD"
+)
+
+// Operations of a delta
+const (
+	opCopy    = 'C' // block index and count
+	opLiteral = 'L' // length and data
+	opEnd     = 'E' // size and hash of the new file
+)
+
+var (
+	ErrFormat = errors.New("delta: invalid stream")
+	ErrHash   = errors.New("delta: hash mismatch")
+)
+
+// Block is the checksums of one block of a file
+type Block struct {
+	Weak   uint32
+	Strong [sha256.Size]byte
+}
+
+// Signature describes a file in blocks. All blocks are BlockSize long,
+// except the last one.
+type Signature struct {
+	BlockSize int
+	Size      int64
+	Blocks    []Block
+}
+
+// Result tells how a delta rebuilt a file
+type Result struct {
+	Size    int64             // of the new file
+	Hash    [sha256.Size]byte // of the new file
+	Copied  int64             // bytes taken from the old file
+	Literal int64             // bytes sent as data
+}
+
+// HashString is the hash as hexadecimal
+func (r Result) HashString() string {
+	return hex.EncodeToString(r.Hash[:])
+}
+
+// NewSignature reads a file and returns its signature. A nil reader is an
+// empty file.
+func NewSignature(r io.Reader, blockSize int) (*Signature, error) {
+	if blockSize <= 0 || blockSize > maxBlockSize {
+		return nil, fmt.Errorf("delta: invalid block size %d", blockSize)
+	}
+	sig := &Signature{BlockSize: blockSize}
+	if r == nil {
+		return sig, nil
+	}
+
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sig.Blocks = append(sig.Blocks, Block{Weak: weakSum(buf[:n]), Strong: sha256.Sum256(buf[:n])})
+			sig.Size += int64(n)
+		}
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return sig, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+// FileSignature returns the signature of a file, of an empty file when it
+// does not exist.
+func FileSignature(name string, blockSize int) (*Signature, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewSignature(nil, blockSize)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewSignature(f, blockSize)
+}
+
+// WriteTo writes the signature in its binary form
+func (s *Signature) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(signatureMagic)
+	binary.Write(bw, binary.BigEndian, uint32(s.BlockSize))
+	binary.Write(bw, binary.BigEndian, s.Size)
+	binary.Write(bw, binary.BigEndian, uint32(len(s.Blocks)))
+	for _, b := range s.Blocks {
+		binary.Write(bw, binary.BigEndian, b.Weak)
+		bw.Write(b.Strong[:])
+	}
+	n := int64(bw.Buffered())
+	return n, bw.Flush()
+}
+
+// ReadSignature reads a signature that WriteTo wrote
+func ReadSignature(r io.Reader) (*Signature, error) {
+	br := bufio.NewReader(r)
+
+	var head struct {
+		Magic     [4]byte
+		BlockSize uint32
+		Size      int64
+		Count     uint32
+	}
+	if err := binary.Read(br, binary.BigEndian, &head); err != nil {
+		return nil, ErrFormat
+	}
+	if string(head.Magic[:]) != signatureMagic || head.BlockSize == 0 || head.BlockSize > maxBlockSize ||
+		head.Count > maxBlocks || head.Size < 0 {
+		return nil, ErrFormat
+	}
+	// The blocks cover the size, the last one may be short
+	bs := int64(head.BlockSize)
+	if int64(head.Count) != (head.Size+bs-1)/bs {
+		return nil, ErrFormat
+	}
+
+	// The count is not trusted with memory, the blocks are read first
+	sig := &Signature{BlockSize: int(head.BlockSize), Size: head.Size, Blocks: make([]Block, 0, min(head.Count, 1024))}
+	for range head.Count {
+		var b Block
+		if err := binary.Read(br, binary.BigEndian, &b); err != nil {
+			return nil, ErrFormat
+		}
+		sig.Blocks = append(sig.Blocks, b)
+	}
+	return sig, nil
+}
+
+// HashFile returns the SHA-256 hash as hexadecimal and the size of a file
+func HashFile(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// weakSum is the rolling checksum of rsync
+func weakSum(buf []byte) uint32 {
+	var a, b uint32
+	n := uint32(len(buf))
+	for i, c := range buf {
+		a += uint32(c)
+		b += (n - uint32(i)) * uint32(c)
+	}
+	return a&0xffff | b<<16
+}
+
+// roll moves the window of a weak checksum one byte
+func roll(sum uint32, out, in byte, n int) uint32 {
+	a := sum & 0xffff
+	b := sum >> 16
+	a = (a - uint32(out) + uint32(in)) & 0xffff
+	b = (b - uint32(n)*uint32(out) + a) & 0xffff
+	return a | b<<16
+}
+
+// Write writes the delta that turns the file of sig into the data of r.
+// The delta starts at offset: the receiver already has the data before
+// it, which only counts for the hash.
+func Write(w io.Writer, sig *Signature, r io.Reader, offset int64) (Result, error) {
+	h := sha256.New()
+	src := bufio.NewReaderSize(io.TeeReader(r, h), 64<<10)
+	if _, err := io.CopyN(io.Discard, src, offset); err != nil {
+		return Result{}, fmt.Errorf("delta: offset %d: %w", offset, err)
+	}
+
+	g := generator{w: bufio.NewWriter(w), sig: sig, bs: sig.BlockSize, lookup: map[uint32][]int{}}
+	g.res.Size = offset
+	for i, b := range sig.Blocks {
+		// Only full blocks match a window, the last block is checked at the end
+		if i < len(sig.Blocks)-1 || sig.Size%int64(sig.BlockSize) == 0 {
+			g.lookup[b.Weak] = append(g.lookup[b.Weak], i)
+		}
+	}
+
+	g.w.WriteString(deltaMagic)
+	if err := g.run(src); err != nil {
+		return g.res, err
+	}
+
+	copy(g.res.Hash[:], h.Sum(nil))
+	g.w.WriteByte(opEnd)
+	binary.Write(g.w, binary.BigEndian, g.res.Size)
+	g.w.Write(g.res.Hash[:])
+	return g.res, g.w.Flush()
+}
+
+// generator finds the blocks of the old file in the new data
+type generator struct {
+	w      *bufio.Writer
+	sig    *Signature
+	bs     int
+	lookup map[uint32][]int
+	res    Result
+
+	copyStart, copyCount int // pending copy operation
+}
+
+// run writes the operations. The literal data is buf[:pos], the window
+// that is compared with the blocks is buf[pos:].
+func (g *generator) run(src *bufio.Reader) error {
+	buf := make([]byte, 0, maxLiteral+g.bs)
+	pos := 0
+
+	fill := func() error {
+		for len(buf)-pos < g.bs {
+			c, err := src.ReadByte()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			buf = append(buf, c)
+			g.res.Size++
+		}
+		return nil
+	}
+
+	if err := fill(); err != nil {
+		return err
+	}
+	var weak uint32
+	if len(buf) == g.bs {
+		weak = weakSum(buf)
+	}
+
+	for len(buf)-pos == g.bs {
+		if idx := g.match(weak, buf[pos:]); idx >= 0 {
+			if err := g.literal(buf[:pos]); err != nil {
+				return err
+			}
+			g.copyBlock(idx)
+			buf, pos = buf[:0], 0
+			if err := fill(); err != nil {
+				return err
+			}
+			if len(buf) == g.bs {
+				weak = weakSum(buf)
+			}
+			continue
+		}
+
+		c, err := src.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		g.res.Size++
+		weak = roll(weak, buf[pos], c, g.bs)
+		buf = append(buf, c)
+		pos++
+
+		if pos >= maxLiteral {
+			if err := g.literal(buf[:pos]); err != nil {
+				return err
+			}
+			buf, pos = append(buf[:0], buf[pos:]...), 0
+		}
+	}
+
+	// The end of the data may be the short last block of the old file
+	rest := buf[pos:]
+	if n := len(g.sig.Blocks); n > 0 && len(rest) > 0 && int64(len(rest)) == g.sig.Size-int64(n-1)*int64(g.bs) {
+		if sha256.Sum256(rest) == g.sig.Blocks[n-1].Strong {
+			if err := g.literal(buf[:pos]); err != nil {
+				return err
+			}
+			g.copyBlock(n - 1)
+			g.flushCopy()
+			return nil
+		}
+	}
+	return g.literal(buf)
+}
+
+// match returns the block of the window, -1 when there is none
+func (g *generator) match(weak uint32, window []byte) int {
+	candidates := g.lookup[weak]
+	if len(candidates) == 0 {
+		return -1
+	}
+	strong := sha256.Sum256(window)
+	for _, idx := range candidates {
+		if g.sig.Blocks[idx].Strong == strong {
+			return idx
+		}
+	}
+	return -1
+}
+
+// copyBlock adds a block to the pending copy operation
+func (g *generator) copyBlock(idx int) {
+	if g.copyCount > 0 && g.copyStart+g.copyCount == idx {
+		g.copyCount++
+	} else {
+		g.flushCopy()
+		g.copyStart, g.copyCount = idx, 1
+	}
+
+	size := int64(g.bs)
+	if idx == len(g.sig.Blocks)-1 {
+		size = g.sig.Size - int64(idx)*int64(g.bs)
+	}
+	g.res.Copied += size
+}
+
+func (g *generator) flushCopy() {
+	if g.copyCount == 0 {
+		return
+	}
+	g.w.WriteByte(opCopy)
+	binary.Write(g.w, binary.BigEndian, uint32(g.copyStart))
+	binary.Write(g.w, binary.BigEndian, uint32(g.copyCount))
+	g.copyCount = 0
+}
+
+func (g *generator) literal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	g.flushCopy()
+	for len(data) > 0 {
+		n := min(len(data), maxLiteral)
+		g.w.WriteByte(opLiteral)
+		binary.Write(g.w, binary.BigEndian, uint32(n))
+		if _, err := g.w.Write(data[:n]); err != nil {
+			return err
+		}
+		g.res.Literal += int64(n)
+		data = data[n:]
+	}
+	return nil
+}
+
+// Apply rebuilds the new file from the delta in r and the old file in base,
+// with the block size of the signature that the delta was made of, and
+// writes it to w. It returns the size and hash that the delta ends with;
+// the caller verifies them, see Verify.
+func Apply(w io.Writer, base io.ReaderAt, blockSize int, r io.Reader) (Result, error) {
+	var res Result
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+	defer bw.Flush() // keep what is written for a resume
+
+	magic := make([]byte, len(deltaMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != deltaMagic {
+		return res, ErrFormat
+	}
+
+	block := make([]byte, blockSize)
+	for {
+		op, err := br.ReadByte()
+		if err != nil {
+			return res, fmt.Errorf("delta: truncated: %w", err)
+		}
+
+		switch op {
+		case opCopy:
+			var args [2]uint32
+			if err := binary.Read(br, binary.BigEndian, &args); err != nil {
+				return res, fmt.Errorf("delta: truncated: %w", err)
+			}
+			if base == nil {
+				return res, ErrFormat
+			}
+			for idx := int64(args[0]); idx < int64(args[0])+int64(args[1]); idx++ {
+				n, err := base.ReadAt(block, idx*int64(blockSize))
+				if n == 0 || (err != nil && err != io.EOF) {
+					return res, fmt.Errorf("delta: block %d of the old file: %v", idx, err)
+				}
+				if _, err := bw.Write(block[:n]); err != nil {
+					return res, err
+				}
+				res.Copied += int64(n)
+			}
+
+		case opLiteral:
+			var n uint32
+			if err := binary.Read(br, binary.BigEndian, &n); err != nil {
+				return res, fmt.Errorf("delta: truncated: %w", err)
+			}
+			if n > maxLiteral {
+				return res, ErrFormat
+			}
+			copied, err := io.CopyN(bw, br, int64(n))
+			res.Literal += copied
+			if err != nil {
+				return res, fmt.Errorf("delta: truncated: %w", err)
+			}
+
+		case opEnd:
+			if err := binary.Read(br, binary.BigEndian, &res.Size); err != nil {
+				return res, fmt.Errorf("delta: truncated: %w", err)
+			}
+			if _, err := io.ReadFull(br, res.Hash[:]); err != nil {
+				return res, fmt.Errorf("delta: truncated: %w", err)
+			}
+			return res, bw.Flush()
+
+		default:
+			return res, ErrFormat
+		}
+	}
+}
+
+// Verify checks that a file is what the delta rebuilt
+func Verify(name string, res Result) error {
+	hash, size, err := HashFile(name)
+	if err != nil {
+		return err
+	}
+	if size != res.Size || hash != res.HashString() {
+		return ErrHash
+	}
+	return nil
+}
+
+// Equal tells whether a file has the hash, false when it does not exist
+func Equal(name, hash string) bool {
+	h, _, err := HashFile(name)
+	return err == nil && h == hash
+}
@@ -0,0 +1,114 @@
+package delta_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/grd/FreePDM/internal/delta"
+)
+
+// roundTrip sends new as a delta against old, starting at offset
+func roundTrip(t *testing.T, old, new []byte, offset int64) delta.Result {
+	t.Helper()
+
+	sig, err := delta.NewSignature(bytes.NewReader(old), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sigBuf bytes.Buffer
+	sig.WriteTo(&sigBuf)
+	if sig, err = delta.ReadSignature(&sigBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	var stream bytes.Buffer
+	sent, err := delta.Write(&stream, sig, bytes.NewReader(new), offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := bytes.NewBuffer(append([]byte(nil), new[:offset]...))
+	res, err := delta.Apply(out, bytes.NewReader(old), sig.BlockSize, &stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), new) {
+		t.Fatalf("rebuilt %d bytes, expected %d", out.Len(), len(new))
+	}
+	if res.Size != int64(len(new)) || res.Hash != sha256.Sum256(new) {
+		t.Errorf("unexpected trailer %+v", res)
+	}
+	if res.Literal != sent.Literal || res.Copied != sent.Copied {
+		t.Errorf("sent %+v, applied %+v", sent, res)
+	}
+	return res
+}
+
+func TestDelta(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	old := make([]byte, 100_000+10) // with a short last block
+	rnd.Read(old)
+
+	// An insert in the middle and a changed end
+	changed := append([]byte(nil), old[:30_000]...)
+	changed = append(changed, []byte("inserted")...)
+	changed = append(changed, old[30_000:90_000]...)
+	changed = append(changed, make([]byte, 5000)...)
+
+	res := roundTrip(t, old, changed, 0)
+	if res.Literal > 5000+8+2*64 {
+		t.Errorf("too much literal data: %d", res.Literal)
+	}
+
+	// Unchanged, after an interrupted transfer and without an old file
+	if res := roundTrip(t, old, old, 0); res.Literal != 0 {
+		t.Errorf("unchanged file sent %d bytes", res.Literal)
+	}
+	roundTrip(t, old, changed, 40_000)
+	roundTrip(t, nil, changed, 0)
+	roundTrip(t, old, nil, 0)
+}
+
+func TestCorruptDelta(t *testing.T) {
+	sig, _ := delta.NewSignature(nil, delta.DefaultBlockSize)
+	var stream bytes.Buffer
+	if _, err := delta.Write(&stream, sig, bytes.NewReader([]byte("data")), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	truncated := stream.Bytes()[:stream.Len()-10]
+	if _, err := delta.Apply(&bytes.Buffer{}, nil, sig.BlockSize, bytes.NewReader(truncated)); err == nil {
+		t.Error("a truncated delta is applied")
+	}
+}
+
+func TestCorruptSignature(t *testing.T) {
+	sig, err := delta.NewSignature(bytes.NewReader([]byte("some data")), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := sig.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := delta.ReadSignature(bytes.NewReader(buf.Bytes())); err != nil || len(got.Blocks) != 3 {
+		t.Fatalf("ReadSignature = %v, %v", got, err)
+	}
+
+	// A count that does not match the size, and a large count without
+	// the blocks
+	stream := buf.Bytes()
+	for _, count := range []uint32{2, 1 << 24} {
+		binary.BigEndian.PutUint32(stream[16:20], count)
+		if _, err := delta.ReadSignature(bytes.NewReader(stream)); err != delta.ErrFormat {
+			t.Errorf("count %d: %v, want ErrFormat", count, err)
+		}
+	}
+	binary.BigEndian.PutUint64(stream[8:16], 4<<24)
+	if _, err := delta.ReadSignature(bytes.NewReader(stream)); err != delta.ErrFormat {
+		t.Errorf("truncated blocks: %v, want ErrFormat", err)
+	}
+}
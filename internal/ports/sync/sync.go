@@ -37,3 +37,12 @@ type Transport interface {
 	Push(vault models.VaultInfo, srcRel string) (Report, error)
 	Pull(vault models.VaultInfo, rel string) (Report, error)
 }
+
+// LocalCopy is a Transport that keeps a local copy of the vaults, with the
+// versions of the containers and the file indexes of the vaults.
+type LocalCopy interface {
+	Transport
+
+	PullVersion(vault models.VaultInfo, rel string, version int16) (Report, error)
+	PullIndex(vault models.VaultInfo) (Report, error)
+}
@@ -0,0 +1,208 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/config"
+	"github.com/grd/FreePDM/internal/db"
+)
+
+// validVaultName rejects names that would leave the vaults directory
+func validVaultName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
+
+// vaultAccess returns the rights of the user on a vault
+func (s *Server) vaultAccess(user *db.PdmUser, vault string) (*db.Access, error) {
+	return s.AclRepo.Effective(user, user.GroupNames(), vault)
+}
+
+// allVaults returns the names of the vault directories
+func allVaults() ([]string, error) {
+	dirs, err := os.ReadDir(config.VaultsDir())
+	if err != nil {
+		return nil, err
+	}
+
+	var vaults []string
+	for _, d := range dirs {
+		if d.IsDir() && !strings.HasPrefix(d.Name(), ".") {
+			vaults = append(vaults, d.Name())
+		}
+	}
+	return vaults, nil
+}
+
+// visibleVaults returns the vaults that the user has any access to
+func (s *Server) visibleVaults(user *db.PdmUser) ([]string, error) {
+	all, err := allVaults()
+	if err != nil {
+		return nil, err
+	}
+
+	var vaults []string
+	for _, vault := range all {
+		access, err := s.vaultAccess(user, vault)
+		if err != nil {
+			return nil, err
+		}
+		if access.Any() {
+			vaults = append(vaults, vault)
+		}
+	}
+	return vaults, nil
+}
+
+// VaultAclRow is one line of the vault overview
+type VaultAclRow struct {
+	Name    string
+	Entries int
+}
+
+// AdminVaultsGet shows the vaults with the size of their ACL
+func (s *Server) AdminVaultsGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vaults, err := allVaults()
+	if err != nil {
+		log.Printf("[ERROR] Unable to read the root vault: %v", err)
+		http.Error(w, "Unable to read vaults directory", http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]VaultAclRow, 0, len(vaults))
+	for _, vault := range vaults {
+		acl, err := s.AclRepo.VaultAcl(vault)
+		if err != nil {
+			http.Error(w, "Failed to load access control lists", http.StatusInternalServerError)
+			return
+		}
+		rows = append(rows, VaultAclRow{Name: vault, Entries: len(acl)})
+	}
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Vaults":          rows,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/admin",
+	}
+	s.ExecuteTemplate(w, "admin-vaults.html", data)
+}
+
+// AdminVaultAclGet shows the access control list of a vault
+func (s *Server) AdminVaultAclGet(w http.ResponseWriter, r *http.Request) {
+	s.showVaultAcl(w, r, "")
+}
+
+func (s *Server) showVaultAcl(w http.ResponseWriter, r *http.Request, errMsg string) {
+	vault := chi.URLParam(r, "vaultName")
+	if !validVaultName(vault) {
+		http.NotFound(w, r)
+		return
+	}
+
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	acl, err := s.AclRepo.VaultAcl(vault)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load the ACL of vault %s: %v", vault, err)
+		http.Error(w, "Failed to load access control list", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"VaultName":       vault,
+		"Acl":             acl,
+		"Permissions":     db.AclPermissions(),
+		"Error":           errMsg,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/admin/vaults",
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "admin-vault-acl.html", data)
+}
+
+// AdminVaultAclPost grants permissions on a vault directory
+func (s *Server) AdminVaultAclPost(w http.ResponseWriter, r *http.Request) {
+	vault := chi.URLParam(r, "vaultName")
+	if !validVaultName(vault) {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Form parsing error", http.StatusBadRequest)
+		return
+	}
+
+	subjectType := r.FormValue("subject_type")
+	subject := strings.TrimSpace(r.FormValue("subject"))
+	if subjectType == db.SubjectUser {
+		if _, err := s.UserRepo.LoadUser(subject); err != nil {
+			s.showVaultAcl(w, r, "Unknown user "+subject)
+			return
+		}
+	}
+
+	var perms []db.AclPermission
+	for _, p := range r.Form["permissions"] {
+		perms = append(perms, db.AclPermission(p))
+	}
+
+	dir := r.FormValue("path")
+	if err := s.AclRepo.Grant(vault, dir, subjectType, subject, perms); err != nil {
+		s.showVaultAcl(w, r, err.Error())
+		return
+	}
+
+	admin, _ := s.getSessionUser(r)
+	if admin != nil {
+		log.Printf("[INFO] %s granted %v on %s/%s to %s %s", admin.LoginName, perms, vault, db.CleanVaultPath(dir), subjectType, subject)
+	}
+
+	http.Redirect(w, r, "/admin/vaults/"+vault+"/acl", http.StatusSeeOther)
+}
+
+// AdminVaultAclDeletePost removes an entry of the access control list
+func (s *Server) AdminVaultAclDeletePost(w http.ResponseWriter, r *http.Request) {
+	vault := chi.URLParam(r, "vaultName")
+	if !validVaultName(vault) {
+		http.NotFound(w, r)
+		return
+	}
+
+	aclID, err := strconv.Atoi(chi.URLParam(r, "aclID"))
+	if err != nil {
+		http.Error(w, "Invalid ACL ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.AclRepo.Revoke(vault, uint(aclID)); err != nil {
+		log.Printf("[ERROR] Failed to revoke ACL entry %d: %v", aclID, err)
+		http.Error(w, "Failed to revoke", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/vaults/"+vault+"/acl", http.StatusSeeOther)
+}
@@ -133,7 +133,11 @@ func (s *Server) ShowLogsGet(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) LoginGet(w http.ResponseWriter, r *http.Request) {
-	if err := s.ExecuteTemplate(w, "login.html", nil); err != nil {
+	data := map[string]any{
+		"SSOEnabled": s.OIDC != nil,
+	}
+
+	if err := s.ExecuteTemplate(w, "login.html", data); err != nil {
 		http.Error(w, "Failed to load login page", http.StatusInternalServerError)
 	}
 }
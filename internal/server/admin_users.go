@@ -167,11 +167,37 @@ func (s *Server) EditUserGet(w http.ResponseWriter, r *http.Request) {
 	availableRoles := db.GetAvailableRoles()
 	availableStatuses := db.GetAvailableStatuses()
 
+	// Two-factor authentication
+	totpRoles := make(map[string]bool)
+	policies, err := s.UserRepo.RolePolicies()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load role policies: %v", err)
+	}
+	for _, p := range policies {
+		totpRoles[p.Role] = p.RequireTOTP
+	}
+	totpRequired, _ := s.UserRepo.RequiresTOTP(user)
+
+	// Groups
+	groups, err := s.GroupRepo.AllGroups()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load groups: %v", err)
+	}
+	groupChecks := make(map[uint]bool)
+	for _, g := range user.Groups {
+		groupChecks[g.ID] = true
+	}
+
 	data := map[string]interface{}{
 		"User":              user,
 		"RoleChecks":        roleChecks,
 		"AvailableRoles":    availableRoles,
+		"AvailableGroups":   groups,
+		"GroupChecks":       groupChecks,
+		"EffectiveRoles":    user.EffectiveRoles(),
 		"AvailableStatuses": availableStatuses,
+		"TOTPRoles":         totpRoles,
+		"TOTPRequired":      totpRequired,
 		"BackButtonShow":    true,
 		"BackButtonLink":    "/admin/users",
 		"MenuButtonShow":    false,
@@ -242,6 +268,18 @@ func (s *Server) EditUserPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var groupIDs []uint
+	for _, idStr := range r.Form["groups"] {
+		if id, err := strconv.Atoi(idStr); err == nil {
+			groupIDs = append(groupIDs, uint(id))
+		}
+	}
+	if err := s.GroupRepo.SetUserGroups(user.ID, groupIDs); err != nil {
+		log.Printf("[ERROR] Failed to update groups of %s: %v", user.LoginName, err)
+		http.Error(w, "Failed to update groups", http.StatusInternalServerError)
+		return
+	}
+
 	url := fmt.Sprint("/admin/users/edit/", userIDStr)
 	http.Redirect(w, r, url, http.StatusSeeOther)
 }
@@ -366,6 +404,10 @@ func (s *Server) AdminUserResetPasswordPost(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "Password cannot be empty", http.StatusBadRequest)
 		return
 	}
+	if err := s.PasswordPolicy.Validate(newPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	hash, err := auth.HashPassword(newPassword)
 	if err != nil {
@@ -373,11 +415,20 @@ func (s *Server) AdminUserResetPasswordPost(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if err := s.UserRepo.UpdatePasswordByID(uint(userID), hash); err != nil {
+	// The user has to pick an own password after the next login
+	if err := s.UserRepo.ResetPassword(uint(userID), hash); err != nil {
 		http.Error(w, "Failed to update password", http.StatusInternalServerError)
 		log.Printf("[ERROR] Failed to update password for user %d: %v", userID, err)
 		return
 	}
+
+	admin, _ := s.getSessionUser(r)
+	detail := ""
+	if admin != nil {
+		detail = "by " + admin.LoginName
+	}
+	s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventPasswordReset, clientIP(r), detail)
+
 	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 }
 
@@ -415,11 +466,23 @@ func (s *Server) UserChangeStatusPost(w http.ResponseWriter, r *http.Request) {
 
 	status := r.FormValue("account_status")
 
+	user, err := s.UserRepo.LoadUserByID(uint(userID))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
 	if err := s.UserRepo.UpdateAccountStatus(uint(userID), status); err != nil {
 		http.Error(w, "Failed to update status", http.StatusInternalServerError)
 		return
 	}
 
+	if user.HasStatus(db.StatusLocked) && !strings.EqualFold(status, string(db.StatusLocked)) {
+		s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventAccountUnlocked, clientIP(r), "by admin")
+	} else if !user.HasStatus(db.StatusLocked) && strings.EqualFold(status, string(db.StatusLocked)) {
+		s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventAccountLocked, clientIP(r), "by admin")
+	}
+
 	redirectStr := path.Join("/admin/users", idStr)
 	http.Redirect(w, r, redirectStr, http.StatusSeeOther)
 }
@@ -446,3 +509,30 @@ func StatusTooltip(status string) string {
 		return "Unknown status"
 	}
 }
+
+// SecurityEventsGet shows the audit trail of logins, lockouts and password changes
+func (s *Server) SecurityEventsGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	loginName := r.URL.Query().Get("user")
+	events, err := s.UserRepo.SecurityEvents(loginName, 500)
+	if err != nil {
+		http.Error(w, "Error loading security events", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"User":           user,
+		"Events":         events,
+		"Filter":         loginName,
+		"BackButtonShow": true,
+		"BackButtonLink": "/admin",
+		"MenuButtonShow": false,
+	}
+
+	s.ExecuteTemplate(w, "admin-security.html", data)
+}
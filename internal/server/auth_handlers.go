@@ -5,13 +5,17 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 	"unicode"
 
 	"github.com/grd/FreePDM/internal/auth"
+	"github.com/grd/FreePDM/internal/db"
 	"github.com/grd/FreePDM/internal/shared"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func (s *Server) HomeGet(w http.ResponseWriter, r *http.Request) {
@@ -30,39 +34,175 @@ func (s *Server) HomeGet(w http.ResponseWriter, r *http.Request) {
 func (s *Server) LoginPost(w http.ResponseWriter, r *http.Request) {
 	loginName := r.FormValue("login_name")
 	password := r.FormValue("password")
+	ip := clientIP(r)
 
 	user, err := s.UserRepo.LoadUserByLoginName(loginName)
 	if err != nil || user == nil {
+		s.UserRepo.LogSecurityEvent(0, loginName, db.EventLoginFailed, ip, "unknown login name")
 		http.Error(w, "Invalid login name", http.StatusUnauthorized)
 		return
 	}
 
+	if err := s.checkAccountStatus(user, ip); err != nil {
+		s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventLoginFailed, ip, err.Error())
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	if !auth.CheckPasswordHash(password, user.PasswordHash) {
+		locked, err := s.UserRepo.RecordFailedLogin(user, s.Lockout.MaxFailed, s.Lockout.LockDuration)
+		if err != nil {
+			log.Printf("[ERROR] Failed to record failed login of %s: %v", user.LoginName, err)
+		}
+		s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventLoginFailed, ip, fmt.Sprintf("wrong password, attempt %d", user.FailedLogins))
+
+		if locked {
+			log.Printf("[INFO] Account %s locked after %d failed logins", user.LoginName, user.FailedLogins)
+			s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventAccountLocked, ip, lockDetail(user))
+			http.Error(w, "Too many failed logins, the account is locked", http.StatusForbidden)
+			return
+		}
+
 		http.Error(w, "Invalid password", http.StatusUnauthorized)
 		return
 	}
 
-	sess, _ := s.SessionStore.Get(r, shared.SessionName)
-	sess.Values["user_id"] = user.ID
-	if err := sess.Save(r, w); err != nil {
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	if s.PasswordPolicy.Expired(changedAt, time.Now()) && !user.HasStatus(db.StatusExpired) {
+		if err := s.UserRepo.ExpirePassword(user); err != nil {
+			log.Printf("[ERROR] Failed to expire password of %s: %v", user.LoginName, err)
+		}
+		s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventPasswordExpired, ip, "")
+	}
+
+	s.finishLogin(w, r, user, "password")
+}
+
+// checkAccountStatus returns an error when the account may not log in. A
+// lock that has run out is lifted here.
+func (s *Server) checkAccountStatus(user *db.PdmUser, ip string) error {
+	switch {
+	case user.HasStatus(db.StatusLocked):
+		if user.LockedUntil == nil || time.Now().Before(*user.LockedUntil) {
+			return errors.New("account is locked")
+		}
+		if err := s.UserRepo.UnlockAccount(user); err != nil {
+			return err
+		}
+		s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventAccountUnlocked, ip, "lock expired")
+	case user.HasStatus(db.StatusDisabled), user.HasStatus(db.StatusSuspended),
+		user.HasStatus(db.StatusDeleted), user.HasStatus(db.StatusPending):
+		return fmt.Errorf("account is %s", strings.ToLower(user.AccountStatus))
+	}
+	return nil
+}
+
+func lockDetail(user *db.PdmUser) string {
+	if user.LockedUntil == nil {
+		return "locked until an admin unlocks it"
+	}
+	return "locked until " + user.LockedUntil.Format("2006-01-02 15:04")
+}
+
+// finishLogin is called after the first factor (password or single sign-on).
+// Users with two-factor authentication get the second step first, the
+// others are logged in right away. method is the first factor, for the
+// audit trail.
+func (s *Server) finishLogin(w http.ResponseWriter, r *http.Request, user *db.PdmUser, method string) {
+	required, err := s.UserRepo.RequiresTOTP(user)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load 2FA policy of %s: %v", user.LoginName, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if user.TOTPEnabled || required {
+		sess, _ := s.SessionStore.Get(r, shared.SessionName)
+		delete(sess.Values, "user_id")
+		sess.Values["pending_user_id"] = user.ID
+		sess.Values["pending_at"] = time.Now().Unix()
+		if err := sess.Save(r, w); err != nil {
+			http.Error(w, "Session save failed", http.StatusInternalServerError)
+			return
+		}
+
+		if user.TOTPEnabled {
+			http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		} else {
+			http.Redirect(w, r, "/login/2fa/enroll", http.StatusSeeOther)
+		}
+		return
+	}
+
+	s.completeLogin(w, r, user, method)
+}
+
+// completeLogin stores the user in the session and redirects to the start
+// page. Only here the login counts as successful, after all factors.
+func (s *Server) completeLogin(w http.ResponseWriter, r *http.Request, user *db.PdmUser, method string) {
+	if err := s.startSession(w, r, user); err != nil {
 		http.Error(w, "Session save failed", http.StatusInternalServerError)
 		return
 	}
+	s.recordLogin(r, user, method)
+
+	http.Redirect(w, r, startPage(user), http.StatusSeeOther)
+}
 
-	if user.HasRole("Admin") {
-		http.Redirect(w, r, "/admin", http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+// recordLogin resets the failed logins and adds the login to the audit trail
+func (s *Server) recordLogin(r *http.Request, user *db.PdmUser, method string) {
+	ip := clientIP(r)
+	if err := s.UserRepo.RecordLogin(user, ip); err != nil {
+		log.Printf("[ERROR] Failed to record login of %s: %v", user.LoginName, err)
 	}
+	s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventLoginSuccess, ip, method)
 }
 
-func (s *Server) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		s.ExecuteTemplate(w, "change-password.html", nil)
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, user *db.PdmUser) error {
+	sess, _ := s.SessionStore.Get(r, shared.SessionName)
+	delete(sess.Values, "pending_user_id")
+	delete(sess.Values, "pending_at")
+	delete(sess.Values, "totp_secret")
+	sess.Values["user_id"] = user.ID
+	return sess.Save(r, w)
+}
+
+// startPage is where a user lands after logging in
+func startPage(user *db.PdmUser) string {
+	switch {
+	case user.MustChangePassword && user.AuthSource != db.AuthSourceOIDC:
+		return "/change-password"
+	case user.HasRole("Admin"):
+		return "/admin"
+	default:
+		return "/dashboard"
 	}
+}
 
-	loginname, err := shared.GetSessionLoginname(r)
-	if err != nil {
+// ChangePasswordGet shows the form to change the own password
+func (s *Server) ChangePasswordGet(w http.ResponseWriter, r *http.Request) {
+	s.showChangePassword(w, r, "")
+}
+
+func (s *Server) showChangePassword(w http.ResponseWriter, r *http.Request, errMsg string) {
+	data := s.BaseTemplateData(r, map[string]any{
+		"Rules": s.PasswordPolicy.Rules(),
+		"Error": errMsg,
+	})
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "change-password.html", data)
+}
+
+// ChangePasswordPost checks the new password against the password policy
+// and stores it.
+func (s *Server) ChangePasswordPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || user == nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -72,65 +212,77 @@ func (s *Server) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
 	newPassword := r.FormValue("new_password")
 	repeatPassword := r.FormValue("repeat_password")
 
-	user, err := s.UserRepo.LoadUser(loginname)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusUnauthorized)
-		return
-	}
+	// A wrong current password counts as a failed login, so that a
+	// session left open can't be used to guess the password
+	if !auth.CheckPasswordHash(oldPassword, user.PasswordHash) {
+		ip := clientIP(r)
+		locked, err := s.UserRepo.RecordFailedLogin(user, s.Lockout.MaxFailed, s.Lockout.LockDuration)
+		if err != nil {
+			log.Printf("[ERROR] Failed to record failed login of %s: %v", user.LoginName, err)
+		}
+		s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventLoginFailed, ip, fmt.Sprintf("wrong current password, attempt %d", user.FailedLogins))
 
-	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword)) != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Current password is incorrect")
+		if locked {
+			log.Printf("[INFO] Account %s locked after %d failed logins", user.LoginName, user.FailedLogins)
+			s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventAccountLocked, ip, lockDetail(user))
+			sess, _ := s.SessionStore.Get(r, shared.SessionName)
+			sess.Options.MaxAge = -1
+			sess.Save(r, w)
+			http.Error(w, "Too many failed logins, the account is locked", http.StatusForbidden)
+			return
+		}
+
+		s.showChangePassword(w, r, "Current password is incorrect")
 		return
 	}
 
 	// Basic checks
 	if newPassword != repeatPassword {
-		http.Error(w, "Passwords do not match", http.StatusBadRequest)
+		s.showChangePassword(w, r, "Passwords do not match")
 		return
 	}
-	if len(newPassword) < 10 {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprint(w, "Password must be at least 10 characters long")
-		return
-	}
-	if !containsUppercase(newPassword) {
-		http.Error(w, "Password must contain at least one uppercase letter", http.StatusBadRequest)
+	if err := s.PasswordPolicy.Validate(newPassword); err != nil {
+		s.showChangePassword(w, r, upperFirst(err.Error()))
 		return
 	}
 
-	// Hash new password
-	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	history, err := s.UserRepo.PasswordHistory(user.ID, s.PasswordPolicy.History)
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
+	// the current password counts as the newest one
+	history = append([]string{user.PasswordHash}, history...)
+	if err := s.PasswordPolicy.CheckHistory(newPassword, history); err != nil {
+		s.showChangePassword(w, r, fmt.Sprintf("The password must differ from your last %d passwords", s.PasswordPolicy.History))
+		return
+	}
 
-	// Update DB
-	err = s.UserRepo.UpdatePassword(loginname, string(hash))
+	// Hash new password
+	hash, err := auth.HashPassword(newPassword)
 	if err != nil {
-		http.Error(w, "Failed to update password3", http.StatusInternalServerError)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
 
-	// Set MustChangePassword = false
-	err = s.UserRepo.ClearMustChangePassword(loginname)
-	if err != nil {
-		http.Error(w, "Failed to finalize update", http.StatusInternalServerError)
+	// Update DB, this also clears MustChangePassword
+	if err := s.UserRepo.ChangePassword(user, hash, s.PasswordPolicy.History); err != nil {
+		log.Printf("[ERROR] Failed to update password of %s: %v", user.LoginName, err)
+		http.Error(w, "Failed to update password", http.StatusInternalServerError)
 		return
 	}
+	s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventPasswordChanged, clientIP(r), "")
 
-	// Return redirect via HX
-	w.Header().Set("HX-Redirect", "/dashboard")
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
 }
 
-func containsUppercase(s string) bool {
-	for _, r := range s {
-		if unicode.IsUpper(r) {
-			return true
-		}
+func upperFirst(s string) string {
+	if s == "" {
+		return s
 	}
-	return false
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
 }
 
 func (s *Server) DashboardGet(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,220 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/db"
+)
+
+// bomChild finds the child of a new BOM line: by part number, or else by
+// item ID.
+func (s *Server) bomChild(ref string) (*db.PdmItem, error) {
+	ref = strings.TrimSpace(ref)
+	item, err := s.ItemRepo.ItemByNumber(ref)
+	if !errors.Is(err, db.ErrItemNotFound) {
+		return item, err
+	}
+	id, perr := strconv.Atoi(strings.TrimPrefix(ref, "#"))
+	if perr != nil {
+		return nil, err
+	}
+	return s.ItemRepo.LoadItem(uint(id))
+}
+
+// parseQuantity reads a positive quantity, "1" when it is empty
+func parseQuantity(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 1, nil
+	}
+	qty, err := strconv.ParseFloat(value, 64)
+	if err != nil || qty <= 0 {
+		return 0, fmt.Errorf("invalid quantity %q", value)
+	}
+	return qty, nil
+}
+
+// ItemBomPost adds a child item to the BOM of an item
+func (s *Server) ItemBomPost(w http.ResponseWriter, r *http.Request) {
+	user, item, ok := s.writableItem(w, r)
+	if !ok {
+		return
+	}
+
+	qty, err := parseQuantity(r.FormValue("quantity"))
+	if err != nil {
+		s.showItem(w, r, err.Error())
+		return
+	}
+
+	child, err := s.bomChild(r.FormValue("child"))
+	if errors.Is(err, db.ErrItemNotFound) {
+		s.showItem(w, r, "Unknown item "+r.FormValue("child"))
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to find BOM child %q: %v", r.FormValue("child"), err)
+		s.showItem(w, r, "Failed to find the item")
+		return
+	}
+
+	if _, err := s.BomRepo.AddBomLine(item.ID, child.ID, qty); err != nil {
+		if errors.Is(err, db.ErrBomCycle) {
+			s.showItem(w, r, "The item can't contain itself")
+			return
+		}
+		log.Printf("[ERROR] Failed to add item %d to the BOM of item %d: %v", child.ID, item.ID, err)
+		s.showItem(w, r, "Failed to add the BOM line")
+		return
+	}
+	log.Printf("[INFO] %s added %g x item %d to the BOM of item %d", user.LoginName, qty, child.ID, item.ID)
+
+	http.Redirect(w, r, fmt.Sprint("/items/", item.ID), http.StatusSeeOther)
+}
+
+// ItemBomLinePost changes the quantity of a BOM line
+func (s *Server) ItemBomLinePost(w http.ResponseWriter, r *http.Request) {
+	_, item, ok := s.writableItem(w, r)
+	if !ok {
+		return
+	}
+
+	lineID, err := strconv.Atoi(chi.URLParam(r, "lineID"))
+	if err != nil {
+		http.Error(w, "Invalid line ID", http.StatusBadRequest)
+		return
+	}
+	qty, err := parseQuantity(r.FormValue("quantity"))
+	if err != nil {
+		s.showItem(w, r, err.Error())
+		return
+	}
+
+	if err := s.BomRepo.UpdateBomLine(item.ID, uint(lineID), qty); err != nil {
+		if errors.Is(err, db.ErrBomLineNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("[ERROR] Failed to update BOM line %d: %v", lineID, err)
+		http.Error(w, "Failed to update BOM line", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprint("/items/", item.ID), http.StatusSeeOther)
+}
+
+// ItemBomLineDeletePost removes a line of the BOM of an item
+func (s *Server) ItemBomLineDeletePost(w http.ResponseWriter, r *http.Request) {
+	_, item, ok := s.writableItem(w, r)
+	if !ok {
+		return
+	}
+
+	lineID, err := strconv.Atoi(chi.URLParam(r, "lineID"))
+	if err != nil {
+		http.Error(w, "Invalid line ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.BomRepo.RemoveBomLine(item.ID, uint(lineID)); err != nil {
+		if errors.Is(err, db.ErrBomLineNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("[ERROR] Failed to remove BOM line %d: %v", lineID, err)
+		http.Error(w, "Failed to remove BOM line", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprint("/items/", item.ID), http.StatusSeeOther)
+}
+
+// bomExportHeader are the columns of the BOM export
+var bomExportHeader = []string{
+	"Level", "Position", "Number", "Name", "Description", "Quantity",
+	"Unit weight (kg)", "Total weight (kg)", "Traceability",
+	"Manufacturers", "Manufacturer part numbers", "Vendors", "Vendor part numbers",
+}
+
+// bomExportRow is a line of the BOM export. An item with several approved
+// sources has them joined, the preferred source first.
+func bomExportRow(row db.BomLevel) []string {
+	child := row.Line.Child
+
+	var manufacturers, mpns, vendors, vendorPNs []string
+	for _, src := range child.Sources {
+		if src.Manufacturer != nil {
+			manufacturers = append(manufacturers, src.Manufacturer.ManufacturerName)
+			mpns = append(mpns, src.ManufacturerPartNumber)
+		}
+		if src.Vendor != nil {
+			vendors = append(vendors, src.Vendor.VendorName)
+			vendorPNs = append(vendorPNs, src.VendorPartNumber)
+		}
+	}
+
+	return []string{
+		strconv.Itoa(row.Level),
+		strconv.Itoa(row.Line.Position),
+		child.ItemNumber,
+		child.ItemName,
+		child.ItemDescription,
+		strconv.FormatFloat(row.Quantity, 'g', -1, 64),
+		strconv.FormatFloat(row.Weight, 'f', 3, 64),
+		strconv.FormatFloat(row.Quantity*row.Weight, 'f', 3, 64),
+		string(child.ItemTraceability),
+		strings.Join(manufacturers, "; "),
+		strings.Join(mpns, "; "),
+		strings.Join(vendors, "; "),
+		strings.Join(vendorPNs, "; "),
+	}
+}
+
+// ItemBomCsvGet exports the BOM of an item with all its levels as CSV
+func (s *Server) ItemBomCsvGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	item, _, ok := s.loadItem(w, r, user)
+	if !ok {
+		return
+	}
+
+	rows, err := s.BomRepo.Explode(item.ID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to explode the BOM of item %d: %v", item.ID, err)
+		http.Error(w, "Failed to export the BOM", http.StatusInternalServerError)
+		return
+	}
+
+	name := item.ItemNumber
+	if name == "" {
+		name = fmt.Sprint("item-", item.ID)
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"-bom.csv"))
+
+	out := csv.NewWriter(w)
+	out.Write(bomExportHeader)
+	for _, row := range rows {
+		out.Write(bomExportRow(row))
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Printf("[ERROR] Failed to write the BOM of item %d: %v", item.ID, err)
+	}
+}
@@ -3,3 +3,145 @@
 // license that can be found in the LICENSE file.
 
 package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/util"
+	vfs "github.com/grd/FreePDM/internal/vault/localfs"
+)
+
+// The largest document that can be uploaded
+const maxDocumentSize = 64 << 20
+
+// ItemDocumentPost attaches a document to an item. The document is either
+// uploaded, and then stored in a new container next to the item, or it is
+// an existing document container of the vault.
+func (s *Server) ItemDocumentPost(w http.ResponseWriter, r *http.Request) {
+	user, item, ok := s.writableItem(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentSize+1<<20)
+	if err := r.ParseMultipartForm(maxDocumentSize); err != nil {
+		s.showItem(w, r, "The document is too large")
+		return
+	}
+
+	container := strings.TrimSpace(r.FormValue("container"))
+	if container == "" {
+		var err error
+		if container, err = s.uploadDocument(r, user, item); err != nil {
+			s.showItem(w, r, err.Error())
+			return
+		}
+	}
+
+	if _, err := s.ItemRepo.AttachDocument(item.ID, item.Vault, container); err != nil {
+		if errors.Is(err, db.ErrDocumentNotFound) {
+			s.showItem(w, r, "Container "+container+" does not hold a document")
+			return
+		}
+		log.Printf("[ERROR] Failed to attach %s/%s to item %d: %v", item.Vault, container, item.ID, err)
+		s.showItem(w, r, "Failed to attach the document")
+		return
+	}
+	log.Printf("[INFO] %s attached %s/%s to item %d", user.LoginName, item.Vault, container, item.ID)
+
+	http.Redirect(w, r, fmt.Sprint("/items/", item.ID), http.StatusSeeOther)
+}
+
+// uploadDocument imports the uploaded file into the directory of the item
+// and checks it in. It returns the new container number.
+func (s *Server) uploadDocument(r *http.Request, user *db.PdmUser, item *db.PdmItem) (string, error) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return "", errors.New("choose a file or enter a container number")
+	}
+	defer file.Close()
+
+	name := filepath.Base(header.Filename)
+	if name == "." || name == "/" || name == vfs.EmptyFile {
+		return "", fmt.Errorf("invalid file name %q", header.Filename)
+	}
+	if db.IsModelFile(name) {
+		return "", errors.New("models get a container of their own, import them with the client")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "freepdm-upload-")
+	if err != nil {
+		return "", errors.New("failed to store the upload")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpFile := filepath.Join(tmpDir, name)
+	out, err := os.Create(tmpFile)
+	if err != nil {
+		return "", errors.New("failed to store the upload")
+	}
+	_, err = io.Copy(out, file)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", errors.New("failed to store the upload")
+	}
+
+	fs, err := vfs.NewFileSystem(item.Vault, user.LoginName)
+	if err != nil {
+		log.Printf("[ERROR] Unable to access vault %s: %v", item.Vault, err)
+		return "", errors.New("unable to access the vault")
+	}
+
+	fl, err := fs.ImportFile(item.ItemPath, tmpFile)
+	if err != nil {
+		log.Printf("[ERROR] Failed to import %s into %s/%s: %v", name, item.Vault, item.ItemPath, err)
+		return "", fmt.Errorf("failed to import %s: %v", name, err)
+	}
+
+	// An imported file is checked out, a document is ready as it is
+	version := vfs.FileVersion{Number: 0, Pretty: "0", Date: util.Now()}
+	if err := fs.CheckIn(*fl, version, r.FormValue("description"), ""); err != nil {
+		log.Printf("[ERROR] Failed to check in %s/%s: %v", item.Vault, fl.ContainerNumber, err)
+	}
+
+	return fl.ContainerNumber, nil
+}
+
+// ItemDocumentDetachPost removes a document from an item. The document
+// stays in the vault.
+func (s *Server) ItemDocumentDetachPost(w http.ResponseWriter, r *http.Request) {
+	_, item, ok := s.writableItem(w, r)
+	if !ok {
+		return
+	}
+
+	docID, err := strconv.Atoi(chi.URLParam(r, "documentID"))
+	if err != nil {
+		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.ItemRepo.DetachDocument(item.ID, uint(docID)); err != nil {
+		if errors.Is(err, db.ErrDocumentNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("[ERROR] Failed to detach document %d from item %d: %v", docID, item.ID, err)
+		http.Error(w, "Failed to detach document", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprint("/items/", item.ID), http.StatusSeeOther)
+}
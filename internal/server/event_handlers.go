@@ -0,0 +1,214 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/grd/FreePDM/internal/db"
+	vfs "github.com/grd/FreePDM/internal/vault/localfs"
+)
+
+// The changes of the vaults are pushed to the clients with server-sent
+// events, so that fpg, the web pages and the FreeCAD addon don't have to
+// poll the server. Every event is one JSON encoded vfs.Event:
+//
+//	event: checkin
+//	data: {"kind":"checkin","vault":"Models","container":"1234",...}
+
+const (
+	eventBuffer    = 64               // events that wait for a slow subscriber
+	eventKeepAlive = 25 * time.Second // a comment keeps the proxies from closing the stream
+)
+
+// eventBus hands the events of the vaults to the subscribers
+type eventBus struct {
+	mu     sync.Mutex
+	subs   map[*subscription]bool
+	closed bool
+}
+
+// subscription receives the events of some vaults, all vaults when the set
+// is empty.
+type subscription struct {
+	vaults  map[string]bool
+	events  chan vfs.Event
+	dropped bool // the subscriber was too slow, its stream ends
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: map[*subscription]bool{}}
+}
+
+// subscribe starts a subscription on the vaults
+func (b *eventBus) subscribe(vaults []string) *subscription {
+	sub := &subscription{vaults: map[string]bool{}, events: make(chan vfs.Event, eventBuffer)}
+	for _, v := range vaults {
+		sub.vaults[v] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.events)
+		return sub
+	}
+	b.subs[sub] = true
+	return sub
+}
+
+// unsubscribe ends a subscription
+func (b *eventBus) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs[sub] {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// close ends the subscriptions, when the server stops
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+	b.closed = true
+}
+
+// publish sends an event to the subscribers of its vault. It never blocks
+// the file system operation: a subscriber whose buffer is full is dropped,
+// it connects again and reads the vault anew.
+func (b *eventBus) publish(ev vfs.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if len(sub.vaults) > 0 && !sub.vaults[ev.Vault] {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			sub.dropped = true
+			delete(b.subs, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// CloseEvents ends the streams of EventsApiGet, which otherwise keep the
+// server from shutting down, and stops following the vaults.
+func (s *Server) CloseEvents() {
+	for _, remove := range s.unwatch {
+		remove()
+	}
+	s.unwatch = nil
+	s.events.close()
+}
+
+// EventsApiGet streams the events of the vaults that the user can see as
+// server-sent events. The "vault" parameters narrow the stream, without
+// them it has all vaults of the user. An event of a container outside the
+// access of the user is left out.
+func (s *Server) EventsApiGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vaults := r.URL.Query()["vault"]
+	for _, vault := range vaults {
+		if !validVaultName(vault) {
+			writeJsonError(w, "Invalid vault: "+vault, http.StatusBadRequest)
+			return
+		}
+		access, err := s.vaultAccess(user, vault)
+		if err != nil {
+			log.Printf("[ERROR] Failed to read the access of %s to %s: %v", user.LoginName, vault, err)
+			writeJsonError(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if !access.Any() {
+			writeJsonError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		log.Printf("[ERROR] Failed to clear the write deadline of the events of %s: %v", user.LoginName, err)
+	}
+
+	sub := s.events.subscribe(vaults)
+	defer s.events.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("[ERROR] Events of %s can't be streamed: %v", user.LoginName, err)
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+
+		case ev, ok := <-sub.events:
+			if !ok {
+				if sub.dropped {
+					log.Printf("[WARN] Dropped the events of %s, the client is too slow", user.LoginName)
+				}
+				return
+			}
+			if !s.canSeeEvent(user, ev) {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Printf("[ERROR] Failed to encode the %s event of %s/%s: %v", ev.Kind, ev.Vault, ev.ContainerNumber, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Kind, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// canSeeEvent tells whether the user can see the container of an event.
+// The access is read for every event, so that a change of the access
+// control list counts right away.
+func (s *Server) canSeeEvent(user *db.PdmUser, ev vfs.Event) bool {
+	access, err := s.vaultAccess(user, ev.Vault)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read the access of %s to %s: %v", user.LoginName, ev.Vault, err)
+		return false
+	}
+	return access.CanSee(path.Join(ev.Path, ev.ContainerNumber))
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/grd/FreePDM/internal/db"
+	vfs "github.com/grd/FreePDM/internal/vault/localfs"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// received returns the events that wait in a subscription, and whether it
+// is closed
+func received(sub *subscription) (list []vfs.Event, closed bool) {
+	for {
+		select {
+		case ev, ok := <-sub.events:
+			if !ok {
+				return list, true
+			}
+			list = append(list, ev)
+		default:
+			return list, false
+		}
+	}
+}
+
+func TestEventBusVaults(t *testing.T) {
+	bus := newEventBus()
+	models := bus.subscribe([]string{"Models"})
+	both := bus.subscribe([]string{"Models", "Parts"})
+	all := bus.subscribe(nil)
+
+	bus.publish(vfs.Event{Kind: vfs.EventImport, Vault: "Models", ContainerNumber: "1"})
+	bus.publish(vfs.Event{Kind: vfs.EventImport, Vault: "Parts", ContainerNumber: "2"})
+	bus.publish(vfs.Event{Kind: vfs.EventImport, Vault: "Other", ContainerNumber: "3"})
+
+	tests := []struct {
+		name string
+		sub  *subscription
+		want []string
+	}{
+		{"one vault", models, []string{"1"}},
+		{"two vaults", both, []string{"1", "2"}},
+		{"all vaults", all, []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		list, closed := received(tt.sub)
+		if closed {
+			t.Errorf("%s: the subscription is closed", tt.name)
+		}
+		var got []string
+		for _, ev := range list {
+			got = append(got, ev.ContainerNumber)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got events %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got events %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+
+	// An ended subscription gets nothing more
+	bus.unsubscribe(models)
+	bus.unsubscribe(models)
+	bus.publish(vfs.Event{Kind: vfs.EventImport, Vault: "Models", ContainerNumber: "4"})
+	if list, closed := received(models); len(list) != 0 || !closed {
+		t.Errorf("after unsubscribe: %v, closed %v", list, closed)
+	}
+}
+
+func TestEventBusDropsSlowSubscribers(t *testing.T) {
+	bus := newEventBus()
+	slow := bus.subscribe([]string{"Models"})
+	other := bus.subscribe([]string{"Parts"})
+
+	// The buffer fills up, the next event drops the subscriber instead of
+	// blocking the file system operation
+	for i := 0; i <= eventBuffer; i++ {
+		bus.publish(vfs.Event{Kind: vfs.EventCheckOut, Vault: "Models"})
+	}
+	list, closed := received(slow)
+	if len(list) != eventBuffer || !closed || !slow.dropped {
+		t.Errorf("slow subscriber: %d events, closed %v, dropped %v", len(list), closed, slow.dropped)
+	}
+
+	// The others carry on, and the dropped one can be ended as usual
+	bus.unsubscribe(slow)
+	bus.publish(vfs.Event{Kind: vfs.EventCheckOut, Vault: "Parts"})
+	if list, closed := received(other); len(list) != 1 || closed || other.dropped {
+		t.Errorf("other subscriber: %d events, closed %v, dropped %v", len(list), closed, other.dropped)
+	}
+}
+
+func TestEventBusClose(t *testing.T) {
+	bus := newEventBus()
+	subs := []*subscription{bus.subscribe(nil), bus.subscribe([]string{"Models"})}
+
+	bus.close()
+	for i, sub := range subs {
+		if _, closed := received(sub); !closed || sub.dropped {
+			t.Errorf("subscription %d: closed %v, dropped %v", i, closed, sub.dropped)
+		}
+		bus.unsubscribe(sub)
+	}
+
+	// Nothing is delivered anymore, a late subscriber ends right away
+	bus.publish(vfs.Event{Kind: vfs.EventImport, Vault: "Models"})
+	late := bus.subscribe(nil)
+	if list, closed := received(late); len(list) != 0 || !closed {
+		t.Errorf("late subscriber: %v, closed %v", list, closed)
+	}
+	bus.unsubscribe(late)
+}
+
+func TestCanSeeEvent(t *testing.T) {
+	gormdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "events.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open SQLite DB: %v", err)
+	}
+	if err := gormdb.AutoMigrate(&db.PdmAcl{}); err != nil {
+		t.Fatalf("failed to migrate schema: %v", err)
+	}
+	s := &Server{AclRepo: db.NewAclRepo(gormdb)}
+
+	grants := []struct{ dir, subjectType, subject string }{
+		{"pumps", db.SubjectUser, "jdoe"},
+		{"valves/brass", db.SubjectGroup, "valve-team"},
+		{"secret", db.SubjectUser, "boss"},
+	}
+	for _, g := range grants {
+		if err := s.AclRepo.Grant("Models", g.dir, g.subjectType, g.subject, []db.AclPermission{db.AclRead}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jdoe := &db.PdmUser{LoginName: "jdoe", Roles: []string{"designer"}, Groups: []*db.PdmGroup{{Name: "valve-team"}}}
+	admin := &db.PdmUser{LoginName: "root", Roles: []string{"admin"}}
+
+	tests := []struct {
+		user *db.PdmUser
+		ev   vfs.Event
+		want bool
+	}{
+		{jdoe, vfs.Event{Vault: "Models", Path: "pumps", ContainerNumber: "1"}, true},
+		{jdoe, vfs.Event{Vault: "Models", Path: "pumps/impellers", ContainerNumber: "2"}, true},
+		{jdoe, vfs.Event{Vault: "Models", Path: "valves/brass", ContainerNumber: "3"}, true}, // through the group
+		{jdoe, vfs.Event{Vault: "Models", Path: "valves", ContainerNumber: "4"}, false},      // the container is not a parent
+		{jdoe, vfs.Event{Vault: "Models", Path: "secret", ContainerNumber: "5"}, false},
+		{jdoe, vfs.Event{Vault: "Models", Path: "", ContainerNumber: "6"}, false},
+		{jdoe, vfs.Event{Vault: "Parts", Path: "secret", ContainerNumber: "7"}, true}, // an open vault
+		{admin, vfs.Event{Vault: "Models", Path: "secret", ContainerNumber: "5"}, true},
+	}
+	for _, tt := range tests {
+		if got := s.canSeeEvent(tt.user, tt.ev); got != tt.want {
+			t.Errorf("canSeeEvent(%s, %s/%s/%s) = %v, want %v",
+				tt.user.LoginName, tt.ev.Vault, tt.ev.Path, tt.ev.ContainerNumber, got, tt.want)
+		}
+	}
+
+	// A change of the access counts right away
+	if err := s.AclRepo.RevokeSubject("Models", "pumps", db.SubjectUser, "jdoe"); err != nil {
+		t.Fatal(err)
+	}
+	if s.canSeeEvent(jdoe, vfs.Event{Vault: "Models", Path: "pumps", ContainerNumber: "1"}) {
+		t.Error("the event is seen after the grant is revoked")
+	}
+}
@@ -0,0 +1,502 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/shared"
+	"github.com/grd/FreePDM/internal/util"
+	vfs "github.com/grd/FreePDM/internal/vault/localfs"
+)
+
+// The file commands of the shell. Files are named like in the vault, the
+// container number is looked up in the directory "path".
+
+// openVault opens the vault for the user, or writes the error
+func openVault(w http.ResponseWriter, user, vault string) (*vfs.FileSystem, bool) {
+	fs, err := vfs.NewFileSystem(vault, user)
+	switch {
+	case errors.Is(err, vfs.ErrVaultNotFound):
+		writeJsonError(w, "Vault not found: "+vault, http.StatusNotFound)
+		return nil, false
+	case errors.Is(err, vfs.ErrUnknownUser):
+		log.Printf("[ERROR] Unable to access vault %s: %v", vault, err)
+		writeJsonError(w, "User "+user+" is not set up for the vaults", http.StatusForbidden)
+		return nil, false
+	case err != nil:
+		log.Printf("[ERROR] Unable to access vault %s: %v", vault, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return fs, true
+}
+
+// validFileName tells whether name is a single directory or file name
+func validFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// Shows the directories and files under dir that the user may see, one
+// path per line. Directories end with a slash.
+func handleTree(w http.ResponseWriter, user, vault, dir string, access *db.Access) {
+	fs, ok := openVault(w, user, vault)
+	if !ok {
+		return
+	}
+
+	list, err := fs.ListTree(dir)
+	if err != nil {
+		writeJsonError(w, "Failed to show the tree", http.StatusNotFound)
+		return
+	}
+
+	var resp shared.CommandResponse
+	for _, item := range list {
+		name := path.Join(db.CleanVaultPath(item.Path()), item.Name())
+		if item.IsDir() {
+			if access.CanSee(name) {
+				resp.Data = append(resp.Data, name+"/")
+			}
+		} else if access.CanSee(path.Join(db.CleanVaultPath(item.Path()), item.ContainerNumber())) {
+			resp.Data = append(resp.Data, name)
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Creates the directory "name" in dir
+func handleMkdir(w http.ResponseWriter, user, vault, dir string, params map[string]string, access *db.Access) {
+	name := params["name"]
+	if !validFileName(name) || util.IsNumber(name) {
+		writeJsonError(w, "Invalid directory name: "+name, http.StatusBadRequest)
+		return
+	}
+	if !access.Can(dir, db.AclWrite) {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	fs, ok := openVault(w, user, vault)
+	if !ok {
+		return
+	}
+	if err := fs.Mkdir(filepath.Join(fs.VaultDir(), dir, name)); err != nil {
+		writeJsonError(w, "Failed to create the directory: "+err.Error(), http.StatusConflict)
+		return
+	}
+	json.NewEncoder(w).Encode(shared.CommandResponse{Data: []string{path.Join(dir, name)}})
+}
+
+// Removes the empty directory "name" in dir
+func handleRmdir(w http.ResponseWriter, user, vault, dir string, params map[string]string, access *db.Access) {
+	name := params["name"]
+	if !validFileName(name) {
+		writeJsonError(w, "Invalid directory name: "+name, http.StatusBadRequest)
+		return
+	}
+	if !access.Can(path.Join(dir, name), db.AclWrite) {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	fs, ok := openVault(w, user, vault)
+	if !ok {
+		return
+	}
+	if !fs.DirExists(path.Join(dir, name)) {
+		writeJsonError(w, "Directory "+path.Join(dir, name)+" not found", http.StatusNotFound)
+		return
+	}
+	if err := fs.Rmdir(path.Join(dir, name)); err != nil {
+		writeJsonError(w, "Failed to remove the directory: "+err.Error(), http.StatusConflict)
+		return
+	}
+	json.NewEncoder(w).Encode(shared.CommandResponse{})
+}
+
+// Removes the container of the file "file" in dir, with all its versions.
+// That needs the admin permission, or the checkout permission together
+// with the role permission to delete items.
+func handleRemove(w http.ResponseWriter, user *db.PdmUser, vault, dir string, params map[string]string, access *db.Access) {
+	fs, ok := openVault(w, user.LoginName, vault)
+	if !ok {
+		return
+	}
+	fl, err := paramContainer(fs, dir, params)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	rel := path.Join(dir, fl.ContainerNumber)
+	if !access.Can(rel, db.AclAdmin) && !(access.Can(rel, db.AclCheckout) && user.HasPermission(db.DeleteItem)) {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if by := fs.IsLockedItem(fl.ContainerNumber); by != "" {
+		writeJsonError(w, fl.Name+" is checked out by "+by, http.StatusConflict)
+		return
+	}
+	if err := fs.FileRemove(fl.ContainerNumber); err != nil {
+		log.Printf("[ERROR] Failed to remove %s/%s: %v", vault, fl.ContainerNumber, err)
+		writeJsonError(w, "Failed to remove "+fl.Name+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(shared.CommandResponse{Data: []string{fl.ContainerNumber}})
+}
+
+// Renames, moves or copies the file or directory "src" to "dst". Both are
+// paths inside the vault, dst can be a directory.
+func (s *Server) handleRenameCopy(w http.ResponseWriter, user, vault, command string, params map[string]string, access *db.Access) {
+	src := db.CleanVaultPath(params["src"])
+	dst := db.CleanVaultPath(params["dst"])
+	if src == "" || params["dst"] == "" {
+		writeJsonError(w, "Missing parameters", http.StatusBadRequest)
+		return
+	}
+
+	fs, ok := openVault(w, user, vault)
+	if !ok {
+		return
+	}
+
+	srcDir, srcName := db.CleanVaultPath(path.Dir(src)), path.Base(src)
+	if fs.DirExists(src) && !util.IsNumber(srcName) {
+		s.handleDirectoryRenameCopy(w, fs, vault, command, src, dst, access)
+		return
+	}
+	fl, err := fs.GetItem(srcDir, srcName)
+	if err != nil {
+		writeJsonError(w, "File "+src+" not found", http.StatusNotFound)
+		return
+	}
+
+	dstDir, dstName := dst, srcName
+	if !fs.DirExists(dst) {
+		dstDir, dstName = db.CleanVaultPath(path.Dir(dst)), path.Base(dst)
+	}
+	if !fs.DirExists(dstDir) {
+		writeJsonError(w, "Directory "+dstDir+" not found", http.StatusNotFound)
+		return
+	}
+
+	perm := db.AclWrite
+	if command == "copy" {
+		perm = db.AclRead
+	}
+	if !access.Can(path.Join(srcDir, fl.ContainerNumber), perm) || !access.Can(dstDir, db.AclWrite) {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if item, err := fs.GetItem(dstDir, dstName); err == nil {
+		writeJsonError(w, path.Join(dstDir, dstName)+" already exists as "+item.ContainerNumber, http.StatusConflict)
+		return
+	}
+	if by := fs.IsLockedItem(fl.ContainerNumber); by != "" {
+		writeJsonError(w, src+" is checked out by "+by, http.StatusConflict)
+		return
+	}
+
+	// The access entries of a container that moves go along
+	srcRel, dstRel := path.Join(srcDir, fl.ContainerNumber), path.Join(dstDir, fl.ContainerNumber)
+	entries, err := s.AclRepo.SubtreeAcl(vault, srcRel)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read the access entries of %s/%s: %v", vault, srcRel, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	move := command != "copy" && srcRel != dstRel && len(entries) > 0
+	if move {
+		if err := s.AclRepo.MovePath(vault, srcRel, dstRel); err != nil {
+			writeJsonError(w, "Failed to move the access entries of "+src+": "+err.Error(), http.StatusConflict)
+			return
+		}
+	}
+
+	srcAbs := filepath.Join(fs.VaultDir(), srcDir, srcName)
+	dstAbs := filepath.Join(fs.VaultDir(), dstDir, dstName)
+	if command == "copy" {
+		err = fs.FileCopy(srcAbs, dstAbs)
+	} else {
+		err = fs.FileRename(srcAbs, dstAbs)
+	}
+	if err != nil && move {
+		if err := s.AclRepo.MovePath(vault, dstRel, srcRel); err != nil {
+			log.Printf("[ERROR] Failed to move the access entries of %s/%s back from %s: %v", vault, srcRel, dstRel, err)
+		}
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to %s %s/%s to %s: %v", command, vault, src, dst, err)
+		writeJsonError(w, "Failed to "+command+" "+src+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(shared.CommandResponse{Data: []string{path.Join(dstDir, dstName)}})
+}
+
+// Renames, moves or copies the directory src with all its files. The
+// files must not be checked out. The user needs the permission on every
+// subdirectory with access entries of its own, and a rename takes these
+// entries along.
+func (s *Server) handleDirectoryRenameCopy(w http.ResponseWriter, fs *vfs.FileSystem, vault, command, src, dst string, access *db.Access) {
+	if fs.DirExists(dst) {
+		dst = path.Join(dst, path.Base(src))
+	}
+	dstDir, dstName := db.CleanVaultPath(path.Dir(dst)), path.Base(dst)
+	if !validFileName(dstName) || util.IsNumber(dstName) {
+		writeJsonError(w, "Invalid directory name: "+dstName, http.StatusBadRequest)
+		return
+	}
+	if dst == src || strings.HasPrefix(dst, src+"/") {
+		writeJsonError(w, "Can not "+command+" "+src+" into itself", http.StatusBadRequest)
+		return
+	}
+	if !fs.DirExists(dstDir) {
+		writeJsonError(w, "Directory "+dstDir+" not found", http.StatusNotFound)
+		return
+	}
+	if fs.DirExists(dst) {
+		writeJsonError(w, dst+" already exists", http.StatusConflict)
+		return
+	}
+
+	perm := db.AclWrite
+	if command == "copy" {
+		perm = db.AclRead
+	}
+	if !access.Can(src, perm) || !access.Can(dstDir, db.AclWrite) {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	entries, err := s.AclRepo.SubtreeAcl(vault, src)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read the access entries of %s/%s: %v", vault, src, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	for _, e := range entries {
+		if !access.Can(e.Path, perm) {
+			writeJsonError(w, "Forbidden: "+e.Path, http.StatusForbidden)
+			return
+		}
+	}
+
+	if command == "copy" {
+		err = fs.DirectoryCopy(src, dst)
+	} else {
+		if len(entries) > 0 {
+			if err := s.AclRepo.MovePath(vault, src, dst); err != nil {
+				writeJsonError(w, "Failed to move the access entries of "+src+": "+err.Error(), http.StatusConflict)
+				return
+			}
+		}
+		err = fs.DirectoryRename(src, dst)
+		if err != nil && len(entries) > 0 {
+			if err := s.AclRepo.MovePath(vault, dst, src); err != nil {
+				log.Printf("[ERROR] Failed to move the access entries of %s/%s back from %s: %v", vault, src, dst, err)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to %s %s/%s to %s: %v", command, vault, src, dst, err)
+		writeJsonError(w, "Failed to "+command+" "+src+": "+err.Error(), http.StatusConflict)
+		return
+	}
+	json.NewEncoder(w).Encode(shared.CommandResponse{Data: []string{dst}})
+}
+
+// Assigns the file name "file" to the allocated container "container"
+func handleAssign(w http.ResponseWriter, user, vault string, params map[string]string, access *db.Access) {
+	fs, ok := openVault(w, user, vault)
+	if !ok {
+		return
+	}
+	fl, err := fs.ContainerFileList(params["container"])
+	if err != nil {
+		writeJsonError(w, "Container "+params["container"]+" not found", http.StatusNotFound)
+		return
+	}
+	if !access.Can(path.Join(db.CleanVaultPath(fl.Path), fl.ContainerNumber), db.AclWrite) {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !validFileName(params["file"]) {
+		writeJsonError(w, "Invalid file name: "+params["file"], http.StatusBadRequest)
+		return
+	}
+	if err := fs.Assign(fl.ContainerNumber, params["file"]); err != nil {
+		writeJsonError(w, "Failed to assign: "+err.Error(), http.StatusConflict)
+		return
+	}
+	json.NewEncoder(w).Encode(shared.CommandResponse{Data: []string{fl.ContainerNumber}})
+}
+
+// Shows a version of a file, the latest one without "version", and its
+// properties. Every line is "Key: Value".
+func handleInfo(w http.ResponseWriter, user, vault, dir string, params map[string]string, access *db.Access) {
+	fs, ok := openVault(w, user, vault)
+	if !ok {
+		return
+	}
+	fl, err := paramContainer(fs, dir, params)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !access.Can(path.Join(dir, fl.ContainerNumber), db.AclRead) {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	versions, err := fs.Versions(fl)
+	if err != nil || len(versions) == 0 {
+		writeJsonError(w, fl.Name+" has no versions", http.StatusNotFound)
+		return
+	}
+
+	version := versions[len(versions)-1]
+	if params["version"] != "" {
+		nr, err := util.Atoi16(params["version"])
+		found := false
+		for _, v := range versions {
+			if err == nil && v.Number == nr {
+				version, found = v, true
+			}
+		}
+		if !found {
+			writeJsonError(w, "Version "+params["version"]+" not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	resp := shared.CommandResponse{Data: []string{
+		"Name: " + fl.Name,
+		"Container: " + fl.ContainerNumber,
+		"Version: " + util.I16toa(version.Number),
+		"Date: " + version.Date,
+	}}
+	if by := fs.IsLocked(fl.ContainerNumber, version); by != "" {
+		resp.Data = append(resp.Data, "Checked out by: "+by)
+	}
+	if descr := strings.TrimSpace(fs.VersionDescription(fl, version)); descr != "" {
+		resp.Data = append(resp.Data, "Description: "+descr)
+	}
+	for _, prop := range fs.Properties(fl, version) {
+		resp.Data = append(resp.Data, prop.Key+": "+prop.Value)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CanImport tells whether a user may import a file into the directory dir
+// of a vault, for the files that are dropped into the vault. An account
+// that may not log in may not import either.
+func (s *Server) CanImport(loginName, vault, dir string) error {
+	user, err := s.UserRepo.LoadUserByLoginName(loginName)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", loginName, err)
+	}
+	if err := s.checkAccountStatus(user, ""); err != nil {
+		return fmt.Errorf("user %s: %w", loginName, err)
+	}
+	access, err := s.vaultAccess(user, vault)
+	if err != nil {
+		return err
+	}
+	if !access.Can(db.CleanVaultPath(dir), db.AclWrite) {
+		return fmt.Errorf("%s may not import into %s/%s", loginName, vault, dir)
+	}
+	return nil
+}
+
+// ImportPost imports the body as the file "name" into the directory
+// "path" of a vault. The new container is checked out by the user.
+func (s *Server) ImportPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vault := chi.URLParam(r, "vault")
+	if !validVaultName(vault) {
+		writeJsonError(w, "Invalid vault: "+vault, http.StatusBadRequest)
+		return
+	}
+	dir := db.CleanVaultPath(r.URL.Query().Get("path"))
+	name := r.URL.Query().Get("name")
+	if !validFileName(name) {
+		writeJsonError(w, "Invalid file name: "+name, http.StatusBadRequest)
+		return
+	}
+
+	access, err := s.vaultAccess(user, vault)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load the ACL of vault %s: %v", vault, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if !access.Can(dir, db.AclWrite) {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	fs, ok := openVault(w, user.LoginName, vault)
+	if !ok {
+		return
+	}
+	if !fs.DirExists(dir) {
+		writeJsonError(w, "Directory "+dir+" not found", http.StatusNotFound)
+		return
+	}
+	if item, err := fs.GetItem(dir, name); err == nil {
+		writeJsonError(w, path.Join(dir, name)+" already exists as "+item.ContainerNumber, http.StatusConflict)
+		return
+	}
+
+	// The upload keeps its name, ImportFile takes the name of the file
+	tmpRoot := filepath.Join(vfs.Root(), ".sync", vault)
+	if err := os.MkdirAll(tmpRoot, 0o755); err != nil {
+		log.Printf("[ERROR] Failed to create %s: %v", tmpRoot, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	tmpDir, err := os.MkdirTemp(tmpRoot, "import-")
+	if err != nil {
+		log.Printf("[ERROR] Failed to create an import directory: %v", err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpFile := filepath.Join(tmpDir, name)
+	f, err := os.Create(tmpFile)
+	if err == nil {
+		_, err = io.Copy(f, r.Body)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		writeJsonError(w, "Upload interrupted: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fl, err := fs.ImportFile(dir, tmpFile)
+	if err != nil {
+		log.Printf("[ERROR] Failed to import %s into %s/%s: %v", name, vault, dir, err)
+		writeJsonError(w, "Failed to import "+name+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(shared.CommandResponse{Data: []string{fl.ContainerNumber}})
+}
@@ -0,0 +1,213 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/db"
+)
+
+// AdminGroupsGet shows all groups
+func (s *Server) AdminGroupsGet(w http.ResponseWriter, r *http.Request) {
+	s.showGroups(w, r, "")
+}
+
+func (s *Server) showGroups(w http.ResponseWriter, r *http.Request, errMsg string) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	groups, err := s.GroupRepo.AllGroups()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load groups: %v", err)
+		http.Error(w, "Failed to load groups", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Groups":          groups,
+		"AvailableRoles":  db.GetAvailableRoles(),
+		"Error":           errMsg,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/admin",
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "admin-groups.html", data)
+}
+
+// AdminGroupNewPost creates a group
+func (s *Server) AdminGroupNewPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Form parsing error", http.StatusBadRequest)
+		return
+	}
+
+	group, err := s.GroupRepo.CreateGroup(r.FormValue("name"), r.FormValue("description"), r.Form["roles"])
+	if err != nil {
+		s.showGroups(w, r, "Failed to create group: "+err.Error())
+		return
+	}
+	log.Printf("[INFO] Created group %s with roles %v", group.Name, group.Roles)
+
+	http.Redirect(w, r, fmt.Sprint("/admin/groups/", group.ID), http.StatusSeeOther)
+}
+
+// groupFromURL loads the group of the {groupID} parameter
+func (s *Server) groupFromURL(w http.ResponseWriter, r *http.Request) (*db.PdmGroup, bool) {
+	groupID, err := strconv.Atoi(chi.URLParam(r, "groupID"))
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	group, err := s.GroupRepo.LoadGroup(uint(groupID))
+	if err != nil {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return nil, false
+	}
+	return group, true
+}
+
+// AdminGroupGet shows a group with its members and ACL grants
+func (s *Server) AdminGroupGet(w http.ResponseWriter, r *http.Request) {
+	s.showGroup(w, r, "")
+}
+
+func (s *Server) showGroup(w http.ResponseWriter, r *http.Request, errMsg string) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	group, ok := s.groupFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	roleChecks := make(map[string]bool)
+	for _, role := range group.Roles {
+		roleChecks[role] = true
+	}
+
+	acl, err := s.GroupRepo.GroupAcl(group.Name)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load the ACL of group %s: %v", group.Name, err)
+	}
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Group":           group,
+		"RoleChecks":      roleChecks,
+		"AvailableRoles":  db.GetAvailableRoles(),
+		"Acl":             acl,
+		"Error":           errMsg,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/admin/groups",
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "admin-group.html", data)
+}
+
+// AdminGroupPost updates name, description and roles of a group
+func (s *Server) AdminGroupPost(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.groupFromURL(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Form parsing error", http.StatusBadRequest)
+		return
+	}
+
+	roles := r.Form["roles"]
+	if roles == nil {
+		roles = []string{}
+	}
+
+	if err := s.GroupRepo.UpdateGroup(group.ID, r.FormValue("name"), r.FormValue("description"), roles); err != nil {
+		s.showGroup(w, r, "Failed to update group: "+err.Error())
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprint("/admin/groups/", group.ID), http.StatusSeeOther)
+}
+
+// AdminGroupDeletePost removes a group
+func (s *Server) AdminGroupDeletePost(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.groupFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.GroupRepo.DeleteGroup(group.ID); err != nil {
+		log.Printf("[ERROR] Failed to delete group %s: %v", group.Name, err)
+		http.Error(w, "Failed to delete group", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[INFO] Deleted group %s", group.Name)
+
+	http.Redirect(w, r, "/admin/groups", http.StatusSeeOther)
+}
+
+// AdminGroupMemberPost adds a user, by login name, to a group
+func (s *Server) AdminGroupMemberPost(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.groupFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	loginName := strings.TrimSpace(r.FormValue("login_name"))
+	member, err := s.UserRepo.LoadUser(loginName)
+	if err != nil {
+		s.showGroup(w, r, "Unknown user "+loginName)
+		return
+	}
+
+	if err := s.GroupRepo.AddMember(group.ID, member.ID); err != nil {
+		log.Printf("[ERROR] Failed to add %s to group %s: %v", member.LoginName, group.Name, err)
+		http.Error(w, "Failed to add member", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprint("/admin/groups/", group.ID), http.StatusSeeOther)
+}
+
+// AdminGroupMemberRemovePost removes a user from a group
+func (s *Server) AdminGroupMemberRemovePost(w http.ResponseWriter, r *http.Request) {
+	group, ok := s.groupFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.GroupRepo.RemoveMember(group.ID, uint(userID)); err != nil {
+		log.Printf("[ERROR] Failed to remove user %d from group %s: %v", userID, group.Name, err)
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprint("/admin/groups/", group.ID), http.StatusSeeOther)
+}
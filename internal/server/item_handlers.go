@@ -0,0 +1,237 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/db"
+	vfs "github.com/grd/FreePDM/internal/vault/localfs"
+)
+
+// The largest number of items on the overview
+const maxItemsShown = 200
+
+// recordVaultEvent keeps the item, model and document records in sync with
+// the vault containers.
+func (s *Server) recordVaultEvent(ev vfs.Event) {
+	var err error
+
+	switch ev.Kind {
+	case vfs.EventAllocate:
+		_, err = s.ItemRepo.RecordAllocate(ev.Vault, ev.ContainerNumber, ev.Path, ev.PartNumber, ev.User)
+	case vfs.EventImport:
+		err = s.ItemRepo.RecordImport(ev.Vault, ev.ContainerNumber, ev.Path, ev.Name, ev.User)
+	case vfs.EventAssign:
+		err = s.ItemRepo.RecordAssign(ev.Vault, ev.ContainerNumber, ev.Name, ev.User)
+	case vfs.EventCheckIn, vfs.EventNewVersion:
+		err = s.ItemRepo.RecordVersion(ev.Vault, ev.ContainerNumber, ev.Version, ev.Description, ev.LongDescription)
+		if err == nil {
+			// the volume and material of a model
+			err = s.MaterialRepo.RecordProperties(ev.Vault, ev.ContainerNumber, ev.Properties)
+		}
+		if err == nil && ev.Kind == vfs.EventCheckIn {
+			err = s.RefRepo.RecordReferences(ev.Vault, ev.ContainerNumber, ev.Path, ev.Name, ev.Version, referenceTargets(ev.References))
+		}
+	case vfs.EventRename:
+		err = s.ItemRepo.RecordRename(ev.Vault, ev.ContainerNumber, ev.Path, ev.Name)
+		if err == nil {
+			err = s.RefRepo.RecordRename(ev.Vault, ev.ContainerNumber, ev.Path, ev.Name)
+		}
+	case vfs.EventRemove:
+		err = s.ItemRepo.RecordRemove(ev.Vault, ev.ContainerNumber)
+		if err == nil {
+			err = s.RefRepo.RecordRemove(ev.Vault, ev.ContainerNumber)
+		}
+	}
+
+	if err != nil {
+		log.Printf("[ERROR] Failed to record %s of %s/%s: %v", ev.Kind, ev.Vault, ev.ContainerNumber, err)
+	}
+}
+
+// itemPath is the path of the container of an item, for the access checks
+func itemPath(item *db.PdmItem) string {
+	return path.Join(item.ItemPath, item.ContainerNumber)
+}
+
+// loadItem returns the item of the URL with the access of the user on its
+// vault. It writes the error response when that fails.
+func (s *Server) loadItem(w http.ResponseWriter, r *http.Request, user *db.PdmUser) (*db.PdmItem, *db.Access, bool) {
+	itemID, err := strconv.Atoi(chi.URLParam(r, "itemID"))
+	if err != nil {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	item, err := s.ItemRepo.LoadItem(uint(itemID))
+	if errors.Is(err, db.ErrItemNotFound) {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to load item %d: %v", itemID, err)
+		http.Error(w, "Failed to load item", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	access, err := s.vaultAccess(user, item.Vault)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load the ACL of vault %s: %v", item.Vault, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if !access.CanSee(itemPath(item)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return item, access, true
+}
+
+// writableItem returns the item of the URL when the user may change it
+func (s *Server) writableItem(w http.ResponseWriter, r *http.Request) (*db.PdmUser, *db.PdmItem, bool) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	item, access, ok := s.loadItem(w, r, user)
+	if !ok {
+		return nil, nil, false
+	}
+	if !access.Can(item.ItemPath, db.AclWrite) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, nil, false
+	}
+	return user, item, true
+}
+
+// ItemsGet searches the items that the user has access to
+func (s *Server) ItemsGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	vault := r.URL.Query().Get("vault")
+	query := r.URL.Query().Get("q")
+
+	items, err := s.ItemRepo.FindItems(vault, query, maxItemsShown)
+	if err != nil {
+		log.Printf("[ERROR] Failed to search items: %v", err)
+		http.Error(w, "Failed to load items", http.StatusInternalServerError)
+		return
+	}
+
+	// One access check per vault
+	accessOf := map[string]*db.Access{}
+	visible := make([]db.PdmItem, 0, len(items))
+	for _, item := range items {
+		access, ok := accessOf[item.Vault]
+		if !ok {
+			if access, err = s.vaultAccess(user, item.Vault); err != nil {
+				log.Printf("[ERROR] Failed to load the ACL of vault %s: %v", item.Vault, err)
+				continue
+			}
+			accessOf[item.Vault] = access
+		}
+		if access.CanSee(itemPath(&item)) {
+			visible = append(visible, item)
+		}
+	}
+
+	vaults, _ := s.visibleVaults(user)
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Items":           visible,
+		"Vaults":          vaults,
+		"Vault":           vault,
+		"Query":           query,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/dashboard",
+	}
+	s.ExecuteTemplate(w, "items.html", data)
+}
+
+// ItemGet shows an item with its models and documents
+func (s *Server) ItemGet(w http.ResponseWriter, r *http.Request) {
+	s.showItem(w, r, "")
+}
+
+func (s *Server) showItem(w http.ResponseWriter, r *http.Request, errMsg string) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	item, access, ok := s.loadItem(w, r, user)
+	if !ok {
+		return
+	}
+
+	materials, err := s.MaterialRepo.Materials()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load materials: %v", err)
+	}
+	bom, weight, err := s.BomRepo.Bom(item.ID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load the BOM of item %d: %v", item.ID, err)
+	}
+	manufacturers, err := s.PurchaseRepo.Manufacturers()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load manufacturers: %v", err)
+	}
+	vendors, err := s.PurchaseRepo.Vendors()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load vendors: %v", err)
+	}
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Item":            item,
+		"Materials":       materials,
+		"Bom":             bom,
+		"Weight":          weight,
+		"Manufacturers":   manufacturers,
+		"Vendors":         vendors,
+		"Traceability":    db.TracebilityStates(),
+		"CanWrite":        access.Can(item.ItemPath, db.AclWrite),
+		"Error":           errMsg,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/items",
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "item.html", data)
+}
+
+// ItemPost changes the name and descriptions of an item
+func (s *Server) ItemPost(w http.ResponseWriter, r *http.Request) {
+	_, item, ok := s.writableItem(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.ItemRepo.UpdateItem(item.ID, r.FormValue("name"), r.FormValue("description"), r.FormValue("full_description"))
+	if err != nil {
+		log.Printf("[ERROR] Failed to update item %d: %v", item.ID, err)
+		s.showItem(w, r, "Failed to update item")
+		return
+	}
+
+	http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+}
@@ -0,0 +1,148 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/auth"
+	"github.com/grd/FreePDM/internal/db"
+)
+
+// canManageMaterials tells whether the user maintains the materials catalogue
+func canManageMaterials(user *db.PdmUser) bool {
+	return auth.IsAdmin(user) || user.HasRole(string(db.SeniorDesigner))
+}
+
+// MaterialsGet shows the materials catalogue
+func (s *Server) MaterialsGet(w http.ResponseWriter, r *http.Request) {
+	s.showMaterials(w, r, "")
+}
+
+func (s *Server) showMaterials(w http.ResponseWriter, r *http.Request, errMsg string) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	materials, err := s.MaterialRepo.Materials()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load materials: %v", err)
+		http.Error(w, "Failed to load materials", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Materials":       materials,
+		"DensityUnits":    db.DensityUnits(),
+		"CanManage":       canManageMaterials(user),
+		"Error":           errMsg,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/dashboard",
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "materials.html", data)
+}
+
+// materialForm reads the fields of a material
+func materialForm(r *http.Request) (name, finish string, density float64, unit db.DensityUnit, err error) {
+	density, err = strconv.ParseFloat(r.FormValue("density"), 64)
+	if err != nil {
+		return "", "", 0, "", errors.New("invalid density")
+	}
+	return r.FormValue("name"), r.FormValue("finish"), density, db.DensityUnit(r.FormValue("density_unit")), nil
+}
+
+// MaterialNewPost adds a material to the catalogue
+func (s *Server) MaterialNewPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !canManageMaterials(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	name, finish, density, unit, err := materialForm(r)
+	if err != nil {
+		s.showMaterials(w, r, err.Error())
+		return
+	}
+	mat, err := s.MaterialRepo.CreateMaterial(name, finish, density, unit)
+	if err != nil {
+		s.showMaterials(w, r, "Failed to create material: "+err.Error())
+		return
+	}
+	log.Printf("[INFO] %s created material %s", user.LoginName, mat.MaterialName)
+
+	http.Redirect(w, r, "/materials", http.StatusSeeOther)
+}
+
+// MaterialPost changes a material, the weights of its models follow
+func (s *Server) MaterialPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !canManageMaterials(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "materialID"))
+	if err != nil {
+		http.Error(w, "Invalid material ID", http.StatusBadRequest)
+		return
+	}
+
+	name, finish, density, unit, err := materialForm(r)
+	if err != nil {
+		s.showMaterials(w, r, err.Error())
+		return
+	}
+	if err := s.MaterialRepo.UpdateMaterial(uint(id), name, finish, density, unit); err != nil {
+		if errors.Is(err, db.ErrMaterialNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		s.showMaterials(w, r, "Failed to update material: "+err.Error())
+		return
+	}
+	log.Printf("[INFO] %s updated material %d", user.LoginName, id)
+
+	http.Redirect(w, r, "/materials", http.StatusSeeOther)
+}
+
+// MaterialDeletePost removes a material that no model uses
+func (s *Server) MaterialDeletePost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !canManageMaterials(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "materialID"))
+	if err != nil {
+		http.Error(w, "Invalid material ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.MaterialRepo.DeleteMaterial(uint(id)); err != nil {
+		if errors.Is(err, db.ErrMaterialInUse) {
+			s.showMaterials(w, r, "The material is used by models")
+			return
+		}
+		log.Printf("[ERROR] Failed to delete material %d: %v", id, err)
+		http.Error(w, "Failed to delete material", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[INFO] %s deleted material %d", user.LoginName, id)
+
+	http.Redirect(w, r, "/materials", http.StatusSeeOther)
+}
@@ -8,7 +8,9 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"strings"
 
+	"github.com/grd/FreePDM/internal/db"
 	"github.com/grd/FreePDM/internal/shared"
 )
 
@@ -40,11 +42,29 @@ func (s *Server) RequireLoginChi(next http.Handler) http.Handler {
 			return
 		}
 
+		// A new, reset or expired password has to be changed first
+		if user.MustChangePassword && user.AuthSource != db.AuthSourceOIDC &&
+			r.URL.Path != "/change-password" {
+			if apiRequest(r) {
+				writeJsonError(w, "The password has to be changed first, log in with the browser", http.StatusForbidden)
+				return
+			}
+			http.Redirect(w, r, "/change-password", http.StatusSeeOther)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), ctxCurrentUser, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// apiRequest tells whether a request comes from a client of the JSON API,
+// which can't follow the redirects to the web pages.
+func apiRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/command" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
 // RequireAdminChi allows only admin users
 func (s *Server) RequireAdminChi(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -3,3 +3,56 @@
 // license that can be found in the LICENSE file.
 
 package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/db"
+)
+
+// ItemModelMaterialPost sets the material of a model of an item, which
+// updates the weight of the model
+func (s *Server) ItemModelMaterialPost(w http.ResponseWriter, r *http.Request) {
+	user, item, ok := s.writableItem(w, r)
+	if !ok {
+		return
+	}
+
+	modelID, err := strconv.Atoi(chi.URLParam(r, "modelID"))
+	if err != nil {
+		http.Error(w, "Invalid model ID", http.StatusBadRequest)
+		return
+	}
+	found := false
+	for _, m := range item.Models {
+		found = found || m.ID == uint(modelID)
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	var materialID *uint
+	if id, err := strconv.Atoi(r.FormValue("material_id")); err == nil && id > 0 {
+		mid := uint(id)
+		materialID = &mid
+	}
+
+	if err := s.MaterialRepo.AssignMaterial(uint(modelID), materialID); err != nil {
+		if errors.Is(err, db.ErrMaterialNotFound) {
+			s.showItem(w, r, "Unknown material")
+			return
+		}
+		log.Printf("[ERROR] Failed to set the material of model %d: %v", modelID, err)
+		s.showItem(w, r, "Failed to set the material")
+		return
+	}
+	log.Printf("[INFO] %s changed the material of model %d", user.LoginName, modelID)
+
+	http.Redirect(w, r, fmt.Sprint("/items/", item.ID), http.StatusSeeOther)
+}
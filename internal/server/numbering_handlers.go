@@ -0,0 +1,151 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/db"
+)
+
+// SchemeRow is one line of the numbering overview
+type SchemeRow struct {
+	Scheme  db.PdmNumberScheme
+	Project string
+	Example string
+	Issued  []db.PdmIssuedNumber
+}
+
+// AdminNumberingGet shows the numbering schemes
+func (s *Server) AdminNumberingGet(w http.ResponseWriter, r *http.Request) {
+	s.showNumbering(w, r, "", nil)
+}
+
+func (s *Server) showNumbering(w http.ResponseWriter, r *http.Request, errMsg string, reserved []string) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	schemes, err := s.NumberRepo.Schemes()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load numbering schemes: %v", err)
+		http.Error(w, "Failed to load numbering schemes", http.StatusInternalServerError)
+		return
+	}
+	projects, err := s.ProjectRepo.AllProjects()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load projects: %v", err)
+	}
+
+	projectNumbers := map[uint]string{}
+	for _, p := range projects {
+		projectNumbers[p.ID] = p.ProjectNumber
+	}
+
+	rows := make([]SchemeRow, len(schemes))
+	for i, sc := range schemes {
+		rows[i].Scheme = sc
+		rows[i].Project = projectNumbers[sc.ProjectID]
+
+		vars := db.NumberVars{Project: rows[i].Project, Type: sc.ItemType, Seq: sc.NextSeq}
+		if vars.Project == "" {
+			vars.Project = "{project}"
+		}
+		if vars.Type == "" {
+			vars.Type = "{type}"
+		}
+		rows[i].Example, _ = db.FormatNumber(sc.Pattern, vars)
+		rows[i].Issued, _ = s.NumberRepo.IssuedNumbers(sc.ID, 5)
+	}
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Schemes":         rows,
+		"Projects":        projects,
+		"Reserved":        reserved,
+		"Error":           errMsg,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/admin",
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "admin-numbering.html", data)
+}
+
+// AdminNumberingPost creates a numbering scheme
+func (s *Server) AdminNumberingPost(w http.ResponseWriter, r *http.Request) {
+	projectID, _ := strconv.Atoi(r.FormValue("project_id"))
+	start, _ := strconv.ParseInt(r.FormValue("start"), 10, 64)
+
+	scheme, err := s.NumberRepo.CreateScheme(r.FormValue("name"), strings.TrimSpace(r.FormValue("pattern")),
+		uint(projectID), r.FormValue("item_type"), start)
+	if err != nil {
+		s.showNumbering(w, r, "Failed to create scheme: "+err.Error(), nil)
+		return
+	}
+	log.Printf("[INFO] Created numbering scheme %s with pattern %s", scheme.Name, scheme.Pattern)
+
+	http.Redirect(w, r, "/admin/numbering", http.StatusSeeOther)
+}
+
+// AdminNumberingDeletePost removes a numbering scheme
+func (s *Server) AdminNumberingDeletePost(w http.ResponseWriter, r *http.Request) {
+	schemeID, err := strconv.Atoi(chi.URLParam(r, "schemeID"))
+	if err != nil {
+		http.Error(w, "Invalid scheme ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.NumberRepo.DeleteScheme(uint(schemeID)); err != nil {
+		log.Printf("[ERROR] Failed to delete numbering scheme %d: %v", schemeID, err)
+		http.Error(w, "Failed to delete scheme", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/numbering", http.StatusSeeOther)
+}
+
+// AdminNumberingReservePost reserves a block of numbers of a scheme for a user
+func (s *Server) AdminNumberingReservePost(w http.ResponseWriter, r *http.Request) {
+	schemeID, err := strconv.Atoi(chi.URLParam(r, "schemeID"))
+	if err != nil {
+		http.Error(w, "Invalid scheme ID", http.StatusBadRequest)
+		return
+	}
+
+	count, err := strconv.Atoi(r.FormValue("count"))
+	if err != nil || count < 1 || count > maxReservation {
+		s.showNumbering(w, r, "Invalid count", nil)
+		return
+	}
+
+	issuedTo := strings.TrimSpace(r.FormValue("login_name"))
+	if issuedTo == "" {
+		admin, _ := s.getSessionUser(r)
+		if admin != nil {
+			issuedTo = admin.LoginName
+		}
+	} else if _, err := s.UserRepo.LoadUser(issuedTo); err != nil {
+		s.showNumbering(w, r, "Unknown user "+issuedTo, nil)
+		return
+	}
+
+	numbers, err := s.NumberRepo.Reserve(uint(schemeID), db.NumberVars{Type: r.FormValue("item_type")}, count, issuedTo)
+	if err != nil {
+		s.showNumbering(w, r, "Failed to reserve numbers: "+err.Error(), nil)
+		return
+	}
+	log.Printf("[INFO] Reserved %d numbers of scheme %d for %s", count, schemeID, issuedTo)
+
+	s.showNumbering(w, r, "", numbers)
+}
@@ -0,0 +1,127 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/grd/FreePDM/internal/auth"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/shared"
+)
+
+// OIDCLoginGet starts the single sign-on: the state, nonce and PKCE verifier
+// are kept in the session and the browser is sent to the identity provider.
+func (s *Server) OIDCLoginGet(w http.ResponseWriter, r *http.Request) {
+	if s.OIDC == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	state, nonce, verifier := auth.RandomToken(), auth.RandomToken(), auth.RandomToken()
+
+	sess, _ := s.SessionStore.Get(r, shared.SessionName)
+	sess.Values["oidc_state"] = state
+	sess.Values["oidc_nonce"] = nonce
+	sess.Values["oidc_verifier"] = verifier
+	if err := sess.Save(r, w); err != nil {
+		http.Error(w, "Session save failed", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, s.OIDC.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// OIDCCallbackGet handles the redirect back from the identity provider.
+func (s *Server) OIDCCallbackGet(w http.ResponseWriter, r *http.Request) {
+	if s.OIDC == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	sess, _ := s.SessionStore.Get(r, shared.SessionName)
+	state, _ := sess.Values["oidc_state"].(string)
+	nonce, _ := sess.Values["oidc_nonce"].(string)
+	verifier, _ := sess.Values["oidc_verifier"].(string)
+
+	// the values are for one attempt only
+	delete(sess.Values, "oidc_state")
+	delete(sess.Values, "oidc_nonce")
+	delete(sess.Values, "oidc_verifier")
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		log.Printf("[ERROR] SSO login refused by identity provider: %s %s", e, r.URL.Query().Get("error_description"))
+		http.Error(w, "Single sign-on failed", http.StatusUnauthorized)
+		return
+	}
+
+	if state == "" || r.URL.Query().Get("state") != state {
+		http.Error(w, "Invalid SSO state", http.StatusBadRequest)
+		return
+	}
+
+	id, err := s.OIDC.Exchange(r.Context(), r.URL.Query().Get("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("[ERROR] SSO login: %v", err)
+		http.Error(w, "Single sign-on failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.oidcUser(id)
+	if err != nil {
+		log.Printf("[ERROR] SSO login of %s: %v", id.LoginName, err)
+		http.Error(w, "Single sign-on failed", http.StatusForbidden)
+		return
+	}
+
+	ip := clientIP(r)
+	if err := s.checkAccountStatus(user, ip); err != nil {
+		s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventLoginFailed, ip, err.Error())
+		log.Printf("[WARN] SSO login of %s: %v", user.LoginName, err)
+		http.Error(w, "Single sign-on failed", http.StatusForbidden)
+		return
+	}
+
+	log.Printf("[INFO] SSO login of %s", user.LoginName)
+	s.finishLogin(w, r, user, "sso")
+}
+
+// oidcUser looks up (or creates) the PDM user that belongs to the identity
+// and updates it with the claims of the token.
+func (s *Server) oidcUser(id *auth.OIDCIdentity) (*db.PdmUser, error) {
+	user, err := s.UserRepo.LoadUserByExternalSubject(id.Subject)
+	if errors.Is(err, db.ErrUserNotFound) {
+		user, err = s.UserRepo.LoadUser(id.LoginName)
+		switch {
+		case err == nil:
+			// Link an existing local account, but only when the provider
+			// vouches for the same e-mail address and has verified it.
+			if id.Email == "" || !id.EmailVerified || !strings.EqualFold(user.EmailAddress, id.Email) {
+				return nil, errors.New("login name is taken by a local account")
+			}
+		case errors.Is(err, db.ErrUserNotFound):
+			if !s.OIDC.Config.AutoCreate {
+				return nil, errors.New("unknown user")
+			}
+			if id.LoginName == "" || id.Email == "" {
+				return nil, errors.New("token has no login name or e-mail address")
+			}
+			user = &db.PdmUser{Roles: s.OIDC.Config.DefaultRoles}
+		default:
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	id.Apply(user)
+	if err := s.UserRepo.SaveExternalUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
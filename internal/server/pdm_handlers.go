@@ -6,61 +6,119 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
+	"slices"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/auth"
 	"github.com/grd/FreePDM/internal/config"
+	"github.com/grd/FreePDM/internal/db"
 	"github.com/grd/FreePDM/internal/shared"
 	"github.com/grd/FreePDM/internal/util"
 	vfs "github.com/grd/FreePDM/internal/vault/localfs"
 )
 
-func CommandHandler(w http.ResponseWriter, r *http.Request) {
+// CommandHandler runs a vault command for the logged in user. The access
+// control list of the vault decides what the user may do.
+func (s *Server) CommandHandler(w http.ResponseWriter, r *http.Request) {
 	var req shared.CommandRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJsonError(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	fmt.Println(req)
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
-	// Using the right command
+	// Commands without a vault
 	switch req.Command {
 	case "root":
+		if !user.HasRole(string(db.Admin)) {
+			writeJsonError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
 		handleRoot(w)
+		return
 	case "list":
-		handleList(w)
+		s.handleList(w, user)
+		return
+	case "reserve":
+		if !auth.IsAdmin(user) && !user.HasPermission(db.CreateItem) {
+			writeJsonError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		s.handleReserve(w, user, req.Params)
+		return
+	}
+
+	if !validVaultName(req.Vault) {
+		writeJsonError(w, "Invalid vault: "+req.Vault, http.StatusBadRequest)
+		return
+	}
+	access, err := s.vaultAccess(user, req.Vault)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load the ACL of vault %s: %v", req.Vault, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	dir, ok := req.Params["path"]
+	if !ok {
+		writeJsonError(w, "Missing parameters", http.StatusBadRequest)
+		return
+	}
+	dir = db.CleanVaultPath(dir)
+
+	// Using the right command
+	switch req.Command {
 	case "direxists":
-		path, ok := req.Params["path"]
-		if !ok {
-			writeJsonError(w, "Missing parameters", http.StatusBadRequest)
+		if !access.CanSee(dir) {
+			writeJsonError(w, "Forbidden", http.StatusForbidden)
+			return
 		}
-		handleDirexists(w, req.User, req.Vault, path)
+		handleDirexists(w, user.LoginName, req.Vault, dir)
 	case "ls":
-		path, ok := req.Params["path"]
-		if !ok {
-			writeJsonError(w, "Missing parameters", http.StatusBadRequest)
+		if !access.CanSee(dir) {
+			writeJsonError(w, "Forbidden", http.StatusForbidden)
+			return
 		}
-		handleLs(w, req.User, req.Vault, path)
+		handleLs(w, user.LoginName, req.Vault, dir, access)
 	case "allocate":
-		path, ok := req.Params["path"]
-		if !ok {
-			writeJsonError(w, "Missing parameters", http.StatusBadRequest)
+		if !access.Can(dir, db.AclWrite) {
+			writeJsonError(w, "Forbidden", http.StatusForbidden)
+			return
 		}
-		handleAllocate(w, req.User, req.Vault, path)
-
-	// case "rename":
-	// 	// Get 'vault', 'src' and 'dst' out of params map
-	// 	src := req.Params["src"]
-	// 	dst := req.Params["dst"]
-	// 	handleRename(w, src, dst)
+		s.handleAllocate(w, user.LoginName, req.Vault, dir, req.Params)
+	case "versions", "checkout", "checkin", "undocheckout", "newversion":
+		handleVersion(w, user.LoginName, req.Vault, dir, req.Command, req.Params, access)
+	case "tree":
+		if !access.CanSee(dir) {
+			writeJsonError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		handleTree(w, user.LoginName, req.Vault, dir, access)
+	case "mkdir":
+		handleMkdir(w, user.LoginName, req.Vault, dir, req.Params, access)
+	case "rmdir":
+		handleRmdir(w, user.LoginName, req.Vault, dir, req.Params, access)
+	case "rm":
+		handleRemove(w, user, req.Vault, dir, req.Params, access)
+	case "rename", "copy":
+		s.handleRenameCopy(w, user.LoginName, req.Vault, req.Command, req.Params, access)
+	case "assign":
+		handleAssign(w, user.LoginName, req.Vault, req.Params, access)
+	case "info":
+		handleInfo(w, user.LoginName, req.Vault, dir, req.Params, access)
 
 	default:
 		writeJsonError(w, "Unknown command: "+req.Command, http.StatusBadRequest)
@@ -82,11 +140,11 @@ func handleRoot(w http.ResponseWriter) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// Shows the existing vaults
-func handleList(w http.ResponseWriter) {
+// Shows the existing vaults that the user has access to
+func (s *Server) handleList(w http.ResponseWriter, user *db.PdmUser) {
 	var resp shared.CommandResponse
 
-	list, err := vfs.ListVaults()
+	list, err := s.visibleVaults(user)
 	if err != nil {
 		resp = shared.CommandResponse{
 			Error: "Failed to show the list of vaults",
@@ -102,9 +160,9 @@ func handleList(w http.ResponseWriter) {
 func handleDirexists(w http.ResponseWriter, user, vault, dir string) {
 	var resp shared.CommandResponse
 
-	fs, err := vfs.NewFileSystem(vault, user)
-	if err != nil {
-		log.Fatalf("unable to access the filesystem : %s", err)
+	fs, ok := openVault(w, user, vault)
+	if !ok {
+		return
 	}
 
 	if ok := fs.DirExists(dir); !ok {
@@ -119,25 +177,30 @@ func handleDirexists(w http.ResponseWriter, user, vault, dir string) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func handleLs(w http.ResponseWriter, user, vault, path string) {
+func handleLs(w http.ResponseWriter, user, vault, path string, access *db.Access) {
 	var resp shared.CommandResponse
 
-	fs, err := vfs.NewFileSystem(vault, user)
-	if err != nil {
-		log.Fatalf("unable to access the filesystem : %s", err)
+	fs, ok := openVault(w, user, vault)
+	if !ok {
+		return
 	}
 
-	fmt.Printf("path = %s\n", path)
-
 	list, err := fs.ListDir(path)
 	if err != nil {
 		resp = shared.CommandResponse{
 			Error: "Failed to show directory",
 		}
 	} else {
-		files := make([]string, len(list))
-		for i, item := range list {
-			files[i] = item.Name()
+		files := make([]string, 0, len(list))
+		for _, item := range list {
+			// containers are listed by name, but stored by number
+			entry := item.Name()
+			if item.ContainerNumber() != "" {
+				entry = item.ContainerNumber()
+			}
+			if access.CanSee(filepath.Join(path, entry)) {
+				files = append(files, item.Name())
+			}
 		}
 		resp = shared.CommandResponse{
 			Data: files,
@@ -146,146 +209,393 @@ func handleLs(w http.ResponseWriter, user, vault, path string) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func handleAllocate(w http.ResponseWriter, user, vault, path string) {
+// Allocates a container. When a numbering scheme applies the container
+// gets a part number: the reserved number of the "number" parameter, or a
+// new one of the scheme of the project and item "type".
+func (s *Server) handleAllocate(w http.ResponseWriter, user, vault, path string, params map[string]string) {
 	var resp shared.CommandResponse
 
-	fs, err := vfs.NewFileSystem(vault, user)
-	if err != nil {
-		log.Fatalf("unable to access the filesystem : %s", err)
+	fs, ok := openVault(w, user, vault)
+	if !ok {
+		return
+	}
+
+	number, issued, err := s.partNumber(user, vault, path, params)
+	if err != nil && !errors.Is(err, db.ErrSchemeNotFound) {
+		log.Printf("[ERROR] No part number for %s/%s: %v", vault, path, err)
+		json.NewEncoder(w).Encode(shared.CommandResponse{Error: "Failed to issue a part number: " + err.Error()})
+		return
 	}
 
-	bla, err := fs.Allocate(path)
+	var fl *vfs.FileList
+	if number == "" {
+		fl, err = fs.Allocate(path)
+	} else {
+		fl, err = fs.AllocateWithNumber(path, number)
+	}
 	if err != nil {
+		log.Printf("[ERROR] Failed to allocate a container in %s/%s: %v", vault, path, err)
+		if issued {
+			if err := s.NumberRepo.Release(number, user); err != nil {
+				log.Printf("[ERROR] Failed to release part number %s: %v", number, err)
+			}
+		}
 		resp = shared.CommandResponse{
 			Error: "Failed to allocate a container",
 		}
 	} else {
+		data := util.StringToSlice(fl.ContainerNumber)
+		if number != "" {
+			if err := s.NumberRepo.Assign(number, vault, fl.ContainerNumber); err != nil {
+				log.Printf("[ERROR] Failed to record container of %s: %v", number, err)
+			}
+			data = append(data, number)
+		}
 		resp = shared.CommandResponse{
-			Data: util.StringToSlice(bla.ContainerNumber),
+			Data: data,
 		}
 	}
 	json.NewEncoder(w).Encode(resp)
 }
 
-// VaultsListGet shows all vaults inside the filesystem
-func (s *Server) VaultsListGet(w http.ResponseWriter, r *http.Request) {
-	vaultRoot := config.VaultsDir()
-	dirs, err := os.ReadDir(vaultRoot)
+// paramContainer returns the container of the "container" parameter, or
+// else of the file name of the "file" parameter, in the directory dir.
+func paramContainer(fs *vfs.FileSystem, dir string, params map[string]string) (vfs.FileList, error) {
+	if number := params["container"]; number != "" {
+		fl, err := fs.ContainerFileList(number)
+		if err != nil || db.CleanVaultPath(fl.Path) != dir {
+			return fl, fmt.Errorf("container %s not found in %s", number, dir)
+		}
+		return fl, nil
+	}
+	fl, err := fs.GetItem(dir, params["file"])
 	if err != nil {
-		http.Error(w, "Unable to read vaults directory", http.StatusInternalServerError)
-		log.Printf("[ERROR] Unable to read the root vault: %v", err)
+		return fl, fmt.Errorf("file %s not found in %s", params["file"], dir)
+	}
+	return fl, nil
+}
+
+// Runs a version command on the container of the "container" or "file"
+// parameter in the directory path. Reading the versions needs the read
+// permission, the other commands need the checkout permission. A version
+// that is checked out by someone else is a conflict.
+func handleVersion(w http.ResponseWriter, user, vault, dir, command string, params map[string]string, access *db.Access) {
+	fs, ok := openVault(w, user, vault)
+	if !ok {
+		return
+	}
+
+	fl, err := paramContainer(fs, dir, params)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	number := fl.ContainerNumber
+
+	perm := db.AclCheckout
+	if command == "versions" {
+		perm = db.AclRead
+	}
+	if !access.Can(path.Join(dir, number), perm) {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	var vaults []string
-	for _, d := range dirs {
-		if d.IsDir() && !strings.HasPrefix(d.Name(), ".") {
-			vaults = append(vaults, d.Name())
+	versions, err := fs.Versions(fl)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var version vfs.FileVersion
+	switch {
+	case command == "versions" || command == "newversion":
+	case params["version"] != "":
+		nr, err := util.Atoi16(params["version"])
+		i := slices.IndexFunc(versions, func(v vfs.FileVersion) bool { return v.Number == nr })
+		if err != nil || i < 0 {
+			writeJsonError(w, "Version "+params["version"]+" not found", http.StatusNotFound)
+			return
+		}
+		version = versions[i]
+	case command == "checkin" || command == "undocheckout":
+		// The version that the user checked out
+		i := slices.IndexFunc(versions, func(v vfs.FileVersion) bool { return fs.IsLocked(number, v) == user })
+		if i < 0 {
+			writeJsonError(w, fl.Name+" is not checked out by "+user, http.StatusConflict)
+			return
 		}
+		version = versions[i]
+	case len(versions) == 0:
+		writeJsonError(w, fl.Name+" has no versions", http.StatusNotFound)
+		return
+	default:
+		version = versions[len(versions)-1]
 	}
 
-	data := map[string]any{
-		"Vaults":          vaults,
-		"Title":           "Vaults",
-		"BackButtonShow":  true,
-		"BackButtonLink":  "/dashboard",
-		"MenuButtonShow":  false,
-		"ThemePreference": "system",
+	var resp shared.CommandResponse
+	switch command {
+	case "versions":
+		for _, v := range versions {
+			info := shared.VersionInfo{Number: v.Number, Pretty: v.Pretty, Date: v.Date,
+				LockedBy: fs.IsLocked(number, v), Description: fs.VersionDescription(fl, v)}
+			resp.Data = append(resp.Data, info.String())
+		}
+
+	case "checkout":
+		if by := fs.IsLocked(number, version); by != "" {
+			writeJsonError(w, fmt.Sprintf("Version %d of %s is checked out by %s", version.Number, fl.Name, by), http.StatusConflict)
+			return
+		}
+		err = fs.CheckOut(fl, version)
+
+	case "checkin":
+		if by := fs.IsLocked(number, version); by != user {
+			writeJsonError(w, fmt.Sprintf("Version %d of %s is not checked out by %s", version.Number, fl.Name, user), http.StatusConflict)
+			return
+		}
+		if err := checkInData(fs, fl, version, params); err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = fs.CheckIn(fl, version, params["description"], params["long_description"])
+
+	case "undocheckout":
+		if by := fs.IsLocked(number, version); by != user {
+			writeJsonError(w, fmt.Sprintf("Version %d of %s is not checked out by %s", version.Number, fl.Name, user), http.StatusConflict)
+			return
+		}
+		err = fs.UndoCheckOut(fl, version)
+
+	case "newversion":
+		if by := fs.IsLockedItem(number); by != "" {
+			writeJsonError(w, fmt.Sprintf("%s is checked out by %s", fl.Name, by), http.StatusConflict)
+			return
+		}
+		var v *vfs.FileVersion
+		if v, err = fs.NewVersion(fl); err == nil {
+			version = *v
+		}
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to %s %s/%s: %v", command, vault, number, err)
+		writeJsonError(w, "Failed to "+command+": "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	err = s.ExecuteTemplate(w, "vaults-list.html", data)
+	if command != "versions" {
+		resp.Data = []string{util.I16toa(version.Number)}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkInData stores the parameters of a check in with the version: the
+// "properties", for instance the volume and material of a model, which the
+// database turns into the weight, and the "references" to the containers
+// that the version uses, for the where-used queries.
+func checkInData(fs *vfs.FileSystem, fl vfs.FileList, version vfs.FileVersion, params map[string]string) error {
+	if params["properties"] != "" {
+		props, err := shared.ParsePropertiesParam(params["properties"])
+		if err != nil {
+			return err
+		}
+		if volume := props[db.PropertyVolume]; volume != "" {
+			if _, _, err := db.ParseVolume(volume); err != nil {
+				return err
+			}
+		}
+		if err := fs.UpdateProperties(fl, version, props); err != nil {
+			return err
+		}
+	}
+
+	if params["references"] != "" {
+		list, err := shared.ParseReferencesParam(params["references"])
+		if err != nil {
+			return err
+		}
+		refs := make([]vfs.FileReference, len(list))
+		for i, ref := range list {
+			refs[i] = vfs.FileReference{Vault: ref.Vault, ContainerNumber: ref.Container, Version: ref.Version}
+		}
+		if err := fs.SetReferences(fl, version, refs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partNumber returns the part number for a new container. issued tells
+// whether the number is new, and not one that the user reserved before.
+func (s *Server) partNumber(user, vault, path string, params map[string]string) (number string, issued bool, err error) {
+	if number := params["number"]; number != "" {
+		return number, false, s.NumberRepo.ClaimReserved(number, user)
+	}
+
+	projectID, err := s.paramProject(vault, path, params)
 	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
+		return "", false, err
 	}
+	number, err = s.NumberRepo.Next(projectID, params["type"], user)
+	return number, err == nil, err
 }
 
-func (s *Server) VaultBrowseGet(w http.ResponseWriter, r *http.Request) {
-	vaultName := chi.URLParam(r, "vaultName")
-	subPath := chi.URLParam(r, "*") // alles ná de vaultName
-	subPath = strings.TrimPrefix(subPath, "/")
+// paramProject returns the project of the "project" parameter, or else the
+// project that is linked to the vault directory.
+func (s *Server) paramProject(vault, path string, params map[string]string) (uint, error) {
+	if number := params["project"]; number != "" {
+		return s.ProjectRepo.GetId(number)
+	}
+	if vault == "" {
+		return 0, nil
+	}
 
-	user, err := s.getSessionUser(r)
+	proj, err := s.ProjectRepo.ProjectForPath(vault, path)
+	if errors.Is(err, db.ErrProjectNotFound) {
+		return 0, nil
+	}
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, err
+	}
+	return proj.ID, nil
+}
+
+// Reserves a block of part numbers for later use. The numbers of a project
+// are for its members.
+func (s *Server) handleReserve(w http.ResponseWriter, user *db.PdmUser, params map[string]string) {
+	count, err := strconv.Atoi(params["count"])
+	if err != nil || count < 1 || count > maxReservation {
+		writeJsonError(w, fmt.Sprintf("count must be 1 to %d", maxReservation), http.StatusBadRequest)
 		return
 	}
 
-	fs, err := vfs.NewFileSystem(vaultName, user.LoginName)
+	projectID, err := s.paramProject("", "", params)
 	if err != nil {
-		log.Printf("[ERROR] Failed to create FS for vault=%s user=%s: %v", vaultName, user.LoginName, err)
-		http.Error(w, "Vault init error", http.StatusInternalServerError)
+		writeJsonError(w, "Unknown project", http.StatusBadRequest)
 		return
 	}
+	if projectID != 0 && !canManageProjects(user) {
+		proj, err := s.ProjectRepo.LoadProject(projectID)
+		if err != nil {
+			writeJsonError(w, "Unknown project", http.StatusBadRequest)
+			return
+		}
+		if !slices.ContainsFunc(proj.Users, func(u *db.PdmUser) bool { return u.ID == user.ID }) {
+			writeJsonError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
 
-	fullPath := path.Join(fs.VaultDir(), subPath)
-	entries, err := os.ReadDir(fullPath)
+	var resp shared.CommandResponse
+	scheme, err := s.NumberRepo.ResolveScheme(projectID, params["type"])
+	if err == nil {
+		var vars db.NumberVars
+		if vars, err = s.NumberRepo.Vars(projectID, params["type"]); err == nil {
+			var numbers []string
+			numbers, err = s.NumberRepo.Reserve(scheme.ID, vars, count, user.LoginName)
+			resp.Data = numbers
+		}
+	}
 	if err != nil {
-		http.Error(w, "Read error", http.StatusInternalServerError)
+		resp.Error = "Failed to reserve numbers: " + err.Error()
+	} else {
+		log.Printf("[INFO] Reserved %d numbers of scheme %s for %s", count, scheme.Name, user.LoginName)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// The largest block of numbers that can be reserved at once
+const maxReservation = 1000
+
+// VaultsListGet shows the vaults that the user has access to
+func (s *Server) VaultsListGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	var results []VaultEntry
-	for _, entry := range entries {
-		results = append(results, VaultEntry{
-			Name:    entry.Name(),
-			IsDir:   entry.IsDir(),
-			NextURL: path.Join("/vaults", vaultName, subPath, entry.Name()),
-		})
+	vaults, err := s.visibleVaults(user)
+	if err != nil {
+		http.Error(w, "Unable to read vaults directory", http.StatusInternalServerError)
+		log.Printf("[ERROR] Unable to read the root vault: %v", err)
+		return
 	}
 
 	data := map[string]any{
-		"VaultName":      vaultName,
-		"SubPath":        subPath,
-		"Entries":        results,
-		"BackButtonShow": true,
-		"BackButtonLink": "/vaults/list",
-		"MenuButtonShow": false,
+		"User":            user,
+		"Vaults":          vaults,
+		"Title":           "Vaults",
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/dashboard",
+		"MenuButtonShow":  false,
+		"ThemePreference": user.ThemePreference,
 	}
 
-	if err := s.ExecuteTemplate(w, "vaults-browse.html", data); err != nil {
+	err = s.ExecuteTemplate(w, "vaults-list.html", data)
+	if err != nil {
 		http.Error(w, "Template error", http.StatusInternalServerError)
 	}
 }
 
-func (s *Server) VaultPathBrowseGet(w http.ResponseWriter, r *http.Request) {
+// VaultBrowseGet shows a directory of a vault, without the entries that the
+// user has no access to.
+func (s *Server) VaultBrowseGet(w http.ResponseWriter, r *http.Request) {
 	vaultName := chi.URLParam(r, "vaultName")
-	subPath := chi.URLParam(r, "*")
+	subPath := db.CleanVaultPath(chi.URLParam(r, "*")) // everything after the vaultName
 
-	// Clean vault path
-	cleanPath := path.Join("vaults", vaultName, subPath)
-	fullPath := filepath.Join(config.Conf.VaultsDirectory, cleanPath)
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !validVaultName(vaultName) {
+		http.NotFound(w, r)
+		return
+	}
 
-	entries, err := fs.ReadDir(*s.FS, fullPath)
+	access, err := s.vaultAccess(user, vaultName)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load the ACL of vault %s: %v", vaultName, err)
+		http.Error(w, "Vault init error", http.StatusInternalServerError)
+		return
+	}
+	if !access.CanSee(subPath) {
+		log.Printf("[INFO] %s has no access to %s/%s", user.LoginName, vaultName, subPath)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	fullPath := filepath.Join(config.VaultsDir(), vaultName, subPath)
+	entries, err := os.ReadDir(fullPath)
 	if err != nil {
 		http.Error(w, "Unable to read vault path", http.StatusNotFound)
 		log.Printf("[ERROR] Cannot read vault path %q: %v", fullPath, err)
 		return
 	}
 
-	var files []VaultEntry
+	var results []VaultEntry
 	for _, entry := range entries {
-		name := entry.Name()
-		entryPath := path.Join("/vaults", vaultName, subPath, name)
-
-		// Ensure directories end with a slash for UX clarity (optional)
-		if entry.IsDir() {
-			entryPath += "/"
+		if !access.CanSee(path.Join(subPath, entry.Name())) {
+			continue
 		}
-
-		files = append(files, VaultEntry{
-			Name:    name,
+		results = append(results, VaultEntry{
+			Name:    entry.Name(),
 			IsDir:   entry.IsDir(),
-			NextURL: entryPath,
+			NextURL: path.Join("/vaults", vaultName, subPath, entry.Name()),
 		})
 	}
 
 	data := map[string]any{
-		"VaultName":      vaultName,
-		"SubPath":        subPath,
-		"Entries":        files,
-		"BackButtonShow": true,
-		"BackButtonLink": "/vaults/list",
-		"MenuButtonShow": false,
+		"User":            user,
+		"VaultName":       vaultName,
+		"SubPath":         subPath,
+		"Entries":         results,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/vaults/list",
+		"MenuButtonShow":  false,
+		"ThemePreference": user.ThemePreference,
 	}
 
 	if err := s.ExecuteTemplate(w, "vaults-browse.html", data); err != nil {
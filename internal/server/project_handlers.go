@@ -5,30 +5,396 @@
 package server
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/grd/FreePDM/internal/auth"
-	"github.com/grd/FreePDM/internal/shared"
+	"github.com/grd/FreePDM/internal/db"
 )
 
-func (s *Server) HandleProjectManagement(w http.ResponseWriter, r *http.Request) {
-	loginname, err := shared.GetSessionLoginname(r)
+// canManageProjects tells whether the user creates and changes projects
+func canManageProjects(user *db.PdmUser) bool {
+	return auth.IsAdmin(user) || user.HasPermission(db.CreateProject)
+}
+
+// ProjectRow is one line of the project overview
+type ProjectRow struct {
+	Project  db.PdmProject
+	Progress db.ProjectProgress
+}
+
+// ProjectsGet shows the projects. Project leads and admins see all
+// projects, the others the projects they are a member of.
+func (s *Server) ProjectsGet(w http.ResponseWriter, r *http.Request) {
+	s.showProjects(w, r, "")
+}
+
+func (s *Server) showProjects(w http.ResponseWriter, r *http.Request, errMsg string) {
+	user, err := s.getSessionUser(r)
 	if err != nil {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	user, err := s.UserRepo.LoadUser(loginname)
+	manage := canManageProjects(user)
+
+	var projects []db.PdmProject
+	if manage {
+		projects, err = s.ProjectRepo.AllProjects()
+	} else {
+		projects, err = s.ProjectRepo.ProjectsOfUser(user.ID)
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to load projects: %v", err)
+		http.Error(w, "Failed to load projects", http.StatusInternalServerError)
+		return
+	}
+
+	rows := make([]ProjectRow, len(projects))
+	for i, p := range projects {
+		rows[i].Project = p
+		if rows[i].Progress, err = s.ProjectRepo.Progress(&p); err != nil {
+			log.Printf("[ERROR] Failed to compute progress of project %s: %v", p.ProjectNumber, err)
+		}
+	}
+
+	vaults, _ := allVaults()
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Projects":        rows,
+		"CanManage":       manage,
+		"Vaults":          vaults,
+		"Error":           errMsg,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/dashboard",
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "project-management.html", data)
+}
+
+// ProjectNewPost creates a project
+func (s *Server) ProjectNewPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !canManageProjects(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	vault := r.FormValue("vault")
+	if vault != "" && !validVaultName(vault) {
+		s.showProjects(w, r, "Invalid vault "+vault)
+		return
+	}
+	if err := s.canLinkProject(user, vault, r.FormValue("path")); err != nil {
+		s.showProjects(w, r, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		s.showProjects(w, r, "The project needs a name")
+		return
+	}
+
+	proj, err := s.ProjectRepo.NewProject(strings.TrimSpace(r.FormValue("number")), name, db.New, vault, r.FormValue("path"))
+	if err != nil {
+		s.showProjects(w, r, "Failed to create project: "+err.Error())
+		return
+	}
+	log.Printf("[INFO] %s created project %s %s", user.LoginName, proj.ProjectNumber, proj.ProjectName)
+
+	// The creator is the first member
+	if err := s.ProjectRepo.AddUserToProject(proj.ID, user.ID, defaultProjectPermissions()); err != nil {
+		log.Printf("[ERROR] Failed to add %s to project %s: %v", user.LoginName, proj.ProjectNumber, err)
+	}
+
+	http.Redirect(w, r, fmt.Sprint("/projects/", proj.ID), http.StatusSeeOther)
+}
+
+func defaultProjectPermissions() []db.AclPermission {
+	return []db.AclPermission{db.AclRead, db.AclWrite, db.AclCheckout}
+}
+
+// projectPermissions are the permissions that a project can give its
+// members. Admin is not one of them, that is for the access control list.
+func projectPermissions() []db.AclPermission {
+	return slices.DeleteFunc(db.AclPermissions(), func(p db.AclPermission) bool { return p == db.AclAdmin })
+}
+
+// canLinkProject tells whether the user may link a project to a vault
+// directory. The members get their access through the project, so only an
+// admin of the directory can link it.
+func (s *Server) canLinkProject(user *db.PdmUser, vault, dir string) error {
+	if vault == "" {
+		return nil
+	}
+	access, err := s.vaultAccess(user, vault)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read the access of %s to %s: %v", user.LoginName, vault, err)
+		return fmt.Errorf("failed to read the access to vault %s", vault)
+	}
+	if !access.Can(dir, db.AclAdmin) {
+		return fmt.Errorf("you are not an admin of %s/%s", vault, db.CleanVaultPath(dir))
+	}
+	return nil
+}
+
+// projectFromURL loads the project of the {projectID} parameter, if the
+// user may see it.
+func (s *Server) projectFromURL(w http.ResponseWriter, r *http.Request, user *db.PdmUser) (*db.PdmProject, bool) {
+	projectID, err := strconv.Atoi(chi.URLParam(r, "projectID"))
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	proj, err := s.ProjectRepo.LoadProject(uint(projectID))
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	member := slices.ContainsFunc(proj.Users, func(u *db.PdmUser) bool { return u.ID == user.ID })
+	if !member && !canManageProjects(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return proj, true
+}
+
+// ProjectGet shows a project with its members, items and progress
+func (s *Server) ProjectGet(w http.ResponseWriter, r *http.Request) {
+	s.showProject(w, r, "")
+}
+
+func (s *Server) showProject(w http.ResponseWriter, r *http.Request, errMsg string) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	proj, ok := s.projectFromURL(w, r, user)
+	if !ok {
+		return
+	}
+
+	items, err := s.ProjectRepo.ProjectItems(proj.ID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load items of project %s: %v", proj.ProjectNumber, err)
+	}
+	progress, err := s.ProjectRepo.Progress(proj)
+	if err != nil {
+		log.Printf("[ERROR] Failed to compute progress of project %s: %v", proj.ProjectNumber, err)
+	}
+	vaults, _ := allVaults()
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Project":         proj,
+		"State":           proj.State(),
+		"Transitions":     db.ProjectTransitions(proj.State()),
+		"Items":           items,
+		"Progress":        progress,
+		"Vaults":          vaults,
+		"Permissions":     projectPermissions(),
+		"CanManage":       canManageProjects(user),
+		"IsAdmin":         auth.IsAdmin(user),
+		"CanAddUser":      auth.IsAdmin(user) || user.HasPermission(db.AddUserToProject),
+		"CanRemoveUser":   auth.IsAdmin(user) || user.HasPermission(db.RemoveUserFromProject),
+		"Error":           errMsg,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/projects",
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "project.html", data)
+}
+
+// ProjectPost updates name, dates and the vault link of a project
+func (s *Server) ProjectPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !canManageProjects(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	proj, ok := s.projectFromURL(w, r, user)
+	if !ok {
+		return
+	}
+
+	proj.ProjectName = strings.TrimSpace(r.FormValue("name"))
+	proj.ProjectDateStart = formDate(r.FormValue("date_start"))
+	proj.ProjectDateFinish = formDate(r.FormValue("date_finish"))
+
+	if err := s.ProjectRepo.UpdateProject(proj); err != nil {
+		s.showProject(w, r, "Failed to update project: "+err.Error())
+		return
+	}
+
+	vault, dir := r.FormValue("vault"), db.CleanVaultPath(r.FormValue("path"))
+	if vault != proj.ProjectVault || dir != proj.ProjectPath {
+		if vault != "" && !validVaultName(vault) {
+			s.showProject(w, r, "Invalid vault "+vault)
+			return
+		}
+		if err := s.canLinkProject(user, vault, dir); err != nil {
+			s.showProject(w, r, err.Error())
+			return
+		}
+		if err := s.ProjectRepo.LinkVault(proj.ID, vault, dir); err != nil {
+			s.showProject(w, r, "Failed to link vault: "+err.Error())
+			return
+		}
+		log.Printf("[INFO] %s linked project %s to %s/%s", user.LoginName, proj.ProjectNumber, vault, dir)
+	}
+
+	http.Redirect(w, r, fmt.Sprint("/projects/", proj.ID), http.StatusSeeOther)
+}
+
+// formDate parses a date field, an empty field is no date
+func formDate(value string) *time.Time {
+	t, err := time.Parse("2006-01-02", value)
 	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+	return &t
+}
+
+// ProjectStatePost moves a project to another state
+func (s *Server) ProjectStatePost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !canManageProjects(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	proj, ok := s.projectFromURL(w, r, user)
+	if !ok {
 		return
 	}
 
-	// Autorisationcheck
-	if !auth.HasAnyRole(user, "Admin", "ProjectLead") {
+	to := db.ProjectState(r.FormValue("state"))
+	if err := s.ProjectRepo.SetState(proj.ID, to); err != nil {
+		s.showProject(w, r, err.Error())
+		return
+	}
+	log.Printf("[INFO] %s moved project %s from %s to %s", user.LoginName, proj.ProjectNumber, proj.State(), to)
+
+	http.Redirect(w, r, fmt.Sprint("/projects/", proj.ID), http.StatusSeeOther)
+}
+
+// ProjectDeletePost removes a project
+func (s *Server) ProjectDeletePost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !auth.IsAdmin(user) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
+	proj, ok := s.projectFromURL(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := s.ProjectRepo.RemoveProject(proj.ID); err != nil {
+		log.Printf("[ERROR] Failed to remove project %s: %v", proj.ProjectNumber, err)
+		http.Error(w, "Failed to remove project", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[INFO] %s removed project %s", user.LoginName, proj.ProjectNumber)
+
+	http.Redirect(w, r, "/projects", http.StatusSeeOther)
+}
+
+// ProjectMemberPost adds a user to a project
+func (s *Server) ProjectMemberPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !(auth.IsAdmin(user) || user.HasPermission(db.AddUserToProject)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	proj, ok := s.projectFromURL(w, r, user)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Form parsing error", http.StatusBadRequest)
+		return
+	}
+
+	loginName := strings.TrimSpace(r.FormValue("login_name"))
+	member, err := s.UserRepo.LoadUser(loginName)
+	if err != nil {
+		s.showProject(w, r, "Unknown user "+loginName)
+		return
+	}
+
+	// Nobody gives more than they have themselves
+	var perms []db.AclPermission
+	if proj.ProjectVault != "" {
+		access, err := s.vaultAccess(user, proj.ProjectVault)
+		if err != nil {
+			log.Printf("[ERROR] Failed to read the access of %s to %s: %v", user.LoginName, proj.ProjectVault, err)
+			s.showProject(w, r, "Failed to read your access to vault "+proj.ProjectVault)
+			return
+		}
+		for _, p := range r.Form["permissions"] {
+			perm := db.AclPermission(p)
+			if !slices.Contains(projectPermissions(), perm) {
+				s.showProject(w, r, "Invalid permission "+p)
+				return
+			}
+			if !access.Can(proj.ProjectPath, perm) {
+				s.showProject(w, r, "You don't have the permission "+p+" yourself")
+				return
+			}
+			perms = append(perms, perm)
+		}
+	}
+
+	if err := s.ProjectRepo.AddUserToProject(proj.ID, member.ID, perms); err != nil {
+		s.showProject(w, r, "Failed to add member: "+err.Error())
+		return
+	}
+	log.Printf("[INFO] %s added %s to project %s with %v", user.LoginName, member.LoginName, proj.ProjectNumber, perms)
+
+	http.Redirect(w, r, fmt.Sprint("/projects/", proj.ID), http.StatusSeeOther)
+}
+
+// ProjectMemberRemovePost removes a user from a project
+func (s *Server) ProjectMemberRemovePost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !(auth.IsAdmin(user) || user.HasPermission(db.RemoveUserFromProject)) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	proj, ok := s.projectFromURL(w, r, user)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.ProjectRepo.RemoveUserFromProject(proj.ID, uint(userID)); err != nil {
+		log.Printf("[ERROR] Failed to remove user %d from project %s: %v", userID, proj.ProjectNumber, err)
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		return
+	}
 
-	s.ExecuteTemplate(w, "project-management.html", user)
+	http.Redirect(w, r, fmt.Sprint("/projects/", proj.ID), http.StatusSeeOther)
 }
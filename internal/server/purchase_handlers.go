@@ -0,0 +1,232 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/auth"
+	"github.com/grd/FreePDM/internal/db"
+)
+
+// canManagePurchasing tells whether the user maintains the manufacturers
+// and vendors
+func canManagePurchasing(user *db.PdmUser) bool {
+	return auth.IsAdmin(user) || user.HasRole(string(db.SeniorDesigner)) || user.HasRole(string(db.ProjectLead))
+}
+
+// optionalID reads an ID of a selection list, nil when nothing is chosen
+func optionalID(value string) (*uint, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid ID %q", value)
+	}
+	u := uint(id)
+	return &u, nil
+}
+
+// PurchasingGet shows the manufacturers and vendors
+func (s *Server) PurchasingGet(w http.ResponseWriter, r *http.Request) {
+	s.showPurchasing(w, r, "")
+}
+
+func (s *Server) showPurchasing(w http.ResponseWriter, r *http.Request, errMsg string) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	manufacturers, err := s.PurchaseRepo.Manufacturers()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load manufacturers: %v", err)
+		http.Error(w, "Failed to load manufacturers", http.StatusInternalServerError)
+		return
+	}
+	vendors, err := s.PurchaseRepo.Vendors()
+	if err != nil {
+		log.Printf("[ERROR] Failed to load vendors: %v", err)
+		http.Error(w, "Failed to load vendors", http.StatusInternalServerError)
+		return
+	}
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Manufacturers":   manufacturers,
+		"Vendors":         vendors,
+		"CanManage":       canManagePurchasing(user),
+		"Error":           errMsg,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/dashboard",
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "purchasing.html", data)
+}
+
+// ManufacturerNewPost adds a manufacturer
+func (s *Server) ManufacturerNewPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !canManagePurchasing(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	m, err := s.PurchaseRepo.CreateManufacturer(r.FormValue("name"), r.FormValue("website"))
+	if err != nil {
+		s.showPurchasing(w, r, "Failed to create manufacturer: "+err.Error())
+		return
+	}
+	log.Printf("[INFO] %s created manufacturer %s", user.LoginName, m.ManufacturerName)
+
+	http.Redirect(w, r, "/purchasing", http.StatusSeeOther)
+}
+
+// ManufacturerDeletePost removes a manufacturer without approved sources
+func (s *Server) ManufacturerDeletePost(w http.ResponseWriter, r *http.Request) {
+	s.deleteParty(w, r, "manufacturerID", "manufacturer", s.PurchaseRepo.DeleteManufacturer)
+}
+
+// VendorNewPost adds a vendor
+func (s *Server) VendorNewPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !canManagePurchasing(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	v, err := s.PurchaseRepo.CreateVendor(r.FormValue("name"), r.FormValue("website"))
+	if err != nil {
+		s.showPurchasing(w, r, "Failed to create vendor: "+err.Error())
+		return
+	}
+	log.Printf("[INFO] %s created vendor %s", user.LoginName, v.VendorName)
+
+	http.Redirect(w, r, "/purchasing", http.StatusSeeOther)
+}
+
+// VendorDeletePost removes a vendor without approved sources
+func (s *Server) VendorDeletePost(w http.ResponseWriter, r *http.Request) {
+	s.deleteParty(w, r, "vendorID", "vendor", s.PurchaseRepo.DeleteVendor)
+}
+
+func (s *Server) deleteParty(w http.ResponseWriter, r *http.Request, param, kind string, remove func(uint) error) {
+	user, err := s.getSessionUser(r)
+	if err != nil || !canManagePurchasing(user) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, param))
+	if err != nil {
+		http.Error(w, "Invalid "+kind+" ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := remove(uint(id)); err != nil {
+		switch {
+		case errors.Is(err, db.ErrPartyInUse):
+			s.showPurchasing(w, r, "The "+kind+" is used by approved sources")
+		case errors.Is(err, db.ErrManufacturerNotFound), errors.Is(err, db.ErrVendorNotFound):
+			http.NotFound(w, r)
+		default:
+			log.Printf("[ERROR] Failed to delete %s %d: %v", kind, id, err)
+			http.Error(w, "Failed to delete "+kind, http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("[INFO] %s deleted %s %d", user.LoginName, kind, id)
+
+	http.Redirect(w, r, "/purchasing", http.StatusSeeOther)
+}
+
+// ItemSourcePost adds an approved source to an item
+func (s *Server) ItemSourcePost(w http.ResponseWriter, r *http.Request) {
+	user, item, ok := s.writableItem(w, r)
+	if !ok {
+		return
+	}
+
+	manufacturerID, err := optionalID(r.FormValue("manufacturer"))
+	if err != nil {
+		s.showItem(w, r, "Invalid manufacturer")
+		return
+	}
+	vendorID, err := optionalID(r.FormValue("vendor"))
+	if err != nil {
+		s.showItem(w, r, "Invalid vendor")
+		return
+	}
+
+	_, err = s.PurchaseRepo.AddSource(item.ID, manufacturerID, r.FormValue("mpn"), vendorID, r.FormValue("vendor_pn"))
+	if err != nil {
+		s.showItem(w, r, "Failed to add the source: "+err.Error())
+		return
+	}
+	log.Printf("[INFO] %s added a source to item %d", user.LoginName, item.ID)
+
+	http.Redirect(w, r, fmt.Sprint("/items/", item.ID), http.StatusSeeOther)
+}
+
+// ItemSourcePreferredPost makes a source the preferred one
+func (s *Server) ItemSourcePreferredPost(w http.ResponseWriter, r *http.Request) {
+	s.changeSource(w, r, s.PurchaseRepo.SetPreferred)
+}
+
+// ItemSourceDeletePost removes an approved source of an item
+func (s *Server) ItemSourceDeletePost(w http.ResponseWriter, r *http.Request) {
+	s.changeSource(w, r, s.PurchaseRepo.RemoveSource)
+}
+
+func (s *Server) changeSource(w http.ResponseWriter, r *http.Request, change func(itemID, sourceID uint) error) {
+	_, item, ok := s.writableItem(w, r)
+	if !ok {
+		return
+	}
+
+	sourceID, err := strconv.Atoi(chi.URLParam(r, "sourceID"))
+	if err != nil {
+		http.Error(w, "Invalid source ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := change(item.ID, uint(sourceID)); err != nil {
+		if errors.Is(err, db.ErrSourceNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("[ERROR] Failed to change source %d of item %d: %v", sourceID, item.ID, err)
+		http.Error(w, "Failed to change the source", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprint("/items/", item.ID), http.StatusSeeOther)
+}
+
+// ItemTraceabilityPost sets the traceability that is required for an item
+func (s *Server) ItemTraceabilityPost(w http.ResponseWriter, r *http.Request) {
+	_, item, ok := s.writableItem(w, r)
+	if !ok {
+		return
+	}
+
+	state := db.TracebilityState(r.FormValue("traceability"))
+	if err := s.PurchaseRepo.SetTraceability(item.ID, state); err != nil {
+		s.showItem(w, r, "Failed to set the traceability: "+err.Error())
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprint("/items/", item.ID), http.StatusSeeOther)
+}
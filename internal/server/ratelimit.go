@@ -0,0 +1,98 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grd/FreePDM/internal/db"
+)
+
+// rateLimiter allows a number of requests per client address in a fixed
+// time window. It is meant for /login, so the bookkeeping is kept simple.
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		hits:   map[string]*rateWindow{},
+	}
+}
+
+// Allow counts a request of key and tells whether it is within the limit,
+// and whether it is the first request of the window that is over it.
+func (l *rateLimiter) Allow(key string) (ok, first bool) {
+	if l == nil || l.limit <= 0 {
+		return true, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.hits) > 10000 {
+		// forget the windows that are over
+		for k, win := range l.hits {
+			if now.Sub(win.start) > l.window {
+				delete(l.hits, k)
+			}
+		}
+	}
+
+	win, found := l.hits[key]
+	if !found || now.Sub(win.start) > l.window {
+		l.hits[key] = &rateWindow{start: now, count: 1}
+		return true, false
+	}
+
+	win.count++
+	return win.count <= l.limit, win.count == l.limit+1
+}
+
+// RateLimitChi rejects clients that post too often. Only the first
+// rejection of a window is logged, so that a flood of requests doesn't
+// flood the audit trail as well.
+func (s *Server) RateLimitChi(l *rateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r)
+			if ok, first := l.Allow(ip); !ok {
+				if first {
+					log.Printf("[INFO] Rate limit hit on %s by %s", r.URL.Path, ip)
+					s.UserRepo.LogSecurityEvent(0, r.FormValue("login_name"), db.EventRateLimited, ip, r.URL.Path)
+				}
+				w.Header().Set("Retry-After", "60")
+				http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP is the address of the client without the port. Proxy headers
+// are not trusted.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -25,7 +25,16 @@ func (s *Server) Routes(mux *http.ServeMux) {
 	r.Group(func(r chi.Router) {
 		r.Get("/", s.HomeGet)
 		r.Get("/login", s.LoginGet)
-		r.Post("/login", s.LoginPost)
+		r.With(s.RateLimitChi(s.loginLimiter)).Post("/login", s.LoginPost)
+		r.Get("/login/oidc", s.OIDCLoginGet)
+		r.Get("/login/oidc/callback", s.OIDCCallbackGet)
+
+		// Two-factor authentication, for a pending login or a logged in user
+		r.Get("/login/2fa", s.TwoFactorGet)
+		r.With(s.RateLimitChi(s.loginLimiter)).Post("/login/2fa", s.TwoFactorPost)
+		r.Get("/login/2fa/enroll", s.TwoFactorEnrollGet)
+		r.With(s.RateLimitChi(s.loginLimiter)).Post("/login/2fa/enroll", s.TwoFactorEnrollPost)
+		r.Get("/login/2fa/qr", s.TwoFactorQRGet)
 		r.Post("/logout", s.LogoutPost)
 	})
 
@@ -38,6 +47,8 @@ func (s *Server) Routes(mux *http.ServeMux) {
 		r.Get("/dashboard", s.DashboardGet)
 		r.Get("/admin/preferences", s.AdminPreferencesGet)
 		r.Patch("/preferences/theme", s.ThemePreferencePatch)
+		r.Get("/change-password", s.ChangePasswordGet)
+		r.Post("/change-password", s.ChangePasswordPost)
 
 		// ✅ Logs
 		r.With(s.RequireRoleChi("Admin")).Get("/admin/logs", s.ShowLogsGet)
@@ -56,13 +67,95 @@ func (s *Server) Routes(mux *http.ServeMux) {
 			r.Post("/admin/users/upload-photo/{userID}", s.UserPhotoPost)
 			r.Get("/admin/users/change-status/{userID}", s.UserChangeStatusGet)
 			r.Post("/admin/users/change-status/{userID}", s.UserChangeStatusPost)
+			r.Post("/admin/users/2fa/{userID}", s.AdminUserTwoFactorPost)
+			r.Post("/admin/2fa/roles", s.AdminRoleTwoFactorPost)
+			r.Get("/admin/security", s.SecurityEventsGet)
+
+			// ✅ Groups
+			r.Get("/admin/groups", s.AdminGroupsGet)
+			r.Post("/admin/groups", s.AdminGroupNewPost)
+			r.Get("/admin/groups/{groupID}", s.AdminGroupGet)
+			r.Post("/admin/groups/{groupID}", s.AdminGroupPost)
+			r.Post("/admin/groups/{groupID}/delete", s.AdminGroupDeletePost)
+			r.Post("/admin/groups/{groupID}/members", s.AdminGroupMemberPost)
+			r.Post("/admin/groups/{groupID}/members/{userID}/delete", s.AdminGroupMemberRemovePost)
 		})
 
-		// ✅ Vault routes (Admin only)
+		// ✅ Projects
+		r.Get("/projects", s.ProjectsGet)
+		r.Post("/projects", s.ProjectNewPost)
+		r.Get("/projects/{projectID}", s.ProjectGet)
+		r.Post("/projects/{projectID}", s.ProjectPost)
+		r.Post("/projects/{projectID}/state", s.ProjectStatePost)
+		r.Post("/projects/{projectID}/delete", s.ProjectDeletePost)
+		r.Post("/projects/{projectID}/members", s.ProjectMemberPost)
+		r.Post("/projects/{projectID}/members/{userID}/delete", s.ProjectMemberRemovePost)
+
+		// ✅ Items and their documents
+		r.Get("/items", s.ItemsGet)
+		r.Get("/items/{itemID}", s.ItemGet)
+		r.Post("/items/{itemID}", s.ItemPost)
+		r.Post("/items/{itemID}/documents", s.ItemDocumentPost)
+		r.Post("/items/{itemID}/documents/{documentID}/detach", s.ItemDocumentDetachPost)
+		r.Post("/items/{itemID}/models/{modelID}/material", s.ItemModelMaterialPost)
+		r.Post("/items/{itemID}/bom", s.ItemBomPost)
+		r.Post("/items/{itemID}/bom/{lineID}", s.ItemBomLinePost)
+		r.Post("/items/{itemID}/bom/{lineID}/delete", s.ItemBomLineDeletePost)
+		r.Get("/items/{itemID}/bom.csv", s.ItemBomCsvGet)
+		r.Post("/items/{itemID}/traceability", s.ItemTraceabilityPost)
+		r.Post("/items/{itemID}/sources", s.ItemSourcePost)
+		r.Post("/items/{itemID}/sources/{sourceID}/preferred", s.ItemSourcePreferredPost)
+		r.Post("/items/{itemID}/sources/{sourceID}/delete", s.ItemSourceDeletePost)
+
+		// ✅ Where used, across the vaults
+		r.Get("/whereused", s.WhereUsedGet)
+		r.Get("/api/whereused/{container}", s.WhereUsedApiGet)
+
+		// ✅ Search of the containers, across the vaults
+		r.Get("/api/search", s.SearchApiGet)
+		r.Get("/api/thumbnail/{vault}", s.ThumbnailApiGet)
+
+		// ✅ Materials catalogue
+		r.Get("/materials", s.MaterialsGet)
+		r.Post("/materials", s.MaterialNewPost)
+		r.Post("/materials/{materialID}", s.MaterialPost)
+		r.Post("/materials/{materialID}/delete", s.MaterialDeletePost)
+
+		// ✅ Manufacturers and vendors
+		r.Get("/purchasing", s.PurchasingGet)
+		r.Post("/purchasing/manufacturers", s.ManufacturerNewPost)
+		r.Post("/purchasing/manufacturers/{manufacturerID}/delete", s.ManufacturerDeletePost)
+		r.Post("/purchasing/vendors", s.VendorNewPost)
+		r.Post("/purchasing/vendors/{vendorID}/delete", s.VendorDeletePost)
+
+		// ✅ Vault routes, filtered by the access control lists
+		r.Get("/vaults/list", s.VaultsListGet)
+		r.Get("/vaults/{vaultName}", s.VaultBrowseGet)
+		r.Get("/vaults/{vaultName}/*", s.VaultBrowseGet)
+		r.Post("/command", s.CommandHandler)
+		r.Post("/api/import/{vault}", s.ImportPost)
+
+		// ✅ Delta sync of the vault files, see the httpsync transport
+		r.Get("/api/sync/{vault}/files", s.SyncFilesGet)
+		r.Post("/api/sync/{vault}/delta", s.SyncDeltaPost)
+		r.Get("/api/sync/{vault}/signature", s.SyncSignatureGet)
+		r.Get("/api/sync/{vault}/upload", s.SyncUploadGet)
+		r.Post("/api/sync/{vault}/upload", s.SyncUploadPost)
+		r.Get("/api/status/{vault}", s.StatusApiGet)
+
+		// ✅ Server-sent events of the changes of the vaults
+		r.Get("/api/events", s.EventsApiGet)
+
+		// ✅ Vault access control lists (Admin only)
 		r.With(s.RequireAdminChi).Group(func(r chi.Router) {
-			r.Get("/vaults/list", s.VaultsListGet)
-			r.Get("/vaults/{vaultName}", s.VaultBrowseGet)
-			r.Get("/vaults/{vaultName}/*", s.VaultPathBrowseGet)
+			r.Get("/admin/vaults", s.AdminVaultsGet)
+			r.Get("/admin/numbering", s.AdminNumberingGet)
+			r.Post("/admin/numbering", s.AdminNumberingPost)
+			r.Post("/admin/numbering/{schemeID}/delete", s.AdminNumberingDeletePost)
+			r.Post("/admin/numbering/{schemeID}/reserve", s.AdminNumberingReservePost)
+			r.Get("/admin/vaults/{vaultName}/acl", s.AdminVaultAclGet)
+			r.Post("/admin/vaults/{vaultName}/acl", s.AdminVaultAclPost)
+			r.Post("/admin/vaults/{vaultName}/acl/{aclID}/delete", s.AdminVaultAclDeletePost)
 
 			// r.Get("/admin/vault/{vaultID}", s.VaultViewGet)
 			// r.Post("/admin/vault/{vaultID}/upload", s.VaultUploadPost)
@@ -0,0 +1,241 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/shared"
+	vfs "github.com/grd/FreePDM/internal/vault/localfs"
+)
+
+// The number of search results when the query has no limit
+const searchLimit = 200
+
+// The thumbnail that FreeCAD stores inside a document
+const thumbnailFile = "thumbnails/Thumbnail.png"
+
+// searchQuery is what a search looks for. The text matches, without case,
+// a part of the name, the container number, the part number, the
+// description or the material of the latest version.
+type searchQuery struct {
+	text  string
+	state string // the revision state, "" for any
+	limit int
+}
+
+// search returns the containers that match the query in a vault, or in all
+// vaults that the user may see when vault is "". The item records are
+// searched, only the lock and the revision state come from the vault. A
+// vault that fails is left out of a search of all vaults.
+func (s *Server) search(user *db.PdmUser, vault string, q searchQuery) ([]shared.SearchResult, error) {
+	vaults := []string{vault}
+	if vault == "" {
+		var err error
+		if vaults, err = s.visibleVaults(user); err != nil {
+			return nil, err
+		}
+	}
+
+	result := []shared.SearchResult{}
+	for _, name := range vaults {
+		found, err := s.searchVault(user, name, q, q.limit-len(result))
+		if err != nil && vault == "" {
+			log.Printf("[ERROR] Failed to search %q in %s, skipped: %v", q.text, name, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, found...)
+		if len(result) == q.limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// searchVault returns at most limit containers of a vault that match the
+// query and that the user may read.
+func (s *Server) searchVault(user *db.PdmUser, vault string, q searchQuery, limit int) ([]shared.SearchResult, error) {
+	access, err := s.vaultAccess(user, vault)
+	if err != nil {
+		return nil, err
+	}
+	if !access.Any() {
+		return nil, nil
+	}
+	fs, err := vfs.NewFileSystem(vault, user.LoginName)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []shared.SearchResult
+	seen := map[string]bool{}
+	for offset := 0; ; offset += searchLimit {
+		matches, err := s.ItemRepo.SearchContainers(vault, q.text, offset, searchLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if seen[m.ContainerNumber] {
+				continue
+			}
+			seen[m.ContainerNumber] = true
+
+			found, ok := searchResult(fs, m)
+			if !ok || !access.Can(path.Join(found.Path, found.ContainerNumber), db.AclRead) {
+				continue
+			}
+			if q.state != "" && !strings.EqualFold(found.State, q.state) {
+				continue
+			}
+			result = append(result, found)
+			if len(result) == limit {
+				return result, nil
+			}
+		}
+		if len(matches) < searchLimit {
+			return result, nil
+		}
+	}
+}
+
+// searchResult completes the records of a container with the vault: the
+// directory of a document, the lock and the revision state of the latest
+// version. It is false for a container that is no longer in the vault.
+func searchResult(fs *vfs.FileSystem, m db.ContainerMatch) (shared.SearchResult, bool) {
+	fl, err := fs.ContainerFileList(m.ContainerNumber)
+	if err != nil {
+		return shared.SearchResult{}, false
+	}
+	found := shared.SearchResult{
+		Vault:           m.Vault,
+		ContainerNumber: m.ContainerNumber,
+		Path:            fl.Path,
+		Name:            fl.Name,
+		PartNumber:      m.PartNumber,
+		Version:         m.Version,
+		Description:     strings.TrimSpace(m.Description),
+		LockedBy:        fs.IsLockedItem(m.ContainerNumber),
+	}
+	if versions, err := fs.Versions(fl); err == nil && len(versions) > 0 {
+		for _, prop := range fs.Properties(fl, versions[len(versions)-1]) {
+			if prop.Key == shared.StateProperty {
+				found.State = prop.Value
+			}
+		}
+	}
+	return found, true
+}
+
+// SearchApiGet returns the containers that match a search as JSON. The
+// query parameters are "q" for the text, "vault" to search one vault,
+// "state" for the revision state and "limit".
+func (s *Server) SearchApiGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vault := r.URL.Query().Get("vault")
+	if vault != "" && !validVaultName(vault) {
+		writeJsonError(w, "Invalid vault: "+vault, http.StatusBadRequest)
+		return
+	}
+	q := searchQuery{
+		text:  strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q"))),
+		state: strings.TrimSpace(r.URL.Query().Get("state")),
+		limit: searchLimit,
+	}
+	if str := r.URL.Query().Get("limit"); str != "" {
+		limit, err := strconv.Atoi(str)
+		if err != nil || limit <= 0 {
+			writeJsonError(w, "Invalid limit: "+str, http.StatusBadRequest)
+			return
+		}
+		q.limit = min(limit, searchLimit)
+	}
+
+	list, err := s.search(user, vault, q)
+	if err != nil {
+		log.Printf("[ERROR] Failed to search %q in %q: %v", q.text, vault, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// ThumbnailApiGet returns the thumbnail of the latest version of the
+// container "path" as PNG, which FreeCAD stores in its documents.
+func (s *Server) ThumbnailApiGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vault := chi.URLParam(r, "vault")
+	if !validVaultName(vault) {
+		writeJsonError(w, "Invalid vault: "+vault, http.StatusBadRequest)
+		return
+	}
+	rel := db.CleanVaultPath(r.URL.Query().Get("path"))
+	access, err := s.vaultAccess(user, vault)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read the access of %s to %s: %v", user.LoginName, vault, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if !access.Can(rel, db.AclRead) {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	fs, ok := openVault(w, user.LoginName, vault)
+	if !ok {
+		return
+	}
+	fl, err := fs.ContainerFileList(path.Base(rel))
+	if err != nil || path.Join(fl.Path, fl.ContainerNumber) != rel {
+		writeJsonError(w, "Not a container: "+rel, http.StatusNotFound)
+		return
+	}
+	versions, err := fs.Versions(fl)
+	if err != nil || len(versions) == 0 {
+		writeJsonError(w, fl.Name+" has no versions", http.StatusNotFound)
+		return
+	}
+
+	file := filepath.Join(fs.VaultDir(), filepath.FromSlash(rel), versions[len(versions)-1].Pretty, fl.Name)
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		writeJsonError(w, fl.Name+" has no thumbnail", http.StatusNotFound)
+		return
+	}
+	defer zr.Close()
+	thumb, err := zr.Open(thumbnailFile)
+	if err != nil {
+		writeJsonError(w, fl.Name+" has no thumbnail", http.StatusNotFound)
+		return
+	}
+	defer thumb.Close()
+
+	w.Header().Set("Content-Type", "image/png")
+	io.Copy(w, thumb)
+}
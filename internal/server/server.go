@@ -10,8 +10,10 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/gorilla/sessions"
+	"github.com/grd/FreePDM/internal/auth"
 	"github.com/grd/FreePDM/internal/config"
 	"github.com/grd/FreePDM/internal/db"
 	vfs "github.com/grd/FreePDM/internal/vault/localfs"
@@ -19,9 +21,26 @@ import (
 
 type Server struct {
 	UserRepo     *db.UserRepo
+	AclRepo      *db.AclRepo
+	GroupRepo    *db.GroupRepo
+	ProjectRepo  *db.ProjectRepo
+	NumberRepo   *db.NumberRepo
+	ItemRepo     *db.ItemRepo
+	MaterialRepo *db.MaterialRepo
+	BomRepo      *db.BomRepo
+	PurchaseRepo *db.PurchaseRepo
+	RefRepo      *db.ReferenceRepo
 	Templates    *template.Template
 	SessionStore *sessions.CookieStore
 	FS           *vfs.FileSystem
+	OIDC         *auth.OIDCProvider // nil when single sign-on is off
+
+	PasswordPolicy auth.PasswordPolicy
+	Lockout        auth.LockoutPolicy
+	loginLimiter   *rateLimiter
+	events         *eventBus
+	uploads        uploadLocks
+	unwatch        []func() // unregister the vault event handlers of this server
 
 	// TODO: Add things such as Logger, Config etc.
 }
@@ -33,11 +52,33 @@ func NewServer(userRepo *db.UserRepo) *Server {
 	templatePath := filepath.Join(config.AppDir(), "templates", "*.html")
 	templates := template.Must(template.ParseGlob(templatePath))
 
-	return &Server{
-		UserRepo:     userRepo,
-		Templates:    templates,
-		SessionStore: sessions.NewCookieStore(sessionKey),
+	s := &Server{
+		UserRepo:       userRepo,
+		AclRepo:        db.NewAclRepo(userRepo.DB),
+		GroupRepo:      db.NewGroupRepo(userRepo.DB),
+		ProjectRepo:    db.NewProjectRepo(userRepo.DB),
+		NumberRepo:     db.NewNumberRepo(userRepo.DB),
+		ItemRepo:       db.NewItemRepo(userRepo.DB),
+		MaterialRepo:   db.NewMaterialRepo(userRepo.DB),
+		BomRepo:        db.NewBomRepo(userRepo.DB),
+		PurchaseRepo:   db.NewPurchaseRepo(userRepo.DB),
+		RefRepo:        db.NewReferenceRepo(userRepo.DB),
+		Templates:      templates,
+		SessionStore:   sessions.NewCookieStore(sessionKey),
+		PasswordPolicy: auth.LoadPasswordPolicy(),
+		Lockout:        auth.LoadLockoutPolicy(),
+		loginLimiter:   newRateLimiter(auth.EnvInt("LOGIN_RATE_LIMIT", 10), time.Minute),
+		events:         newEventBus(),
+	}
+
+	// Keep the items in the database in sync with the vaults, and tell the
+	// clients about the changes
+	s.unwatch = []func(){
+		vfs.OnEvent(s.recordVaultEvent),
+		vfs.OnEvent(s.events.publish),
 	}
+
+	return s
 }
 
 func (s *Server) ExecuteTemplate(w http.ResponseWriter, name string, data any) error {
@@ -0,0 +1,399 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/adapters/httpsync"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/delta"
+	vfs "github.com/grd/FreePDM/internal/vault/localfs"
+	"github.com/grd/FreePDM/internal/workspace"
+)
+
+//
+// The sync protocol of the httpsync transport. A client lists a directory
+// with the hashes of its files and fetches the files that differ as a
+// delta against its own copy. A push uploads a delta against the file of
+// the server, into a version that the user checked out. Both directions
+// resume at an offset after an interruption and verify the hash at the end.
+//
+
+// maxSignatureSize limits the body of a delta request
+const maxSignatureSize = 64 << 20
+
+// syncFile is the file or directory of a sync request on disk
+type syncFile struct {
+	vault string
+	rel   string // inside the vault, or inside its data directory
+	abs   string
+	fs    *vfs.FileSystem
+}
+
+// syncTarget resolves the vault and the path of a sync request and checks
+// the rights of the user. With "data=1" the path is in the data directory
+// of the vault, which is read-only and needs read access to the whole
+// vault: the file index lists every container. Writing needs the checkout
+// permission and a version directory that the user checked out.
+func (s *Server) syncTarget(w http.ResponseWriter, r *http.Request, user *db.PdmUser, param string, write bool) (*syncFile, bool) {
+	vault := chi.URLParam(r, "vault")
+	if !validVaultName(vault) {
+		writeJsonError(w, "Invalid vault: "+vault, http.StatusBadRequest)
+		return nil, false
+	}
+	rel := db.CleanVaultPath(r.URL.Query().Get(param))
+	data := r.URL.Query().Get("data") == "1"
+
+	access, err := s.vaultAccess(user, vault)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read the access of %s to %s: %v", user.LoginName, vault, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	switch {
+	case data && (write || !access.Can("", db.AclRead)),
+		!data && !write && !access.Can(rel, db.AclRead),
+		!data && write && !access.Can(rel, db.AclCheckout):
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	vfsys, ok := openVault(w, user.LoginName, vault)
+	if !ok {
+		return nil, false
+	}
+
+	if write {
+		if msg := checkedOutVersion(vfsys, rel, user.LoginName); msg != "" {
+			writeJsonError(w, msg, http.StatusForbidden)
+			return nil, false
+		}
+	}
+
+	target := &syncFile{vault: vault, rel: rel, abs: filepath.Join(vfsys.VaultDir(), filepath.FromSlash(rel)), fs: vfsys}
+	if data {
+		target.abs = filepath.Join(vfs.RootData(), vault, filepath.FromSlash(rel))
+	}
+	return target, true
+}
+
+// checkedOutVersion tells why the file rel may not be written, "" when it
+// is in a version directory that the user checked out.
+func checkedOutVersion(vfsys *vfs.FileSystem, rel, user string) string {
+	parts := strings.Split(rel, "/")
+	if len(parts) < 3 {
+		return "Not a file of a version: " + rel
+	}
+	n := len(parts)
+	dir := strings.Join(parts[:n-3], "/")
+
+	by, err := vfsys.VersionCheckedOutBy(dir, parts[n-3], parts[n-2])
+	switch {
+	case err != nil:
+		return "Not a file of a version: " + rel
+	case by == "":
+		return "The version is not checked out: " + rel
+	case by != user:
+		return "The version is checked out by " + by
+	}
+	return ""
+}
+
+// SyncFilesGet lists the files of a directory with their hashes. With
+// "shallow=1" the subdirectories are left out.
+func (s *Server) SyncFilesGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	target, ok := s.syncTarget(w, r, user, "path", false)
+	if !ok {
+		return
+	}
+	shallow := r.URL.Query().Get("shallow") == "1"
+
+	files := []httpsync.File{}
+	err = filepath.WalkDir(target.abs, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if shallow && p != target.abs {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		hash, size, err := delta.HashFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(target.abs, p)
+		files = append(files, httpsync.File{Path: filepath.ToSlash(rel), Size: size, Hash: hash})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		writeJsonError(w, "Not found: "+target.rel, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to list %s/%s: %v", target.vault, target.rel, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// SyncDeltaPost sends a file as a delta against the signature in the
+// request body, from the byte at "offset" on.
+func (s *Server) SyncDeltaPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	target, ok := s.syncTarget(w, r, user, "file", false)
+	if !ok {
+		return
+	}
+
+	sig, err := delta.ReadSignature(http.MaxBytesReader(w, r.Body, maxSignatureSize))
+	if err != nil {
+		writeJsonError(w, "Invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	f, err := os.Open(target.abs)
+	if err != nil {
+		writeJsonError(w, "Not found: "+target.rel, http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() || offset < 0 || offset > info.Size() {
+		writeJsonError(w, "Invalid offset", http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if _, err := delta.Write(w, sig, f, offset); err != nil {
+		log.Printf("[ERROR] Failed to send %s/%s: %v", target.vault, target.rel, err)
+	}
+}
+
+// SyncSignatureGet sends the signature of a file that the user is going to
+// upload, of an empty file when it is new.
+func (s *Server) SyncSignatureGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	target, ok := s.syncTarget(w, r, user, "file", true)
+	if !ok {
+		return
+	}
+
+	sig, err := delta.FileSignature(target.abs, delta.DefaultBlockSize)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read %s/%s: %v", target.vault, target.rel, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	sig.WriteTo(w)
+}
+
+// uploadPart is where the upload of a file with a hash is assembled, on
+// the file system of the vaults so that it is renamed into place.
+func uploadPart(target *syncFile, hash string) string {
+	key := sha256.Sum256([]byte(target.rel + ":" + hash))
+	return filepath.Join(vfs.Root(), ".sync", target.vault, hex.EncodeToString(key[:16])+".part")
+}
+
+// uploadLocks keeps the uploads of the same file apart, they would append
+// to the same part.
+type uploadLocks struct {
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+// lock takes the file, it is false when another upload has it
+func (l *uploadLocks) lock(file string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.busy[file] {
+		return false
+	}
+	if l.busy == nil {
+		l.busy = map[string]bool{}
+	}
+	l.busy[file] = true
+	return true
+}
+
+func (l *uploadLocks) unlock(file string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.busy, file)
+}
+
+// partSize is the size of an upload part, zero when there is none
+func partSize(part string) int64 {
+	info, err := os.Stat(part)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// SyncUploadGet tells how much of the upload of a file with "hash" the
+// server already has, where an interrupted upload resumes.
+func (s *Server) SyncUploadGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	target, ok := s.syncTarget(w, r, user, "file", true)
+	if !ok {
+		return
+	}
+	hash := r.URL.Query().Get("hash")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(httpsync.Upload{Offset: partSize(uploadPart(target, hash)), Hash: hash})
+}
+
+// SyncUploadPost receives a file as a delta against the file of the
+// server, from "offset" on. The file replaces the old one when its size
+// and hash are right.
+func (s *Server) SyncUploadPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	target, ok := s.syncTarget(w, r, user, "file", true)
+	if !ok {
+		return
+	}
+	hash := r.URL.Query().Get("hash")
+	offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+
+	reply := func(status int, upload httpsync.Upload) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(upload)
+	}
+
+	part := uploadPart(target, hash)
+	if !s.uploads.lock(target.abs) {
+		reply(http.StatusConflict, httpsync.Upload{Offset: partSize(part), Hash: hash, Error: "Another upload of the file is running"})
+		return
+	}
+	defer s.uploads.unlock(target.abs)
+
+	if size := partSize(part); size != offset {
+		reply(http.StatusConflict, httpsync.Upload{Offset: size, Hash: hash, Error: "Resume at the offset"})
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(part), 0o755); err != nil {
+		log.Printf("[ERROR] Failed to create %s: %v", filepath.Dir(part), err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	out, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Printf("[ERROR] Failed to open %s: %v", part, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var base io.ReaderAt
+	if old, err := os.Open(target.abs); err == nil {
+		defer old.Close()
+		base = old
+	}
+
+	res, err := delta.Apply(out, base, delta.DefaultBlockSize, r.Body)
+	out.Close()
+	if err != nil {
+		// The part stays, the client resumes after what arrived
+		reply(http.StatusBadRequest, httpsync.Upload{Offset: partSize(part), Hash: hash, Error: err.Error()})
+		return
+	}
+
+	if err := delta.Verify(part, res); err != nil || res.HashString() != hash {
+		os.Remove(part)
+		reply(http.StatusUnprocessableEntity, httpsync.Upload{Hash: hash, Error: delta.ErrHash.Error()})
+		return
+	}
+	if err := target.fs.Chown(part); err != nil {
+		log.Printf("[ERROR] Failed to change the owner of %s/%s: %v", target.vault, target.rel, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(part, target.abs); err != nil {
+		log.Printf("[ERROR] Failed to store %s/%s: %v", target.vault, target.rel, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s uploaded %s/%s (%d of %d bytes sent)", user.LoginName, target.vault, target.rel, res.Literal, res.Size)
+	reply(http.StatusOK, httpsync.Upload{Offset: res.Size, Hash: hash})
+}
+
+// StatusApiGet returns the versions, the check outs and the file hashes of
+// the container at "path", which a workspace compares its copy with.
+func (s *Server) StatusApiGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	target, ok := s.syncTarget(w, r, user, "path", false)
+	if !ok {
+		return
+	}
+	if !workspace.IsContainer(target.abs) {
+		writeJsonError(w, "Not a container: "+target.rel, http.StatusNotFound)
+		return
+	}
+
+	c, err := workspace.DiskRemote{Root: vfs.Root()}.Container(target.vault, target.rel)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read %s/%s: %v", target.vault, target.rel, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
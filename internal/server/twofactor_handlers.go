@@ -0,0 +1,367 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/auth"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/shared"
+	"rsc.io/qr"
+)
+
+// A login that waits for the second factor expires after this time
+const pendingLoginTimeout = 5 * time.Minute
+
+// pendingUser returns the user that passed the first login step.
+func (s *Server) pendingUser(r *http.Request) (*db.PdmUser, error) {
+	sess, _ := s.SessionStore.Get(r, shared.SessionName)
+
+	userID, ok := sess.Values["pending_user_id"].(uint)
+	if !ok {
+		return nil, errors.New("no pending login")
+	}
+	at, _ := sess.Values["pending_at"].(int64)
+	if time.Since(time.Unix(at, 0)) > pendingLoginTimeout {
+		return nil, errors.New("pending login expired")
+	}
+
+	return s.UserRepo.LoadUserByID(userID)
+}
+
+// pendingAccountOK checks the account of a pending login again before the
+// second step, it may have been locked or disabled since the first one.
+// Otherwise the pending login ends.
+func (s *Server) pendingAccountOK(w http.ResponseWriter, r *http.Request, user *db.PdmUser) bool {
+	ip := clientIP(r)
+	err := s.checkAccountStatus(user, ip)
+	if err == nil {
+		return true
+	}
+	s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventLoginFailed, ip, err.Error())
+
+	sess, _ := s.SessionStore.Get(r, shared.SessionName)
+	delete(sess.Values, "pending_user_id")
+	sess.Save(r, w)
+
+	http.Error(w, err.Error(), http.StatusForbidden)
+	return false
+}
+
+// twoFactorUser is the user that enrols: a pending login or a logged in
+// user that turns on 2FA voluntarily.
+func (s *Server) twoFactorUser(r *http.Request) (user *db.PdmUser, pending bool, err error) {
+	if user, err := s.pendingUser(r); err == nil {
+		return user, true, nil
+	}
+	user, err = s.getSessionUser(r)
+	return user, false, err
+}
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "FreePDM"
+}
+
+// TwoFactorGet asks for the code of the authenticator app
+func (s *Server) TwoFactorGet(w http.ResponseWriter, r *http.Request) {
+	s.showTwoFactor(w, r, "")
+}
+
+func (s *Server) showTwoFactor(w http.ResponseWriter, r *http.Request, errMsg string) {
+	if _, err := s.pendingUser(r); err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := map[string]any{
+		"Error": errMsg,
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	s.ExecuteTemplate(w, "login-2fa.html", data)
+}
+
+// TwoFactorPost checks the code, or a recovery code, and completes the login
+func (s *Server) TwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	user, err := s.pendingUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	ip := clientIP(r)
+	if !s.pendingAccountOK(w, r, user) {
+		return
+	}
+	code := strings.TrimSpace(r.FormValue("code"))
+
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		if err := s.UserRepo.UpdateTOTPStep(user, step); err != nil {
+			log.Printf("[ERROR] Failed to store TOTP step of %s: %v", user.LoginName, err)
+		}
+		s.completeLogin(w, r, user, "totp")
+		return
+	}
+
+	if remaining, ok := auth.UseRecoveryCode(code, user.RecoveryCodes); ok {
+		if err := s.UserRepo.UpdateRecoveryCodes(user, remaining); err != nil {
+			log.Printf("[ERROR] Failed to store recovery codes of %s: %v", user.LoginName, err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventRecoveryCode, ip, fmt.Sprintf("%d left", len(remaining)))
+		s.completeLogin(w, r, user, "recovery code")
+		return
+	}
+
+	// A wrong code counts as a failed login
+	locked, err := s.UserRepo.RecordFailedLogin(user, s.Lockout.MaxFailed, s.Lockout.LockDuration)
+	if err != nil {
+		log.Printf("[ERROR] Failed to record failed login of %s: %v", user.LoginName, err)
+	}
+	s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventTOTPFailed, ip, fmt.Sprintf("attempt %d", user.FailedLogins))
+
+	if locked {
+		s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventAccountLocked, ip, lockDetail(user))
+
+		sess, _ := s.SessionStore.Get(r, shared.SessionName)
+		delete(sess.Values, "pending_user_id")
+		sess.Save(r, w)
+
+		http.Error(w, "Too many failed logins, the account is locked", http.StatusForbidden)
+		return
+	}
+
+	s.showTwoFactor(w, r, "Invalid code")
+}
+
+// TwoFactorEnrollGet shows the QR code of a new secret
+func (s *Server) TwoFactorEnrollGet(w http.ResponseWriter, r *http.Request) {
+	s.showTwoFactorEnroll(w, r, "")
+}
+
+func (s *Server) showTwoFactorEnroll(w http.ResponseWriter, r *http.Request, errMsg string) {
+	user, pending, err := s.twoFactorUser(r)
+	if err != nil || user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if pending && user.TOTPEnabled {
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	data := map[string]any{
+		"Enabled":        user.TOTPEnabled,
+		"Pending":        pending,
+		"Error":          errMsg,
+		"BackButtonShow": !pending,
+		"BackButtonLink": "/dashboard",
+	}
+	if !pending {
+		data["User"] = user
+		data["ThemePreference"] = user.ThemePreference
+	}
+
+	if !user.TOTPEnabled {
+		secret, err := s.enrollSecret(w, r)
+		if err != nil {
+			http.Error(w, "Session save failed", http.StatusInternalServerError)
+			return
+		}
+		data["Secret"] = secret
+		data["URI"] = auth.TOTPProvisioningURI(totpIssuer(), user.LoginName, secret)
+	}
+
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "login-2fa-enroll.html", data)
+}
+
+// enrollSecret keeps the new secret in the session until it is confirmed
+func (s *Server) enrollSecret(w http.ResponseWriter, r *http.Request) (string, error) {
+	sess, _ := s.SessionStore.Get(r, shared.SessionName)
+	if secret, ok := sess.Values["totp_secret"].(string); ok && secret != "" {
+		return secret, nil
+	}
+
+	secret := auth.GenerateTOTPSecret()
+	sess.Values["totp_secret"] = secret
+	return secret, sess.Save(r, w)
+}
+
+// TwoFactorQRGet returns the provisioning URI as QR code
+func (s *Server) TwoFactorQRGet(w http.ResponseWriter, r *http.Request) {
+	user, _, err := s.twoFactorUser(r)
+	if err != nil || user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sess, _ := s.SessionStore.Get(r, shared.SessionName)
+	secret, _ := sess.Values["totp_secret"].(string)
+	if secret == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	code, err := qr.Encode(auth.TOTPProvisioningURI(totpIssuer(), user.LoginName, secret), qr.M)
+	if err != nil {
+		http.Error(w, "Failed to create QR code", http.StatusInternalServerError)
+		return
+	}
+	code.Scale = 6
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(code.PNG())
+}
+
+// TwoFactorEnrollPost confirms the secret with a first code and shows the
+// recovery codes
+func (s *Server) TwoFactorEnrollPost(w http.ResponseWriter, r *http.Request) {
+	user, pending, err := s.twoFactorUser(r)
+	if err != nil || user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusBadRequest)
+		return
+	}
+	if pending && !s.pendingAccountOK(w, r, user) {
+		return
+	}
+
+	sess, _ := s.SessionStore.Get(r, shared.SessionName)
+	secret, _ := sess.Values["totp_secret"].(string)
+	if secret == "" {
+		http.Redirect(w, r, "/login/2fa/enroll", http.StatusSeeOther)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(secret, r.FormValue("code"), time.Now(), 0)
+	if !ok {
+		s.showTwoFactorEnroll(w, r, "Invalid code, check the time on your device")
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.UserRepo.EnableTOTP(user, secret, hashes, step); err != nil {
+		log.Printf("[ERROR] Failed to enable 2FA for %s: %v", user.LoginName, err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventTOTPEnabled, clientIP(r), "")
+	log.Printf("[INFO] Two-factor authentication enabled for %s", user.LoginName)
+
+	// An enrolment during login completes the login
+	if err := s.startSession(w, r, user); err != nil {
+		http.Error(w, "Session save failed", http.StatusInternalServerError)
+		return
+	}
+	if pending {
+		s.recordLogin(r, user, "totp enrolment")
+	}
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"RecoveryCodes":   codes,
+		"ContinueLink":    startPage(user),
+	}
+	if !pending {
+		data["ContinueLink"] = "/dashboard"
+	}
+	s.ExecuteTemplate(w, "login-2fa-recovery.html", data)
+}
+
+// AdminUserTwoFactorPost requires, makes optional or resets 2FA of a user
+func (s *Server) AdminUserTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	userIDStr := chi.URLParam(r, "userID")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.UserRepo.LoadUserByID(uint(userID))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.FormValue("action") {
+	case "require":
+		err = s.UserRepo.SetTOTPRequired(user.ID, true)
+	case "optional":
+		err = s.UserRepo.SetTOTPRequired(user.ID, false)
+	case "reset":
+		err = s.UserRepo.ResetTOTP(user.ID)
+		if err == nil {
+			admin, _ := s.getSessionUser(r)
+			detail := ""
+			if admin != nil {
+				detail = "by " + admin.LoginName
+			}
+			s.UserRepo.LogSecurityEvent(user.ID, user.LoginName, db.EventTOTPReset, clientIP(r), detail)
+		}
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to update 2FA of %s: %v", user.LoginName, err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/users/edit/"+userIDStr, http.StatusSeeOther)
+}
+
+// AdminRoleTwoFactorPost sets the roles that require 2FA
+func (s *Server) AdminRoleTwoFactorPost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Form parsing error", http.StatusBadRequest)
+		return
+	}
+
+	required := map[string]bool{}
+	for _, role := range r.Form["require_roles"] {
+		required[role] = true
+	}
+
+	for _, role := range db.GetAvailableRoles() {
+		if err := s.UserRepo.SetRoleRequiresTOTP(role, required[role]); err != nil {
+			log.Printf("[ERROR] Failed to update 2FA policy of role %s: %v", role, err)
+			http.Error(w, "Failed to update role policy", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	back := "/admin/users"
+	if userID, err := strconv.Atoi(r.FormValue("user_id")); err == nil {
+		back = fmt.Sprint("/admin/users/edit/", userID)
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/grd/FreePDM/internal/db"
+	"github.com/grd/FreePDM/internal/shared"
+	vfs "github.com/grd/FreePDM/internal/vault/localfs"
+)
+
+// referenceTargets converts the references of a checked in version
+func referenceTargets(refs []vfs.FileReference) []db.ReferenceTarget {
+	targets := make([]db.ReferenceTarget, len(refs))
+	for i, ref := range refs {
+		targets[i] = db.ReferenceTarget{Vault: ref.Vault, Container: ref.ContainerNumber, Version: ref.Version}
+	}
+	return targets
+}
+
+// whereUsed returns the parents of a container that the user may see
+func (s *Server) whereUsed(user *db.PdmUser, vault, container string, recursive bool) ([]shared.WhereUsed, error) {
+	list, err := s.RefRepo.WhereUsed(vault, container, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	// One access check per vault
+	accessOf := map[string]*db.Access{}
+	result := make([]shared.WhereUsed, 0, len(list))
+	for _, used := range list {
+		ref := used.Reference
+
+		access, ok := accessOf[ref.ParentVault]
+		if !ok {
+			if access, err = s.vaultAccess(user, ref.ParentVault); err != nil {
+				return nil, err
+			}
+			accessOf[ref.ParentVault] = access
+		}
+		if !access.CanSee(path.Join(ref.ParentPath, ref.ParentContainer)) {
+			continue
+		}
+
+		result = append(result, shared.WhereUsed{
+			Level:           used.Level,
+			Vault:           ref.ParentVault,
+			ContainerNumber: ref.ParentContainer,
+			Path:            ref.ParentPath,
+			Name:            ref.ParentName,
+			Version:         ref.ParentVersion,
+			ItemID:          used.ItemID,
+			PartNumber:      used.Number,
+			ChildVault:      ref.ChildVault,
+			ChildContainer:  ref.ChildContainer,
+			ChildVersion:    ref.ChildVersion,
+		})
+	}
+	return result, nil
+}
+
+// WhereUsedApiGet returns the parents of a container as JSON. The query
+// parameter "vault" limits the container number to one vault and
+// "recursive" adds the parents of the parents.
+func (s *Server) WhereUsedApiGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	container := chi.URLParam(r, "container")
+	vault := r.URL.Query().Get("vault")
+	if vault != "" && !validVaultName(vault) {
+		writeJsonError(w, "Invalid vault: "+vault, http.StatusBadRequest)
+		return
+	}
+
+	list, err := s.whereUsed(user, vault, container, r.URL.Query().Get("recursive") == "1")
+	if err != nil {
+		log.Printf("[ERROR] Failed to find where %s/%s is used: %v", vault, container, err)
+		writeJsonError(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// WhereUsedGet shows the parents of a container
+func (s *Server) WhereUsedGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.getSessionUser(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	vault := r.URL.Query().Get("vault")
+	container := strings.TrimSpace(r.URL.Query().Get("container"))
+	recursive := r.URL.Query().Get("recursive") == "1"
+
+	var list []shared.WhereUsed
+	errMsg := ""
+	switch {
+	case vault != "" && !validVaultName(vault):
+		errMsg = "Invalid vault " + vault
+	case container != "":
+		if list, err = s.whereUsed(user, vault, container, recursive); err != nil {
+			log.Printf("[ERROR] Failed to find where %s/%s is used: %v", vault, container, err)
+			errMsg = "Failed to search"
+		}
+	}
+
+	vaults, _ := s.visibleVaults(user)
+
+	data := map[string]any{
+		"User":            user,
+		"ThemePreference": user.ThemePreference,
+		"Vaults":          vaults,
+		"Vault":           vault,
+		"Container":       container,
+		"Recursive":       recursive,
+		"WhereUsed":       list,
+		"Error":           errMsg,
+		"BackButtonShow":  true,
+		"BackButtonLink":  "/items",
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.ExecuteTemplate(w, "whereused.html", data)
+}
@@ -5,7 +5,14 @@
 package shared
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/vault/localfs"
 )
 
 type CommandRequest struct {
@@ -29,3 +36,118 @@ func (res CommandResponse) String() string {
 	str, _ := json.Marshal(res)
 	return string(str)
 }
+
+// WhereUsed is a parent container version that refers to a version of a
+// container, the reply of the where used query.
+type WhereUsed struct {
+	Level           int    `json:"level"` // 1 for a direct parent
+	Vault           string `json:"vault"`
+	ContainerNumber string `json:"container"`
+	Path            string `json:"path"`
+	Name            string `json:"name"`
+	Version         int16  `json:"version"`
+	ItemID          uint   `json:"item_id,omitempty"`
+	PartNumber      string `json:"part_number,omitempty"`
+	ChildVault      string `json:"child_vault"`
+	ChildContainer  string `json:"child_container"`
+	ChildVersion    int16  `json:"child_version"`
+}
+
+// VersionInfo is a version of a container, a line of the reply of the
+// "versions" command.
+type VersionInfo struct {
+	Number      int16  `json:"number"`
+	Pretty      string `json:"pretty"`
+	Date        string `json:"date"`
+	LockedBy    string `json:"locked_by,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// String encodes the version as a colon separated line, like VER.txt
+func (v VersionInfo) String() string {
+	var buf strings.Builder
+	w := csv.NewWriter(&buf)
+	w.Comma = ':'
+	w.Write([]string{strconv.Itoa(int(v.Number)), v.Pretty, v.Date, v.LockedBy, v.Description})
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// ParseVersionInfo decodes a line that String encoded
+func ParseVersionInfo(line string) (VersionInfo, error) {
+	r := csv.NewReader(strings.NewReader(line))
+	r.Comma = ':'
+	rec, err := r.Read()
+	if err != nil {
+		return VersionInfo{}, err
+	}
+	if len(rec) != 5 {
+		return VersionInfo{}, fmt.Errorf("invalid version %q", line)
+	}
+	nr, err := strconv.ParseInt(rec[0], 10, 16)
+	if err != nil {
+		return VersionInfo{}, fmt.Errorf("invalid version %q", line)
+	}
+	return VersionInfo{Number: int16(nr), Pretty: rec[1], Date: rec[2], LockedBy: rec[3], Description: rec[4]}, nil
+}
+
+// StateProperty is the version property with the revision state of the
+// version, like "Released".
+const StateProperty = localfs.StateProperty
+
+// RevisionStates are the revision states of a version, the values of
+// db.RevisionState.
+var RevisionStates = []string{"Concept", "Under Review", "Released", "In-Work", "Depreciated"}
+
+// SearchResult is a container that matches a search, with its latest
+// version.
+type SearchResult struct {
+	Vault           string `json:"vault"`
+	ContainerNumber string `json:"container"`
+	Path            string `json:"path"`
+	Name            string `json:"name"`
+	PartNumber      string `json:"part_number,omitempty"`
+	Version         int16  `json:"version"`
+	Description     string `json:"description,omitempty"`
+	State           string `json:"state,omitempty"`
+	LockedBy        string `json:"locked_by,omitempty"`
+}
+
+// PropertiesParam encodes the properties of a version, such as the volume
+// and material of a model, for the "properties" parameter of the checkin
+// command
+func PropertiesParam(props map[string]string) string {
+	buf, _ := json.Marshal(props)
+	return string(buf)
+}
+
+// ParsePropertiesParam decodes the "properties" parameter. A key can't be
+// empty or hold " = " or a line break, a value can't hold a line break.
+func ParsePropertiesParam(param string) (map[string]string, error) {
+	var props map[string]string
+	if err := json.Unmarshal([]byte(param), &props); err != nil {
+		return nil, fmt.Errorf("invalid properties: %w", err)
+	}
+	for key, value := range props {
+		if strings.TrimSpace(key) == "" || strings.Contains(key, " = ") || strings.ContainsAny(key+value, "\r\n") {
+			return nil, fmt.Errorf("invalid property %q", key)
+		}
+	}
+	return props, nil
+}
+
+// ReferencesParam encodes the containers that a version uses, for the
+// "references" parameter of the checkin command
+func ReferencesParam(refs []layout.Reference) string {
+	buf, _ := json.Marshal(refs)
+	return string(buf)
+}
+
+// ParseReferencesParam decodes the "references" parameter
+func ParseReferencesParam(param string) ([]layout.Reference, error) {
+	var refs []layout.Reference
+	if err := json.Unmarshal([]byte(param), &refs); err != nil {
+		return nil, fmt.Errorf("invalid references: %w", err)
+	}
+	return refs, nil
+}
@@ -0,0 +1,365 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package dropfolder imports the files that are dropped into the
+// directories of a vault, for instance with drag-and-drop on the file
+// share. A file is imported into the directory where it was dropped, for
+// the user that owns it, once it stopped changing. A file that can't be
+// imported is moved to the quarantine of its vault, with the reason next to
+// it.
+package dropfolder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/grd/FreePDM/internal/config"
+	"github.com/grd/FreePDM/internal/util"
+	"github.com/grd/FreePDM/internal/vault/localfs"
+)
+
+// QuarantineDir is the directory in the vaults directory with the files
+// that could not be imported, by vault.
+const QuarantineDir = ".quarantine"
+
+// Options configure an Importer
+type Options struct {
+	Root   string          // the vaults directory
+	Vaults map[string]bool // the vaults whose directories are drop folders
+	Settle time.Duration   // a file is imported when it did not change this long, 2 seconds when zero
+
+	// Allow tells whether the user may import into the directory dir of the
+	// vault, nil allows everybody.
+	Allow func(user, vault, dir string) error
+}
+
+// pending is a dropped file that is still being written, perhaps
+type pending struct {
+	size  int64
+	mod   time.Time
+	timer *time.Timer
+}
+
+// Importer imports the files of the drop folders, see Run
+type Importer struct {
+	opts    Options
+	w       *fsnotify.Watcher
+	pending map[string]*pending // abs file -> the last state, only used by Run
+	settled chan string         // files whose timer went off
+	jobs    chan string         // files that are ready for the import
+	done    chan struct{}       // closed when Run returns
+}
+
+// New returns an Importer of the vaults that are enabled in the options
+func New(opts Options) (*Importer, error) {
+	if opts.Settle == 0 {
+		opts.Settle = 2 * time.Second
+	}
+	if !util.DirExists(opts.Root) {
+		return nil, fmt.Errorf("vaults directory %s does not exist", opts.Root)
+	}
+	for vault, on := range opts.Vaults {
+		if on && !util.DirExists(filepath.Join(opts.Root, vault)) {
+			return nil, fmt.Errorf("vault %s does not exist", vault)
+		}
+	}
+
+	return &Importer{
+		opts:    opts,
+		pending: map[string]*pending{},
+		settled: make(chan string, 64),
+		jobs:    make(chan string, 256),
+	}, nil
+}
+
+// Run watches the drop folders and imports the files that are dropped into
+// them, and the files that were there already. It returns when the context
+// ends, after the import that runs at that moment.
+func (im *Importer) Run(ctx context.Context) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	im.w = w
+	im.done = make(chan struct{})
+	defer close(im.done)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		im.work(ctx)
+	}()
+	defer wg.Wait()
+
+	for vault, on := range im.opts.Vaults {
+		if !on {
+			continue
+		}
+		if err := im.addTree(filepath.Join(im.opts.Root, vault)); err != nil {
+			return err
+		}
+		log.Printf("[INFO] Importing the files dropped into vault %s", vault)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, p := range im.pending {
+				p.timer.Stop()
+			}
+			return nil
+
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			im.noteChange(ev)
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("[ERROR] Watching the drop folders: %v", err)
+
+		case file := <-im.settled:
+			im.checkSettled(ctx, file)
+		}
+	}
+}
+
+// dropDir tells whether a directory of a vault is a drop folder: not a
+// container and not hidden.
+func dropDir(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	_, err := util.Atoi64(name)
+	return err != nil
+}
+
+// dropFile tells whether a file can be imported. Hidden files and the
+// temporary files of editors and file managers stay where they are.
+func dropFile(name string) bool {
+	return !strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "~") &&
+		!strings.HasSuffix(name, ".part") && !strings.HasSuffix(name, ".tmp")
+}
+
+// addTree watches a drop folder and the drop folders in it, and schedules
+// the files that are in them.
+func (im *Importer) addTree(root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil // removed meanwhile
+		}
+		if d.IsDir() {
+			if p != root && !dropDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return im.w.Add(p)
+		}
+		if d.Type().IsRegular() && dropFile(d.Name()) {
+			im.schedule(p)
+		}
+		return nil
+	})
+}
+
+// noteChange handles a change in a drop folder
+func (im *Importer) noteChange(ev fsnotify.Event) {
+	name := filepath.Base(ev.Name)
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		if p, ok := im.pending[ev.Name]; ok {
+			p.timer.Stop()
+			delete(im.pending, ev.Name)
+		}
+		return
+	}
+	if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+		return
+	}
+
+	fi, err := os.Lstat(ev.Name)
+	if err != nil {
+		return // gone already
+	}
+	switch {
+	case fi.IsDir():
+		if ev.Has(fsnotify.Create) && dropDir(name) {
+			// A new folder, or one that was moved in with its files
+			if err := im.addTree(ev.Name); err != nil {
+				log.Printf("[ERROR] Watching %s: %v", ev.Name, err)
+			}
+		}
+	case fi.Mode().IsRegular() && dropFile(name):
+		im.schedule(ev.Name)
+	}
+}
+
+// schedule starts or restarts the wait of a file until it settles
+func (im *Importer) schedule(file string) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+	if p, ok := im.pending[file]; ok {
+		p.size, p.mod = fi.Size(), fi.ModTime()
+		p.timer.Reset(im.opts.Settle)
+		return
+	}
+	im.pending[file] = &pending{
+		size: fi.Size(),
+		mod:  fi.ModTime(),
+		timer: time.AfterFunc(im.opts.Settle, func() {
+			select {
+			case im.settled <- file:
+			case <-im.done:
+			}
+		}),
+	}
+}
+
+// checkSettled hands a file to the import when it did not change since it
+// was scheduled, otherwise it waits again.
+func (im *Importer) checkSettled(ctx context.Context, file string) {
+	p, ok := im.pending[file]
+	if !ok {
+		return
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		delete(im.pending, file)
+		return
+	}
+	if fi.Size() != p.size || !fi.ModTime().Equal(p.mod) {
+		p.size, p.mod = fi.Size(), fi.ModTime()
+		p.timer.Reset(im.opts.Settle)
+		return
+	}
+	delete(im.pending, file)
+
+	select {
+	case im.jobs <- file:
+	case <-ctx.Done():
+	}
+}
+
+// work imports the files one by one, the vaults are not safe for
+// concurrent imports.
+func (im *Importer) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case file := <-im.jobs:
+			vault, dir := im.place(file)
+			if err := im.importFile(vault, dir, file); err != nil {
+				log.Printf("[ERROR] Failed to import %s into vault %s: %v", file, vault, err)
+				if err := im.quarantine(vault, file, err); err != nil {
+					log.Printf("[ERROR] Failed to quarantine %s: %v", file, err)
+				}
+			}
+		}
+	}
+}
+
+// place returns the vault and the directory in the vault of a file
+func (im *Importer) place(file string) (vault, dir string) {
+	rel, _ := filepath.Rel(im.opts.Root, filepath.Dir(file))
+	vault, dir, _ = strings.Cut(filepath.ToSlash(rel), "/")
+	return vault, dir
+}
+
+// importFile imports a file into the directory dir of the vault for its
+// owner, and removes it.
+func (im *Importer) importFile(vault, dir, file string) error {
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return nil // taken away meanwhile
+	}
+	owner, err := fileOwner(file)
+	if err != nil {
+		return err
+	}
+	if im.opts.Allow != nil {
+		if err := im.opts.Allow(owner, vault, dir); err != nil {
+			return err
+		}
+	}
+
+	fsys, err := localfs.NewFileSystem(vault, owner)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(file)
+	if item, err := fsys.GetItem(dir, name); err == nil {
+		return fmt.Errorf("%s exists already as container %s, check out a new version instead", name, item.ContainerNumber)
+	}
+	fl, err := fsys.ImportFile(dir, file)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil {
+		return fmt.Errorf("imported as container %s, but the dropped file stays: %w", fl.ContainerNumber, err)
+	}
+
+	log.Printf("[INFO] Imported %s for %s as container %s of vault %s", file, owner, fl.ContainerNumber, vault)
+	return nil
+}
+
+// fileOwner returns the FreePDM user that owns a file
+func fileOwner(file string) (string, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", fmt.Errorf("the owner of %s is not known", file)
+	}
+	for name, uid := range config.Users() {
+		if uid == int(stat.Uid) && name != "vault" {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("the owner of %s, uid %d, is not a FreePDM user", file, stat.Uid)
+}
+
+// quarantine moves a file that failed to the quarantine of its vault, with
+// the reason in a file next to it.
+func (im *Importer) quarantine(vault, file string, reason error) error {
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	rel, err := filepath.Rel(filepath.Join(im.opts.Root, vault), file)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(im.opts.Root, QuarantineDir, vault, rel)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if util.FileExists(dst) {
+		base, ext := localfs.SplitExt(dst)
+		dst = base + time.Now().Format("-20060102-150405") + ext
+	}
+	if err := os.Rename(file, dst); err != nil {
+		return err
+	}
+	return os.WriteFile(dst+".error", []byte(reason.Error()+"\n"), 0o644)
+}
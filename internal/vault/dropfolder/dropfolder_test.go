@@ -0,0 +1,184 @@
+package dropfolder
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestDropNames(t *testing.T) {
+	dirs := map[string]bool{
+		"parts":       true,
+		"Pump 2":      true,
+		"12":          false, // a container
+		".quarantine": false,
+		".git":        false,
+	}
+	for name, want := range dirs {
+		if got := dropDir(name); got != want {
+			t.Errorf("dropDir(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	files := map[string]bool{
+		"bracket.FCStd":       true,
+		"datasheet.pdf":       true,
+		".bracket.FCStd":      false,
+		"~lock.bracket.FCStd": false,
+		"bracket.FCStd.part":  false,
+		"bracket.tmp":         false,
+	}
+	for name, want := range files {
+		if got := dropFile(name); got != want {
+			t.Errorf("dropFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+// newTestImporter returns an importer of the vault "main" in a temporary
+// vaults directory
+func newTestImporter(t *testing.T) *Importer {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "main", "parts"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	im, err := New(Options{Root: root, Vaults: map[string]bool{"main": true}, Settle: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return im
+}
+
+func TestPlace(t *testing.T) {
+	im := newTestImporter(t)
+
+	tests := []struct {
+		file, vault, dir string
+	}{
+		{"main/bracket.FCStd", "main", ""},
+		{"main/parts/bracket.FCStd", "main", "parts"},
+		{"main/parts/pumps/bracket.FCStd", "main", "parts/pumps"},
+	}
+	for _, tt := range tests {
+		vault, dir := im.place(filepath.Join(im.opts.Root, filepath.FromSlash(tt.file)))
+		if vault != tt.vault || dir != tt.dir {
+			t.Errorf("place(%s) = %q, %q; want %q, %q", tt.file, vault, dir, tt.vault, tt.dir)
+		}
+	}
+}
+
+// waitSettled waits for the timer of a scheduled file
+func waitSettled(t *testing.T, im *Importer) string {
+	t.Helper()
+	select {
+	case file := <-im.settled:
+		return file
+	case <-time.After(5 * time.Second):
+		t.Fatal("the file did not settle")
+		return ""
+	}
+}
+
+// A file is imported only when it did not change during the settle time
+func TestSettle(t *testing.T) {
+	im := newTestImporter(t)
+	ctx := context.Background()
+	file := filepath.Join(im.opts.Root, "main", "parts", "bracket.FCStd")
+	if err := os.WriteFile(file, []byte("part"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Still being written: it waits again
+	im.schedule(file)
+	if err := os.WriteFile(file, []byte("part, longer"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	im.checkSettled(ctx, waitSettled(t, im))
+	if len(im.jobs) != 0 || im.pending[file] == nil {
+		t.Fatal("a file that grew is imported")
+	}
+
+	// The same size, but written again
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	im.checkSettled(ctx, waitSettled(t, im))
+	if len(im.jobs) != 0 || im.pending[file] == nil {
+		t.Fatal("a file with a new modification time is imported")
+	}
+
+	im.checkSettled(ctx, waitSettled(t, im))
+	if len(im.jobs) != 1 || <-im.jobs != file || len(im.pending) != 0 {
+		t.Fatal("a settled file is not imported")
+	}
+
+	// A removed file is forgotten
+	im.schedule(file)
+	im.noteChange(fsnotify.Event{Name: file, Op: fsnotify.Remove})
+	if len(im.pending) != 0 {
+		t.Error("a removed file is still pending")
+	}
+	im.schedule(file)
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	im.checkSettled(ctx, waitSettled(t, im))
+	if len(im.jobs) != 0 || len(im.pending) != 0 {
+		t.Error("a file that is gone is imported")
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	im := newTestImporter(t)
+	reason := errors.New("bracket.FCStd exists already")
+
+	drop := func() string {
+		file := filepath.Join(im.opts.Root, "main", "parts", "bracket.FCStd")
+		if err := os.WriteFile(file, []byte("part"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	file := drop()
+	if err := im.quarantine("main", file, reason); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(im.opts.Root, QuarantineDir, "main", "parts", "bracket.FCStd")
+	if _, err := os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the dropped file stays: %v", err)
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Errorf("not in the quarantine: %v", err)
+	}
+	buf, err := os.ReadFile(dst + ".error")
+	if err != nil || strings.TrimSpace(string(buf)) != reason.Error() {
+		t.Errorf("reason %q, %v", buf, err)
+	}
+
+	// A second file of the same name keeps the first one
+	file = drop()
+	if err := im.quarantine("main", file, reason); err != nil {
+		t.Fatal(err)
+	}
+	list, err := filepath.Glob(filepath.Join(im.opts.Root, QuarantineDir, "main", "parts", "bracket-*.FCStd"))
+	if err != nil || len(list) != 1 {
+		t.Errorf("the second file in the quarantine: %v, %v", list, err)
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Errorf("the first file is gone: %v", err)
+	}
+
+	// A file that is gone already is no error
+	if err := im.quarantine("main", file, reason); err != nil {
+		t.Errorf("quarantine of a file that is gone: %v", err)
+	}
+}
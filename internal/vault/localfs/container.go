@@ -14,6 +14,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -26,6 +27,8 @@ const (
 	Description     = "Description.txt"
 	LongDescription = "LongDescription.txt"
 	Ver             = "VER.txt"
+	PartNumber      = "PartNumber.txt"
+	References      = "References.txt"
 )
 
 // File Directory related struct.
@@ -189,26 +192,50 @@ func (fd FileDirectory) StoreData(version FileVersion, descr, longDescr string)
 	}
 }
 
+// Stores the part number of the container. The number is issued by the
+// numbering service and doesn't change anymore.
+func (fd FileDirectory) SetPartNumber(number string) error {
+	file := filepath.Join(fd.dir, PartNumber)
+	if util.FileExists(file) {
+		return fmt.Errorf("container %s already has a part number", fd.fl.ContainerNumber)
+	}
+
+	if err := os.WriteFile(file, []byte(number), 0444); err != nil {
+		return err
+	}
+	return os.Chown(file, fd.fs.userUid, fd.fs.vaultUid)
+}
+
+// Returns the part number of the container, or "" when there is none.
+func (fd FileDirectory) PartNumber() string {
+	buf, err := os.ReadFile(filepath.Join(fd.dir, PartNumber))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
 // Returns the file properties of the latest version
 func (fd FileDirectory) LatestProperties() []FileProperties {
 	release := fd.LatestVersion()
 	return fd.Properties(release)
 }
 
-// Returns the file properties of the specific version
+// Returns the file properties of the specific version, or nil when the
+// version has no properties.
 func (fd FileDirectory) Properties(version FileVersion) []FileProperties {
-	buf, err := os.ReadFile(filepath.Join(version.Pretty, Properties))
-	util.CheckErr(err)
-	str := string(buf)
-	// check for latest '\n'
-	if str[len(str)-1] == '\n' {
-		str = str[:len(str)-2]
+	buf, err := os.ReadFile(filepath.Join(fd.dir, version.Pretty, Properties))
+	if err != nil {
+		return nil
 	}
-	splitStr := strings.Split(str, "\n")
-	props := make([]FileProperties, len(splitStr))
-	for _, v := range splitStr {
-		kv := strings.Split(v, " = ")
-		props = append(props, FileProperties{Key: kv[0], Value: kv[1]})
+
+	var props []FileProperties
+	for _, line := range strings.Split(string(buf), "\n") {
+		key, value, ok := strings.Cut(line, " = ")
+		if !ok {
+			continue
+		}
+		props = append(props, FileProperties{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value)})
 	}
 	return props
 }
@@ -221,14 +248,51 @@ func (fd FileDirectory) SetLatestProperties(props []FileProperties) {
 
 // Sets the file properties of the specific version
 func (fd FileDirectory) SetProperties(version FileVersion, props []FileProperties) {
-	buf := make([]byte, len(props)*20)
+	var buf []byte
 	for _, v := range props {
-		str := []byte(fmt.Sprintf("%s = %s\n", v.Key, v.Value))
-		buf = append(buf, str...)
+		buf = fmt.Appendf(buf, "%s = %s\n", v.Key, v.Value)
+	}
+	file := filepath.Join(fd.dir, version.Pretty, Properties)
+	err := os.WriteFile(file, buf, 0644)
+	util.CheckErr(err)
+	err = os.Chown(file, fd.fs.userUid, fd.fs.vaultUid)
+	util.CheckErr(err)
+}
+
+// Returns the references of the specific version, or nil when the version
+// doesn't refer to other containers. Each line holds the vault, the
+// container number and the version.
+func (fd FileDirectory) References(version FileVersion) []FileReference {
+	buf, err := os.ReadFile(filepath.Join(fd.dir, version.Pretty, References))
+	if err != nil {
+		return nil
+	}
+
+	var refs []FileReference
+	for _, line := range strings.Split(string(buf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		nr, err := strconv.ParseInt(fields[2], 10, 16)
+		if err != nil {
+			continue
+		}
+		refs = append(refs, FileReference{Vault: fields[0], ContainerNumber: fields[1], Version: int16(nr)})
+	}
+	return refs
+}
+
+// Sets the references of the specific version
+func (fd FileDirectory) SetReferences(version FileVersion, refs []FileReference) {
+	var buf []byte
+	for _, r := range refs {
+		buf = fmt.Appendf(buf, "%s %s %d\n", r.Vault, r.ContainerNumber, r.Version)
 	}
-	err := os.WriteFile(filepath.Join(version.Pretty, Properties), buf, 0644)
+	file := filepath.Join(fd.dir, version.Pretty, References)
+	err := os.WriteFile(file, buf, 0644)
 	util.CheckErr(err)
-	err = os.Chown(filepath.Join(version.Pretty, Properties), fd.fs.userUid, fd.fs.vaultUid)
+	err = os.Chown(file, fd.fs.userUid, fd.fs.vaultUid)
 	util.CheckErr(err)
 }
 
@@ -0,0 +1,127 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package localfs
+
+import (
+	"slices"
+	"sync"
+)
+
+// EventKind tells what happened to a container
+type EventKind string
+
+const (
+	EventImport     EventKind = "import"     // a file is imported into a new container
+	EventAllocate   EventKind = "allocate"   // an empty container is allocated
+	EventAssign     EventKind = "assign"     // a file is assigned to an allocated container
+	EventCheckOut   EventKind = "checkout"   // a version is checked out
+	EventCheckIn    EventKind = "checkin"    // a version is checked in
+	EventRelease    EventKind = "release"    // a check-out is undone, without a check-in
+	EventNewVersion EventKind = "newversion" // a new version is created
+	EventRename     EventKind = "rename"     // the file is renamed or moved
+	EventRemove     EventKind = "remove"     // the container is removed
+	EventState      EventKind = "state"      // a checked in version has another revision state
+)
+
+// StateProperty is the version property with the revision state of the
+// version, like "Released".
+const StateProperty = "State"
+
+// Event describes a change of a container in a vault
+type Event struct {
+	Kind            EventKind         `json:"kind"`
+	Vault           string            `json:"vault"`
+	User            string            `json:"user"`
+	ContainerNumber string            `json:"container"`
+	Path            string            `json:"path"`               // directory of the container inside the vault
+	OldPath         string            `json:"old_path,omitempty"` // directory before a move
+	Name            string            `json:"name,omitempty"`     // file name
+	Version         int16             `json:"version,omitempty"`
+	PartNumber      string            `json:"part_number,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	LongDescription string            `json:"long_description,omitempty"`
+	State           string            `json:"state,omitempty"`      // the new revision state
+	Properties      map[string]string `json:"properties,omitempty"` // of the checked in version
+	References      []FileReference   `json:"references,omitempty"` // of the checked in version
+}
+
+// stateOf returns the revision state of the properties
+func stateOf(props []FileProperties) string {
+	for _, p := range props {
+		if p.Key == StateProperty {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// renameEvent reports a file that was renamed or moved from one place to
+// another
+func renameEvent(from, to FileList) Event {
+	ev := Event{Kind: EventRename, ContainerNumber: to.ContainerNumber, Path: to.Path, Name: to.Name}
+	if from.Path != to.Path {
+		ev.OldPath = from.Path
+	}
+	return ev
+}
+
+// propertyMap turns the properties of a version into a map
+func propertyMap(props []FileProperties) map[string]string {
+	if len(props) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(props))
+	for _, p := range props {
+		m[p.Key] = p.Value
+	}
+	return m
+}
+
+// eventHandler is a registered function, the id takes it away again
+type eventHandler struct {
+	id int
+	fn func(Event)
+}
+
+var (
+	eventMu       sync.RWMutex
+	eventHandlers []eventHandler
+	eventLastID   int
+)
+
+// OnEvent registers a function that is called after every change of a
+// container, for instance to keep a database in sync with the vaults. The
+// function runs synchronously inside the file system operation. Calling the
+// returned function unregisters it.
+func OnEvent(fn func(Event)) (remove func()) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	eventLastID++
+	id := eventLastID
+	eventHandlers = append(eventHandlers, eventHandler{id: id, fn: fn})
+
+	return func() {
+		eventMu.Lock()
+		defer eventMu.Unlock()
+		eventHandlers = slices.DeleteFunc(slices.Clone(eventHandlers), func(h eventHandler) bool { return h.id == id })
+	}
+}
+
+// emit sends an event of this vault and user to the registered handlers
+func (fs *FileSystem) emit(ev Event) {
+	eventMu.RLock()
+	handlers := eventHandlers
+	eventMu.RUnlock()
+
+	if len(handlers) == 0 {
+		return
+	}
+
+	ev.Vault = fs.VaultName()
+	ev.User = fs.user
+	for _, h := range handlers {
+		h.fn(ev)
+	}
+}
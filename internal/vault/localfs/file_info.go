@@ -25,6 +25,7 @@ const (
 // The FileInfo struct
 type FileInfo struct {
 	containerNumber string
+	partNumber      string
 	isDir           bool // Is it a directory or a file?
 	name            string
 	dir             string
@@ -46,6 +47,15 @@ type FileProperties struct {
 	Key, Value string
 }
 
+// A reference of a version to a version of another container, for
+// instance the parts of an assembly or the model of a drawing. The vault
+// can be another vault.
+type FileReference struct {
+	Vault           string
+	ContainerNumber string
+	Version         int16
+}
+
 func (fi FileInfo) String() string {
 	return filepath.Join(fi.Path(), fi.Name())
 }
@@ -64,6 +74,9 @@ func (fi FileInfo) DirSort() int {
 // Returns the Container Number
 func (fi FileInfo) ContainerNumber() string { return fi.containerNumber }
 
+// Returns the part number, or "" when the container has none
+func (fi FileInfo) PartNumber() string { return fi.partNumber }
+
 // Returns the directory or file name
 func (fi FileInfo) Name() string {
 	return fi.name
@@ -63,6 +63,12 @@ var (
 	vaultsRoot, vaultsDataRoot string // vaultsRoot is the root directory, vaultsdataRoot is the administration part
 )
 
+// The errors of NewFileSystem, which the server answers instead of stopping
+var (
+	ErrVaultNotFound = errors.New("vault not found")
+	ErrUnknownUser   = errors.New("user is not in the FreePDM config file")
+)
+
 // func init() {
 // 	// check for config file
 // 	vaultsRoot = config.VaultsDir()
@@ -89,8 +95,14 @@ func NewFileSystem(vaultDir, userName string) (fs *FileSystem, err error) {
 
 	// Check whether vaults directory contains slaches
 	parts := strings.Split(vaultDir, "/")
-	if len(parts) != 1 {
-		log.Fatalf("multi-level vaultDir parameter: %s", vaultDir)
+	if len(parts) != 1 || vaultDir == "" || strings.HasPrefix(vaultDir, ".") {
+		return nil, fmt.Errorf("%w: %q", ErrVaultNotFound, vaultDir)
+	}
+
+	// The server uses the vaults directory of the config file
+	if vaultsRoot == "" {
+		vaultsRoot = config.VaultsDir()
+		vaultsDataRoot = filepath.Join(vaultsRoot, "/.data")
 	}
 
 	// Some settings
@@ -99,18 +111,19 @@ func NewFileSystem(vaultDir, userName string) (fs *FileSystem, err error) {
 	fs.user = userName
 
 	// check whether the critical directories exist.
-	util.CriticalDirExist(fs.vaultDir)
-	util.CriticalDirExist(fs.dataDir)
+	if !util.DirExists(fs.vaultDir) || !util.DirExists(fs.dataDir) {
+		return nil, fmt.Errorf("%w: %s", ErrVaultNotFound, vaultDir)
+	}
 
 	fs.vaultUid = config.GetUid("vault")
 	fs.userUid = config.GetUid(userName)
 
 	if fs.userUid == -1 {
-		log.Fatalf("Username %s has not been stored into the FreePDM config file, please follow the setup process", userName)
+		return nil, fmt.Errorf("%w: %s, please follow the setup process", ErrUnknownUser, userName)
 	}
 
 	if fs.vaultUid == 0 || fs.vaultUid == -1 {
-		log.Fatal("Vault UID has not been stored into the FreePDM config file. Please follow the setup process.")
+		return nil, errors.New("vault UID has not been stored into the FreePDM config file, please follow the setup process")
 	}
 
 	index, err := NewFileIndex(fs)
@@ -126,8 +139,9 @@ func NewFileSystem(vaultDir, userName string) (fs *FileSystem, err error) {
 		return nil, err
 	}
 
-	err = os.Chdir(fs.vaultDir)
-	util.CheckErr(err)
+	if err = os.Chdir(fs.vaultDir); err != nil {
+		return nil, err
+	}
 
 	log.Printf("Vault dir: %s", fs.VaultDir())
 
@@ -203,6 +217,11 @@ func (fs *FileSystem) VaultDir() string {
 	return fs.vaultDir
 }
 
+// Returns the directory with the file index and the checked out versions
+func (fs *FileSystem) DataDir() string {
+	return fs.dataDir
+}
+
 // Updates the locked index by reading from the lockedTxt file.
 func (fs *FileSystem) ReadLockedIndex() error {
 
@@ -240,6 +259,12 @@ func (fs *FileSystem) ReadLockedIndex() error {
 	return nil
 }
 
+// Chown gives a file of the vault the owner and the group of the files
+// that the file system writes, the user and the vault.
+func (fs *FileSystem) Chown(name string) error {
+	return os.Chown(name, fs.userUid, fs.vaultUid)
+}
+
 // Writes a file in a read-only directory structure
 func (fs *FileSystem) DataWriteFile(name string, data []byte) error {
 	// Mutex to ensure only one operation modifies permissions at a time
@@ -354,6 +379,11 @@ func (fs *FileSystem) ImportFile(dstDir, fileName string) (*FileList, error) {
 
 	log.Printf("imported %s into %s with version %d", fileName, fl.Name, 0)
 
+	// An allocation is reported by Allocate itself
+	if fl.Name != EmptyFile {
+		fs.emit(Event{Kind: EventImport, ContainerNumber: fl.ContainerNumber, Path: fl.Path, Name: fl.Name})
+	}
+
 	return fl, nil
 }
 
@@ -442,6 +472,8 @@ func (fs *FileSystem) ImportUrl(dstDir, url string) (*FileList, error) {
 
 	log.Printf("imported %s into %s with version %d", url, fl.Name, 0)
 
+	fs.emit(Event{Kind: EventImport, ContainerNumber: fl.ContainerNumber, Path: fl.Path, Name: fl.Name})
+
 	return fl, nil
 }
 
@@ -449,6 +481,17 @@ func (fs *FileSystem) ImportUrl(dstDir, url string) (*FileList, error) {
 // The new container inside the PDM gets a revision number automatically and is checked out.
 // The function returns the FileList structure of the imported file or an error.
 func (fs *FileSystem) Allocate(dstDir string) (*FileList, error) {
+	fl, err := fs.allocate(dstDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.emit(Event{Kind: EventAllocate, ContainerNumber: fl.ContainerNumber, Path: fl.Path})
+
+	return fl, nil
+}
+
+func (fs *FileSystem) allocate(dstDir string) (*FileList, error) {
 	file, err := os.CreateTemp("", EmptyFile)
 	if err != nil {
 		return nil, err
@@ -470,6 +513,33 @@ func (fs *FileSystem) Allocate(dstDir string) (*FileList, error) {
 	return fl, nil
 }
 
+// Allocates an empty file container with a part number of the numbering service.
+func (fs *FileSystem) AllocateWithNumber(dstDir, number string) (*FileList, error) {
+	fl, err := fs.allocate(dstDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := NewFileDirectory(fs, *fl).SetPartNumber(number); err != nil {
+		return fl, fmt.Errorf("failed to store part number %s: %w", number, err)
+	}
+
+	log.Printf("allocated container %s with part number %s", fl.ContainerNumber, number)
+
+	fs.emit(Event{Kind: EventAllocate, ContainerNumber: fl.ContainerNumber, Path: fl.Path, PartNumber: number})
+
+	return fl, nil
+}
+
+// Returns the part number of a container, or "" when there is none.
+func (fs *FileSystem) PartNumber(containerNumber string) (string, error) {
+	fl, err := fs.index.ContainerNumberToFileList(containerNumber)
+	if err != nil {
+		return "", err
+	}
+	return NewFileDirectory(fs, fl).PartNumber(), nil
+}
+
 // Assigns the file name to the container.
 // The new container inside the PDM gets a revision number automatically.
 // The function returns the FileList structure of the imported file or an error.
@@ -511,6 +581,8 @@ func (fs *FileSystem) Assign(containerNumber, fileName string) error {
 
 	log.Printf("assigned %s into %s", fileName, fl.ContainerNumber)
 
+	fs.emit(Event{Kind: EventAssign, ContainerNumber: fl.ContainerNumber, Path: fl.Path, Name: fileName})
+
 	return nil
 }
 
@@ -538,14 +610,67 @@ func (fs *FileSystem) NewVersion(fl FileList) (*FileVersion, error) {
 		return nil, err
 	}
 
+	fs.emit(Event{Kind: EventNewVersion, ContainerNumber: fl.ContainerNumber, Path: fl.Path, Name: fl.Name, Version: newVersion.Number})
+
 	return newVersion, nil
 }
 
+// Returns the file list of a container number or an error.
+func (fs *FileSystem) ContainerFileList(containerNumber string) (FileList, error) {
+	return fs.index.ContainerNumberToFileList(containerNumber)
+}
+
+// Returns the versions of a container, oldest first, or an error.
+func (fs *FileSystem) Versions(fl FileList) ([]FileVersion, error) {
+	fd := NewFileDirectory(fs, fl)
+	if !util.FileExists(filepath.Join(fd.dir, Ver)) {
+		return nil, fmt.Errorf("container %s has no versions", fl.ContainerNumber)
+	}
+
+	versions, err := fd.AllFileVersions()
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 1 && versions[0].Number < 0 {
+		return nil, nil // only the header
+	}
+	return versions, nil
+}
+
+// Returns the description of a version, empty when it has none.
+func (fs *FileSystem) VersionDescription(fl FileList, version FileVersion) string {
+	buf, _ := os.ReadFile(filepath.Join(fs.vaultDir, fl.Path, fl.ContainerNumber, version.Pretty, Description))
+	return string(buf)
+}
+
 // Returns the number of an item
 func (fs FileSystem) GetItem(dir, file string) (FileList, error) {
 	return fs.index.FileNameToFileList(dir, file)
 }
 
+// Returns the items in dir and in its subdirectories
+func (fs FileSystem) Items(dir string) []FileList {
+	if dir == "." {
+		dir = ""
+	}
+	var list []FileList
+	for _, item := range fs.index.fileList {
+		if dir == "" || item.Path == dir || strings.HasPrefix(item.Path, dir+"/") {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Reads the file index and the checked out versions again, after the
+// local copy was synced with the server.
+func (fs *FileSystem) Reread() error {
+	if err := fs.index.Read(); err != nil {
+		return err
+	}
+	return fs.ReadLockedIndex()
+}
+
 // Creates a new directory inside the current directory, with the correct uid and gid.
 func (fs FileSystem) Mkdir(dir string) error {
 
@@ -567,6 +692,25 @@ func (fs FileSystem) Mkdir(dir string) error {
 	return nil
 }
 
+// Removes an empty directory of the vault. Containers are removed with FileRemove.
+func (fs FileSystem) Rmdir(dir string) error {
+	dir = filepath.Clean(dir)
+	if dir == "." || filepath.IsAbs(dir) || strings.HasPrefix(dir, "..") {
+		return fmt.Errorf("invalid directory %s", dir)
+	}
+	if util.IsNumber(filepath.Base(dir)) {
+		return fmt.Errorf("%s is a container, not a directory", dir)
+	}
+
+	if err := os.Remove(filepath.Join(fs.vaultDir, dir)); err != nil {
+		return err
+	}
+
+	log.Printf("Removed directory: %s\n", dir)
+
+	return nil
+}
+
 // Chdir creates a directory or an error
 func (fs *FileSystem) Chdir(dir string) error {
 
@@ -686,8 +830,17 @@ func (fs FileSystem) ListDir(dirName string) ([]FileInfo, error) {
 				displayName = fmt.Sprintf("Container %s", cnStr)
 			}
 
+			// 7) Part number of the numbering service, if any
+			partNumber := ""
+			if buf, err := os.ReadFile(filepath.Join(containerAbs, PartNumber)); err == nil {
+				partNumber = strings.TrimSpace(string(buf))
+			}
+
 			// Optional: second line helps disambiguate in the UI
 			second := fmt.Sprintf("Container %s", cnStr)
+			if partNumber != "" {
+				second = fmt.Sprintf("%s · Container %s", partNumber, cnStr)
+			}
 			if lockedUser != "" {
 				second += " · Locked by " + lockedUser
 			}
@@ -700,6 +853,7 @@ func (fs FileSystem) ListDir(dirName string) ([]FileInfo, error) {
 				fileLockedOutBy: lockedUser,
 				fileSecondDescr: second, // optional subtitle for UI
 				containerNumber: cnStr,  // same package → ok to set
+				partNumber:      partNumber,
 
 				allocStatus:    allocStatus,
 				allocCandidate: allocCandidate, // real filename if AllocAllocatedWithCandidate
@@ -778,6 +932,7 @@ func (fs *FileSystem) ListTree(dirName string) ([]FileInfo, error) {
 				lockedBy := fs.IsLockedItem(name)
 
 				list = append(list, FileInfo{
+					containerNumber: name,
 					isDir:           false,
 					name:            fileName,
 					dir:             parent,
@@ -841,6 +996,29 @@ func (fs FileSystem) IsLocked(containerNumber string, version FileVersion) strin
 	return "" // Nothing found
 }
 
+// Returns who checked out the version directory pretty of the container
+// in dir, empty when it is not checked out.
+func (fs *FileSystem) VersionCheckedOutBy(dir, containerNumber, pretty string) (string, error) {
+	fd := NewFileDirectory(fs, FileList{ContainerNumber: containerNumber, Path: dir})
+	if _, err := os.Stat(filepath.Join(fd.dir, Ver)); err != nil {
+		return "", fmt.Errorf("container %s not found in %s", containerNumber, dir)
+	}
+
+	versions, err := fd.AllFileVersions()
+	if err != nil {
+		return "", err
+	}
+	for _, version := range versions {
+		if version.Pretty == pretty {
+			if err := fs.ReadLockedIndex(); err != nil {
+				return "", err
+			}
+			return fs.IsLocked(containerNumber, version), nil
+		}
+	}
+	return "", fmt.Errorf("version %s of container %s not found", pretty, containerNumber)
+}
+
 // Check whether the container number is locked.
 // Returns the name of the user who locked it or empty when not locked.
 func (fs FileSystem) IsLockedItem(containerNumber string) string {
@@ -852,6 +1030,17 @@ func (fs FileSystem) IsLockedItem(containerNumber string) string {
 	return "" // Nothing found
 }
 
+// Returns the version of the container that the user checked out and
+// false when the user has none of its versions checked out.
+func (fs FileSystem) CheckedOutVersion(containerNumber, userName string) (int16, bool) {
+	for _, item := range fs.lockedIndex {
+		if item.containerNumber == containerNumber && item.userName == userName {
+			return item.version, true
+		}
+	}
+	return 0, false
+}
+
 // Checkout means locking a conainer number so that only you can use it.
 func (fs *FileSystem) CheckOut(fl FileList, version FileVersion) error {
 	// update the index
@@ -880,6 +1069,8 @@ func (fs *FileSystem) CheckOut(fl FileList, version FileVersion) error {
 
 		log.Printf("Checked out version %d of file %s\n", version.Number, fl.Name)
 
+		fs.emit(Event{Kind: EventCheckOut, ContainerNumber: fl.ContainerNumber, Path: fl.Path, Name: fl.Name, Version: version.Number})
+
 		return nil
 	}
 }
@@ -923,16 +1114,153 @@ func (fs *FileSystem) CheckIn(fl FileList, version FileVersion, descr, longdescr
 
 		log.Printf("Checked in version %d of file %s", version.Number, fl.Name)
 
+		fs.emit(Event{
+			Kind:            EventCheckIn,
+			ContainerNumber: fl.ContainerNumber,
+			Path:            fl.Path,
+			Name:            fl.Name,
+			Version:         version.Number,
+			Description:     descr,
+			LongDescription: longdescr,
+			Properties:      propertyMap(fd.Properties(version)),
+			References:      fd.References(version),
+		})
+
+		if state, changed := fs.stateChange(fd, fl, version); changed {
+			fs.emit(Event{Kind: EventState, ContainerNumber: fl.ContainerNumber, Path: fl.Path, Name: fl.Name, Version: version.Number, State: state})
+		}
+
 		return nil
 	}
 }
 
+// UndoCheckOut releases the check-out of a version by the user without a
+// check-in. The files of the version stay as they are.
+func (fs *FileSystem) UndoCheckOut(fl FileList, version FileVersion) error {
+	if err := fs.ReadLockedIndex(); err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(fs.lockedIndex, func(item LockedIndex) bool {
+		return item.containerNumber == fl.ContainerNumber && item.version == version.Number
+	})
+	if i < 0 || fs.lockedIndex[i].userName != fs.user {
+		return fmt.Errorf("file %s-%d is not checked out by %s", fl.ContainerNumber, version.Number, fs.user)
+	}
+
+	fd := NewFileDirectory(fs, fl)
+	fd.CloseItemVersion(version)
+
+	fs.lockedIndex = slices.Delete(fs.lockedIndex, i, i+1)
+	if err := fs.WriteLockedIndex(); err != nil {
+		return err
+	}
+
+	log.Printf("Released version %d of file %s", version.Number, fl.Name)
+
+	fs.emit(Event{Kind: EventRelease, ContainerNumber: fl.ContainerNumber, Path: fl.Path, Name: fl.Name, Version: version.Number})
+
+	return nil
+}
+
+// stateChange returns the revision state of a checked in version, and
+// whether it differs from the state of the version before it.
+func (fs *FileSystem) stateChange(fd FileDirectory, fl FileList, version FileVersion) (string, bool) {
+	state := stateOf(fd.Properties(version))
+
+	versions, err := fs.Versions(fl)
+	if err != nil {
+		return state, false
+	}
+	previous := ""
+	for _, v := range versions {
+		if v.Number >= 0 && v.Number < version.Number {
+			previous = stateOf(fd.Properties(v))
+		}
+	}
+	return state, state != previous
+}
+
+// Sets the properties of a version that is checked out, for instance the
+// volume of a model. They are stored with the version at check in.
+func (fs *FileSystem) SetProperties(fl FileList, version FileVersion, props []FileProperties) error {
+	if usr := fs.IsLocked(fl.ContainerNumber, version); usr != fs.user {
+		return fmt.Errorf("file %s-%d is not checked out by %s", fl.ContainerNumber, version.Number, fs.user)
+	}
+	NewFileDirectory(fs, fl).SetProperties(version, props)
+	return nil
+}
+
+// Changes some properties of a version that is checked out. The other
+// properties stay, an empty value removes a property.
+func (fs *FileSystem) UpdateProperties(fl FileList, version FileVersion, changes map[string]string) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	props := fs.Properties(fl, version)
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		i := slices.IndexFunc(props, func(p FileProperties) bool { return p.Key == key })
+		if i < 0 {
+			props = append(props, FileProperties{Key: key, Value: changes[key]})
+		} else {
+			props[i].Value = changes[key]
+		}
+	}
+	props = slices.DeleteFunc(props, func(p FileProperties) bool { return p.Value == "" })
+	return fs.SetProperties(fl, version, props)
+}
+
+// Returns the properties of a version
+func (fs *FileSystem) Properties(fl FileList, version FileVersion) []FileProperties {
+	return NewFileDirectory(fs, fl).Properties(version)
+}
+
+// Sets the references of a version that is checked out to the containers
+// it uses, for instance the parts of an assembly. They are stored with the
+// version at check in. A reference without a vault is one of this vault.
+func (fs *FileSystem) SetReferences(fl FileList, version FileVersion, refs []FileReference) error {
+	if usr := fs.IsLocked(fl.ContainerNumber, version); usr != fs.user {
+		return fmt.Errorf("file %s-%d is not checked out by %s", fl.ContainerNumber, version.Number, fs.user)
+	}
+	for i := range refs {
+		if refs[i].Vault == "" {
+			refs[i].Vault = fs.VaultName()
+		}
+		if refs[i].ContainerNumber == "" || strings.ContainsAny(refs[i].Vault+refs[i].ContainerNumber, " \t\n") {
+			return fmt.Errorf("invalid reference %v", refs[i])
+		}
+	}
+	NewFileDirectory(fs, fl).SetReferences(version, refs)
+	return nil
+}
+
+// Returns the references of a version
+func (fs *FileSystem) References(fl FileList, version FileVersion) []FileReference {
+	return NewFileDirectory(fs, fl).References(version)
+}
+
 // Rename a file, for instance when the user wants to use a file with
 // a specified numbering system
 func (fs *FileSystem) FileRename(src, dst string) error {
+	from, item, err := fs.renameFile(src, dst)
+	if err != nil {
+		return err
+	}
+	fs.emit(renameEvent(from, item))
+	return nil
+}
+
+// renameFile renames or moves a file without an event and returns where
+// it was and where it went.
+func (fs *FileSystem) renameFile(src, dst string) (from, to FileList, err error) {
 	// Check whether src is empty
 	if src == "" {
-		return errors.New("empty source")
+		return FileList{}, FileList{}, errors.New("empty source")
 	}
 
 	// Splitting src
@@ -940,27 +1268,27 @@ func (fs *FileSystem) FileRename(src, dst string) error {
 
 	srcAbs, err := filepath.Abs(s)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for %s: %w", src, err)
+		return FileList{}, FileList{}, fmt.Errorf("failed to get absolute path for %s: %w", src, err)
 	}
 
 	srcDir, err := fs.AbsNormal(srcAbs)
 	if err != nil {
-		return err
+		return FileList{}, FileList{}, err
 	}
 
 	srcFl, err := fs.index.FileNameToFileList(srcDir, srcFile)
 	if err != nil {
-		return fmt.Errorf("failed to get container number for %s: %w", src, err)
+		return FileList{}, FileList{}, fmt.Errorf("failed to get container number for %s: %w", src, err)
 	}
 
 	// Check whether dst is empty
 	if dst == "" {
-		return errors.New("empty destination")
+		return FileList{}, FileList{}, errors.New("empty destination")
 	}
 
 	dstAbs, err := filepath.Abs(dst)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for %s: %w", dst, err)
+		return FileList{}, FileList{}, fmt.Errorf("failed to get absolute path for %s: %w", dst, err)
 	}
 
 	// Check wether dst ends with a file or directory
@@ -976,19 +1304,19 @@ func (fs *FileSystem) FileRename(src, dst string) error {
 
 	dstDir, err := fs.AbsNormal(d)
 	if err != nil {
-		return err
+		return FileList{}, FileList{}, err
 	}
 
 	dstFl := FileList{Path: dstDir, Name: dstFile, ContainerNumber: srcFl.ContainerNumber}
 
 	// Check whether dst exists
 	if item, err := fs.index.FileNameToFileList(dstDir, dstFile); err == nil {
-		return fmt.Errorf("file %s already exists and is stored in %s", dst, item.ContainerNumber)
+		return FileList{}, FileList{}, fmt.Errorf("file %s already exists and is stored in %s", dst, item.ContainerNumber)
 	}
 
 	// Check for src file is locked
 	if name := fs.IsLockedItem(srcFl.ContainerNumber); name != "" {
-		return fmt.Errorf("file %s is checked out by %s", src, name)
+		return FileList{}, FileList{}, fmt.Errorf("file %s is checked out by %s", src, name)
 	}
 
 	// Check whether a src and dst are not the same.
@@ -998,12 +1326,12 @@ func (fs *FileSystem) FileRename(src, dst string) error {
 		fd := NewFileDirectory(fs, srcFl)
 
 		if err = fd.fileRename(srcFl.Name, dstFl.Name); err != nil {
-			return fmt.Errorf("failed to rename file from %s to %s: %w", src, dst, err)
+			return FileList{}, FileList{}, fmt.Errorf("failed to rename file from %s to %s: %w", src, dst, err)
 		}
 
 		// Rename the file in the index
 		if err = fs.index.renameItem(srcFl, dstFl.Name); err != nil {
-			return fmt.Errorf("failed to rename item in index: %w", err)
+			return FileList{}, FileList{}, fmt.Errorf("failed to rename item in index: %w", err)
 		}
 	}
 
@@ -1011,23 +1339,23 @@ func (fs *FileSystem) FileRename(src, dst string) error {
 	// In both cases it is a file move operation.
 	if dst[len(dst)-1] == '/' || srcDir != dstDir {
 		if err := fs.fileMove(srcFl, dstFl); err != nil {
-			return err
+			return FileList{}, FileList{}, err
 		}
 	}
 
 	// Verification
 	item, err := fs.index.FileNameToFileList(dstDir, dstFile)
 	if err != nil {
-		return err
+		return FileList{}, FileList{}, err
 	}
 	if err = fs.Verify(item); err != nil {
-		return err
+		return FileList{}, FileList{}, err
 	}
 
 	// Logging
 	log.Printf("File %s renamed to %s\n", filepath.Join(srcFl.Path, srcFl.Name), filepath.Join(dstDir, dstFile))
 
-	return nil
+	return srcFl, item, nil
 }
 
 // Moves a file to a different directory.
@@ -1059,9 +1387,21 @@ func (fs *FileSystem) fileMove(src, dst FileList) error {
 
 // Copy the latest file from src to dst and returns an error.
 func (fs *FileSystem) FileCopy(src, dst string) error {
+	item, err := fs.copyFile(src, dst)
+	if err != nil {
+		return err
+	}
+	// The copy is a new container, as if it was imported
+	fs.emit(Event{Kind: EventImport, ContainerNumber: item.ContainerNumber, Path: item.Path, Name: item.Name})
+	return nil
+}
+
+// copyFile copies the latest file of src into a new container without an
+// event and returns the new container.
+func (fs *FileSystem) copyFile(src, dst string) (FileList, error) {
 	// Check whether src is empty
 	if src == "" {
-		return errors.New("empty source file")
+		return FileList{}, errors.New("empty source file")
 	}
 
 	// Splitting src
@@ -1069,22 +1409,22 @@ func (fs *FileSystem) FileCopy(src, dst string) error {
 
 	srcAbs, err := filepath.Abs(s)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for %s: %w", src, err)
+		return FileList{}, fmt.Errorf("failed to get absolute path for %s: %w", src, err)
 	}
 
 	srcDir, err := fs.AbsNormal(srcAbs)
 	if err != nil {
-		return err
+		return FileList{}, err
 	}
 
 	// Check whether dst is empty
 	if dst == "" {
-		return errors.New("empty destination file")
+		return FileList{}, errors.New("empty destination file")
 	}
 
 	dstAbs, err := filepath.Abs(dst)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for %s: %w", dst, err)
+		return FileList{}, fmt.Errorf("failed to get absolute path for %s: %w", dst, err)
 	}
 
 	// Check wether dst ends with a file or directory
@@ -1100,7 +1440,7 @@ func (fs *FileSystem) FileCopy(src, dst string) error {
 
 	dstDir, err := fs.AbsNormal(d)
 	if err != nil {
-		return err
+		return FileList{}, err
 	}
 
 	// // setting up a fake dstFl, without a container number inside
@@ -1108,17 +1448,17 @@ func (fs *FileSystem) FileCopy(src, dst string) error {
 
 	// Check whether dst exists
 	if item, err := fs.index.FileNameToFileList(dstDir, dstFile); err == nil {
-		return fmt.Errorf("file %s already exists and is stored in %s", dst, item.Path)
+		return FileList{}, fmt.Errorf("file %s already exists and is stored in %s", dst, item.Path)
 	}
 
 	// Check for src file is locked
 	srcFl, err := fs.index.FileNameToFileList(srcDir, srcFile)
 	if err != nil {
-		return fmt.Errorf("failed to get index for %s: %w", src, err)
+		return FileList{}, fmt.Errorf("failed to get index for %s: %w", src, err)
 	}
 
 	if name := fs.IsLockedItem(srcFl.ContainerNumber); name != "" {
-		return fmt.Errorf("file %s is checked out by %s", src, name)
+		return FileList{}, fmt.Errorf("file %s is checked out by %s", src, name)
 	}
 
 	// Check whether dst is a file or directory
@@ -1135,7 +1475,7 @@ func (fs *FileSystem) FileCopy(src, dst string) error {
 		dstDir = filepath.Join(fs.Getwd(), dst[:num])
 		dstPath = filepath.Join(fs.vaultDir, dstDir)
 		if !util.DirExists(dstPath) {
-			return fmt.Errorf("directory %s doesn't exist", dstPath)
+			return FileList{}, fmt.Errorf("directory %s doesn't exist", dstPath)
 		}
 	} else {
 		dstDir = fs.Getwd()
@@ -1152,17 +1492,17 @@ func (fs *FileSystem) FileCopy(src, dst string) error {
 
 	// Check whether dst exists
 	if _, err := fs.index.FileNameToFileList(dstDir, dstFile); err == nil {
-		return fmt.Errorf("file %s already exists and is stored in %s", dstFile, dstDir)
+		return FileList{}, fmt.Errorf("file %s already exists and is stored in %s", dstFile, dstDir)
 	}
 
 	dstFl, err := fs.index.AddItem(dstDir, dstFile)
 	if err != nil {
-		return err
+		return FileList{}, err
 	}
 
 	dstFd := NewFileDirectory(fs, *dstFl)
 	if err := dstFd.CreateDirectory(); err != nil {
-		return err
+		return FileList{}, err
 	}
 
 	// Copy the file from src to dest
@@ -1170,7 +1510,7 @@ func (fs *FileSystem) FileCopy(src, dst string) error {
 	newFile := filepath.Join(srcFd.dir, version.Pretty, src)
 
 	if err = dstFd.ImportNewFile(newFile); err != nil {
-		return err
+		return FileList{}, err
 	}
 
 	// Rename file, but only when dst doesn't end with '/' (which means a directory)
@@ -1178,24 +1518,24 @@ func (fs *FileSystem) FileCopy(src, dst string) error {
 		dstVer := dstFd.LatestVersion()
 		dstStr := filepath.Join(dstFd.dir, dstVer.Pretty)
 		if err = os.Rename(path.Join(dstStr, src), filepath.Join(dstStr, dstFile)); err != nil {
-			return fmt.Errorf("failed to rename file from %s to %s: %w", src, dstFile, err)
+			return FileList{}, fmt.Errorf("failed to rename file from %s to %s: %w", src, dstFile, err)
 		}
 	}
 
 	// Verification
 	item, err := fs.index.FileNameToFileList(dstDir, dstFile)
 	if err != nil {
-		return err
+		return FileList{}, err
 	}
 	if err = fs.Verify(item); err != nil {
-		return err
+		return FileList{}, err
 	}
 
 	// Logging
 	log.Printf("File %s copied to %s\n", filepath.Join(srcFl.Path, srcFl.Name), filepath.Join(dstDir, dstFile))
 	// log.Printf("File %s copied to %s\n", src, dst)
 
-	return nil
+	return item, nil
 }
 
 // Copy a directory.
@@ -1257,6 +1597,15 @@ func (fs *FileSystem) DirectoryCopy(src, dst string) error {
 
 	cwd := fs.Getwd()
 
+	// Every copy is a new container, as if it was imported. The events
+	// follow the copy, also of the containers before a failure.
+	var events []Event
+	defer func() {
+		for _, ev := range events {
+			fs.emit(ev)
+		}
+	}()
+
 	for k, elem := range dstFiles {
 		dstJoinPath := filepath.Join(dstFiles[k].Path(), dstFiles[k].Name())
 		if elem.IsDir() {
@@ -1266,10 +1615,11 @@ func (fs *FileSystem) DirectoryCopy(src, dst string) error {
 		} else {
 			fs.Chdir(srcFiles[k].Path())
 
-			if err := fs.FileCopy(srcFiles[k].Name(),
-				path.Join("..", dstFiles[k].dir, dstFiles[k].name)); err != nil {
+			item, err := fs.copyFile(srcFiles[k].Name(), path.Join("..", dstFiles[k].dir, dstFiles[k].name))
+			if err != nil {
 				return err
 			}
+			events = append(events, Event{Kind: EventImport, ContainerNumber: item.ContainerNumber, Path: item.Path, Name: item.Name})
 		}
 
 		// Verification
@@ -1352,6 +1702,15 @@ func (fs FileSystem) DirectoryRename(src, dst string) error {
 	dstFirst := FileInfo{name: dst, isDir: true}
 	dstFiles = slices.Insert(dstFiles, 0, dstFirst)
 
+	// Every moved container gets its event after the move, also the
+	// containers before a failure
+	var events []Event
+	defer func() {
+		for _, ev := range events {
+			fs.emit(ev)
+		}
+	}()
+
 	// Moving the files from src to dst
 	for k, v := range srcFiles {
 		srcJoinPath := filepath.Join(srcFiles[k].Path(), srcFiles[k].Name())
@@ -1361,9 +1720,11 @@ func (fs FileSystem) DirectoryRename(src, dst string) error {
 				return err
 			}
 		} else {
-			if err := fs.FileRename(srcJoinPath, dstJoinPath); err != nil {
+			from, item, err := fs.renameFile(srcJoinPath, dstJoinPath)
+			if err != nil {
 				return err
 			}
+			events = append(events, renameEvent(from, item))
 		}
 
 		// Verification
@@ -1568,6 +1929,8 @@ func (fs *FileSystem) FileRemove(containerNumber string) error {
 	// Log the successful move operation
 	log.Printf("Successfully removed container %s", containerNumber)
 
+	fs.emit(Event{Kind: EventRemove, ContainerNumber: containerNumber, Path: fl.Path, Name: fl.Name})
+
 	return nil
 }
 
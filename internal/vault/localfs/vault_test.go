@@ -211,12 +211,14 @@ func TestFileRename(t *testing.T) {
 	if err := os.Chdir("Projects"); err != nil {
 		t.Fatal("chdir failed")
 	}
+	events := recordEvents(t)
 
 	// Ordinary file rename
 	if err := fs.FileRename("0001.FCStd", "0007.FCStd"); err != nil {
 		t.Fatalf("FileRename %s error: %s", file1, err)
 	}
 	compareFileListLine(1, "1:0007.FCStd:0001.FCStd:Projects:")
+	compareEvents(t, events(), fsm.Event{Kind: fsm.EventRename, ContainerNumber: "1", Path: "Projects", Name: "0007.FCStd"})
 
 	// ... and put it back in place again
 	if err := fs.FileRename("0007.FCStd", "0001.FCStd"); err != nil {
@@ -235,10 +237,12 @@ func TestFileRename(t *testing.T) {
 	}
 
 	// Ordinary file move
+	events()
 	if err := fs.FileRename("0003.FCStd", "temp/"); err != nil {
 		t.Fatalf("FileMove failed: %v", err)
 	}
 	compareFileListLine(3, "3:0003.FCStd::Projects/temp:Projects")
+	compareEvents(t, events(), fsm.Event{Kind: fsm.EventRename, ContainerNumber: "3", Path: "Projects/temp", OldPath: "Projects", Name: "0003.FCStd"})
 
 	// And put it back again
 	if err := fs.FileRename("temp/0003.FCStd", "0003.FCStd"); err != nil {
@@ -259,10 +263,12 @@ func TestFileRename(t *testing.T) {
 	compareFileListLine(1, "1:0001.FCStd:0007.FCStd:Projects:")
 
 	// File rename and move with a sub directory
+	events()
 	if err := fs.FileRename("0006.FCStd", "temp/0006a.FCStd"); err != nil {
 		t.Fatalf("FileMove failed: %v", err)
 	}
 	compareFileListLine(6, "6:0006a.FCStd:0006.FCStd:Projects/temp:Projects")
+	compareEvents(t, events(), fsm.Event{Kind: fsm.EventRename, ContainerNumber: "6", Path: "Projects/temp", OldPath: "Projects", Name: "0006a.FCStd"})
 
 	// And put it back in the right place again
 	if err := fs.FileRename("temp/0006a.FCStd", "0006.FCStd"); err != nil {
@@ -299,6 +305,7 @@ func TestFileRename(t *testing.T) {
 
 func TestFileCopy(t *testing.T) {
 	os.Chdir("Projects")
+	events := recordEvents(t)
 
 	// src is empty
 	err := fs.FileCopy("", "0010.FCStd")
@@ -318,12 +325,14 @@ func TestFileCopy(t *testing.T) {
 		t.Fatalf("FileCopy failed: %v", err)
 	}
 	compareFileListLine(7, "8:0011.FCStd::Projects:")
+	compareEvents(t, events(), fsm.Event{Kind: fsm.EventImport, ContainerNumber: "8", Path: "Projects", Name: "0011.FCStd"})
 
 	// copy to different dir and new file name
 	if err = fs.FileCopy("0002.FCStd", "../test/0012.FCStd"); err != nil {
 		t.Fatalf("FileCopy %s error: %s", file1, err)
 	}
 	compareFileListLine(8, "9:0012.FCStd::test:")
+	compareEvents(t, events(), fsm.Event{Kind: fsm.EventImport, ContainerNumber: "9", Path: "test", Name: "0012.FCStd"})
 
 	// Test for a file copy with only a directory as destination.
 	if err = fs.FileCopy("0002.FCStd", "../test/"); err != nil {
@@ -378,11 +387,23 @@ func TestDirectoryRename(t *testing.T) {
 	fmt.Println("hello 1")
 
 	// Test with data, including sub-dirs
+	events := recordEvents(t)
 	err = fs.DirectoryRename("Projects", "test/Projects2")
 	if err != nil {
 		t.Fatalf("DirectoryMove failed: %v", err)
 	}
 
+	// Every moved container is reported, with where it was
+	list := events()
+	if len(list) != 7 {
+		t.Errorf("expected 7 rename events, got %v", list)
+	}
+	for _, ev := range list {
+		if ev.Kind != fsm.EventRename || ev.OldPath != "Projects" || ev.Path != "test/Projects2" {
+			t.Errorf("unexpected event of the directory move: %+v", ev)
+		}
+	}
+
 	fmt.Println("hello 2")
 
 	// Test for destination directory being a number
@@ -468,12 +489,16 @@ func TestDirectoryCopy(t *testing.T) {
 	}
 
 	// Test with data
+	events := recordEvents(t)
 	err = fs.DirectoryCopy("test", "Project5")
 	if err != nil {
 		t.Fatalf("DirectoryCopy failed: %v", err)
 	}
 	compareFileListLine(10, "11:0002.FCStd::Project5:")
 	compareFileListLine(11, "12:0012.FCStd::Project5:")
+	compareEvents(t, events(),
+		fsm.Event{Kind: fsm.EventImport, ContainerNumber: "11", Path: "Project5", Name: "0002.FCStd"},
+		fsm.Event{Kind: fsm.EventImport, ContainerNumber: "12", Path: "Project5", Name: "0012.FCStd"})
 
 	// Test with data, including an empty sub directory
 	err = fs.DirectoryCopy("Projects", "Project6")
@@ -527,6 +552,31 @@ func TestDirectoryCopy(t *testing.T) {
 	checkInStatus(2, 0)
 }
 
+func TestUndoCheckOut(t *testing.T) {
+	file, err := fs.GetItem("Projects", "0001.FCStd")
+	if err != nil {
+		t.Fatalf("GetItem error: %s", err)
+	}
+	version := fsm.FileVersion{Number: 0, Pretty: "0"}
+
+	// Only a check-out can be undone
+	if err := fs.UndoCheckOut(file, version); err == nil {
+		t.Fatal("undid a check-out that is not there")
+	}
+
+	if err = fs.CheckOut(file, version); err != nil {
+		t.Fatalf("Checkout %s error: %s", file.Name, err)
+	}
+	checkOutStatus(1, 0)
+
+	events := recordEvents(t)
+	if err := fs.UndoCheckOut(file, version); err != nil {
+		t.Fatalf("UndoCheckOut %s error: %s", file.Name, err)
+	}
+	checkInStatus(1, 0)
+	compareEvents(t, events(), fsm.Event{Kind: fsm.EventRelease, ContainerNumber: "1", Path: "Projects", Name: "0001.FCStd"})
+}
+
 func TestListTree(t *testing.T) {
 	lt, err := fs.ListTree("Projects")
 	if err != nil {
@@ -706,6 +756,34 @@ func writeIndexNumber() {
 	util.CheckErr(err)
 }
 
+// recordEvents collects the events of the file system until the test
+// ends. The returned function hands out the events since its last call.
+func recordEvents(t *testing.T) func() []fsm.Event {
+	var list []fsm.Event
+	remove := fsm.OnEvent(func(ev fsm.Event) { list = append(list, ev) })
+	t.Cleanup(remove)
+	return func() []fsm.Event {
+		ret := list
+		list = nil
+		return ret
+	}
+}
+
+// compareEvents checks the kind, container and place of events
+func compareEvents(t *testing.T, got []fsm.Event, want ...fsm.Event) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("expected the events %+v, got %+v", want, got)
+		return
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Kind != w.Kind || g.ContainerNumber != w.ContainerNumber || g.Path != w.Path || g.OldPath != w.OldPath || g.Name != w.Name {
+			t.Errorf("expected the event %+v, got %+v", w, g)
+		}
+	}
+}
+
 func compareFileListLine(num int, line string) {
 	content, err := os.ReadFile(filepath.Join(testvaultsdata, "FileList.csv"))
 	if err != nil {
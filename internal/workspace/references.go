@@ -0,0 +1,134 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package workspace
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/grd/FreePDM/internal/adapters/layout"
+)
+
+// FileLinks returns the files that a FreeCAD document links to, as they are
+// written in the document: relative to its directory, or absolute. An
+// FCStd file is a zip file, the links are the "file" attributes of the
+// XLink elements of its Document.xml.
+func FileLinks(file string) ([]string, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	doc, err := zr.Open("Document.xml")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	defer doc.Close()
+
+	var links []string
+	dec := xml.NewDecoder(doc)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return links, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		elem, ok := tok.(xml.StartElement)
+		if !ok || !strings.HasPrefix(elem.Name.Local, "XLink") {
+			continue
+		}
+		for _, attr := range elem.Attr {
+			if attr.Name.Local == "file" && attr.Value != "" && !slices.Contains(links, attr.Value) {
+				links = append(links, attr.Value)
+			}
+		}
+	}
+}
+
+// References returns the containers that the FreeCAD documents of a
+// version of the container at rel link to, with the version of the linked
+// file. The version is the latest local one when it is layout.Latest.
+// Links to files outside the containers of the local copy are left out.
+// The list is nil when the version has no FreeCAD documents, so that the
+// references stay as they are.
+func (w *Workspace) References(vault, rel string, version int16) ([]layout.Reference, error) {
+	rel = layout.CleanRel(rel)
+	dir := filepath.Join(w.Root, vault, filepath.FromSlash(rel))
+
+	var pretty string
+	if version == layout.Latest {
+		local, err := localVersion(dir)
+		if err != nil || local == nil {
+			return nil, err
+		}
+		pretty = local.Pretty
+	} else {
+		var err error
+		if pretty, err = layout.VersionDir(filepath.Join(dir, layout.VersionFile), version); err != nil {
+			return nil, err
+		}
+	}
+
+	docs, err := filepath.Glob(filepath.Join(dir, pretty, "*"))
+	if err != nil {
+		return nil, err
+	}
+	docs = slices.DeleteFunc(docs, func(f string) bool { return !strings.EqualFold(filepath.Ext(f), ".fcstd") })
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	refs := []layout.Reference{}
+	for _, doc := range docs {
+		links, err := FileLinks(doc)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			if !filepath.IsAbs(link) {
+				link = filepath.Join(filepath.Dir(doc), filepath.FromSlash(link))
+			}
+			ref, ok := w.linkReference(link)
+			if ok && !slices.Contains(refs, ref) && !(ref.Vault == vault && ref.Container == filepath.Base(dir)) {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs, nil
+}
+
+// linkReference returns the container and version of a file of the local
+// copy: root/vault/dir/container/version/name.
+func (w *Workspace) linkReference(file string) (layout.Reference, bool) {
+	rel, err := filepath.Rel(w.Root, filepath.Clean(file))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return layout.Reference{}, false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 4 {
+		return layout.Reference{}, false
+	}
+
+	container := filepath.Join(w.Root, filepath.Join(parts[:len(parts)-2]...))
+	pretty := parts[len(parts)-2]
+	versions, err := layout.ReadVersions(filepath.Join(container, layout.VersionFile))
+	if err != nil {
+		return layout.Reference{}, false
+	}
+	i := slices.IndexFunc(versions, func(v layout.Version) bool { return v.Pretty == pretty })
+	if i < 0 {
+		return layout.Reference{}, false
+	}
+	return layout.Reference{Vault: parts[0], Container: filepath.Base(container), Version: versions[i].Number}, true
+}
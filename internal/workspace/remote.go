@@ -0,0 +1,63 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package workspace
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/grd/FreePDM/internal/adapters/layout"
+)
+
+// DiskRemote reads the containers from the vaults directory of the server,
+// for the server itself and for the local mode. The client API asks the
+// server over HTTPS.
+type DiskRemote struct {
+	Root string // the vaults directory, with the .data directory
+}
+
+func (d DiskRemote) Container(vault, rel string) (*Container, error) {
+	rel = layout.CleanRel(rel)
+	dir := filepath.Join(d.Root, vault, filepath.FromSlash(rel))
+
+	versions, err := layout.ReadVersions(filepath.Join(dir, layout.VersionFile))
+	if err != nil {
+		return nil, err
+	}
+	locks, err := layout.ReadLocks(filepath.Join(d.Root, layout.DataDir, vault, layout.LockedFileCsv))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Container{Files: map[string]string{}}
+	for _, v := range versions {
+		c.Versions = append(c.Versions, Version{Number: v.Number, Pretty: v.Pretty})
+	}
+	number := path.Base(rel)
+	for _, lock := range locks {
+		if lock.Container == number {
+			c.Locks = append(c.Locks, Lock{Version: lock.Version, User: lock.User})
+		}
+	}
+
+	// The files of the versions, not those of the container itself. Only
+	// the files that changed since the last status are hashed again.
+	err = filepath.WalkDir(dir, func(p string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+		name, _ := filepath.Rel(dir, p)
+		name = filepath.ToSlash(name)
+		if !strings.Contains(name, "/") {
+			return nil
+		}
+		hash, err := fileHashes.hash(p, e)
+		c.Files[name] = hash
+		return err
+	})
+	return c, err
+}
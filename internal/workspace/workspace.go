@@ -0,0 +1,269 @@
+// Copyright 2025 The FreePDM team. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package workspace compares the local copy of the vaults with the server:
+// which containers are modified, outdated or checked out, and by whom. The
+// vcs tool prints it and fpg shows it as badges in the vault tree.
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/delta"
+)
+
+// State is the state of a container of the local copy
+type State string
+
+const (
+	Unmodified        State = "unmodified"
+	Modified          State = "modified"    // changed locally without a check out
+	Outdated          State = "outdated"    // the server has a newer version
+	CheckedOutByMe    State = "checked-out" // by the user of the workspace
+	CheckedOutByOther State = "locked"      // by someone else
+)
+
+var ErrNoContainer = errors.New("not a container")
+
+// Version is a version of a container on the server
+type Version struct {
+	Number int16  `json:"number"`
+	Pretty string `json:"pretty"` // the directory of the version
+}
+
+// Lock is a checked out version of a container on the server
+type Lock struct {
+	Version int16  `json:"version"`
+	User    string `json:"user"`
+}
+
+// Container is the state of a container on the server
+type Container struct {
+	Versions []Version         `json:"versions"` // oldest first
+	Locks    []Lock            `json:"locks"`
+	Files    map[string]string `json:"files"` // "pretty/name" -> SHA-256 hash
+}
+
+// Latest returns the latest version, -1 when there is none
+func (c *Container) Latest() int16 {
+	if len(c.Versions) == 0 {
+		return -1
+	}
+	return c.Versions[len(c.Versions)-1].Number
+}
+
+// LockedBy returns who checked out a version, "" when nobody did
+func (c *Container) LockedBy(version int16) string {
+	for _, lock := range c.Locks {
+		if lock.Version == version {
+			return lock.User
+		}
+	}
+	return ""
+}
+
+// Remote tells the state of the containers on the server
+type Remote interface {
+	Container(vault, rel string) (*Container, error)
+}
+
+// Status is the state of a container of the local copy
+type Status struct {
+	Vault         string   `json:"vault"`
+	Path          string   `json:"path"` // of the container inside the vault
+	State         State    `json:"state"`
+	LocalVersion  int16    `json:"local_version"` // -1 when no version is pulled
+	ServerVersion int16    `json:"server_version"`
+	LockedBy      string   `json:"locked_by,omitempty"` // of the local version
+	Modified      []string `json:"modified,omitempty"`  // the changed files of the local version
+	Error         string   `json:"error,omitempty"`     // why the state is not known, of StatusTree
+}
+
+// Conflict tells whether local changes meet changes of someone else: the
+// container is modified while it is outdated or checked out by another user.
+func (s Status) Conflict() bool {
+	if len(s.Modified) == 0 {
+		return false
+	}
+	return s.State == CheckedOutByOther || s.LocalVersion < s.ServerVersion
+}
+
+// Workspace is the local copy of the vaults of a user
+type Workspace struct {
+	Root   string // the local copy, with a directory per vault
+	User   string
+	Remote Remote
+}
+
+// Constructor
+func New(root, user string, remote Remote) *Workspace {
+	return &Workspace{Root: root, User: user, Remote: remote}
+}
+
+// IsContainer tells whether a local directory is a container
+func IsContainer(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, layout.VersionFile))
+	return err == nil
+}
+
+// Status returns the state of the container at rel
+func (w *Workspace) Status(vault, rel string) (Status, error) {
+	rel = layout.CleanRel(rel)
+	dir := filepath.Join(w.Root, vault, filepath.FromSlash(rel))
+	if !IsContainer(dir) {
+		return Status{}, fmt.Errorf("%s: %w", path.Join(vault, rel), ErrNoContainer)
+	}
+
+	st := Status{Vault: vault, Path: rel, LocalVersion: -1}
+	local, err := localVersion(dir)
+	if err != nil {
+		return st, err
+	}
+
+	remote, err := w.Remote.Container(vault, rel)
+	if err != nil {
+		return st, err
+	}
+	st.ServerVersion = remote.Latest()
+
+	if local != nil {
+		st.LocalVersion = local.Number
+		st.LockedBy = remote.LockedBy(local.Number)
+		if st.Modified, err = modifiedFiles(dir, local.Pretty, remote.Files); err != nil {
+			return st, err
+		}
+	}
+
+	switch {
+	case st.LockedBy != "" && st.LockedBy == w.User:
+		st.State = CheckedOutByMe
+	case st.LockedBy != "":
+		st.State = CheckedOutByOther
+	case len(st.Modified) > 0:
+		st.State = Modified
+	case st.LocalVersion < st.ServerVersion:
+		st.State = Outdated
+	default:
+		st.State = Unmodified
+	}
+	return st, nil
+}
+
+// StatusTree returns the states of the containers in a directory of the
+// local copy and its subdirectories. A container whose state can't be
+// read has the error in its status, the others are still compared.
+func (w *Workspace) StatusTree(vault, rel string) ([]Status, error) {
+	rel = layout.CleanRel(rel)
+	top := filepath.Join(w.Root, vault, filepath.FromSlash(rel))
+
+	var list []Status
+	err := filepath.WalkDir(top, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		if !IsContainer(p) {
+			return nil
+		}
+		sub, _ := filepath.Rel(filepath.Join(w.Root, vault), p)
+		st, err := w.Status(vault, filepath.ToSlash(sub))
+		if err != nil {
+			st = Status{Vault: vault, Path: layout.CleanRel(filepath.ToSlash(sub)), LocalVersion: -1, Error: err.Error()}
+		}
+		list = append(list, st)
+		return filepath.SkipDir
+	})
+	return list, err
+}
+
+// localVersion returns the latest version of a container that is pulled,
+// nil when there is none. VER.txt lists the versions of the server at the
+// time of the pull, only some of them have a directory.
+func localVersion(dir string) (*layout.Version, error) {
+	versions, err := layout.ReadVersions(filepath.Join(dir, layout.VersionFile))
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range slices.Backward(versions) {
+		if info, err := os.Stat(filepath.Join(dir, v.Pretty)); err == nil && info.IsDir() {
+			return &v, nil
+		}
+	}
+	return nil, nil
+}
+
+// modifiedFiles returns the files of a local version that differ from the
+// server, "pretty/name" like the hashes of the server.
+func modifiedFiles(dir, pretty string, hashes map[string]string) ([]string, error) {
+	var modified []string
+	err := filepath.WalkDir(filepath.Join(dir, pretty), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(p, layout.PartSuffix) {
+			return err
+		}
+		hash, err := fileHashes.hash(p, d)
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(dir, p)
+		name = filepath.ToSlash(name)
+		if hashes[name] != hash {
+			modified = append(modified, name)
+		}
+		return nil
+	})
+	return modified, err
+}
+
+// hashCache keeps the hashes of the files by their size and modification
+// time, so that a status compares a file again only after it changed.
+type hashCache struct {
+	mu    sync.Mutex
+	files map[string]cachedHash
+}
+
+type cachedHash struct {
+	size int64
+	mod  time.Time
+	hash string
+}
+
+// fileHashes caches the hashes of the local copy, and of the vaults on the
+// server for DiskRemote.
+var fileHashes hashCache
+
+// hash returns the SHA-256 hash of a file as hexadecimal
+func (c *hashCache) hash(file string, d fs.DirEntry) (string, error) {
+	info, err := d.Info()
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	cached, ok := c.files[file]
+	c.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.mod.Equal(info.ModTime()) {
+		return cached.hash, nil
+	}
+
+	hash, _, err := delta.HashFile(file)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	if c.files == nil {
+		c.files = map[string]cachedHash{}
+	}
+	c.files[file] = cachedHash{size: info.Size(), mod: info.ModTime(), hash: hash}
+	c.mu.Unlock()
+	return hash, nil
+}
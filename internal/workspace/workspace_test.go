@@ -0,0 +1,144 @@
+package workspace_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/grd/FreePDM/internal/adapters/layout"
+	"github.com/grd/FreePDM/internal/workspace"
+)
+
+func write(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	server, local := t.TempDir(), t.TempDir()
+	ver := "Version:Pretty:Date\n0:0:d\n1:1:d\n"
+
+	// Five containers with version 1 on the server, 3 and 4 are checked out
+	for _, nr := range []string{"1", "2", "3", "4", "5"} {
+		write(t, filepath.Join(server, "main/parts", nr, "VER.txt"), ver)
+		write(t, filepath.Join(server, "main/parts", nr, "1/part.FCStd"), "part "+nr)
+		write(t, filepath.Join(local, "main/parts", nr, "VER.txt"), ver)
+		write(t, filepath.Join(local, "main/parts", nr, "1/part.FCStd"), "part "+nr)
+	}
+	write(t, filepath.Join(server, ".data/main/LockedFiles.csv"), "ContainerNumber:Version:UserName\n3:1:me\n4:1:other\n")
+
+	// 2 is changed without a check out, 4 is changed while someone else
+	// has it and 5 has a newer version on the server
+	write(t, filepath.Join(local, "main/parts/2/1/part.FCStd"), "changed")
+	write(t, filepath.Join(local, "main/parts/4/1/part.FCStd"), "changed")
+	write(t, filepath.Join(server, "main/parts/5/VER.txt"), ver+"2:2:d\n")
+	write(t, filepath.Join(server, "main/parts/5/2/part.FCStd"), "newer")
+
+	// 6 is gone from the server, the others are still compared
+	write(t, filepath.Join(local, "main/parts/6/VER.txt"), ver)
+
+	ws := workspace.New(local, "me", workspace.DiskRemote{Root: server})
+	list, err := ws.StatusTree("main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(list); n != 6 || list[n-1].Path != "parts/6" || list[n-1].Error == "" {
+		t.Fatalf("expected an error for parts/6, got %+v", list)
+	}
+	list = list[:5]
+
+	expected := []workspace.State{workspace.Unmodified, workspace.Modified, workspace.CheckedOutByMe,
+		workspace.CheckedOutByOther, workspace.Outdated}
+	if len(list) != len(expected) {
+		t.Fatalf("expected %d containers, got %+v", len(expected), list)
+	}
+	for i, st := range list {
+		if st.State != expected[i] {
+			t.Errorf("%s: expected %s, got %s", st.Path, expected[i], st.State)
+		}
+	}
+	if !list[3].Conflict() || list[1].Conflict() || list[4].LocalVersion != 1 || list[4].ServerVersion != 2 {
+		t.Errorf("unexpected states %+v", list)
+	}
+
+	// A change of the same size is seen, the hash is not taken from the cache
+	file := filepath.Join(local, "main/parts/1/1/part.FCStd")
+	write(t, file, "part X")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := ws.Status("main", "parts/1"); err != nil || st.State != workspace.Modified {
+		t.Errorf("changed parts/1 = %+v, %v; want modified", st, err)
+	}
+
+	if _, err := ws.Status("main", "parts"); err == nil {
+		t.Error("a directory has a status")
+	}
+}
+
+// writeFCStd writes a FreeCAD document with the Document.xml doc
+func writeFCStd(t *testing.T, file, doc string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("Document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(doc))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	write(t, file, buf.String())
+}
+
+func TestReferences(t *testing.T) {
+	local := t.TempDir()
+	ver := "Version:Pretty:Date\n0:0:d\n1:1:d\n"
+
+	// An assembly that links two versions of a bolt and a file outside the
+	// vaults
+	write(t, filepath.Join(local, "main/parts/7/VER.txt"), ver)
+	write(t, filepath.Join(local, "main/parts/7/0/bolt.FCStd"), "bolt")
+	write(t, filepath.Join(local, "main/parts/7/1/bolt.FCStd"), "bolt")
+	write(t, filepath.Join(local, "main/assy/5/VER.txt"), ver)
+	writeFCStd(t, filepath.Join(local, "main/assy/5/1/assy.FCStd"), `<?xml version="1.0" encoding="utf-8"?>
+<Document SchemaVersion="4">
+  <ObjectData>
+    <Object name="Link"><Properties>
+      <Property name="LinkedObject" type="App::PropertyXLink"><XLink file="../../../parts/7/1/bolt.FCStd" name="Body"/></Property>
+    </Properties></Object>
+    <Object name="Link001"><Properties>
+      <Property name="LinkedObject" type="App::PropertyXLink"><XLinkSub file="../../../parts/7/0/bolt.FCStd" name="Body" sub=""/></Property>
+      <Property name="Others" type="App::PropertyXLinkList"><XLinkList count="1"><XLink file="/tmp/elsewhere.FCStd" name="Body"/></XLinkList></Property>
+    </Properties></Object>
+  </ObjectData>
+</Document>`)
+	write(t, filepath.Join(local, "main/parts/9/VER.txt"), ver)
+	write(t, filepath.Join(local, "main/parts/9/1/datasheet.pdf"), "pdf")
+
+	ws := workspace.New(local, "me", nil)
+	refs, err := ws.References("main", "assy/5", layout.Latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []layout.Reference{{Vault: "main", Container: "7", Version: 1}, {Vault: "main", Container: "7", Version: 0}}
+	if !slices.Equal(refs, want) {
+		t.Errorf("References = %+v, want %+v", refs, want)
+	}
+
+	// A container without FreeCAD documents keeps its references
+	if refs, err := ws.References("main", "parts/9", layout.Latest); err != nil || refs != nil {
+		t.Errorf("References of a document = %+v, %v", refs, err)
+	}
+}